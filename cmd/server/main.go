@@ -1,17 +1,38 @@
 package main
 
 import (
+	"context"
+	"expvar"
+	"flag"
+	"fmt"
 	"log"
-	_ "net/http/pprof"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/mtekmir/warehouse-service/internal/article"
+	"github.com/mtekmir/warehouse-service/internal/audit"
+	"github.com/mtekmir/warehouse-service/internal/auth"
+	"github.com/mtekmir/warehouse-service/internal/cache"
 	"github.com/mtekmir/warehouse-service/internal/config"
+	"github.com/mtekmir/warehouse-service/internal/health"
 	"github.com/mtekmir/warehouse-service/internal/logs"
-	"github.com/mtekmir/warehouse-service/internal/postgres"
+	"github.com/mtekmir/warehouse-service/internal/metrics"
+	"github.com/mtekmir/warehouse-service/internal/outbox"
 	"github.com/mtekmir/warehouse-service/internal/product"
+	"github.com/mtekmir/warehouse-service/internal/ratelimit"
+	"github.com/mtekmir/warehouse-service/internal/rpc"
 	"github.com/mtekmir/warehouse-service/internal/server"
+	"github.com/mtekmir/warehouse-service/internal/stream"
+	"github.com/mtekmir/warehouse-service/internal/tracing"
 )
 
+// version is the build version, set with -ldflags "-X main.version=...".
+var version = "dev"
+
 func main() {
 	if err := program(); err != nil {
 		log.Fatal(err.Error())
@@ -19,33 +40,214 @@ func main() {
 }
 
 func program() error {
-	c, err := config.Parse()
+	c, err := config.Parse(os.Args[1:])
+	if err == flag.ErrHelp {
+		return nil
+	}
 	if err != nil {
 		return err
 	}
+	if c.PrintConfig {
+		return c.Print(os.Stdout)
+	}
 
 	logger, err := logs.NewLogger(&c.Env, c.LogFile)
 	if err != nil {
 		return err
 	}
 
-	db, dbTidy, err := postgres.Setup(logger, c.DBURL, c.DBMigrationsPath)
+	shutdownTracing, err := tracing.Setup(context.Background(), c.TraceExporter, c.TraceFile)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			logger.Printf("Unable to flush spans: %v", err)
+		}
+	}()
+
+	st, dbTidy, err := setupStorage(logger, c)
 	if err != nil {
 		return err
 	}
 	defer dbTidy()
 
-	pr := postgres.NewProductRepo()
-	ar := postgres.NewArticleRepo()
+	pr := metrics.ProductRepo(st.products)
+	ar := metrics.ArticleRepo(st.articles)
 
-	ps := product.NewService(logger, db, pr, ar)
-	as := article.NewService(logger, db, ar)
+	if c.CacheSize > 0 {
+		cc := cache.New(c.CacheSize, c.CacheTTL)
+		pr = cc.ProductRepo(pr)
+		ar = cc.ArticleRepo(ar)
+		err = metrics.RegisterCache(func() *metrics.Cache {
+			st := cc.Stats()
+			return &metrics.Cache{Entries: st.Entries, Hits: st.Hits, Misses: st.Misses, Evictions: st.Evictions, Invalidations: st.Invalidations}
+		})
+		if err != nil {
+			return err
+		}
+	}
 
-	s := server.NewServer(logger, ps, as)
+	// Events are only stored while they are published or streamed, so that the outbox
+	// doesn't grow without use.
+	pub, pubTidy, err := setupPublisher(c)
+	if err != nil {
+		return err
+	}
+	defer pubTidy()
+	var or outbox.Repo
+	if pub != nil || c.EventStream {
+		or = metrics.OutboxRepo(st.outbox)
+	}
 
-	if err := s.Start(c.Port, c.WriteTimeout, c.ReadTimeout, c.IdleTimeout); err != nil {
+	ps := metrics.ProductService{Service: product.NewService(logger, st.db, pr, ar, or)}
+	as := metrics.ArticleService{Service: article.NewService(logger, st.db, ar, or)}
+
+	aus := auth.NewService(logger, st.db, metrics.APIKeyRepo(st.apiKeys), c.AdminAPIKey)
+	aud := audit.NewService(logger, st.db, metrics.AuditRepo(st.events))
+
+	err = metrics.RegisterInventory(func(ctx context.Context) (*metrics.Inventory, error) {
+		outOfStock, units, err := st.inventory(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return &metrics.Inventory{OutOfStockProducts: outOfStock, ArticleUnits: units}, nil
+	}, c.InventoryTimeout)
+	if err != nil {
 		return err
 	}
 
-	return nil
+	hc := health.NewChecker(st.checkedDB, st.schemaVersion, st.latestVersion, c.HealthTimeout, version)
+
+	s := server.NewServer(logger, ps, as, aus, hc)
+	s.AuditService = aud
+	s.CORSOrigins = c.CORSOrigins
+	rs := rpc.NewServer(logger, ps, as, aus)
+	rs.AuditService = aud
+	if c.RateLimit.Limit > 0 || len(c.RouteRateLimits) > 0 {
+		rl := ratelimit.New(c.RateLimit, c.RouteRateLimits)
+		s.RateLimiter = rl
+		rs.RateLimiter = rl
+		expvar.Publish("ratelimit", expvar.Func(func() interface{} { return rl.Stats() }))
+	}
+	// Both servers share the buckets of the ips.
+	if c.IPRateLimit.Limit > 0 {
+		ipl := ratelimit.New(c.IPRateLimit, nil)
+		s.IPRateLimiter = ipl
+		rs.IPRateLimiter = ipl
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+
+	var bg sync.WaitGroup
+	if pub != nil {
+		relay := outbox.NewRelay(logger, st.db, or, pub, c.OutboxInterval, c.OutboxBatchSize, c.OutboxMaxAttempts)
+		bg.Go(func() { relay.Run(ctx) })
+	}
+	if or != nil {
+		// Without a publisher the events are only streamed, so pending events are pruned
+		// too.
+		pruner := outbox.NewPruner(logger, st.db, or, c.OutboxRetention, pub == nil)
+		bg.Go(func() { pruner.Run(ctx) })
+	}
+	if c.EventStream {
+		// Availabilities are read past the cache, which isn't invalidated by the changes
+		// of other replicas.
+		finder := product.NewService(logger, st.db, metrics.ProductRepo(st.products), metrics.ArticleRepo(st.articles), nil)
+		hub := stream.NewHub(logger, st.db, or, finder, c.EventStreamPoll)
+		s.Stream = hub
+		bg.Go(func() { hub.Run(ctx) })
+		if st.listen != nil {
+			bg.Go(func() { listen(ctx, logger, st, hub) })
+		}
+	}
+
+	servers := []shutdowner{s, rs}
+	errC := make(chan error, 3)
+	go func() { errC <- s.Start(c.Port, c.WriteTimeout, c.ReadTimeout, c.IdleTimeout) }()
+	go func() { errC <- rs.Start(c.GRPCPort) }()
+	if c.DebugPort != "" {
+		ds := &http.Server{Addr: fmt.Sprintf(":%s", c.DebugPort), Handler: server.DebugHandler()}
+		servers = append(servers, ds)
+		go func() {
+			if err := ds.ListenAndServe(); err != http.ErrServerClosed {
+				errC <- err
+			}
+		}()
+	}
+
+	var serveErr error
+	select {
+	case <-ctx.Done():
+		logger.Printf("Shutting down, draining for %s and waiting up to %s for in-flight requests", c.ShutdownDrainDelay, c.ShutdownGracePeriod)
+	case serveErr = <-errC:
+		logger.Printf("Server stopped: %v, shutting down", serveErr)
+	}
+	stop()
+
+	// The servers and the background workers share the grace period, which starts after
+	// the drain delay.
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), c.ShutdownDrainDelay+c.ShutdownGracePeriod)
+	defer cancel()
+	if err := shutdown(shutdownCtx, hc, c.ShutdownDrainDelay, servers...); err != nil {
+		logger.Printf("Unable to shut down gracefully: %v", err)
+	}
+	// Pending events are published by the relay of the next start.
+	if err := wait(shutdownCtx, &bg); err != nil {
+		logger.Printf("Background workers didn't stop within the grace period: %v", err)
+	}
+	return serveErr
+}
+
+// wait waits for the goroutines of the group until ctx is done.
+func wait(ctx context.Context, wg *sync.WaitGroup) error {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+type shutdowner interface {
+	Shutdown(ctx context.Context) error
+}
+
+type drainer interface {
+	Drain()
+}
+
+// shutdown flips readiness to failing and keeps serving for the drain delay, so that
+// load balancers notice and stop sending requests. Then it shuts the servers down
+// concurrently, waiting for their in-flight requests until ctx is done.
+func shutdown(ctx context.Context, hc drainer, delay time.Duration, ss ...shutdowner) error {
+	hc.Drain()
+	t := time.NewTimer(delay)
+	select {
+	case <-t.C:
+	case <-ctx.Done():
+		t.Stop()
+	}
+
+	errC := make(chan error, len(ss))
+	for _, s := range ss {
+		go func(s shutdowner) { errC <- s.Shutdown(ctx) }(s)
+	}
+
+	var err error
+	for range ss {
+		if e := <-errC; e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
 }
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recorder records the calls of the shutdown steps in order.
+type recorder struct {
+	mu    sync.Mutex
+	calls []string
+	err   error
+}
+
+func (r *recorder) add(call string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls = append(r.calls, call)
+}
+
+func (r *recorder) Drain() { r.add("drain") }
+
+func (r *recorder) Shutdown(ctx context.Context) error {
+	r.add("shutdown")
+	return r.err
+}
+
+func TestShutdown(t *testing.T) {
+	r := &recorder{}
+	delay := 50 * time.Millisecond
+
+	start := time.Now()
+	if err := shutdown(context.Background(), r, delay, r, r); err != nil {
+		t.Fatalf("Unable to shut down. %v", err)
+	}
+
+	if elapsed := time.Since(start); elapsed < delay {
+		t.Errorf("Expected the servers to be shut down after the drain delay. Got %s", elapsed)
+	}
+	if len(r.calls) != 3 || r.calls[0] != "drain" || r.calls[1] != "shutdown" || r.calls[2] != "shutdown" {
+		t.Errorf("Expected to drain and then shut down both servers. Got %v", r.calls)
+	}
+}
+
+func TestShutdown_ContextDone(t *testing.T) {
+	r := &recorder{err: errors.New("timeout")}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// The drain delay doesn't outlast the context.
+	start := time.Now()
+	if err := shutdown(ctx, r, time.Hour, r); err == nil || err.Error() != "timeout" {
+		t.Errorf("Expected the error of the server. Got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected the drain delay to end with the context. Got %s", elapsed)
+	}
+	if len(r.calls) != 2 || r.calls[0] != "drain" || r.calls[1] != "shutdown" {
+		t.Errorf("Expected to drain and then shut down. Got %v", r.calls)
+	}
+}
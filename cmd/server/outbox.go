@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/mtekmir/warehouse-service/internal/config"
+	"github.com/mtekmir/warehouse-service/internal/metrics"
+	"github.com/mtekmir/warehouse-service/internal/outbox"
+	"github.com/mtekmir/warehouse-service/internal/stream"
+	"github.com/sirupsen/logrus"
+)
+
+// setupPublisher returns the configured publisher of the outbox and a func to close it.
+// Returns a nil publisher if events aren't published.
+func setupPublisher(c *config.Config) (outbox.Publisher, func(), error) {
+	var p outbox.Publisher
+	tidy := func() {}
+
+	switch c.OutboxPublisher {
+	case "":
+		return nil, tidy, nil
+	case "stdout":
+		p = outbox.NewWriterPublisher(os.Stdout)
+	case "file":
+		fp, err := outbox.NewFilePublisher(c.OutboxFile)
+		if err != nil {
+			return nil, tidy, err
+		}
+		p, tidy = fp, func() { fp.Close() }
+	case "http":
+		p = outbox.NewHTTPPublisher(c.OutboxURL, c.OutboxTimeout)
+	}
+
+	return metrics.Publisher(p), tidy, nil
+}
+
+// listenRetry is how long to wait before listening again when the connection fails.
+const listenRetry = 5 * time.Second
+
+// listen wakes the hub when events are stored by any replica, until ctx is done. The hub
+// polls while listening is interrupted.
+func listen(ctx context.Context, log *logrus.Logger, st *storage, hub *stream.Hub) {
+	for {
+		err := st.listen(ctx, hub.Wake)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("Stopped listening for events, retrying in %s: %v", listenRetry, err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(listenRetry):
+		}
+	}
+}
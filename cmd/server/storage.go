@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/mtekmir/warehouse-service/internal/article"
+	"github.com/mtekmir/warehouse-service/internal/audit"
+	"github.com/mtekmir/warehouse-service/internal/auth"
+	"github.com/mtekmir/warehouse-service/internal/config"
+	"github.com/mtekmir/warehouse-service/internal/memory"
+	"github.com/mtekmir/warehouse-service/internal/outbox"
+	"github.com/mtekmir/warehouse-service/internal/postgres"
+	"github.com/mtekmir/warehouse-service/internal/product"
+	"github.com/mtekmir/warehouse-service/internal/sqlite"
+	"github.com/sirupsen/logrus"
+)
+
+// storage holds the repos of the configured storage along with what the health checks
+// and metrics need from it.
+type storage struct {
+	db       *sql.DB
+	products product.Repo
+	articles article.Repo
+	apiKeys  auth.Repo
+	events   audit.Repo
+	outbox   outbox.Repo
+
+	// checkedDB is checked by the readiness probe, nil if there's no db to check.
+	checkedDB     *sql.DB
+	schemaVersion func(context.Context) (int, error)
+	latestVersion int
+	inventory     func(context.Context) (outOfStock, units int, err error)
+	// listen calls notify when events are stored in the outbox by any replica, until ctx
+	// is done or it fails. Nil if the storage doesn't notify.
+	listen func(ctx context.Context, notify func()) error
+}
+
+// setupStorage sets up the storage and returns a func to close it. Postgres and SQLite
+// are migrated to the latest version.
+func setupStorage(log *logrus.Logger, c *config.Config) (*storage, func(), error) {
+	switch c.Storage {
+	case config.StorageMemory:
+		log.Println("Using memory storage, data is lost on restart")
+		s := memory.NewStore()
+		db := memory.NewDB(s)
+		return &storage{
+			db:            db,
+			products:      memory.NewProductRepo(s),
+			articles:      memory.NewArticleRepo(s),
+			apiKeys:       memory.NewAPIKeyRepo(s),
+			events:        memory.NewAuditRepo(s),
+			outbox:        memory.NewOutboxRepo(s),
+			schemaVersion: func(context.Context) (int, error) { return 0, nil },
+			inventory:     s.InventoryStats,
+		}, func() { db.Close() }, nil
+
+	case config.StorageSQLite:
+		db, dbTidy, err := sqlite.Setup(log, c.DBURL)
+		if err != nil {
+			return nil, dbTidy, err
+		}
+		latest, err := sqlite.LatestVersion()
+		if err != nil {
+			return nil, dbTidy, err
+		}
+
+		return &storage{
+			db:        db,
+			products:  sqlite.NewProductRepo(),
+			articles:  sqlite.NewArticleRepo(),
+			apiKeys:   sqlite.NewAPIKeyRepo(),
+			events:    sqlite.NewAuditRepo(),
+			outbox:    sqlite.NewOutboxRepo(),
+			checkedDB: db,
+			schemaVersion: func(ctx context.Context) (int, error) {
+				return sqlite.SchemaVersion(ctx, db)
+			},
+			latestVersion: latest,
+			inventory: func(ctx context.Context) (int, int, error) {
+				return sqlite.InventoryStats(ctx, db)
+			},
+		}, dbTidy, nil
+	}
+
+	migrations := postgres.Migrations(c.DBMigrationsPath)
+	db, dbTidy, err := postgres.Setup(log, c.DBURL, migrations)
+	if err != nil {
+		return nil, dbTidy, err
+	}
+	latest, err := postgres.LatestVersion(migrations)
+	if err != nil {
+		return nil, dbTidy, err
+	}
+
+	return &storage{
+		db:        db,
+		products:  postgres.NewProductRepo(),
+		articles:  postgres.NewArticleRepo(),
+		apiKeys:   postgres.NewAPIKeyRepo(),
+		events:    postgres.NewAuditRepo(),
+		outbox:    postgres.NewOutboxRepo(),
+		checkedDB: db,
+		schemaVersion: func(ctx context.Context) (int, error) {
+			return postgres.SchemaVersion(ctx, db)
+		},
+		latestVersion: latest,
+		inventory: func(ctx context.Context) (int, int, error) {
+			return postgres.InventoryStats(ctx, db)
+		},
+		listen: func(ctx context.Context, notify func()) error {
+			return postgres.Listen(ctx, db, postgres.OutboxChannel, notify)
+		},
+	}, dbTidy, nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/mtekmir/warehouse-service/internal/config"
+	"github.com/mtekmir/warehouse-service/internal/postgres"
+	"github.com/mtekmir/warehouse-service/internal/sqlite"
+)
+
+// checkCmd checks that the schema matches the migrations and runs the integrity checks
+// of the catalogue. It fails if any issue is found.
+func checkCmd(a *app, args []string) error {
+	if len(args) > 0 {
+		return errUsage
+	}
+
+	db, err := a.db()
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+
+	var issues []*postgres.Issue
+	ss, err := a.migrationStatus(ctx, db)
+	if err != nil {
+		return err
+	}
+	for _, s := range ss {
+		switch {
+		case s.unknown:
+			issues = append(issues, &postgres.Issue{Check: "unknown_migration", Detail: fmt.Sprintf("migration %s is applied but its file is missing", s.filename)})
+		case s.edited:
+			issues = append(issues, &postgres.Issue{Check: "edited_migration", Detail: fmt.Sprintf("migration %s was edited after it was applied", s.filename)})
+		case !s.applied:
+			issues = append(issues, &postgres.Issue{Check: "pending_migration", Detail: fmt.Sprintf("migration %s is not applied", s.filename)})
+		}
+	}
+
+	if a.c.Storage == config.StorageSQLite {
+		ii, err := sqlite.CheckIntegrity(ctx, db)
+		if err != nil {
+			return err
+		}
+		for _, i := range ii {
+			issues = append(issues, &postgres.Issue{Check: i.Check, Detail: i.Detail})
+		}
+	} else {
+		ii, err := postgres.CheckIntegrity(ctx, db)
+		if err != nil {
+			return err
+		}
+		issues = append(issues, ii...)
+	}
+
+	for _, i := range issues {
+		fmt.Fprintf(a.out, "%s: %s\n", i.Check, i.Detail)
+	}
+	if len(issues) > 0 {
+		return fmt.Errorf("%d integrity issues found", len(issues))
+	}
+	fmt.Fprintln(a.out, "No issues found")
+	return nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/mtekmir/warehouse-service/internal/article"
+	"github.com/mtekmir/warehouse-service/internal/product"
+)
+
+// exportCmd dumps the products with their stock information or the articles. Products
+// of every status are dumped, as one CSV row per article of the product.
+func exportCmd(a *app, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	kind := fs.String("kind", "products", "products or articles")
+	format := fs.String("format", "json", "json or csv")
+	output := fs.String("o", "", "output file, stdout if empty")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *format != "json" && *format != "csv" {
+		return fmt.Errorf("format must be json or csv, got %q", *format)
+	}
+
+	db, err := a.db()
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+
+	pr, ar, _ := a.repos()
+	var data interface{}
+	var rows [][]string
+	switch *kind {
+	case "products":
+		ps := product.NewService(a.log, db, pr, ar, nil)
+		pp, err := ps.FindAll(ctx, &product.Filters{Statuses: product.Statuses})
+		if err != nil {
+			return err
+		}
+		data, rows = pp, productRows(pp)
+	case "articles":
+		as := article.NewService(a.log, db, ar, nil)
+		arts, err := as.FindAll(ctx)
+		if err != nil {
+			return err
+		}
+		data, rows = arts, articleRows(arts)
+	default:
+		return fmt.Errorf("kind must be products or articles, got %q", *kind)
+	}
+
+	var w io.Writer = a.out
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	if *format == "csv" {
+		cw := csv.NewWriter(w)
+		cw.WriteAll(rows)
+		return cw.Error()
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(data)
+}
+
+// productRows returns a row per article of the products. Products without articles get
+// a row with empty article columns.
+func productRows(pp []*product.StockInfo) [][]string {
+	rows := [][]string{{"id", "barcode", "name", "status", "available_quantity", "art_id", "article_name", "article_stock", "required_amount"}}
+	for _, p := range pp {
+		cols := []string{strconv.Itoa(int(p.ID)), string(p.Barcode), p.Name, string(p.Status), strconv.Itoa(p.AvailableQty)}
+		if len(p.Articles) == 0 {
+			rows = append(rows, append(cols, "", "", "", ""))
+		}
+		for _, art := range p.Articles {
+			rows = append(rows, append(cols[:len(cols):len(cols)],
+				string(art.ArtID),
+				art.Name,
+				strconv.Itoa(art.Stock),
+				strconv.Itoa(art.RequiredAmount),
+			))
+		}
+	}
+	return rows
+}
+
+func articleRows(arts []*article.Article) [][]string {
+	rows := [][]string{{"art_id", "name", "stock"}}
+	for _, art := range arts {
+		rows = append(rows, []string{string(art.ArtID), art.Name, strconv.Itoa(art.Stock)})
+	}
+	return rows
+}
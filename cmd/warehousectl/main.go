@@ -0,0 +1,144 @@
+// Command warehousectl runs maintenance tasks on the warehouse db without the http
+// server. It reads the same config file, env variables and flags as the server, and
+// works on Postgres and SQLite storage.
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/mtekmir/warehouse-service/internal/article"
+	"github.com/mtekmir/warehouse-service/internal/config"
+	"github.com/mtekmir/warehouse-service/internal/logs"
+	"github.com/mtekmir/warehouse-service/internal/outbox"
+	"github.com/mtekmir/warehouse-service/internal/postgres"
+	"github.com/mtekmir/warehouse-service/internal/product"
+	"github.com/mtekmir/warehouse-service/internal/sqlite"
+	"github.com/sirupsen/logrus"
+)
+
+const usage = `Usage: warehousectl [flags] <command> [args]
+
+Commands:
+  migrate up                  apply the pending migrations
+  migrate down [n]            revert the last n migrations, 1 by default, postgres only
+  migrate status              list the migrations and whether they are applied
+  migrate new [-dir dir] <description>
+                              create the files of the next migration
+  seed [-articles file] [-products file]
+                              import articles and products from json files
+  export [-kind products|articles] [-format json|csv] [-o file]
+                              dump the catalogue, archived products included
+  check                       run the integrity checks
+
+Flags are the settings of the server, run warehousectl --help to list them.
+`
+
+// errUsage is returned if the command line is invalid.
+var errUsage = errors.New("invalid usage")
+
+func main() {
+	if err := program(os.Args[1:], os.Stdout); err != nil {
+		if err == errUsage {
+			fmt.Fprint(os.Stderr, usage)
+		} else {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		os.Exit(1)
+	}
+}
+
+// app holds the dependencies of the commands.
+type app struct {
+	c   *config.Config
+	log *logrus.Logger
+	out io.Writer
+
+	conn *sql.DB
+}
+
+// db opens the db on first use. Migrations aren't run.
+func (a *app) db() (*sql.DB, error) {
+	if a.conn != nil {
+		return a.conn, nil
+	}
+
+	var db *sql.DB
+	var err error
+	switch a.c.Storage {
+	case config.StoragePostgres:
+		db, err = postgres.Open(a.c.DBURL)
+	case config.StorageSQLite:
+		db, err = sqlite.Open(a.c.DBURL)
+	default:
+		return nil, fmt.Errorf("%s storage isn't kept after the server stops, use postgres or sqlite", a.c.Storage)
+	}
+	if err != nil {
+		return nil, err
+	}
+	a.conn = db
+	return db, nil
+}
+
+// repos returns the repos of the storage. The outbox repo is nil unless the servers
+// store events, i.e. a publisher or the event stream is enabled.
+func (a *app) repos() (product.Repo, article.Repo, outbox.Repo) {
+	var or outbox.Repo
+	if a.c.Storage == config.StorageSQLite {
+		if a.c.OutboxPublisher != "" || a.c.EventStream {
+			or = sqlite.NewOutboxRepo()
+		}
+		return sqlite.NewProductRepo(), sqlite.NewArticleRepo(), or
+	}
+	if a.c.OutboxPublisher != "" || a.c.EventStream {
+		or = postgres.NewOutboxRepo()
+	}
+	return postgres.NewProductRepo(), postgres.NewArticleRepo(), or
+}
+
+var commands = map[string]func(a *app, args []string) error{
+	"migrate": migrateCmd,
+	"seed":    seedCmd,
+	"export":  exportCmd,
+	"check":   checkCmd,
+}
+
+func program(args []string, out io.Writer) error {
+	c, err := config.Parse(args)
+	if err == flag.ErrHelp {
+		fmt.Fprint(os.Stderr, usage)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if len(c.Args) == 0 {
+		return errUsage
+	}
+	cmd, ok := commands[c.Args[0]]
+	if !ok {
+		return errUsage
+	}
+
+	logger, err := logs.NewLogger(&c.Env, c.LogFile)
+	if err != nil {
+		return err
+	}
+	// Stdout is left to the output of the commands.
+	if logger.Out == os.Stdout {
+		logger.Out = os.Stderr
+	}
+
+	a := &app{c: c, log: logger, out: out}
+	defer func() {
+		if a.conn != nil {
+			a.conn.Close()
+		}
+	}()
+
+	return cmd(a, c.Args[1:])
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mtekmir/warehouse-service/internal/product"
+	"github.com/mtekmir/warehouse-service/internal/sqlite"
+)
+
+// run runs warehousectl on the sqlite db and returns its output.
+func run(t *testing.T, dbURL string, args ...string) (string, error) {
+	t.Helper()
+	var out bytes.Buffer
+	err := program(append([]string{"--db-url", dbURL}, args...), &out)
+	return out.String(), err
+}
+
+func mustRun(t *testing.T, dbURL string, args ...string) string {
+	t.Helper()
+	out, err := run(t, dbURL, args...)
+	if err != nil {
+		t.Fatalf("Unable to run %v. %v", args, err)
+	}
+	return out
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	p := filepath.Join(t.TempDir(), name)
+	if err := ioutil.WriteFile(p, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+// states returns the states of the migrations in the output of migrate status, keyed by
+// file name.
+func states(out string) map[string]string {
+	ss := map[string]string{}
+	for _, l := range strings.Split(out, "\n")[1:] {
+		if f := strings.Fields(l); len(f) > 2 {
+			ss[f[1]] = strings.TrimSuffix(f[2], ",")
+		}
+	}
+	return ss
+}
+
+func TestMigrate(t *testing.T) {
+	dbURL := "sqlite://" + filepath.Join(t.TempDir(), "warehouse.db")
+
+	out := mustRun(t, dbURL, "migrate", "status")
+	if ss := states(out); len(ss) != 12 || ss["V001__create_articles_table.sql"] != "pending" {
+		t.Errorf("Expected the migrations to be pending. Got\n%s", out)
+	}
+
+	mustRun(t, dbURL, "migrate", "up")
+	out = mustRun(t, dbURL, "migrate", "status")
+	for f, st := range states(out) {
+		if st != "applied" {
+			t.Errorf("Expected %s to be applied. Got %s", f, st)
+		}
+	}
+
+	if _, err := run(t, dbURL, "migrate", "down"); err == nil {
+		t.Error("Expected sqlite migrations not to be reverted")
+	}
+
+	dir := t.TempDir()
+	out = mustRun(t, dbURL, "migrate", "new", "-dir", dir, "add bins")
+	if out != "Created "+filepath.Join(dir, "V001__add_bins.sql")+"\n" {
+		t.Errorf("Expected a single migration file. Got %s", out)
+	}
+}
+
+func TestSeedExportCheck(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "warehouse.db")
+	dbURL := "sqlite://" + path
+	articles := writeFile(t, "articles.json", `{"inventory": [{"art_id": "1", "name": "leg", "stock": "8"}, {"art_id": "2", "name": "seat", "stock": "1"}]}`)
+	products := writeFile(t, "products.json", `{"products": [
+		{"name": "chair", "barcode": "1", "contain_articles": [{"art_id": "1", "amount_of": "4"}, {"art_id": "2", "amount_of": "1"}]},
+		{"name": "stool", "barcode": "2", "contain_articles": [{"art_id": "1", "amount_of": "3"}]}
+	]}`)
+
+	mustRun(t, dbURL, "migrate", "up")
+	out := mustRun(t, dbURL, "seed", "-articles", articles, "-products", products)
+	if !strings.Contains(out, "Imported 2 articles") || !strings.Contains(out, "Imported 2 products") {
+		t.Errorf("Expected the articles and products to be imported. Got\n%s", out)
+	}
+
+	// Archived products are exported too.
+	db, err := sqlite.Open(dbURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := sqlite.NewProductRepo().UpdateStatus(context.Background(), db, 2, product.StatusActive, product.StatusArchived); err != nil {
+		t.Fatal(err)
+	}
+
+	var pp []*product.StockInfo
+	if err := json.Unmarshal([]byte(mustRun(t, dbURL, "export")), &pp); err != nil {
+		t.Fatalf("Unable to decode the export. %v", err)
+	}
+	// Importing products adds their articles to the stock.
+	if len(pp) != 2 || pp[0].AvailableQty != 2 || pp[1].Status != product.StatusArchived {
+		t.Errorf("Expected the chair and the archived stool. Got %+v, %+v", pp[0], pp[1])
+	}
+
+	rows, err := csv.NewReader(strings.NewReader(mustRun(t, dbURL, "export", "-format", "csv"))).ReadAll()
+	if err != nil {
+		t.Fatalf("Unable to read the csv. %v", err)
+	}
+	if len(rows) != 4 || rows[3][3] != "archived" {
+		t.Errorf("Expected a header and a row per article. Got %v", rows)
+	}
+	rows, err = csv.NewReader(strings.NewReader(mustRun(t, dbURL, "export", "-kind", "articles", "-format", "csv"))).ReadAll()
+	if err != nil || len(rows) != 3 {
+		t.Errorf("Expected a header and a row per article. Got %v, %v", rows, err)
+	}
+
+	if out := mustRun(t, dbURL, "check"); out != "No issues found\n" {
+		t.Errorf("Expected no issues. Got %s", out)
+	}
+	if _, err := db.Exec("UPDATE articles SET stock = -1 WHERE art_id = '2'"); err != nil {
+		t.Fatal(err)
+	}
+	out, err = run(t, dbURL, "check")
+	if err == nil || out != "negative_article_stock: article 2 has stock -1\n" {
+		t.Errorf("Expected the negative stock to be found. Got %s, %v", out, err)
+	}
+}
+
+func TestProductRows(t *testing.T) {
+	rows := productRows([]*product.StockInfo{
+		{ID: 1, Barcode: "1", Name: "chair", Status: product.StatusDraft},
+		{ID: 2, Barcode: "2", Name: "stool", Status: product.StatusActive, AvailableQty: 2, Articles: []*product.ArticleStock{
+			{ArtID: "1", Name: "leg", Stock: 8, RequiredAmount: 3},
+			{ArtID: "2", Name: "seat", Stock: 2, RequiredAmount: 1},
+		}},
+	})
+
+	expected := [][]string{
+		{"id", "barcode", "name", "status", "available_quantity", "art_id", "article_name", "article_stock", "required_amount"},
+		{"1", "1", "chair", "draft", "0", "", "", "", ""},
+		{"2", "2", "stool", "active", "2", "1", "leg", "8", "3"},
+		{"2", "2", "stool", "active", "2", "2", "seat", "2", "1"},
+	}
+	if len(rows) != len(expected) {
+		t.Fatalf("Expected %d rows. Got %v", len(expected), rows)
+	}
+	for i := range expected {
+		if strings.Join(rows[i], ",") != strings.Join(expected[i], ",") {
+			t.Errorf("Expected row %d to be %v. Got %v", i, expected[i], rows[i])
+		}
+	}
+}
+
+func TestMemoryStorage(t *testing.T) {
+	if _, err := run(t, "sqlite://unused.db", "--storage", "memory", "check"); err == nil || !strings.Contains(err.Error(), "use postgres or sqlite") {
+		t.Errorf("Expected memory storage to be rejected. Got %v", err)
+	}
+}
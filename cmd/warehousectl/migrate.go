@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mtekmir/warehouse-service/internal/config"
+	"github.com/mtekmir/warehouse-service/internal/postgres"
+	"github.com/mtekmir/warehouse-service/internal/sqlite"
+)
+
+// Directories where new migrations are created if DB_MIGRATIONS_PATH is empty, relative
+// to the root of the repository. SQLite migrations are always embedded.
+const (
+	defaultMigrationsDir       = "internal/postgres/migrations"
+	defaultSQLiteMigrationsDir = "internal/sqlite/migrations"
+)
+
+// migrationState is the state of a migration of either storage.
+type migrationState struct {
+	version    int
+	filename   string
+	applied    bool
+	appliedOn  *time.Time
+	edited     bool
+	unknown    bool
+	reversible bool
+}
+
+// migrationStatus returns the states of the migrations of the storage, sorted by
+// version.
+func (a *app) migrationStatus(ctx context.Context, db *sql.DB) ([]*migrationState, error) {
+	var states []*migrationState
+	if a.c.Storage == config.StorageSQLite {
+		ss, err := sqlite.MigrationStatus(ctx, db)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range ss {
+			states = append(states, &migrationState{version: s.Version, filename: s.Filename, applied: s.Applied, appliedOn: s.AppliedOn, edited: s.Edited, unknown: s.Unknown})
+		}
+		return states, nil
+	}
+
+	ss, err := postgres.MigrationStatus(ctx, db, postgres.Migrations(a.c.DBMigrationsPath))
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range ss {
+		states = append(states, &migrationState{version: s.Version, filename: s.Filename, applied: s.Applied, appliedOn: s.AppliedOn, edited: s.Edited, unknown: s.Unknown, reversible: s.Reversible})
+	}
+	return states, nil
+}
+
+func migrateCmd(a *app, args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+
+	switch args[0] {
+	case "up":
+		db, err := a.db()
+		if err != nil {
+			return err
+		}
+		if a.c.Storage == config.StorageSQLite {
+			return sqlite.Migrate(a.log, db)
+		}
+		return postgres.Migrate(a.log, db, postgres.Migrations(a.c.DBMigrationsPath))
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				return fmt.Errorf("number of migrations to revert must be a positive number, got %q", args[1])
+			}
+			steps = n
+		}
+		if a.c.Storage == config.StorageSQLite {
+			return errors.New("sqlite migrations can't be reverted")
+		}
+		db, err := a.db()
+		if err != nil {
+			return err
+		}
+		return postgres.MigrateDown(a.log, db, postgres.Migrations(a.c.DBMigrationsPath), steps)
+
+	case "status":
+		db, err := a.db()
+		if err != nil {
+			return err
+		}
+		ss, err := a.migrationStatus(context.Background(), db)
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(a.out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tFILE\tSTATE\tAPPLIED ON\tDOWN")
+		for _, s := range ss {
+			state := "pending"
+			switch {
+			case s.unknown:
+				state = "applied, file missing"
+			case s.edited:
+				state = "applied, edited"
+			case s.applied:
+				state = "applied"
+			}
+			appliedOn := "-"
+			if s.appliedOn != nil {
+				appliedOn = s.appliedOn.Format("2006-01-02 15:04:05")
+			}
+			down := "no"
+			if s.reversible {
+				down = "yes"
+			}
+			fmt.Fprintf(w, "%03d\t%s\t%s\t%s\t%s\n", s.version, s.filename, state, appliedOn, down)
+		}
+		return w.Flush()
+
+	case "new":
+		sqliteStorage := a.c.Storage == config.StorageSQLite
+		def := a.c.DBMigrationsPath
+		if sqliteStorage {
+			def = ""
+		}
+		fs := flag.NewFlagSet("migrate new", flag.ContinueOnError)
+		dir := fs.String("dir", def, "directory of the migrations")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		if fs.NArg() == 0 {
+			return errUsage
+		}
+		description := strings.Join(fs.Args(), " ")
+
+		if sqliteStorage {
+			if *dir == "" {
+				*dir = defaultSQLiteMigrationsDir
+			}
+			up, err := sqlite.NewMigration(*dir, description)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(a.out, "Created %s\n", up)
+			return nil
+		}
+
+		if *dir == "" {
+			*dir = defaultMigrationsDir
+		}
+		up, down, err := postgres.NewMigration(*dir, description)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(a.out, "Created %s\nCreated %s\n", up, down)
+		return nil
+
+	default:
+		return errUsage
+	}
+}
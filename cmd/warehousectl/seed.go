@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/mtekmir/warehouse-service/internal/article"
+	"github.com/mtekmir/warehouse-service/internal/product"
+)
+
+// seedCmd imports the articles and then the products through the services, the files
+// have the format of the import endpoints. An empty file name skips it.
+func seedCmd(a *app, args []string) error {
+	fs := flag.NewFlagSet("seed", flag.ContinueOnError)
+	articlesFile := fs.String("articles", "articles.json", "articles file, as accepted by POST /articles/import")
+	productsFile := fs.String("products", "products.json", "products file, as accepted by POST /products/import")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	db, err := a.db()
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+
+	// Events of the imports are published by the relays of the servers and streamed by
+	// their hubs, as long as the servers store events.
+	pr, ar, or := a.repos()
+
+	if *articlesFile != "" {
+		var b struct {
+			Inventory []*article.Article `json:"inventory"`
+		}
+		if err := readJSON(*articlesFile, &b); err != nil {
+			return err
+		}
+		as := article.NewService(a.log, db, ar, or)
+		if _, err := as.Import(ctx, b.Inventory); err != nil {
+			return err
+		}
+		fmt.Fprintf(a.out, "Imported %d articles from %s\n", len(b.Inventory), *articlesFile)
+	}
+
+	if *productsFile != "" {
+		var b struct {
+			Products []*product.Product `json:"products"`
+		}
+		if err := readJSON(*productsFile, &b); err != nil {
+			return err
+		}
+		ps := product.NewService(a.log, db, pr, ar, or)
+		if err := ps.Import(ctx, b.Products); err != nil {
+			return err
+		}
+		fmt.Fprintf(a.out, "Imported %d products from %s\n", len(b.Products), *productsFile)
+	}
+
+	return nil
+}
+
+func readJSON(name string, v interface{}) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := json.NewDecoder(f).Decode(v); err != nil {
+		return fmt.Errorf("unable to decode %s: %w", name, err)
+	}
+	return nil
+}
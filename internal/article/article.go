@@ -3,6 +3,7 @@ package article
 import (
 	"encoding/json"
 	"strconv"
+	"time"
 
 	"github.com/mtekmir/warehouse-service/internal/errors"
 )
@@ -13,15 +14,18 @@ type ID int
 // ArtID is the external ID of an article.
 type ArtID string
 
-// Article represents a part of a product.
+// Article represents a part of a product. Lots are only set on imports, they hold part
+// or all of the imported stock.
 type Article struct {
 	ID    ID     `json:"-"`
 	ArtID ArtID  `json:"art_id"`
 	Name  string `json:"name"`
 	Stock int    `json:"stock"`
+	Lots  []*Lot `json:"lots,omitempty"`
 }
 
-// UnmarshalJSON implements json.Unmarshaler.
+// UnmarshalJSON implements json.Unmarshaler. Stock defaults to the total quantity of the
+// lots if the article has lots.
 func (a *Article) UnmarshalJSON(data []byte) error {
 	var op errors.Op = "article.unmarshalJSON"
 
@@ -37,6 +41,14 @@ func (a *Article) UnmarshalJSON(data []byte) error {
 		return errors.E(op, err)
 	}
 
+	if j.Stock == "" && len(a.Lots) > 0 {
+		a.Stock = 0
+		for _, l := range a.Lots {
+			a.Stock += l.Qty
+		}
+		return nil
+	}
+
 	s, err := strconv.Atoi(j.Stock)
 	if err != nil {
 		return errors.E(op, err)
@@ -47,6 +59,27 @@ func (a *Article) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
+// LotID is the internal ID of a lot.
+type LotID int
+
+// Lot is a batch of units of an article received together. Stock of an article that
+// isn't in any of its lots is untracked and never expires. Units of expired lots stay in
+// the stock of the article but can't be used to build products.
+type Lot struct {
+	ID         LotID      `json:"-"`
+	ArticleID  ID         `json:"-"`
+	ArtID      ArtID      `json:"art_id,omitempty"`
+	Number     string     `json:"lot_number"`
+	ReceivedAt time.Time  `json:"received_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	Qty        int        `json:"qty"`
+}
+
+// Expired reports whether the lot is expired at the time.
+func (l *Lot) Expired(at time.Time) bool {
+	return l.ExpiresAt != nil && !l.ExpiresAt.After(at)
+}
+
 // QtyAdjustmentKind is the type of qty adjustment of articleRepo.AdjustQuantities method
 type QtyAdjustmentKind int
 
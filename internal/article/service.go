@@ -3,9 +3,17 @@ package article
 import (
 	"context"
 	"database/sql"
+	"fmt"
+	"time"
 
+	"github.com/mtekmir/warehouse-service/internal/audit"
 	"github.com/mtekmir/warehouse-service/internal/errors"
+	"github.com/mtekmir/warehouse-service/internal/logs"
+	"github.com/mtekmir/warehouse-service/internal/outbox"
+	"github.com/mtekmir/warehouse-service/internal/tracing"
+	"github.com/mtekmir/warehouse-service/internal/txhook"
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // Executor provides an interface for required db methods.
@@ -21,26 +29,49 @@ type Repo interface {
 	BatchInsert(context.Context, Executor, []*Article) ([]*Article, error)
 	AdjustQuantities(context.Context, Executor, QtyAdjustmentKind, []*QtyAdjustment) error
 	Import(context.Context, Executor, []*Article) ([]*Article, error)
+	// InsertLots adds the quantities of the lots to the lots of their articles with the
+	// same numbers, or inserts them if there are none. Dates of existing lots don't change.
+	// Lots must not repeat a number of an article.
+	InsertLots(context.Context, Executor, []*Lot) error
+	// ConsumeLots subtracts the quantities from the lots of the articles that aren't expired
+	// at the time, first expired first out. Lots without an expiry date are consumed after
+	// the ones with, in the order they were received, and quantities exceeding the lots
+	// are left to the untracked stock. Emptied lots are deleted.
+	ConsumeLots(context.Context, Executor, []*QtyAdjustment, time.Time) error
+	// FindLots returns the lots that expire at or before the time with their art ids,
+	// soonest first.
+	FindLots(context.Context, Executor, time.Time) ([]*Lot, error)
 }
 
 // Service exposes methods on articles.
 type Service struct {
-	log  *logrus.Logger
-	db   *sql.DB
-	repo Repo
+	log    *logrus.Logger
+	db     *sql.DB
+	repo   Repo
+	outbox outbox.Repo
 }
 
 // Import imports the articles into the DB. New rows will be created for the non-existing
 // articles and quantities of existing articles will be updated. Returns the new articles and
 // updated articles. Handles duplicate items, quantities of duplicate items will be summed up.
-func (s *Service) Import(ctx context.Context, rows []*Article) ([]*Article, error) {
+// Lots of the articles are added to the existing lots with the same numbers, lots received
+// without a date are received now. stock.changed and import.completed events are stored in
+// the outbox with the import.
+func (s *Service) Import(ctx context.Context, rows []*Article) (_ []*Article, err error) {
 	var op errors.Op = "articleService.import"
-	s.log.Printf("Importing %d articles", len(rows))
+	ctx, span := tracing.Start(ctx, string(op), attribute.Int("rows", len(rows)))
+	defer func() { tracing.End(span, err) }()
+	logs.FromContext(ctx, s.log).Printf("Importing %d articles", len(rows))
+
+	if err := validateLots(rows, time.Now().UTC()); err != nil {
+		return nil, errors.E(op, err)
+	}
 
 	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
 		return nil, errors.E(op, err)
 	}
+	defer txhook.Ended(tx, s.repo)
 
 	arts, err := s.repo.Import(ctx, tx, rows)
 	if err != nil {
@@ -48,16 +79,36 @@ func (s *Service) Import(ctx context.Context, rows []*Article) ([]*Article, erro
 		return nil, errors.E(op, err)
 	}
 
+	if lots := importedLots(rows, arts); len(lots) > 0 {
+		if err := s.repo.InsertLots(ctx, tx, lots); err != nil {
+			tx.Rollback()
+			return nil, errors.E(op, err)
+		}
+	}
+
+	if err := outbox.Add(ctx, s.outbox, tx,
+		StockChanged(outbox.ReasonImport, arts),
+		&outbox.ImportCompleted{Kind: "articles", Rows: len(rows)},
+	); err != nil {
+		tx.Rollback()
+		return nil, errors.E(op, err)
+	}
+
 	if err := tx.Commit(); err != nil {
 		return nil, errors.E(op, err)
 	}
+	for _, a := range arts {
+		audit.AddTargets(ctx, audit.Target("article", a.ID))
+	}
 
 	return arts, nil
 }
 
 // FindAll returns all the articles in db.
-func (s *Service) FindAll(ctx context.Context) ([]*Article, error) {
+func (s *Service) FindAll(ctx context.Context) (_ []*Article, err error) {
 	var op errors.Op = "articleService.findAll"
+	ctx, span := tracing.Start(ctx, string(op))
+	defer func() { tracing.End(span, err) }()
 
 	arts, err := s.repo.FindAll(ctx, s.db, nil)
 	if err != nil {
@@ -67,11 +118,107 @@ func (s *Service) FindAll(ctx context.Context) ([]*Article, error) {
 	return arts, nil
 }
 
-// NewService creates a new service with required dependencies.
-func NewService(l *logrus.Logger, db *sql.DB, r Repo) *Service {
+// ExpiringLots returns the lots that expire within the number of days, soonest first.
+// Lots that are already expired are returned as well.
+func (s *Service) ExpiringLots(ctx context.Context, days int) (_ []*Lot, err error) {
+	var op errors.Op = "articleService.expiringLots"
+	ctx, span := tracing.Start(ctx, string(op), attribute.Int("days", days))
+	defer func() { tracing.End(span, err) }()
+
+	if days < 0 {
+		return nil, errors.E(op, errors.Invalid, "Days must not be negative")
+	}
+
+	lots, err := s.repo.FindLots(ctx, s.db, time.Now().AddDate(0, 0, days))
+	if err != nil {
+		return nil, errors.E(op, err)
+	}
+
+	return lots, nil
+}
+
+// validateLots validates the lots of the rows and sets the received dates that are
+// missing to now.
+func validateLots(rows []*Article, now time.Time) error {
+	var op errors.Op = "article.validateLots"
+
+	for _, r := range rows {
+		var qty int
+		for _, l := range r.Lots {
+			if l.Number == "" {
+				return errors.E(op, errors.Invalid, fmt.Sprintf("Lots of article %s must have a lot number", r.ArtID))
+			}
+			if l.Qty <= 0 {
+				return errors.E(op, errors.Invalid, fmt.Sprintf("Quantity of lot %s of article %s must be bigger than 0", l.Number, r.ArtID))
+			}
+			if l.ReceivedAt.IsZero() {
+				l.ReceivedAt = now
+			}
+			if l.ExpiresAt != nil && !l.ExpiresAt.After(l.ReceivedAt) {
+				return errors.E(op, errors.Invalid, fmt.Sprintf("Lot %s of article %s must expire after it's received", l.Number, r.ArtID))
+			}
+			qty += l.Qty
+		}
+		if r.Stock < qty {
+			return errors.E(op, errors.Invalid, fmt.Sprintf("Stock of article %s is less than the quantity of its lots", r.ArtID))
+		}
+	}
+
+	return nil
+}
+
+// importedLots returns the lots of the rows with the ids of their imported articles.
+// Quantities of lots with the same number of an article are summed up, the dates of the
+// first one are kept.
+func importedLots(rows []*Article, arts []*Article) []*Lot {
+	IDs := make(map[ArtID]ID, len(arts))
+	for _, a := range arts {
+		IDs[a.ArtID] = a.ID
+	}
+
+	type key struct {
+		ID     ID
+		number string
+	}
+	var lots []*Lot
+	seen := make(map[key]*Lot)
+	for _, r := range rows {
+		for _, l := range r.Lots {
+			k := key{IDs[r.ArtID], l.Number}
+			if existing, ok := seen[k]; ok {
+				existing.Qty += l.Qty
+				continue
+			}
+			lot := &Lot{ArticleID: k.ID, ArtID: r.ArtID, Number: l.Number, ReceivedAt: l.ReceivedAt.UTC(), Qty: l.Qty}
+			if l.ExpiresAt != nil {
+				e := l.ExpiresAt.UTC()
+				lot.ExpiresAt = &e
+			}
+			seen[k] = lot
+			lots = append(lots, lot)
+		}
+	}
+
+	return lots
+}
+
+// StockChanged returns the payload of the stock.changed event of the articles with their
+// new stocks.
+func StockChanged(reason string, arts []*Article) *outbox.StockChanged {
+	p := &outbox.StockChanged{Reason: reason, Articles: make([]*outbox.ArticleStock, 0, len(arts))}
+	for _, a := range arts {
+		p.Articles = append(p.Articles, &outbox.ArticleStock{ArtID: string(a.ArtID), Stock: a.Stock})
+	}
+	return p
+}
+
+// NewService creates a new service with required dependencies. Events aren't stored if
+// the outbox repo is nil.
+func NewService(l *logrus.Logger, db *sql.DB, r Repo, or outbox.Repo) *Service {
 	return &Service{
-		log:  l,
-		db:   db,
-		repo: r,
+		log:    l,
+		db:     db,
+		repo:   r,
+		outbox: or,
 	}
 }
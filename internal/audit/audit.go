@@ -0,0 +1,135 @@
+// Package audit records who changed what and when. Events are created by the servers
+// for every mutating call, the services add the rows they change as targets.
+package audit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mtekmir/warehouse-service/internal/errors"
+)
+
+// EventID is the ID of an audit event.
+type EventID int
+
+// ResultOK is the result of successful calls. Failed calls have the code of their error
+// as the result, e.g. not_found.
+const ResultOK = "ok"
+
+// Event is an entry of the audit log.
+type Event struct {
+	ID            EventID   `json:"id"`
+	Actor         string    `json:"actor"`  // The caller, e.g. key:3, or ip:10.0.0.1 if it's not authenticated.
+	Action        string    `json:"action"` // e.g. product.remove.
+	Targets       []string  `json:"targets"`
+	PayloadDigest string    `json:"payload_digest,omitempty"` // Empty if the call had no payload.
+	Result        string    `json:"result"`
+	RequestID     string    `json:"request_id,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// Filters of audit events. Zero values match all events.
+type Filters struct {
+	Actor  string
+	Action string
+	Target string     // Matches the events with the target among their targets.
+	From   *time.Time // Inclusive.
+	To     *time.Time // Exclusive.
+	Limit  int
+	Offset int
+}
+
+// KeyActor returns the actor of the api key with the id. The bootstrap key has no id.
+func KeyActor(ID int) string {
+	if ID == 0 {
+		return "key:bootstrap"
+	}
+	return fmt.Sprintf("key:%d", ID)
+}
+
+// IPActor returns the actor of a caller that isn't authenticated, by its ip.
+func IPActor(ip string) string {
+	return "ip:" + ip
+}
+
+// Target returns the target of the row with the kind and the id, e.g. product:3.
+func Target(kind string, ID interface{}) string {
+	return fmt.Sprintf("%s:%v", kind, ID)
+}
+
+// Digest returns the hex encoded sha256 digest of the payload prefixed with the
+// algorithm. Returns an empty string for empty payloads.
+func Digest(payload []byte) string {
+	if len(payload) == 0 {
+		return ""
+	}
+	h := sha256.Sum256(payload)
+	return "sha256:" + hex.EncodeToString(h[:])
+}
+
+// JoinTargets returns the space separated representation of targets used for storing
+// them.
+func JoinTargets(tt []string) string {
+	return strings.Join(tt, " ")
+}
+
+// SplitTargets parses space separated targets.
+func SplitTargets(s string) []string {
+	tt := strings.Fields(s)
+	if tt == nil {
+		tt = []string{}
+	}
+	return tt
+}
+
+// AddTargets adds the targets to the event, skipping the ones it already has.
+func (e *Event) AddTargets(targets ...string) {
+outer:
+	for _, t := range targets {
+		for _, et := range e.Targets {
+			if et == t {
+				continue outer
+			}
+		}
+		e.Targets = append(e.Targets, t)
+	}
+}
+
+type ctxKey int
+
+const eventCtxKey ctxKey = iota
+
+// WithEvent returns a copy of ctx that carries the event of the call being audited.
+func WithEvent(ctx context.Context, e *Event) context.Context {
+	return context.WithValue(ctx, eventCtxKey, e)
+}
+
+// FromContext returns the event of the context, if any.
+func FromContext(ctx context.Context) (*Event, bool) {
+	e, ok := ctx.Value(eventCtxKey).(*Event)
+	return e, ok
+}
+
+// AddTargets adds the targets to the event of the context. It does nothing if the call
+// isn't audited.
+func AddTargets(ctx context.Context, targets ...string) {
+	if e, ok := FromContext(ctx); ok {
+		e.AddTargets(targets...)
+	}
+}
+
+// Result returns the result of a call that returned err.
+func Result(err error) string {
+	if err == nil {
+		return ResultOK
+	}
+	var e *errors.Error
+	if errors.As(err, &e) {
+		return e.Kind.Code()
+	}
+	return errors.Other.Code()
+}
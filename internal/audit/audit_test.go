@@ -0,0 +1,39 @@
+package audit_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/mtekmir/warehouse-service/internal/audit"
+	"github.com/mtekmir/warehouse-service/internal/errors"
+	"github.com/mtekmir/warehouse-service/test"
+)
+
+func TestAddTargets(t *testing.T) {
+	t.Parallel()
+	// Calls that aren't audited are ignored.
+	audit.AddTargets(context.Background(), "product:1")
+
+	e := &audit.Event{Targets: []string{"product:1"}}
+	ctx := audit.WithEvent(context.Background(), e)
+	audit.AddTargets(ctx, audit.Target("article", 2), "product:1")
+	audit.AddTargets(ctx, audit.Target("article", 2), audit.Target("article", 3))
+
+	test.Compare(t, "targets", []string{"product:1", "article:2", "article:3"}, e.Targets)
+	test.Compare(t, "split targets", e.Targets, audit.SplitTargets(audit.JoinTargets(e.Targets)))
+	test.Compare(t, "split no targets", []string{}, audit.SplitTargets(""))
+}
+
+func TestHelpers(t *testing.T) {
+	t.Parallel()
+	test.Compare(t, "actor", "key:3", audit.KeyActor(3))
+	test.Compare(t, "bootstrap actor", "key:bootstrap", audit.KeyActor(0))
+
+	test.Compare(t, "digest", "sha256:2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae", audit.Digest([]byte("foo")))
+	test.Compare(t, "empty digest", "", audit.Digest(nil))
+
+	test.Compare(t, "ok", audit.ResultOK, audit.Result(nil))
+	test.Compare(t, "kind", "not_found", audit.Result(errors.E(errors.Op("op"), errors.NotFound, errors.E(errors.Op("op"), "missing"))))
+	test.Compare(t, "other", "internal", audit.Result(fmt.Errorf("failed")))
+}
@@ -0,0 +1,92 @@
+package audit
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/mtekmir/warehouse-service/internal/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Executor provides an interface for required db methods.
+type Executor interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// Repo provides methods for managing audit events in a db.
+type Repo interface {
+	Insert(context.Context, Executor, *Event) (*Event, error)
+	// FindAll returns the events matching the filters, newest first.
+	FindAll(context.Context, Executor, *Filters) ([]*Event, error)
+}
+
+// Limits of the number of events returned at once.
+const (
+	DefaultLimit = 100
+	MaxLimit     = 1000
+)
+
+// Service exposes methods on audit events.
+type Service struct {
+	log  *logrus.Logger
+	db   *sql.DB
+	repo Repo
+}
+
+// Record stores the event. Events are recorded after the calls finish, so they are
+// stored even if the context of the call is cancelled.
+func (s *Service) Record(ctx context.Context, e *Event) error {
+	var op errors.Op = "auditService.record"
+
+	if e.CreatedAt.IsZero() {
+		e.CreatedAt = time.Now()
+	}
+	if e.Targets == nil {
+		e.Targets = []string{}
+	}
+
+	inserted, err := s.repo.Insert(context.WithoutCancel(ctx), s.db, e)
+	if err != nil {
+		return errors.E(op, err)
+	}
+	e.ID = inserted.ID
+
+	return nil
+}
+
+// FindAll returns the events matching the filters, newest first. At most DefaultLimit
+// events are returned if the filters have no limit.
+func (s *Service) FindAll(ctx context.Context, ff *Filters) ([]*Event, error) {
+	var op errors.Op = "auditService.findAll"
+
+	f := *ff
+	if f.Limit == 0 {
+		f.Limit = DefaultLimit
+	}
+	if f.Limit > MaxLimit {
+		return nil, errors.E(op, errors.Invalid, fmt.Sprintf("Limit must not be bigger than %d", MaxLimit))
+	}
+	if f.From != nil && f.To != nil && !f.From.Before(*f.To) {
+		return nil, errors.E(op, errors.Invalid, "From must be before to")
+	}
+
+	ee, err := s.repo.FindAll(ctx, s.db, &f)
+	if err != nil {
+		return nil, errors.E(op, err)
+	}
+
+	return ee, nil
+}
+
+// NewService creates a new service with required dependencies.
+func NewService(l *logrus.Logger, db *sql.DB, r Repo) *Service {
+	return &Service{
+		log:  l,
+		db:   db,
+		repo: r,
+	}
+}
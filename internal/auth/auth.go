@@ -0,0 +1,117 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"time"
+)
+
+// KeyID is the ID of an api key.
+type KeyID int
+
+// Scope is a permission that can be granted to an api key.
+type Scope string
+
+// Scopes of api keys.
+const (
+	ScopeArticlesRead   Scope = "articles:read"
+	ScopeArticlesWrite  Scope = "articles:write"
+	ScopeProductsRead   Scope = "products:read"
+	ScopeProductsWrite  Scope = "products:write"
+	ScopeProductsRemove Scope = "products:remove"
+	ScopeAuditRead      Scope = "audit:read"
+	ScopeAdmin          Scope = "admin" // Grants every scope.
+)
+
+// Scopes lists all the valid scopes.
+var Scopes = []Scope{ScopeArticlesRead, ScopeArticlesWrite, ScopeProductsRead, ScopeProductsWrite, ScopeProductsRemove, ScopeAuditRead, ScopeAdmin}
+
+// Key is an api key. Only the hash of the key is stored, the key itself is returned
+// once when it's created or rotated.
+type Key struct {
+	ID        KeyID      `json:"id"`
+	Name      string     `json:"name"`
+	Prefix    string     `json:"prefix"` // First characters of the key to help identifying it.
+	Hash      string     `json:"-"`
+	Scopes    []Scope    `json:"scopes"`
+	CreatedAt time.Time  `json:"created_at"`
+	RotatedAt *time.Time `json:"rotated_at"`
+	RevokedAt *time.Time `json:"revoked_at"`
+}
+
+// HasScope reports whether the key is granted the scope.
+func (k *Key) HasScope(s Scope) bool {
+	for _, ks := range k.Scopes {
+		if ks == s || ks == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidScope reports whether s is a known scope.
+func ValidScope(s Scope) bool {
+	for _, vs := range Scopes {
+		if vs == s {
+			return true
+		}
+	}
+	return false
+}
+
+// JoinScopes returns the space separated representation of scopes used for storing them.
+func JoinScopes(ss []Scope) string {
+	parts := make([]string, 0, len(ss))
+	for _, s := range ss {
+		parts = append(parts, string(s))
+	}
+	return strings.Join(parts, " ")
+}
+
+// SplitScopes parses space separated scopes.
+func SplitScopes(s string) []Scope {
+	ss := []Scope{}
+	for _, part := range strings.Fields(s) {
+		ss = append(ss, Scope(part))
+	}
+	return ss
+}
+
+const (
+	tokenPrefix = "wh_"
+	prefixLen   = len(tokenPrefix) + 8
+)
+
+// newToken generates a random api key.
+func newToken() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return tokenPrefix + hex.EncodeToString(b), nil
+}
+
+// hash returns the hex encoded sha256 hash of the token. Tokens are random so a fast
+// hash is sufficient.
+func hash(token string) string {
+	h := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(h[:])
+}
+
+type ctxKey int
+
+const keyCtxKey ctxKey = iota
+
+// WithKey returns a copy of ctx that carries the authenticated key.
+func WithKey(ctx context.Context, k *Key) context.Context {
+	return context.WithValue(ctx, keyCtxKey, k)
+}
+
+// FromContext returns the authenticated key of the context, if any.
+func FromContext(ctx context.Context) (*Key, bool) {
+	k, ok := ctx.Value(keyCtxKey).(*Key)
+	return k, ok
+}
@@ -0,0 +1,157 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/mtekmir/warehouse-service/internal/audit"
+	"github.com/mtekmir/warehouse-service/internal/errors"
+	"github.com/mtekmir/warehouse-service/internal/logs"
+	"github.com/sirupsen/logrus"
+)
+
+// Executor provides an interface for required db methods.
+type Executor interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// Repo provides methods for managing api keys in a db.
+type Repo interface {
+	Insert(context.Context, Executor, *Key) (*Key, error)
+	FindByHash(context.Context, Executor, string) (*Key, error)
+	FindByID(context.Context, Executor, KeyID) (*Key, error)
+	FindAll(context.Context, Executor) ([]*Key, error)
+	UpdateHash(ctx context.Context, db Executor, ID KeyID, prefix, hash string, rotatedAt time.Time) (*Key, error)
+	Revoke(ctx context.Context, db Executor, ID KeyID, revokedAt time.Time) (*Key, error)
+}
+
+// Service exposes methods on api keys.
+type Service struct {
+	log          *logrus.Logger
+	db           *sql.DB
+	repo         Repo
+	bootstrapKey string
+}
+
+// Create creates an api key with the scopes. Returns the key along with the token that
+// has to be sent by the clients. The token can't be retrieved later.
+func (s *Service) Create(ctx context.Context, name string, scopes []Scope) (*Key, string, error) {
+	var op errors.Op = "authService.create"
+
+	if name == "" {
+		return nil, "", errors.E(op, errors.Invalid, "Name must not be empty")
+	}
+	if len(scopes) == 0 {
+		return nil, "", errors.E(op, errors.Invalid, "Key must have at least one scope")
+	}
+	for _, sc := range scopes {
+		if !ValidScope(sc) {
+			return nil, "", errors.E(op, errors.Invalid, fmt.Sprintf("Invalid scope: %s", sc))
+		}
+	}
+
+	token, err := newToken()
+	if err != nil {
+		return nil, "", errors.E(op, err)
+	}
+
+	k, err := s.repo.Insert(ctx, s.db, &Key{Name: name, Prefix: token[:prefixLen], Hash: hash(token), Scopes: scopes})
+	if err != nil {
+		return nil, "", errors.E(op, err)
+	}
+
+	logs.FromContext(ctx, s.log).Printf("Created api key %d (%s)", k.ID, k.Name)
+	audit.AddTargets(ctx, audit.Target("key", k.ID))
+	return k, token, nil
+}
+
+// Rotate replaces the token of an api key. The old token stops working immediately.
+func (s *Service) Rotate(ctx context.Context, ID KeyID) (*Key, string, error) {
+	var op errors.Op = "authService.rotate"
+
+	token, err := newToken()
+	if err != nil {
+		return nil, "", errors.E(op, err)
+	}
+
+	k, err := s.repo.UpdateHash(ctx, s.db, ID, token[:prefixLen], hash(token), time.Now())
+	if err != nil {
+		return nil, "", errors.E(op, err)
+	}
+	if k == nil {
+		return nil, "", errors.E(op, errors.NotFound, "Api key not found")
+	}
+
+	logs.FromContext(ctx, s.log).Printf("Rotated api key %d (%s)", k.ID, k.Name)
+	audit.AddTargets(ctx, audit.Target("key", k.ID))
+	return k, token, nil
+}
+
+// Revoke revokes an api key.
+func (s *Service) Revoke(ctx context.Context, ID KeyID) (*Key, error) {
+	var op errors.Op = "authService.revoke"
+
+	k, err := s.repo.Revoke(ctx, s.db, ID, time.Now())
+	if err != nil {
+		return nil, errors.E(op, err)
+	}
+	if k == nil {
+		return nil, errors.E(op, errors.NotFound, "Api key not found")
+	}
+
+	logs.FromContext(ctx, s.log).Printf("Revoked api key %d (%s)", k.ID, k.Name)
+	audit.AddTargets(ctx, audit.Target("key", k.ID))
+	return k, nil
+}
+
+// FindAll returns all the api keys.
+func (s *Service) FindAll(ctx context.Context) ([]*Key, error) {
+	var op errors.Op = "authService.findAll"
+
+	kk, err := s.repo.FindAll(ctx, s.db)
+	if err != nil {
+		return nil, errors.E(op, err)
+	}
+
+	return kk, nil
+}
+
+// Authenticate returns the api key of the token. Returns an Unauthorized error if the
+// token is unknown or revoked.
+func (s *Service) Authenticate(ctx context.Context, token string) (*Key, error) {
+	var op errors.Op = "authService.authenticate"
+
+	if token == "" {
+		return nil, errors.E(op, errors.Unauthorized, "Api key is required")
+	}
+
+	if s.bootstrapKey != "" && subtle.ConstantTimeCompare([]byte(token), []byte(s.bootstrapKey)) == 1 {
+		return &Key{Name: "bootstrap", Scopes: []Scope{ScopeAdmin}}, nil
+	}
+
+	k, err := s.repo.FindByHash(ctx, s.db, hash(token))
+	if err != nil {
+		return nil, errors.E(op, err)
+	}
+	if k == nil || k.RevokedAt != nil {
+		return nil, errors.E(op, errors.Unauthorized, "Invalid api key")
+	}
+
+	return k, nil
+}
+
+// NewService creates a new service with required dependencies. If bootstrapKey is not
+// empty, it's accepted as an admin key so that the first keys can be created.
+func NewService(l *logrus.Logger, db *sql.DB, r Repo, bootstrapKey string) *Service {
+	return &Service{
+		log:          l,
+		db:           db,
+		repo:         r,
+		bootstrapKey: bootstrapKey,
+	}
+}
@@ -0,0 +1,186 @@
+package auth_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mtekmir/warehouse-service/internal/auth"
+	"github.com/mtekmir/warehouse-service/internal/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// stubRepo keeps the keys in memory.
+type stubRepo struct {
+	keys []*auth.Key
+}
+
+func (r *stubRepo) Insert(_ context.Context, _ auth.Executor, k *auth.Key) (*auth.Key, error) {
+	k.ID = auth.KeyID(len(r.keys) + 1)
+	k.CreatedAt = time.Now()
+	r.keys = append(r.keys, k)
+	return k, nil
+}
+
+func (r *stubRepo) FindByHash(_ context.Context, _ auth.Executor, h string) (*auth.Key, error) {
+	for _, k := range r.keys {
+		if k.Hash == h {
+			return k, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *stubRepo) FindByID(_ context.Context, _ auth.Executor, ID auth.KeyID) (*auth.Key, error) {
+	return r.find(ID), nil
+}
+
+func (r *stubRepo) FindAll(context.Context, auth.Executor) ([]*auth.Key, error) {
+	return r.keys, nil
+}
+
+func (r *stubRepo) find(ID auth.KeyID) *auth.Key {
+	for _, k := range r.keys {
+		if k.ID == ID {
+			return k
+		}
+	}
+	return nil
+}
+
+func (r *stubRepo) UpdateHash(_ context.Context, _ auth.Executor, ID auth.KeyID, prefix, hash string, rotatedAt time.Time) (*auth.Key, error) {
+	k := r.find(ID)
+	if k != nil {
+		k.Prefix, k.Hash, k.RotatedAt = prefix, hash, &rotatedAt
+	}
+	return k, nil
+}
+
+func (r *stubRepo) Revoke(_ context.Context, _ auth.Executor, ID auth.KeyID, revokedAt time.Time) (*auth.Key, error) {
+	k := r.find(ID)
+	if k != nil {
+		k.RevokedAt = &revokedAt
+	}
+	return k, nil
+}
+
+func TestAuthenticate(t *testing.T) {
+	ctx := context.Background()
+	s := auth.NewService(logrus.New(), nil, &stubRepo{}, "bootstrap-key")
+
+	expectKind := func(t *testing.T, err error, kind errors.Kind) {
+		t.Helper()
+		e, ok := err.(*errors.Error)
+		if !ok || e.Kind != kind {
+			t.Errorf("Expected error of kind %d, got %v", kind, err)
+		}
+	}
+
+	k, err := s.Authenticate(ctx, "bootstrap-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !k.HasScope(auth.ScopeProductsRemove) {
+		t.Error("Expected bootstrap key to be granted every scope")
+	}
+
+	_, err = s.Authenticate(ctx, "")
+	expectKind(t, err, errors.Unauthorized)
+
+	_, _, err = s.Create(ctx, "reader", []auth.Scope{"products:delete"})
+	expectKind(t, err, errors.Invalid)
+
+	created, token, err := s.Create(ctx, "reader", []auth.Scope{auth.ScopeProductsRead})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created.Prefix != token[:len(created.Prefix)] {
+		t.Errorf("Expected prefix %s to be the start of the key", created.Prefix)
+	}
+
+	k, err = s.Authenticate(ctx, token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !k.HasScope(auth.ScopeProductsRead) || k.HasScope(auth.ScopeProductsWrite) {
+		t.Errorf("Unexpected scopes %v", k.Scopes)
+	}
+
+	_, rotated, err := s.Rotate(ctx, created.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.Authenticate(ctx, token)
+	expectKind(t, err, errors.Unauthorized)
+	if _, err := s.Authenticate(ctx, rotated); err != nil {
+		t.Errorf("Expected rotated key to be valid, got %v", err)
+	}
+
+	if _, err := s.Revoke(ctx, created.ID); err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.Authenticate(ctx, rotated)
+	expectKind(t, err, errors.Unauthorized)
+
+	_, err = s.Revoke(ctx, 42)
+	expectKind(t, err, errors.NotFound)
+}
+
+func TestTickets(t *testing.T) {
+	ctx := context.Background()
+	s := auth.NewService(logrus.New(), nil, &stubRepo{}, "bootstrap-key")
+
+	expectUnauthorized := func(t *testing.T, ticket string) {
+		t.Helper()
+		_, err := s.AuthenticateTicket(ctx, ticket)
+		e, ok := err.(*errors.Error)
+		if !ok || e.Kind != errors.Unauthorized {
+			t.Errorf("Expected ticket %q to be unauthorized, got %v", ticket, err)
+		}
+	}
+
+	created, _, err := s.Create(ctx, "reader", []auth.Scope{auth.ScopeProductsRead})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ticket, exp, err := s.IssueTicket(ctx, created)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp.Before(time.Now()) || exp.After(time.Now().Add(auth.TicketTTL)) {
+		t.Errorf("Expected the ticket to expire within %s, got %s", auth.TicketTTL, exp)
+	}
+	k, err := s.AuthenticateTicket(ctx, ticket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if k.ID != created.ID {
+		t.Errorf("Expected key %d, got %d", created.ID, k.ID)
+	}
+
+	bootstrap, err := s.Authenticate(ctx, "bootstrap-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bt, _, err := s.IssueTicket(ctx, bootstrap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if k, err := s.AuthenticateTicket(ctx, bt); err != nil || !k.HasScope(auth.ScopeAdmin) {
+		t.Errorf("Expected the ticket of the bootstrap key to be valid, got %v", err)
+	}
+
+	expectUnauthorized(t, "")
+	expectUnauthorized(t, ticket[:len(ticket)-1])
+	// The id of another key.
+	expectUnauthorized(t, "wht_0"+ticket[len("wht_1"):])
+	// An expired ticket.
+	expectUnauthorized(t, fmt.Sprintf("wht_%d.%d.%s", created.ID, time.Now().Add(-time.Minute).Unix(), ticket[strings.LastIndex(ticket, ".")+1:]))
+
+	if _, _, err := s.Rotate(ctx, created.ID); err != nil {
+		t.Fatal(err)
+	}
+	expectUnauthorized(t, ticket)
+}
@@ -0,0 +1,222 @@
+package cache
+
+import (
+	"container/list"
+	"database/sql"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Cache is a bounded in-process cache with ttls. Every entry carries a set of tags
+// describing the rows it was built from, and writes invalidate the entries by tags.
+// Reads inside transactions bypass the cache. Writes inside transactions invalidate
+// the entries right away and again when the transaction ends, which the services
+// report through TxEnded of the repos, so that reads racing the commit don't keep the
+// old rows. Results of reads that overlap an invalidation of one of their tags aren't
+// cached.
+//
+// Only writes through this cache invalidate its entries. Writes of other replicas are
+// seen once the entries expire, so they might be stale for up to the ttl.
+type Cache struct {
+	mu      sync.Mutex
+	size    int
+	ttl     time.Duration
+	ll      *list.List // Least recently used entries are at the back.
+	entries map[string]*list.Element
+	tags    map[string]map[string]struct{} // tag -> keys
+	pending map[*sql.Tx][]string           // Tags written by open transactions.
+	seq     uint64                         // Incremented by every invalidation.
+	tagSeqs map[string]uint64              // tag -> seq of its last invalidation
+	pruned  uint64                         // seq when tagSeqs was last cleared.
+	now     func() time.Time
+
+	hits          uint64
+	misses        uint64
+	evictions     uint64
+	invalidations uint64
+}
+
+// maxTagSeqs is the number of invalidated tags remembered before they are forgotten.
+// Reads that started before they are forgotten aren't cached.
+const maxTagSeqs = 10000
+
+type entry struct {
+	key     string
+	value   interface{}
+	tags    []string
+	expires time.Time
+}
+
+// Stats conveys the counters of the cache.
+type Stats struct {
+	Entries       int    `json:"entries"`
+	Hits          uint64 `json:"hits"`
+	Misses        uint64 `json:"misses"`
+	Evictions     uint64 `json:"evictions"`
+	Invalidations uint64 `json:"invalidations"`
+}
+
+// Stats returns the current counters of the cache.
+func (c *Cache) Stats() Stats {
+	c.mu.Lock()
+	n := c.ll.Len()
+	c.mu.Unlock()
+
+	return Stats{
+		Entries:       n,
+		Hits:          atomic.LoadUint64(&c.hits),
+		Misses:        atomic.LoadUint64(&c.misses),
+		Evictions:     atomic.LoadUint64(&c.evictions),
+		Invalidations: atomic.LoadUint64(&c.invalidations),
+	}
+}
+
+// get returns the value of key if it's cached and not expired.
+func (c *Cache) get(key string) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[key]
+	if !ok {
+		atomic.AddUint64(&c.misses, 1)
+		return nil, false
+	}
+
+	e := el.Value.(*entry)
+	if c.now().After(e.expires) {
+		c.remove(el)
+		atomic.AddUint64(&c.misses, 1)
+		return nil, false
+	}
+
+	c.ll.MoveToFront(el)
+	atomic.AddUint64(&c.hits, 1)
+	return e.value, true
+}
+
+// generation returns the number of invalidations so far. Reads take it before they
+// query the repo and pass it to set.
+func (c *Cache) generation() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.seq
+}
+
+// set caches the value with the given tags unless one of the tags was invalidated
+// since gen, the value might have been read before the write that invalidated it was
+// committed. Least recently used entries are evicted when the cache is full.
+func (c *Cache) set(key string, value interface{}, tags []string, gen uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if gen < c.pruned {
+		return
+	}
+	for _, t := range tags {
+		if c.tagSeqs[t] > gen {
+			return
+		}
+	}
+	if el, ok := c.entries[key]; ok {
+		c.remove(el)
+	}
+
+	for c.ll.Len() >= c.size {
+		c.remove(c.ll.Back())
+		atomic.AddUint64(&c.evictions, 1)
+	}
+
+	e := &entry{key: key, value: value, tags: tags, expires: c.now().Add(c.ttl)}
+	c.entries[key] = c.ll.PushFront(e)
+	for _, t := range tags {
+		keys, ok := c.tags[t]
+		if !ok {
+			keys = make(map[string]struct{})
+			c.tags[t] = keys
+		}
+		keys[key] = struct{}{}
+	}
+}
+
+// invalidate removes every entry that has at least one of the tags.
+func (c *Cache) invalidate(tags ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.seq++
+	if len(c.tagSeqs)+len(tags) > maxTagSeqs {
+		c.tagSeqs = make(map[string]uint64)
+		c.pruned = c.seq
+	}
+	for _, t := range tags {
+		c.tagSeqs[t] = c.seq
+		for key := range c.tags[t] {
+			if el, ok := c.entries[key]; ok {
+				c.remove(el)
+				atomic.AddUint64(&c.invalidations, 1)
+			}
+		}
+	}
+}
+
+// written invalidates the entries with the tags after a write on db. The tags of writes
+// inside transactions are invalidated again when the transaction ends.
+func (c *Cache) written(db interface{}, tags ...string) {
+	if tx, ok := db.(*sql.Tx); ok {
+		c.mu.Lock()
+		c.pending[tx] = append(c.pending[tx], tags...)
+		c.mu.Unlock()
+	}
+	c.invalidate(tags...)
+}
+
+// txEnded invalidates the entries with the tags written in the transaction, once it's
+// committed or rolled back.
+func (c *Cache) txEnded(tx *sql.Tx) {
+	c.mu.Lock()
+	tags, ok := c.pending[tx]
+	delete(c.pending, tx)
+	c.mu.Unlock()
+
+	if ok {
+		c.invalidate(tags...)
+	}
+}
+
+// remove must be called with the lock held.
+func (c *Cache) remove(el *list.Element) {
+	e := c.ll.Remove(el).(*entry)
+	delete(c.entries, e.key)
+	for _, t := range e.tags {
+		keys := c.tags[t]
+		delete(keys, e.key)
+		if len(keys) == 0 {
+			delete(c.tags, t)
+		}
+	}
+}
+
+// cacheable reports whether the results of queries run on db can be cached. Reads
+// inside transactions might see uncommitted rows so they bypass the cache.
+func cacheable(db interface{}) bool {
+	_, isTx := db.(*sql.Tx)
+	return !isTx
+}
+
+// New creates a cache that holds at most size entries for ttl.
+func New(size int, ttl time.Duration) *Cache {
+	if size < 1 {
+		size = 1
+	}
+	return &Cache{
+		size:    size,
+		ttl:     ttl,
+		ll:      list.New(),
+		entries: make(map[string]*list.Element),
+		tags:    make(map[string]map[string]struct{}),
+		pending: make(map[*sql.Tx][]string),
+		tagSeqs: make(map[string]uint64),
+		now:     time.Now,
+	}
+}
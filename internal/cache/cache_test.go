@@ -0,0 +1,298 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/mtekmir/warehouse-service/internal/article"
+	"github.com/mtekmir/warehouse-service/internal/memory"
+	"github.com/mtekmir/warehouse-service/internal/product"
+	"github.com/mtekmir/warehouse-service/test"
+	"github.com/sirupsen/logrus"
+)
+
+type stubProductRepo struct {
+	product.Repo
+	pp     []*product.StockInfo
+	calls  int
+	during func() // Called while finding, after the rows are read.
+}
+
+func (r *stubProductRepo) FindAll(_ context.Context, _ product.Executor, ff *product.Filters) ([]*product.StockInfo, error) {
+	r.calls++
+	defer func() {
+		if r.during != nil {
+			r.during()
+		}
+	}()
+	res := []*product.StockInfo{}
+	for _, p := range r.pp {
+		if ff.ID == nil || *ff.ID == p.ID {
+			res = append(res, p)
+		}
+	}
+	return copyStockInfos(res), nil
+}
+
+func (r *stubProductRepo) InsertProductArticles(context.Context, product.Executor, []*product.ArticleRow) error {
+	return nil
+}
+
+type stubArticleRepo struct {
+	article.Repo
+	calls int
+}
+
+func (r *stubArticleRepo) FindAll(context.Context, article.Executor, *[]article.ArtID) ([]*article.Article, error) {
+	r.calls++
+	return []*article.Article{{ID: 1, ArtID: "1", Name: "leg", Stock: 4}}, nil
+}
+
+func (r *stubArticleRepo) AdjustQuantities(context.Context, article.Executor, article.QtyAdjustmentKind, []*article.QtyAdjustment) error {
+	return nil
+}
+
+func (r *stubArticleRepo) Import(_ context.Context, _ article.Executor, aa []*article.Article) ([]*article.Article, error) {
+	return []*article.Article{{ID: 1, ArtID: "1", Name: "leg", Stock: 8}}, nil
+}
+
+func newStubs() (*stubProductRepo, *stubArticleRepo) {
+	pr := &stubProductRepo{pp: []*product.StockInfo{
+		{ID: 1, Barcode: "1", Name: "chair", AvailableQty: 1, Articles: []*product.ArticleStock{
+			{ID: 1, ArtID: "1", Name: "leg", Stock: 4, RequiredAmount: 4},
+		}},
+		{ID: 2, Barcode: "2", Name: "table", AvailableQty: 2, Articles: []*product.ArticleStock{
+			{ID: 2, ArtID: "2", Name: "board", Stock: 2, RequiredAmount: 1},
+		}},
+	}}
+	return pr, &stubArticleRepo{}
+}
+
+func TestProductRepo(t *testing.T) {
+	c := New(10, time.Minute)
+	pr, ar := newStubs()
+	cpr, car := c.ProductRepo(pr), c.ArticleRepo(ar)
+	ctx := context.Background()
+
+	var ID product.ID = 1
+	find := func() *product.StockInfo {
+		t.Helper()
+		pp, err := cpr.FindAll(ctx, nil, &product.Filters{ID: &ID})
+		if err != nil || len(pp) != 1 {
+			t.Fatalf("Unable to find product. %v", err)
+		}
+		return pp[0]
+	}
+
+	p := find()
+	p.AvailableQty = 100
+	p.Articles[0].Stock = 100
+
+	test.Compare(t, "stockInfo", pr.pp[0], find())
+	test.Compare(t, "stats", Stats{Entries: 1, Hits: 1, Misses: 1}, c.Stats())
+
+	// Adjusting an article that is not in the product keeps the entry.
+	if err := car.AdjustQuantities(ctx, nil, article.QtyAdjustmentAdd, []*article.QtyAdjustment{{ID: 2, Qty: 1}}); err != nil {
+		t.Fatal(err)
+	}
+	find()
+	if pr.calls != 1 {
+		t.Errorf("Expected repo to be called once, got %d", pr.calls)
+	}
+
+	if err := car.AdjustQuantities(ctx, nil, article.QtyAdjustmentAdd, []*article.QtyAdjustment{{ID: 1, Qty: 1}}); err != nil {
+		t.Fatal(err)
+	}
+	find()
+	if pr.calls != 2 {
+		t.Errorf("Expected entry to be invalidated after adjusting quantities, repo calls: %d", pr.calls)
+	}
+
+	if _, err := car.Import(ctx, nil, []*article.Article{{ArtID: "1", Stock: 4}}); err != nil {
+		t.Fatal(err)
+	}
+	find()
+	if pr.calls != 3 {
+		t.Errorf("Expected entry to be invalidated after import, repo calls: %d", pr.calls)
+	}
+
+	// BOM changes of other products only invalidate the lists.
+	if _, err := cpr.FindAll(ctx, nil, &product.Filters{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := cpr.InsertProductArticles(ctx, nil, []*product.ArticleRow{{ID: 2, ProductID: 3, Amount: 1}}); err != nil {
+		t.Fatal(err)
+	}
+	find()
+	if _, err := cpr.FindAll(ctx, nil, &product.Filters{}); err != nil {
+		t.Fatal(err)
+	}
+	if pr.calls != 5 {
+		t.Errorf("Expected only the list to be invalidated, repo calls: %d", pr.calls)
+	}
+}
+
+func TestArticleRepo(t *testing.T) {
+	c := New(10, time.Minute)
+	_, ar := newStubs()
+	car := c.ArticleRepo(ar)
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if _, err := car.FindAll(ctx, nil, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if ar.calls != 1 {
+		t.Errorf("Expected repo to be called once, got %d", ar.calls)
+	}
+
+	if err := car.AdjustQuantities(ctx, nil, article.QtyAdjustmentSubtract, []*article.QtyAdjustment{{ID: 1, Qty: 1}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := car.FindAll(ctx, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if ar.calls != 2 {
+		t.Errorf("Expected entry to be invalidated, repo calls: %d", ar.calls)
+	}
+}
+
+func TestEvictionAndTTL(t *testing.T) {
+	c := New(2, time.Minute)
+	now := time.Now()
+	c.now = func() time.Time { return now }
+
+	c.set("a", 1, nil, 0)
+	c.set("b", 2, nil, 0)
+	c.get("a")
+	c.set("c", 3, nil, 0)
+
+	if _, ok := c.get("b"); ok {
+		t.Error("Expected least recently used entry to be evicted")
+	}
+	if _, ok := c.get("a"); !ok {
+		t.Error("Expected recently used entry to be cached")
+	}
+
+	now = now.Add(2 * time.Minute)
+	if _, ok := c.get("c"); ok {
+		t.Error("Expected entry to expire")
+	}
+
+	test.Compare(t, "stats", Stats{Entries: 1, Hits: 2, Misses: 2, Evictions: 1}, c.Stats())
+}
+
+func TestInvalidateAfterCommit(t *testing.T) {
+	c := New(10, time.Minute)
+	pr, ar := newStubs()
+	cpr, car := c.ProductRepo(pr), c.ArticleRepo(ar)
+	ctx := context.Background()
+
+	var ID product.ID = 1
+	find := func() *product.StockInfo {
+		t.Helper()
+		pp, err := cpr.FindAll(ctx, nil, &product.Filters{ID: &ID})
+		if err != nil || len(pp) != 1 {
+			t.Fatalf("Unable to find product. %v", err)
+		}
+		return pp[0]
+	}
+
+	db := memory.NewDB(memory.NewStore())
+	defer db.Close()
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A read between the write and the commit caches the old stock.
+	if err := car.AdjustQuantities(ctx, tx, article.QtyAdjustmentAdd, []*article.QtyAdjustment{{ID: 1, Qty: 4}}); err != nil {
+		t.Fatal(err)
+	}
+	find()
+	pr.pp[0].Articles[0].Stock, pr.pp[0].AvailableQty = 8, 2
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	car.(*articleRepo).TxEnded(tx)
+	test.Compare(t, "stockInfo after commit", pr.pp[0], find())
+	if len(c.pending) != 0 {
+		t.Errorf("Expected no pending transactions, got %d", len(c.pending))
+	}
+
+	// A read that overlaps the commit isn't cached.
+	pr.during = func() {
+		pr.during = nil
+		pr.pp[0].Articles[0].Stock, pr.pp[0].AvailableQty = 12, 3
+		car.AdjustQuantities(ctx, nil, article.QtyAdjustmentAdd, []*article.QtyAdjustment{{ID: 1, Qty: 4}})
+	}
+	find()
+	test.Compare(t, "stockInfo after overlapping write", pr.pp[0], find())
+}
+
+func TestSetAfterInvalidation(t *testing.T) {
+	c := New(10, time.Minute)
+
+	gen := c.generation()
+	c.invalidate("b")
+	c.set("a", 1, []string{"a"}, gen)
+	if _, ok := c.get("a"); !ok {
+		t.Error("Expected entry to be cached after an unrelated invalidation")
+	}
+
+	gen = c.generation()
+	c.invalidate("a")
+	c.set("a", 2, []string{"a"}, gen)
+	if _, ok := c.get("a"); ok {
+		t.Error("Expected entry not to be cached after an invalidation of its tag")
+	}
+
+	// Reads older than the forgotten tags aren't cached.
+	gen = c.generation()
+	for i := 0; i <= maxTagSeqs; i++ {
+		c.invalidate(fmt.Sprintf("t%d", i))
+	}
+	c.set("a", 3, []string{"a"}, gen)
+	if _, ok := c.get("a"); ok {
+		t.Error("Expected entry not to be cached after the tags are forgotten")
+	}
+	c.set("a", 4, []string{"a"}, c.generation())
+	if _, ok := c.get("a"); !ok {
+		t.Error("Expected entry to be cached")
+	}
+}
+
+func TestServicesEndTransactions(t *testing.T) {
+	c := New(10, time.Minute)
+	s := memory.NewStore()
+	db := memory.NewDB(s)
+	defer db.Close()
+	ar := c.ArticleRepo(memory.NewArticleRepo(s))
+	ps := product.NewService(logrus.New(), db, c.ProductRepo(memory.NewProductRepo(s)), ar, nil)
+	as := article.NewService(logrus.New(), db, ar, nil)
+	ctx := context.Background()
+
+	err := ps.Import(ctx, []*product.Product{
+		{Barcode: "b1", Name: "chair", Articles: []*product.Article{{ArtID: "1", Name: "leg", Amount: 4}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := as.Import(ctx, []*article.Article{{ArtID: "1", Name: "leg", Stock: 8}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ps.Remove(ctx, 1, 1); err != nil {
+		t.Fatal(err)
+	}
+	// Failed calls roll back and end their transactions too.
+	if _, err := ps.Remove(ctx, 1, 5); err == nil {
+		t.Fatal("Expected an insufficient stock error")
+	}
+
+	if len(c.pending) != 0 {
+		t.Errorf("Expected the services to end their transactions, %d pending", len(c.pending))
+	}
+}
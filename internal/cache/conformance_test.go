@@ -0,0 +1,22 @@
+package cache_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mtekmir/warehouse-service/internal/cache"
+	"github.com/mtekmir/warehouse-service/internal/memory"
+	"github.com/mtekmir/warehouse-service/test/repotest"
+)
+
+func TestConformance(t *testing.T) {
+	repotest.Run(t, func(t *testing.T) *repotest.Backend {
+		s := memory.NewStore()
+		c := cache.New(100, time.Minute)
+		return &repotest.Backend{
+			DB:       memory.NewDB(s),
+			Articles: c.ArticleRepo(memory.NewArticleRepo(s)),
+			Products: c.ProductRepo(memory.NewProductRepo(s)),
+		}
+	})
+}
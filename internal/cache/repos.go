@@ -0,0 +1,292 @@
+package cache
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mtekmir/warehouse-service/internal/article"
+	"github.com/mtekmir/warehouse-service/internal/product"
+)
+
+// Tags of the cache entries.
+const (
+	tagProducts = "products" // Entries that depend on which products exist.
+	tagArticles = "articles" // Entries that depend on which articles exist.
+	tagStock    = "stock"    // Entries that depend on the stock of any article.
+)
+
+func tagProduct(ID product.ID) string     { return fmt.Sprintf("product:%d", ID) }
+func tagArticle(ID article.ID) string     { return fmt.Sprintf("article:%d", ID) }
+func tagArtID(artID article.ArtID) string { return fmt.Sprintf("artid:%s", artID) }
+
+type productRepo struct {
+	c    *Cache
+	repo product.Repo
+}
+
+// ProductRepo wraps a product repo and caches the stock information of products.
+func (c *Cache) ProductRepo(r product.Repo) product.Repo {
+	return &productRepo{c: c, repo: r}
+}
+
+func (r *productRepo) FindAll(ctx context.Context, db product.Executor, ff *product.Filters) ([]*product.StockInfo, error) {
+	if !cacheable(db) {
+		return r.repo.FindAll(ctx, db, ff)
+	}
+
+	key := "products:" + filtersKey(ff)
+	if v, ok := r.c.get(key); ok {
+		return copyStockInfos(v.([]*product.StockInfo)), nil
+	}
+	gen := r.c.generation()
+
+	pp, err := r.repo.FindAll(ctx, db, ff)
+	if err != nil {
+		return nil, err
+	}
+
+	tags := []string{}
+	if ff.ID != nil {
+		tags = append(tags, tagProduct(*ff.ID))
+	} else {
+		tags = append(tags, tagProducts)
+	}
+	if ff.InStock || (ff.Sort != nil && ff.Sort.Field == product.SortByAvailability) {
+		tags = append(tags, tagStock)
+	}
+	for _, p := range pp {
+		tags = append(tags, tagProduct(p.ID))
+		for _, a := range p.Articles {
+			tags = append(tags, tagArticle(a.ID))
+		}
+	}
+
+	r.c.set(key, copyStockInfos(pp), tags, gen)
+	return pp, nil
+}
+
+// TxEnded invalidates the entries written in the transaction again, it implements
+// txhook.Observer.
+func (r *productRepo) TxEnded(tx *sql.Tx) {
+	r.c.txEnded(tx)
+}
+
+func (r *productRepo) BatchInsert(ctx context.Context, db product.Executor, pp []*product.Product) ([]*product.Product, error) {
+	// Products are not listed until their articles are inserted.
+	return r.repo.BatchInsert(ctx, db, pp)
+}
+
+func (r *productRepo) InsertProductArticles(ctx context.Context, db product.Executor, arts []*product.ArticleRow) error {
+	tags := []string{tagProducts}
+	for _, a := range arts {
+		tags = append(tags, tagProduct(a.ProductID))
+	}
+	defer r.c.written(db, tags...)
+
+	return r.repo.InsertProductArticles(ctx, db, arts)
+}
+
+func (r *productRepo) ExistingProductsMap(ctx context.Context, db product.Executor, bb []*product.Barcode) (map[product.Barcode]product.ID, error) {
+	return r.repo.ExistingProductsMap(ctx, db, bb)
+}
+
+func (r *productRepo) UpdateStatus(ctx context.Context, db product.Executor, ID product.ID, from, to product.Status) error {
+	// The status decides whether the product is listed.
+	defer r.c.written(db, tagProducts, tagProduct(ID))
+
+	return r.repo.UpdateStatus(ctx, db, ID, from, to)
+}
+
+func (r *productRepo) Lock(ctx context.Context, db product.Executor, ID product.ID) error {
+	return r.repo.Lock(ctx, db, ID)
+}
+
+func (r *productRepo) FindRevisions(ctx context.Context, db product.Executor, ID product.ID) ([]*product.Revision, error) {
+	return r.repo.FindRevisions(ctx, db, ID)
+}
+
+func (r *productRepo) InsertRevision(ctx context.Context, db product.Executor, ID product.ID, rev *product.Revision) error {
+	// Revisions that take effect later are picked up when the entries expire.
+	defer r.c.written(db, tagProducts, tagProduct(ID))
+
+	return r.repo.InsertRevision(ctx, db, ID, rev)
+}
+
+func (r *productRepo) InsertRemoval(ctx context.Context, db product.Executor, rm *product.Removal) error {
+	return r.repo.InsertRemoval(ctx, db, rm)
+}
+
+type articleRepo struct {
+	c    *Cache
+	repo article.Repo
+}
+
+// ArticleRepo wraps an article repo and caches articles. Writes through the returned
+// repo invalidate the cached products that contain the affected articles as well.
+func (c *Cache) ArticleRepo(r article.Repo) article.Repo {
+	return &articleRepo{c: c, repo: r}
+}
+
+func (r *articleRepo) FindAll(ctx context.Context, db article.Executor, artIDs *[]article.ArtID) ([]*article.Article, error) {
+	if !cacheable(db) {
+		return r.repo.FindAll(ctx, db, artIDs)
+	}
+
+	key := "articles:*"
+	tags := []string{}
+	if artIDs == nil {
+		tags = append(tags, tagArticles)
+	} else {
+		ss := make([]string, 0, len(*artIDs))
+		for _, a := range *artIDs {
+			ss = append(ss, string(a))
+			tags = append(tags, tagArtID(a))
+		}
+		key = "articles:" + strings.Join(ss, ",")
+	}
+
+	if v, ok := r.c.get(key); ok {
+		return copyArticles(v.([]*article.Article)), nil
+	}
+	gen := r.c.generation()
+
+	arts, err := r.repo.FindAll(ctx, db, artIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, a := range arts {
+		tags = append(tags, tagArticle(a.ID))
+	}
+
+	r.c.set(key, copyArticles(arts), tags, gen)
+	return arts, nil
+}
+
+// TxEnded invalidates the entries written in the transaction again, it implements
+// txhook.Observer.
+func (r *articleRepo) TxEnded(tx *sql.Tx) {
+	r.c.txEnded(tx)
+}
+
+func (r *articleRepo) BatchInsert(ctx context.Context, db article.Executor, arts []*article.Article) ([]*article.Article, error) {
+	tags := []string{tagArticles}
+	for _, a := range arts {
+		tags = append(tags, tagArtID(a.ArtID))
+	}
+	defer r.c.written(db, tags...)
+
+	return r.repo.BatchInsert(ctx, db, arts)
+}
+
+func (r *articleRepo) AdjustQuantities(ctx context.Context, db article.Executor, t article.QtyAdjustmentKind, changes []*article.QtyAdjustment) error {
+	tags := []string{tagStock}
+	for _, c := range changes {
+		tags = append(tags, tagArticle(c.ID))
+	}
+	defer r.c.written(db, tags...)
+
+	return r.repo.AdjustQuantities(ctx, db, t, changes)
+}
+
+func (r *articleRepo) Import(ctx context.Context, db article.Executor, arts []*article.Article) ([]*article.Article, error) {
+	tags := []string{tagArticles, tagStock}
+	for _, a := range arts {
+		tags = append(tags, tagArtID(a.ArtID))
+	}
+	defer r.c.written(db, tags...)
+
+	imported, err := r.repo.Import(ctx, db, arts)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, 0, len(imported))
+	for _, a := range imported {
+		ids = append(ids, tagArticle(a.ID))
+	}
+	r.c.written(db, ids...)
+
+	return imported, nil
+}
+
+// Lots change the stock that products can use, so writes of lots invalidate the entries
+// that depend on stock. Lots aren't cached.
+
+func (r *articleRepo) InsertLots(ctx context.Context, db article.Executor, lots []*article.Lot) error {
+	defer r.c.written(db, tagStock)
+
+	return r.repo.InsertLots(ctx, db, lots)
+}
+
+func (r *articleRepo) ConsumeLots(ctx context.Context, db article.Executor, changes []*article.QtyAdjustment, at time.Time) error {
+	defer r.c.written(db, tagStock)
+
+	return r.repo.ConsumeLots(ctx, db, changes, at)
+}
+
+func (r *articleRepo) FindLots(ctx context.Context, db article.Executor, before time.Time) ([]*article.Lot, error) {
+	return r.repo.FindLots(ctx, db, before)
+}
+
+// filtersKey returns a key that identifies the results of a products query.
+func filtersKey(ff *product.Filters) string {
+	var b strings.Builder
+	if ff.ID != nil {
+		fmt.Fprintf(&b, "id=%d;", *ff.ID)
+	}
+	if ff.BB != nil {
+		ss := make([]string, 0, len(*ff.BB))
+		for _, bc := range *ff.BB {
+			ss = append(ss, string(bc))
+		}
+		fmt.Fprintf(&b, "barcodes=%s;", strings.Join(ss, ","))
+	}
+	if ff.ArtIDs != nil {
+		ss := make([]string, 0, len(*ff.ArtIDs))
+		for _, artID := range *ff.ArtIDs {
+			ss = append(ss, string(artID))
+		}
+		fmt.Fprintf(&b, "art_ids=%s;", strings.Join(ss, ","))
+	}
+	if len(ff.Statuses) > 0 {
+		ss := make([]string, 0, len(ff.Statuses))
+		for _, st := range ff.Statuses {
+			ss = append(ss, string(st))
+		}
+		fmt.Fprintf(&b, "statuses=%s;", strings.Join(ss, ","))
+	}
+	if ff.Sort != nil {
+		fmt.Fprintf(&b, "sort=%s,%t;", ff.Sort.Field, ff.Sort.Desc)
+	}
+	fmt.Fprintf(&b, "in_stock=%t;limit=%d;offset=%d", ff.InStock, ff.Limit, ff.Offset)
+	return b.String()
+}
+
+// Cached values are copied on the way in and out since callers modify the results.
+
+func copyStockInfos(pp []*product.StockInfo) []*product.StockInfo {
+	res := make([]*product.StockInfo, 0, len(pp))
+	for _, p := range pp {
+		cp := *p
+		cp.Articles = make([]*product.ArticleStock, 0, len(p.Articles))
+		for _, a := range p.Articles {
+			ca := *a
+			cp.Articles = append(cp.Articles, &ca)
+		}
+		res = append(res, &cp)
+	}
+	return res
+}
+
+func copyArticles(aa []*article.Article) []*article.Article {
+	res := make([]*article.Article, 0, len(aa))
+	for _, a := range aa {
+		ca := *a
+		res = append(res, &ca)
+	}
+	return res
+}
@@ -0,0 +1,205 @@
+package config_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mtekmir/warehouse-service/internal/config"
+)
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	p := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(p, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestParseLayers(t *testing.T) {
+	yml := writeFile(t, "config.yaml", "port: 8000\ngrpc_port: 9000\ncache_ttl: 1m\nenv: production\n")
+	tml := writeFile(t, "config.toml", "port = \"8000\"\ngrpc_port = 9000\ncache_ttl = \"1m\"\nenv = \"production\"\n")
+
+	for _, file := range []string{yml, tml} {
+		t.Run(filepath.Ext(file), func(t *testing.T) {
+			t.Setenv("GRPC_PORT", "9001")
+			t.Setenv("CACHE_TTL", "2m")
+
+			c, err := config.Parse([]string{"--config", file, "--cache-ttl", "3m"})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if c.Port != "8000" {
+				t.Errorf("Expected port from the file, got %s", c.Port)
+			}
+			if c.GRPCPort != "9001" {
+				t.Errorf("Expected grpc port from the env, got %s", c.GRPCPort)
+			}
+			if c.CacheTTL != 3*time.Minute {
+				t.Errorf("Expected cache ttl from the flag, got %s", c.CacheTTL)
+			}
+			if c.Env != "production" {
+				t.Errorf("Expected env from the file, got %s", c.Env)
+			}
+			if c.WriteTimeout != 15*time.Second {
+				t.Errorf("Expected default write timeout, got %s", c.WriteTimeout)
+			}
+		})
+	}
+}
+
+func TestStorageFromDBURL(t *testing.T) {
+	tests := []struct {
+		dbURL, storage, expected string
+	}{
+		{dbURL: "postgres://localhost:5432/warehouse", expected: config.StoragePostgres},
+		{dbURL: "sqlite:///var/lib/warehouse.db", expected: config.StorageSQLite},
+		{dbURL: "sqlite://warehouse.db", storage: config.StorageMemory, expected: config.StorageMemory},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.dbURL, func(t *testing.T) {
+			t.Setenv("DB_URL", tt.dbURL)
+			t.Setenv("STORAGE", tt.storage)
+
+			c, err := config.Parse(nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.Storage != tt.expected {
+				t.Errorf("Expected storage %s, got %s", tt.expected, c.Storage)
+			}
+		})
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		env  map[string]string
+		args []string
+		msgs []string
+	}{
+		{
+			name: "Invalid values are reported together",
+			env:  map[string]string{"PORT": "http", "TRACE_EXPORTER": "jaeger"},
+			args: []string{"--health-timeout", "0s"},
+			msgs: []string{
+				`port (env PORT): must be a port number between 1 and 65535, got "http"`,
+				`trace_exporter (env TRACE_EXPORTER): must be one of otlp, stdout or file, got "jaeger"`,
+				`health_timeout (flag --health-timeout): must be a positive duration such as 15s or 1m30s, got "0s"`,
+			},
+		},
+		{
+			name: "Same ports",
+			args: []string{"--port", "9090"},
+			msgs: []string{"port and grpc_port must differ, both are 9090"},
+		},
+		{
+			name: "Debug port same as port",
+			env:  map[string]string{"DEBUG_PORT": "8080"},
+			msgs: []string{"debug_port must differ from port and grpc_port, it's 8080"},
+		},
+		{
+			name: "Unknown setting in file",
+			file: "prot: 8080\n",
+			msgs: []string{"prot: unknown setting"},
+		},
+		{
+			name: "Unsupported db url",
+			env:  map[string]string{"DB_URL": "mysql://localhost"},
+			msgs: []string{"db_url (env DB_URL): must be a postgres:// or sqlite: url"},
+		},
+		{
+			name: "Storage doesn't match db url",
+			env:  map[string]string{"STORAGE": "postgres", "DB_URL": "sqlite://warehouse.db"},
+			msgs: []string{"storage is postgres but db_url is a sqlite url"},
+		},
+		{
+			name: "Http outbox publisher without url",
+			env:  map[string]string{"OUTBOX_PUBLISHER": "http"},
+			msgs: []string{"outbox_url must be set when outbox_publisher is http"},
+		},
+		{
+			name: "Invalid outbox settings",
+			env:  map[string]string{"OUTBOX_PUBLISHER": "kafka", "OUTBOX_BATCH_SIZE": "0", "OUTBOX_MAX_ATTEMPTS": "-1"},
+			msgs: []string{
+				`outbox_publisher (env OUTBOX_PUBLISHER): must be one of stdout, file or http, got "kafka"`,
+				`outbox_batch_size (env OUTBOX_BATCH_SIZE): must be a number of events, 1 or more, got "0"`,
+				`outbox_max_attempts (env OUTBOX_MAX_ATTEMPTS): must be a number of attempts, 0 or more, got "-1"`,
+			},
+		},
+		{
+			name: "Invalid cors origin",
+			env:  map[string]string{"CORS_ORIGINS": "https://app.example.com,app.example.com"},
+			msgs: []string{`cors_origins (env CORS_ORIGINS): must be * or origins such as https://app.example.com, got "app.example.com"`},
+		},
+		{
+			name: "Invalid event stream",
+			args: []string{"--event-stream", "yes"},
+			msgs: []string{`event_stream (flag --event-stream): must be true or false, got "yes"`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			args := tt.args
+			if tt.file != "" {
+				args = append([]string{"--config", writeFile(t, "config.yml", tt.file)}, args...)
+			}
+
+			_, err := config.Parse(args)
+			if err == nil {
+				t.Fatal("Expected an error")
+			}
+			for _, m := range tt.msgs {
+				if !strings.Contains(err.Error(), m) {
+					t.Errorf("Expected error to contain %q, got %q", m, err.Error())
+				}
+			}
+		})
+	}
+}
+
+func TestPrintRedactsSecrets(t *testing.T) {
+	t.Setenv("ADMIN_API_KEY", "s3cret-key")
+	t.Setenv("DB_URL", "postgres://app:hunter2@db:5432/warehouse")
+
+	c, err := config.Parse([]string{"--print-config"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.PrintConfig {
+		t.Error("Expected print config to be set")
+	}
+
+	var b bytes.Buffer
+	if err := c.Print(&b); err != nil {
+		t.Fatal(err)
+	}
+	out := b.String()
+
+	for _, secret := range []string{"s3cret-key", "hunter2"} {
+		if strings.Contains(out, secret) {
+			t.Errorf("Expected %q to be redacted, got\n%s", secret, out)
+		}
+	}
+	for _, line := range []string{
+		`admin_api_key: "REDACTED" # env`,
+		`db_url: "postgres://app:REDACTED@db:5432/warehouse" # env`,
+		`port: "8080" # default`,
+	} {
+		if !strings.Contains(out, line) {
+			t.Errorf("Expected output to contain %q, got\n%s", line, out)
+		}
+	}
+}
@@ -1,6 +1,8 @@
 package errors
 
 import (
+	"encoding/json"
+	stderrors "errors"
 	"fmt"
 	"log"
 	"runtime"
@@ -9,10 +11,17 @@ import (
 
 // Error implements the errors.Error.
 type Error struct {
-	Op      Op     // Operation being performed
-	Kind    Kind   // Kind of the error
-	Message string // Error message that will be sent to the client.
-	Err     error  // Underlying error
+	Op      Op       // Operation being performed
+	Kind    Kind     // Kind of the error
+	Message string   // Error message that will be sent to the client.
+	Details []Detail // Field level violations that will be sent to the client.
+	Err     error    // Underlying error
+}
+
+// Detail describes why a field of a request is invalid.
+type Detail struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
 }
 
 // Op describes an operation, usually as the package and method
@@ -29,6 +38,8 @@ const (
 	Duplicate                // Duplicate
 	Invalid                  // Invalid input
 	Unavailable              // Resource unavailable
+	Forbidden                // Not permitted
+	RateLimited              // Too many requests
 )
 
 func (k Kind) String() string {
@@ -45,11 +56,37 @@ func (k Kind) String() string {
 		return "Invalid input"
 	case Unavailable:
 		return "Service unavailable"
+	case Forbidden:
+		return "Forbidden"
+	case RateLimited:
+		return "Too many requests"
 	default:
 		return "Unknown error kind"
 	}
 }
 
+// Code returns the stable machine readable code of the kind that is sent to clients.
+func (k Kind) Code() string {
+	switch k {
+	case Unauthorized:
+		return "unauthorized"
+	case NotFound:
+		return "not_found"
+	case Duplicate:
+		return "duplicate"
+	case Invalid:
+		return "invalid"
+	case Unavailable:
+		return "unavailable"
+	case Forbidden:
+		return "forbidden"
+	case RateLimited:
+		return "rate_limited"
+	default:
+		return "internal"
+	}
+}
+
 // Code returns http response code.
 func (e *Error) Code() int {
 	switch e.Kind {
@@ -63,6 +100,10 @@ func (e *Error) Code() int {
 		return 400
 	case Unavailable:
 		return 503
+	case Forbidden:
+		return 403
+	case RateLimited:
+		return 429
 	default:
 		return 500
 	}
@@ -104,13 +145,46 @@ func (e *Error) Error() string {
 	return strings.Join(fields, ", ")
 }
 
-// Body returns http response body.
-func (e *Error) Body() []byte {
+// Unwrap returns the underlying error, so that the causes of the error can be inspected
+// with Is and As.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Response is the body of error responses.
+type Response struct {
+	Code      string   `json:"code"`
+	Message   string   `json:"message"`
+	RequestID string   `json:"request_id,omitempty"`
+	Details   []Detail `json:"details,omitempty"`
+}
+
+// Response returns the response body of the error for the request with the id.
+func (e *Error) Response(requestID string) *Response {
 	m := e.Message
 	if m == "" {
-		m = "Something went wrong"
+		m = "Something went wrong."
 	}
-	return []byte(fmt.Sprintf(`{"message": "%s"}`, m))
+	return &Response{Code: e.Kind.Code(), Message: m, RequestID: requestID, Details: e.Details}
+}
+
+// Body returns http response body.
+func (e *Error) Body() []byte {
+	b, _ := json.Marshal(e.Response(""))
+	return b
+}
+
+// Is reports whether any error in err's chain matches target. See the standard
+// library's errors.Is.
+func Is(err, target error) bool {
+	return stderrors.Is(err, target)
+}
+
+// As finds the first error in err's chain that matches target, and if one is found,
+// sets target to that error value and returns true. See the standard library's
+// errors.As.
+func As(err error, target interface{}) bool {
+	return stderrors.As(err, target)
 }
 
 // E builds an error value from its arguments.
@@ -122,6 +196,7 @@ func (e *Error) Body() []byte {
 // errors.Op: name of the operation
 // errors.Kind: kind of the error, default is Other
 // string: Message
+// []errors.Detail: Field level violations
 // error: The underlying error
 func E(args ...interface{}) error {
 	if len(args) == 0 {
@@ -136,6 +211,8 @@ func E(args ...interface{}) error {
 			e.Message = arg
 		case Kind:
 			e.Kind = arg
+		case []Detail:
+			e.Details = arg
 		case *Error:
 			// Make a copy
 			copy := *arg
@@ -163,5 +240,10 @@ func E(args ...interface{}) error {
 		e.Message = prev.Message
 		prev.Message = ""
 	}
+	// Same for Details.
+	if e.Details == nil {
+		e.Details = prev.Details
+		prev.Details = nil
+	}
 	return e
 }
@@ -1,38 +1,66 @@
 package errors
 
-import "testing"
+import (
+	"context"
+	"fmt"
+	"io"
+	"testing"
+)
 
 func TestCodeAndString(t *testing.T) {
 	tests := []struct {
 		e error
 		c int
 		s string
+		k string
 	}{{
 		e: E("err"),
 		c: 500,
 		s: "Other error",
+		k: "internal",
 	}, {
 		e: E(Unauthorized),
 		c: 401,
 		s: "Unauthorized",
+		k: "unauthorized",
 	}, {
 		e: E(NotFound),
 		c: 404,
 		s: "NotFound",
+		k: "not_found",
 	}, {
 		e: E(Duplicate),
 		c: 409,
 		s: "Duplicate",
+		k: "duplicate",
 	}, {
 		e: E(Invalid),
 		c: 400,
 		s: "Invalid input",
+		k: "invalid",
+	}, {
+		e: E(Unavailable),
+		c: 503,
+		s: "Service unavailable",
+		k: "unavailable",
+	}, {
+		e: E(Forbidden),
+		c: 403,
+		s: "Forbidden",
+		k: "forbidden",
+	}, {
+		e: E(RateLimited),
+		c: 429,
+		s: "Too many requests",
+		k: "rate_limited",
 	}}
 	for _, tst := range tests {
 		if e, ok := tst.e.(*Error); !ok {
 			t.Error("Expected err to be of type *Error")
 		} else if e.Code() != tst.c {
 			t.Errorf("Expected code to be %d, got %d", tst.c, e.Code())
+		} else if e.Kind.Code() != tst.k {
+			t.Errorf("Expected kind code to be %s, got %s", tst.k, e.Kind.Code())
 		}
 	}
 }
@@ -63,3 +91,42 @@ func compareOps(t *testing.T, o1 []Op, o2 []Op) {
 		}
 	}
 }
+
+func TestResponse(t *testing.T) {
+	inner := E(Op("inner"), Invalid, `Invalid "barcode"`, []Detail{{Field: "body.barcode", Message: "is required"}})
+	e := E(Op("outer"), inner).(*Error)
+
+	r := e.Response("req-1")
+	if r.Code != "invalid" || r.Message != `Invalid "barcode"` || r.RequestID != "req-1" {
+		t.Errorf("Unexpected response %+v", r)
+	}
+	if len(r.Details) != 1 || r.Details[0].Field != "body.barcode" {
+		t.Errorf("Expected details to be pulled up from the inner error, got %+v", r.Details)
+	}
+
+	expected := `{"code":"invalid","message":"Invalid \"barcode\"","details":[{"field":"body.barcode","message":"is required"}]}`
+	if string(e.Body()) != expected {
+		t.Errorf("Expected body %s, got %s", expected, e.Body())
+	}
+
+	expected = `{"code":"internal","message":"Something went wrong."}`
+	if b := E(Op("op"), io.EOF).(*Error).Body(); string(b) != expected {
+		t.Errorf("Expected body %s, got %s", expected, b)
+	}
+}
+
+func TestIsAndAs(t *testing.T) {
+	err := E(Op("outer"), E(Op("inner"), fmt.Errorf("query: %w", context.Canceled)))
+	if !Is(err, context.Canceled) {
+		t.Error("Expected the cause to be context.Canceled")
+	}
+	if Is(err, io.EOF) {
+		t.Error("Expected the cause not to be io.EOF")
+	}
+
+	var e *Error
+	if !As(fmt.Errorf("wrapped: %w", err), &e) {
+		t.Fatal("Expected to find an *Error in the chain")
+	}
+	compareOps(t, e.Ops(), []Op{"inner", "outer"})
+}
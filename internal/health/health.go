@@ -0,0 +1,152 @@
+package health
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// Check is the result of a readiness check.
+type Check struct {
+	Name  string `json:"name"`
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+// Readiness conveys whether the service can handle requests.
+type Readiness struct {
+	Ready  bool     `json:"ready"`
+	Checks []*Check `json:"checks"`
+}
+
+// Status conveys the state of the running service.
+type Status struct {
+	Version       string    `json:"version"`
+	StartedAt     time.Time `json:"started_at"`
+	Uptime        string    `json:"uptime"`
+	Draining      bool      `json:"draining"`
+	SchemaVersion *int      `json:"schema_version"`
+	DB            *DBStats  `json:"db"`
+}
+
+// DBStats are the stats of the db connection pool.
+type DBStats struct {
+	MaxOpenConnections int    `json:"max_open_connections"`
+	OpenConnections    int    `json:"open_connections"`
+	InUse              int    `json:"in_use"`
+	Idle               int    `json:"idle"`
+	WaitCount          int64  `json:"wait_count"`
+	WaitDuration       string `json:"wait_duration"`
+}
+
+// Checker checks the health of the service. DB checks are skipped if db is nil.
+type Checker struct {
+	db            *sql.DB
+	schemaVersion func(context.Context) (int, error)
+	latestVersion int
+	timeout       time.Duration
+	version       string
+	startedAt     time.Time
+	draining      int32
+}
+
+// Drain marks the service as draining, it reports not ready from then on.
+func (c *Checker) Drain() {
+	atomic.StoreInt32(&c.draining, 1)
+}
+
+// Draining reports whether the service is draining.
+func (c *Checker) Draining() bool {
+	return atomic.LoadInt32(&c.draining) == 1
+}
+
+// Ready runs the readiness checks. The service is ready if the db is reachable, the
+// migrations are at least at the latest version it knows and it's not draining. Newer
+// schemas are accepted, they are migrated by newer replicas during rolling deploys.
+func (c *Checker) Ready(ctx context.Context) *Readiness {
+	r := &Readiness{Ready: true}
+	add := func(name string, err error) {
+		ch := &Check{Name: name, OK: err == nil}
+		if err != nil {
+			ch.Error = err.Error()
+			r.Ready = false
+		}
+		r.Checks = append(r.Checks, ch)
+	}
+
+	var draining error
+	if c.Draining() {
+		draining = fmt.Errorf("server is shutting down")
+	}
+	add("draining", draining)
+
+	if c.db == nil {
+		return r
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	if err := c.db.PingContext(ctx); err != nil {
+		add("db", err)
+		add("migrations", fmt.Errorf("db is unreachable"))
+		return r
+	}
+	add("db", nil)
+
+	v, err := c.schemaVersion(ctx)
+	if err == nil && v < c.latestVersion {
+		err = fmt.Errorf("schema is at version %d, expected %d or later", v, c.latestVersion)
+	}
+	add("migrations", err)
+
+	return r
+}
+
+// Status returns the status of the service. The schema version is omitted if the db
+// can't be queried within the timeout.
+func (c *Checker) Status(ctx context.Context) *Status {
+	s := &Status{
+		Version:   c.version,
+		StartedAt: c.startedAt,
+		Uptime:    time.Since(c.startedAt).Round(time.Second).String(),
+		Draining:  c.Draining(),
+	}
+	if c.db == nil {
+		return s
+	}
+
+	stats := c.db.Stats()
+	s.DB = &DBStats{
+		MaxOpenConnections: stats.MaxOpenConnections,
+		OpenConnections:    stats.OpenConnections,
+		InUse:              stats.InUse,
+		Idle:               stats.Idle,
+		WaitCount:          stats.WaitCount,
+		WaitDuration:       stats.WaitDuration.String(),
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	if v, err := c.schemaVersion(ctx); err == nil {
+		s.SchemaVersion = &v
+	}
+
+	return s
+}
+
+// NewChecker returns a checker of the service started now. schemaVersion returns the
+// applied schema version, which is expected to be latestVersion or later. DB checks
+// time out after timeout.
+func NewChecker(db *sql.DB, schemaVersion func(context.Context) (int, error), latestVersion int, timeout time.Duration, version string) *Checker {
+	return &Checker{
+		db:            db,
+		schemaVersion: schemaVersion,
+		latestVersion: latestVersion,
+		timeout:       timeout,
+		version:       version,
+		startedAt:     time.Now(),
+	}
+}
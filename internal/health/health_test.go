@@ -0,0 +1,55 @@
+package health_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mtekmir/warehouse-service/internal/health"
+	"github.com/mtekmir/warehouse-service/internal/memory"
+)
+
+func TestReady(t *testing.T) {
+	c := health.NewChecker(nil, nil, 0, time.Second, "v1.2.3")
+
+	if r := c.Ready(context.Background()); !r.Ready {
+		t.Errorf("Expected checker to be ready, got %+v", r.Checks[0])
+	}
+
+	c.Drain()
+	r := c.Ready(context.Background())
+	if r.Ready {
+		t.Error("Expected draining checker not to be ready")
+	}
+	if r.Checks[0].Name != "draining" || r.Checks[0].Error == "" {
+		t.Errorf("Expected draining check to fail, got %+v", r.Checks[0])
+	}
+
+	s := c.Status(context.Background())
+	if s.Version != "v1.2.3" || !s.Draining || s.DB != nil {
+		t.Errorf("Unexpected status %+v", s)
+	}
+}
+
+func TestReadySchemaVersion(t *testing.T) {
+	db := memory.NewDB(memory.NewStore())
+	defer db.Close()
+
+	tests := []struct {
+		version int
+		ready   bool
+	}{
+		{version: 4, ready: false},
+		{version: 5, ready: true},
+		// Newer replicas migrate first during rolling deploys.
+		{version: 6, ready: true},
+	}
+
+	for _, tt := range tests {
+		schemaVersion := func(context.Context) (int, error) { return tt.version, nil }
+		r := health.NewChecker(db, schemaVersion, 5, time.Second, "dev").Ready(context.Background())
+		if r.Ready != tt.ready {
+			t.Errorf("Expected ready to be %t at version %d, got %+v", tt.ready, tt.version, r.Checks)
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package logs
+
+import (
+	"context"
+
+	"github.com/sirupsen/logrus"
+)
+
+type ctxKey int
+
+const entryCtxKey ctxKey = iota
+
+// WithEntry returns a copy of ctx that carries the log entry.
+func WithEntry(ctx context.Context, e *logrus.Entry) context.Context {
+	return context.WithValue(ctx, entryCtxKey, e)
+}
+
+// FromContext returns the log entry of the context, e.g. the entry of a request with
+// its id. If the context doesn't carry one, an entry of l is returned.
+func FromContext(ctx context.Context, l *logrus.Logger) *logrus.Entry {
+	if e, ok := ctx.Value(entryCtxKey).(*logrus.Entry); ok {
+		return e
+	}
+	return logrus.NewEntry(l)
+}
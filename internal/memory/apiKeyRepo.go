@@ -0,0 +1,127 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"github.com/mtekmir/warehouse-service/internal/auth"
+	"github.com/mtekmir/warehouse-service/internal/errors"
+)
+
+type apiKeyRepo struct {
+	s *Store
+}
+
+// Insert inserts an api key.
+func (r apiKeyRepo) Insert(ctx context.Context, db auth.Executor, k *auth.Key) (*auth.Key, error) {
+	var op errors.Op = "memoryAPIKeyRepo.insert"
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for _, existing := range r.s.keys {
+		if existing.Hash == k.Hash {
+			return nil, errors.E(op, errors.Duplicate, "Api key already exists")
+		}
+	}
+
+	r.s.lastKeyID++
+	inserted := &auth.Key{
+		ID:        r.s.lastKeyID,
+		Name:      k.Name,
+		Prefix:    k.Prefix,
+		Hash:      k.Hash,
+		Scopes:    append([]auth.Scope(nil), k.Scopes...),
+		CreatedAt: time.Now(),
+	}
+	r.s.keys = append(r.s.keys, inserted)
+
+	return copyKey(inserted), nil
+}
+
+// FindByHash returns the api key with the hash. Returns nil if it doesn't exist.
+func (r apiKeyRepo) FindByHash(ctx context.Context, db auth.Executor, hash string) (*auth.Key, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	for _, k := range r.s.keys {
+		if k.Hash == hash {
+			return copyKey(k), nil
+		}
+	}
+	return nil, nil
+}
+
+// FindByID returns the api key with the id. Returns nil if it doesn't exist.
+func (r apiKeyRepo) FindByID(ctx context.Context, db auth.Executor, ID auth.KeyID) (*auth.Key, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	for _, k := range r.s.keys {
+		if k.ID == ID {
+			return copyKey(k), nil
+		}
+	}
+	return nil, nil
+}
+
+// FindAll returns all the api keys.
+func (r apiKeyRepo) FindAll(ctx context.Context, db auth.Executor) ([]*auth.Key, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	kk := make([]*auth.Key, 0, len(r.s.keys))
+	for _, k := range r.s.keys {
+		kk = append(kk, copyKey(k))
+	}
+	return kk, nil
+}
+
+// UpdateHash replaces the hash of a non-revoked api key. Returns nil if there's no such key.
+func (r apiKeyRepo) UpdateHash(ctx context.Context, db auth.Executor, ID auth.KeyID, prefix, hash string, rotatedAt time.Time) (*auth.Key, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	k := r.s.key(ID)
+	if k == nil || k.RevokedAt != nil {
+		return nil, nil
+	}
+	k.Prefix, k.Hash, k.RotatedAt = prefix, hash, &rotatedAt
+	return copyKey(k), nil
+}
+
+// Revoke revokes an api key. Revoking a revoked key keeps the original revocation time.
+// Returns nil if there's no such key.
+func (r apiKeyRepo) Revoke(ctx context.Context, db auth.Executor, ID auth.KeyID, revokedAt time.Time) (*auth.Key, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	k := r.s.key(ID)
+	if k == nil {
+		return nil, nil
+	}
+	if k.RevokedAt == nil {
+		k.RevokedAt = &revokedAt
+	}
+	return copyKey(k), nil
+}
+
+// key returns the api key with the id, or nil. The lock must be held.
+func (s *Store) key(ID auth.KeyID) *auth.Key {
+	for _, k := range s.keys {
+		if k.ID == ID {
+			return k
+		}
+	}
+	return nil
+}
+
+func copyKey(k *auth.Key) *auth.Key {
+	c := *k
+	c.Scopes = append([]auth.Scope(nil), k.Scopes...)
+	return &c
+}
+
+// NewAPIKeyRepo returns a memory repo for api keys.
+func NewAPIKeyRepo(s *Store) auth.Repo {
+	return apiKeyRepo{s: s}
+}
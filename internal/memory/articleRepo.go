@@ -0,0 +1,391 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/mtekmir/warehouse-service/internal/article"
+	"github.com/mtekmir/warehouse-service/internal/errors"
+)
+
+type articleRepo struct {
+	s *Store
+}
+
+// Import imports articles. Stocks of duplicate articles are summed up, new articles are
+// created and stocks of existing ones are increased. Returns the articles in the order
+// they first appear in aa.
+func (r articleRepo) Import(ctx context.Context, db article.Executor, aa []*article.Article) ([]*article.Article, error) {
+	var op errors.Op = "memoryArticleRepo.import"
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	order := make([]article.ArtID, 0, len(aa))
+	rows := make(map[article.ArtID]*article.Article, len(aa))
+	for _, a := range aa {
+		if row, ok := rows[a.ArtID]; ok {
+			row.Stock += a.Stock
+			continue
+		}
+		order = append(order, a.ArtID)
+		rows[a.ArtID] = &article.Article{ArtID: a.ArtID, Name: a.Name, Stock: a.Stock}
+	}
+
+	res := make([]*article.Article, 0, len(order))
+	added := make(map[article.ID]int, len(order))
+	var created []article.ID
+	undo := func() {
+		r.s.addStocks(added, -1)
+		r.s.deleteArticles(created)
+	}
+	for _, artID := range order {
+		row := rows[artID]
+		if ID, ok := r.s.artIDs[artID]; ok {
+			r.s.articles[ID].Stock += row.Stock
+			added[ID] += row.Stock
+			res = append(res, copyArticle(r.s.articles[ID]))
+			continue
+		}
+		inserted, err := r.s.insertArticle(row)
+		if err != nil {
+			undo()
+			return nil, errors.E(op, err)
+		}
+		created = append(created, inserted.ID)
+		res = append(res, inserted)
+	}
+
+	if err := r.s.onRollback(db, undo); err != nil {
+		return nil, errors.E(op, err)
+	}
+	return res, nil
+}
+
+// BatchInsert inserts articles. Fails without inserting any if an article exists.
+func (r articleRepo) BatchInsert(ctx context.Context, db article.Executor, arts []*article.Article) ([]*article.Article, error) {
+	var op errors.Op = "memoryArticleRepo.batchInsert"
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	seen := make(map[article.ArtID]bool, len(arts))
+	for _, a := range arts {
+		if _, ok := r.s.artIDs[a.ArtID]; ok || seen[a.ArtID] {
+			return nil, errors.E(op, errors.Duplicate, fmt.Sprintf("Article %s already exists", a.ArtID))
+		}
+		seen[a.ArtID] = true
+	}
+
+	inserted := make([]*article.Article, 0, len(arts))
+	created := make([]article.ID, 0, len(arts))
+	for _, a := range arts {
+		art, err := r.s.insertArticle(a)
+		if err != nil {
+			r.s.deleteArticles(created)
+			return nil, errors.E(op, err)
+		}
+		inserted = append(inserted, art)
+		created = append(created, art.ID)
+	}
+
+	if err := r.s.onRollback(db, func() { r.s.deleteArticles(created) }); err != nil {
+		return nil, errors.E(op, err)
+	}
+	return inserted, nil
+}
+
+// AdjustQuantities updates the stocks of articles. Fails without updating any if an
+// article doesn't exist.
+func (r articleRepo) AdjustQuantities(ctx context.Context, db article.Executor, t article.QtyAdjustmentKind, changes []*article.QtyAdjustment) error {
+	var op errors.Op = "memoryArticleRepo.adjustQuantities"
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	// Like an UPDATE, an article is updated once even if it has several changes.
+	seen := make(map[article.ID]bool, len(changes))
+	for _, c := range changes {
+		if _, ok := r.s.articles[c.ID]; !ok || seen[c.ID] {
+			return errors.E(op, "Updated rows don't match with articles length")
+		}
+		seen[c.ID] = true
+	}
+
+	// Differences are undone rather than the old stocks restored, so that the changes of
+	// other transactions are kept.
+	added := make(map[article.ID]int, len(changes))
+	for _, c := range changes {
+		a := r.s.articles[c.ID]
+		old := a.Stock
+		switch t {
+		case article.QtyAdjustmentAdd:
+			a.Stock += c.Qty
+		case article.QtyAdjustmentSubtract:
+			a.Stock -= c.Qty
+		default:
+			a.Stock = c.Qty
+		}
+		added[c.ID] = a.Stock - old
+	}
+	if err := r.s.onRollback(db, func() { r.s.addStocks(added, -1) }); err != nil {
+		return errors.E(op, err)
+	}
+	return nil
+}
+
+// FindAll returns the articles with the art ids, or all articles if bb is nil, ordered
+// by art id.
+func (r articleRepo) FindAll(ctx context.Context, db article.Executor, bb *[]article.ArtID) ([]*article.Article, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	arts := []*article.Article{}
+	if bb == nil {
+		for _, a := range r.s.articles {
+			arts = append(arts, copyArticle(a))
+		}
+	} else {
+		seen := make(map[article.ArtID]bool, len(*bb))
+		for _, artID := range *bb {
+			if ID, ok := r.s.artIDs[artID]; ok && !seen[artID] {
+				seen[artID] = true
+				arts = append(arts, copyArticle(r.s.articles[ID]))
+			}
+		}
+	}
+	sort.Slice(arts, func(i, j int) bool { return arts[i].ArtID < arts[j].ArtID })
+
+	return arts, nil
+}
+
+// InsertLots adds the quantities of the lots to the existing lots with the same numbers
+// or inserts them. Fails without changing any if an article doesn't exist.
+func (r articleRepo) InsertLots(ctx context.Context, db article.Executor, lots []*article.Lot) error {
+	var op errors.Op = "memoryArticleRepo.insertLots"
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for _, l := range lots {
+		if _, ok := r.s.articles[l.ArticleID]; !ok {
+			return errors.E(op, fmt.Sprintf("Article %d doesn't exist", l.ArticleID))
+		}
+	}
+
+	var changed []lotChange
+	for _, l := range lots {
+		if existing := r.s.findLot(l.ArticleID, l.Number); existing != nil {
+			existing.Qty += l.Qty
+			changed = append(changed, lotChange{lot: existing, qty: l.Qty})
+			continue
+		}
+		r.s.lastLotID++
+		lot := copyLot(l)
+		lot.ID = r.s.lastLotID
+		lot.ArtID = ""
+		r.s.lots[l.ArticleID] = append(r.s.lots[l.ArticleID], lot)
+		changed = append(changed, lotChange{lot: lot, qty: l.Qty})
+	}
+	if err := r.s.onRollback(db, func() { r.s.addLotQtys(changed, -1) }); err != nil {
+		return errors.E(op, err)
+	}
+	return nil
+}
+
+// ConsumeLots subtracts the quantities from the lots that aren't expired at the time,
+// first expired first out, and deletes the emptied lots.
+func (r articleRepo) ConsumeLots(ctx context.Context, db article.Executor, changes []*article.QtyAdjustment, at time.Time) error {
+	var op errors.Op = "memoryArticleRepo.consumeLots"
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	var consumed []lotChange
+	for _, c := range changes {
+		lots := make([]*article.Lot, 0, len(r.s.lots[c.ID]))
+		for _, l := range r.s.lots[c.ID] {
+			if !l.Expired(at) {
+				lots = append(lots, l)
+			}
+		}
+		sort.SliceStable(lots, func(i, j int) bool { return consumedBefore(lots[i], lots[j]) })
+
+		left := c.Qty
+		for _, l := range lots {
+			if left == 0 {
+				break
+			}
+			q := l.Qty
+			if q > left {
+				q = left
+			}
+			l.Qty -= q
+			left -= q
+			consumed = append(consumed, lotChange{lot: l, qty: q})
+		}
+
+		r.s.deleteEmptyLots(c.ID)
+	}
+	if err := r.s.onRollback(db, func() { r.s.addLotQtys(consumed, 1) }); err != nil {
+		return errors.E(op, err)
+	}
+	return nil
+}
+
+// consumedBefore reports whether lot a is consumed before lot b. Lots that expire sooner
+// are consumed first, lots without an expiry date last.
+func consumedBefore(a, b *article.Lot) bool {
+	switch {
+	case a.ExpiresAt != nil && b.ExpiresAt == nil:
+		return true
+	case a.ExpiresAt == nil && b.ExpiresAt != nil:
+		return false
+	case a.ExpiresAt != nil && !a.ExpiresAt.Equal(*b.ExpiresAt):
+		return a.ExpiresAt.Before(*b.ExpiresAt)
+	case !a.ReceivedAt.Equal(b.ReceivedAt):
+		return a.ReceivedAt.Before(b.ReceivedAt)
+	default:
+		return a.ID < b.ID
+	}
+}
+
+// FindLots returns the lots expiring at or before the time, soonest first.
+func (r articleRepo) FindLots(ctx context.Context, db article.Executor, before time.Time) ([]*article.Lot, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	lots := []*article.Lot{}
+	for ID, ll := range r.s.lots {
+		for _, l := range ll {
+			if l.Expired(before) {
+				lot := copyLot(l)
+				lot.ArtID = r.s.articles[ID].ArtID
+				lots = append(lots, lot)
+			}
+		}
+	}
+	sort.Slice(lots, func(i, j int) bool {
+		a, b := lots[i], lots[j]
+		if !a.ExpiresAt.Equal(*b.ExpiresAt) {
+			return a.ExpiresAt.Before(*b.ExpiresAt)
+		}
+		if a.ArtID != b.ArtID {
+			return a.ArtID < b.ArtID
+		}
+		return a.Number < b.Number
+	})
+
+	return lots, nil
+}
+
+// findLot returns the lot of the article with the number, or nil. The lock must be held.
+func (s *Store) findLot(ID article.ID, number string) *article.Lot {
+	for _, l := range s.lots[ID] {
+		if l.Number == number {
+			return l
+		}
+	}
+	return nil
+}
+
+// usableStock is the stock of the article without the units of the lots that are expired
+// at the time. The lock must be held.
+func (s *Store) usableStock(ID article.ID, at time.Time) int {
+	stock := s.articles[ID].Stock
+	for _, l := range s.lots[ID] {
+		if l.Expired(at) {
+			stock -= l.Qty
+		}
+	}
+	return stock
+}
+
+func copyLot(l *article.Lot) *article.Lot {
+	c := *l
+	if l.ExpiresAt != nil {
+		e := *l.ExpiresAt
+		c.ExpiresAt = &e
+	}
+	return &c
+}
+
+// insertArticle inserts an article with the next id. The lock must be held.
+func (s *Store) insertArticle(a *article.Article) (*article.Article, error) {
+	if _, ok := s.artIDs[a.ArtID]; ok {
+		return nil, errors.E(errors.Duplicate, fmt.Sprintf("Article %s already exists", a.ArtID))
+	}
+	s.lastArticleID++
+	art := &article.Article{ID: s.lastArticleID, ArtID: a.ArtID, Name: a.Name, Stock: a.Stock}
+	s.articles[art.ID] = art
+	s.artIDs[art.ArtID] = art.ID
+	return copyArticle(art), nil
+}
+
+// deleteArticles deletes the articles with the ids and their lots. The lock must be held.
+func (s *Store) deleteArticles(IDs []article.ID) {
+	for _, ID := range IDs {
+		if a, ok := s.articles[ID]; ok {
+			delete(s.artIDs, a.ArtID)
+			delete(s.articles, ID)
+			delete(s.lots, ID)
+		}
+	}
+}
+
+// addStocks adds the quantities times sign to the stocks of the articles. The lock must
+// be held.
+func (s *Store) addStocks(qtys map[article.ID]int, sign int) {
+	for ID, qty := range qtys {
+		if a, ok := s.articles[ID]; ok {
+			a.Stock += sign * qty
+		}
+	}
+}
+
+// lotChange is a quantity added to or taken from a lot.
+type lotChange struct {
+	lot *article.Lot
+	qty int
+}
+
+// addLotQtys adds the quantities times sign to the lots. Emptied lots are deleted and
+// deleted lots that get units again are put back in the order of their ids. The lock
+// must be held.
+func (s *Store) addLotQtys(changes []lotChange, sign int) {
+	for _, c := range changes {
+		if _, ok := s.articles[c.lot.ArticleID]; !ok {
+			continue
+		}
+		if c.lot.Qty == 0 && sign > 0 {
+			lots := s.lots[c.lot.ArticleID]
+			i := sort.Search(len(lots), func(i int) bool { return lots[i].ID > c.lot.ID })
+			lots = append(lots, nil)
+			copy(lots[i+1:], lots[i:])
+			lots[i] = c.lot
+			s.lots[c.lot.ArticleID] = lots
+		}
+		c.lot.Qty += sign * c.qty
+	}
+	for _, c := range changes {
+		s.deleteEmptyLots(c.lot.ArticleID)
+	}
+}
+
+// deleteEmptyLots deletes the lots of the article without units. The lock must be held.
+func (s *Store) deleteEmptyLots(ID article.ID) {
+	kept := s.lots[ID][:0]
+	for _, l := range s.lots[ID] {
+		if l.Qty > 0 {
+			kept = append(kept, l)
+		}
+	}
+	s.lots[ID] = kept
+}
+
+func copyArticle(a *article.Article) *article.Article {
+	c := *a
+	return &c
+}
+
+// NewArticleRepo returns a memory repo for articles.
+func NewArticleRepo(s *Store) article.Repo {
+	return articleRepo{s: s}
+}
@@ -0,0 +1,134 @@
+package memory_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/mtekmir/warehouse-service/internal/article"
+	"github.com/mtekmir/warehouse-service/internal/errors"
+	"github.com/mtekmir/warehouse-service/internal/memory"
+	"github.com/mtekmir/warehouse-service/test"
+)
+
+func TestImportArticles(t *testing.T) {
+	s := memory.NewStore()
+	db := memory.NewDB(s)
+	r := memory.NewArticleRepo(s)
+	ctx := context.Background()
+
+	aa := createArticles(3)
+	aa = append(aa, &article.Article{Name: "Name_1", ArtID: "ArtID_1", Stock: 10})
+
+	imported, err := r.Import(ctx, db, aa)
+	if err != nil {
+		t.Fatalf("Unable to import articles. %v", err)
+	}
+
+	expectedArts := []*article.Article{
+		{ID: 1, Name: "Name_1", ArtID: "ArtID_1", Stock: 11},
+		{ID: 2, Name: "Name_2", ArtID: "ArtID_2", Stock: 2},
+		{ID: 3, Name: "Name_3", ArtID: "ArtID_3", Stock: 3},
+	}
+	test.Compare(t, "article", expectedArts, imported)
+
+	imported, err = r.Import(ctx, db, createArticles(4))
+	if err != nil {
+		t.Fatalf("Unable to import articles. %v", err)
+	}
+
+	expectedArts = []*article.Article{
+		{ID: 1, Name: "Name_1", ArtID: "ArtID_1", Stock: 12},
+		{ID: 2, Name: "Name_2", ArtID: "ArtID_2", Stock: 4},
+		{ID: 3, Name: "Name_3", ArtID: "ArtID_3", Stock: 6},
+		{ID: 4, Name: "Name_4", ArtID: "ArtID_4", Stock: 4},
+	}
+	test.Compare(t, "article", expectedArts, imported)
+
+	found, err := r.FindAll(ctx, db, nil)
+	if err != nil {
+		t.Fatalf("Unable to find articles. %v", err)
+	}
+	test.Compare(t, "article", expectedArts, found)
+
+	found, err = r.FindAll(ctx, db, &[]article.ArtID{"ArtID_3", "ArtID_1", "missing"})
+	if err != nil {
+		t.Fatalf("Unable to find articles. %v", err)
+	}
+	test.Compare(t, "article", []*article.Article{expectedArts[0], expectedArts[2]}, found)
+}
+
+func TestBatchInsertDuplicate(t *testing.T) {
+	s := memory.NewStore()
+	db := memory.NewDB(s)
+	r := memory.NewArticleRepo(s)
+	ctx := context.Background()
+
+	if _, err := r.BatchInsert(ctx, db, createArticles(2)); err != nil {
+		t.Fatalf("Unable to insert articles. %v", err)
+	}
+
+	_, err := r.BatchInsert(ctx, db, createArticles(3))
+	if e, ok := err.(*errors.Error); !ok || e.Kind != errors.Duplicate {
+		t.Fatalf("Expected a duplicate error. Got %v", err)
+	}
+
+	found, err := r.FindAll(ctx, db, nil)
+	if err != nil {
+		t.Fatalf("Unable to find articles. %v", err)
+	}
+	if len(found) != 2 {
+		t.Errorf("Expected no articles to be inserted by the failed batch. Got %d articles", len(found))
+	}
+}
+
+func TestAdjustQuantities(t *testing.T) {
+	s := memory.NewStore()
+	db := memory.NewDB(s)
+	r := memory.NewArticleRepo(s)
+	ctx := context.Background()
+
+	if _, err := r.BatchInsert(ctx, db, createArticles(3)); err != nil {
+		t.Fatalf("Unable to insert articles. %v", err)
+	}
+
+	tests := []struct {
+		kind     article.QtyAdjustmentKind
+		qty      int
+		expected int
+	}{
+		{article.QtyAdjustmentAdd, 5, 6},
+		{article.QtyAdjustmentSubtract, 2, 4},
+		{article.QtyAdjustmentReplace, 9, 9},
+	}
+	for _, tt := range tests {
+		if err := r.AdjustQuantities(ctx, db, tt.kind, []*article.QtyAdjustment{{ID: 1, Qty: tt.qty}}); err != nil {
+			t.Fatalf("Unable to adjust quantities. %v", err)
+		}
+		found, _ := r.FindAll(ctx, db, &[]article.ArtID{"ArtID_1"})
+		if found[0].Stock != tt.expected {
+			t.Errorf("Expected stock to be %d. Got %d", tt.expected, found[0].Stock)
+		}
+	}
+
+	err := r.AdjustQuantities(ctx, db, article.QtyAdjustmentAdd, []*article.QtyAdjustment{{ID: 2, Qty: 1}, {ID: 42, Qty: 1}})
+	if err == nil {
+		t.Error("Expected an error for a missing article")
+	}
+	found, _ := r.FindAll(ctx, db, &[]article.ArtID{"ArtID_2"})
+	if found[0].Stock != 2 {
+		t.Errorf("Expected stocks not to change on error. Got %d", found[0].Stock)
+	}
+}
+
+func createArticles(n int) []*article.Article {
+	aa := make([]*article.Article, 0, n)
+	for i := 0; i < n; i++ {
+		aa = append(aa, &article.Article{
+			Name:  fmt.Sprintf("Name_%d", i+1),
+			ArtID: article.ArtID(fmt.Sprintf("ArtID_%d", i+1)),
+			Stock: i + 1,
+		})
+	}
+	return aa
+}
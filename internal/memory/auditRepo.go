@@ -0,0 +1,88 @@
+package memory
+
+import (
+	"context"
+	"sort"
+
+	"github.com/mtekmir/warehouse-service/internal/audit"
+)
+
+type auditRepo struct {
+	s *Store
+}
+
+// Insert inserts an audit event.
+func (r auditRepo) Insert(ctx context.Context, db audit.Executor, e *audit.Event) (*audit.Event, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	r.s.lastEventID++
+	inserted := copyEvent(e)
+	inserted.ID = r.s.lastEventID
+	r.s.events = append(r.s.events, inserted)
+
+	return copyEvent(inserted), nil
+}
+
+// FindAll returns the audit events matching the filters, newest first.
+func (r auditRepo) FindAll(ctx context.Context, db audit.Executor, ff *audit.Filters) ([]*audit.Event, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	ee := []*audit.Event{}
+	for _, e := range r.s.events {
+		if matchesEvent(e, ff) {
+			ee = append(ee, copyEvent(e))
+		}
+	}
+	sort.SliceStable(ee, func(i, j int) bool {
+		if !ee[i].CreatedAt.Equal(ee[j].CreatedAt) {
+			return ee[i].CreatedAt.After(ee[j].CreatedAt)
+		}
+		return ee[i].ID > ee[j].ID
+	})
+
+	if ff.Offset >= len(ee) {
+		return []*audit.Event{}, nil
+	}
+	ee = ee[ff.Offset:]
+	if ff.Limit > 0 && ff.Limit < len(ee) {
+		ee = ee[:ff.Limit]
+	}
+	return ee, nil
+}
+
+func matchesEvent(e *audit.Event, ff *audit.Filters) bool {
+	if ff.Actor != "" && e.Actor != ff.Actor {
+		return false
+	}
+	if ff.Action != "" && e.Action != ff.Action {
+		return false
+	}
+	if ff.From != nil && e.CreatedAt.Before(*ff.From) {
+		return false
+	}
+	if ff.To != nil && !e.CreatedAt.Before(*ff.To) {
+		return false
+	}
+	if ff.Target == "" {
+		return true
+	}
+	for _, t := range e.Targets {
+		if t == ff.Target {
+			return true
+		}
+	}
+	return false
+}
+
+func copyEvent(e *audit.Event) *audit.Event {
+	c := *e
+	c.Targets = append([]string{}, e.Targets...)
+	return &c
+}
+
+// NewAuditRepo returns a memory repo for audit events.
+func NewAuditRepo(s *Store) audit.Repo {
+	return auditRepo{s: s}
+}
@@ -0,0 +1,15 @@
+package memory_test
+
+import (
+	"testing"
+
+	"github.com/mtekmir/warehouse-service/internal/memory"
+	"github.com/mtekmir/warehouse-service/test/repotest"
+)
+
+func TestConformance(t *testing.T) {
+	repotest.Run(t, func(t *testing.T) *repotest.Backend {
+		s := memory.NewStore()
+		return &repotest.Backend{DB: memory.NewDB(s), Articles: memory.NewArticleRepo(s), Products: memory.NewProductRepo(s), Audit: memory.NewAuditRepo(s), Outbox: memory.NewOutboxRepo(s), Inventory: s.InventoryStats}
+	})
+}
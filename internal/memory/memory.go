@@ -0,0 +1,234 @@
+// Package memory implements the repos in memory, for tests and demos. Repos ignore the
+// executors they are given except for transactions begun on NewDB: changes made in a
+// transaction are undone when it rolls back. Transactions of a store are serialized,
+// but uncommitted changes are visible to readers outside of transactions.
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"sync"
+	"time"
+
+	"github.com/mtekmir/warehouse-service/internal/article"
+	"github.com/mtekmir/warehouse-service/internal/audit"
+	"github.com/mtekmir/warehouse-service/internal/auth"
+	"github.com/mtekmir/warehouse-service/internal/errors"
+	"github.com/mtekmir/warehouse-service/internal/outbox"
+	"github.com/mtekmir/warehouse-service/internal/product"
+)
+
+// Store holds the data of the memory repos. Repos sharing a store see each other's
+// changes, e.g. product stocks follow article stocks. It's safe for concurrent use.
+type Store struct {
+	mu sync.RWMutex
+
+	articles map[article.ID]*article.Article
+	artIDs   map[article.ArtID]article.ID
+	lots     map[article.ID][]*article.Lot // In insertion order.
+
+	products        map[product.ID]*productRow
+	barcodes        map[product.Barcode]product.ID
+	productArticles map[product.ID][]*bomRow // In insertion order.
+	removals        []*product.Removal
+
+	keys   []*auth.Key
+	events []*audit.Event
+	outbox []*outboxRow
+
+	lastArticleID article.ID
+	lastLotID     article.LotID
+	lastProductID product.ID
+	lastKeyID     auth.KeyID
+	lastEventID   audit.EventID
+	lastOutboxID  outbox.EventID
+
+	tx     *tx           // The open transaction.
+	txLock chan struct{} // Held while a transaction is open.
+}
+
+// productRow is a product with its lifecycle state.
+type productRow struct {
+	product.Product
+	status     product.Status
+	archivedAt *time.Time
+}
+
+// bomRow is an article of a revision of the bill of materials of a product.
+type bomRow struct {
+	product.ArticleRow
+	revision      int
+	effectiveFrom time.Time
+	effectiveTo   *time.Time
+}
+
+// effective reports whether the row is in effect at the time.
+func (r *bomRow) effective(at time.Time) bool {
+	return !r.effectiveFrom.After(at) && (r.effectiveTo == nil || r.effectiveTo.After(at))
+}
+
+// currentBOM returns the article rows of the revision of a product in effect at the
+// time and the number of the revision. The lock must be held.
+func (s *Store) currentBOM(ID product.ID, at time.Time) ([]*product.ArticleRow, int) {
+	var rows []*product.ArticleRow
+	var revision int
+	for _, r := range s.productArticles[ID] {
+		if r.effective(at) {
+			rows = append(rows, &r.ArticleRow)
+			revision = r.revision
+		}
+	}
+	return rows, revision
+}
+
+// NewStore returns an empty store.
+func NewStore() *Store {
+	return &Store{
+		articles:        make(map[article.ID]*article.Article),
+		artIDs:          make(map[article.ArtID]article.ID),
+		lots:            make(map[article.ID][]*article.Lot),
+		products:        make(map[product.ID]*productRow),
+		barcodes:        make(map[product.Barcode]product.ID),
+		productArticles: make(map[product.ID][]*bomRow),
+		txLock:          make(chan struct{}, 1),
+	}
+}
+
+// InventoryStats returns the number of products that can't be built with the current
+// stock and the total units of articles in stock. Archived products aren't counted and
+// products are built with the revisions of their bills of materials in effect, without
+// the units of expired lots.
+func (s *Store) InventoryStats(ctx context.Context) (outOfStock, units int, err error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, a := range s.articles {
+		units += a.Stock
+	}
+	now := time.Now()
+	for ID, p := range s.products {
+		if p.status == product.StatusArchived {
+			continue
+		}
+		if rows, _ := s.currentBOM(ID, now); len(rows) > 0 && s.availableQty(rows, now) <= 0 {
+			outOfStock++
+		}
+	}
+	return outOfStock, units, nil
+}
+
+// NewDB returns an executor to pass to the services backed by the memory repos of the
+// store. It runs no queries, its transactions only let the repos revert the changes
+// made in them.
+func NewDB(s *Store) *sql.DB {
+	return sql.OpenDB(connector{s: s})
+}
+
+var errNoQueries = errors.E(errors.Op("memory.query"), "Memory storage doesn't run queries")
+
+// tx is the open transaction of a store. Transactions of a store are serialized, so
+// changes made on a *sql.Tx that hasn't ended belong to the open one.
+type tx struct {
+	undo []func() // Revert the changes made in the transaction, in order.
+}
+
+// begin opens a transaction once the open one ends.
+func (s *Store) begin(ctx context.Context) (*tx, error) {
+	select {
+	case s.txLock <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	t := &tx{}
+	s.mu.Lock()
+	s.tx = t
+	s.mu.Unlock()
+	return t, nil
+}
+
+// end ends the transaction, its changes are reverted in reverse order unless it's
+// committed.
+func (s *Store) end(t *tx, commit bool) {
+	s.mu.Lock()
+	if !commit {
+		for i := len(t.undo) - 1; i >= 0; i-- {
+			t.undo[i]()
+		}
+	}
+	s.tx = nil
+	s.mu.Unlock()
+	<-s.txLock
+}
+
+// onRollback registers undo to revert a change made on db if db is a transaction. Both
+// have to be called with the lock held. If it can't be registered, because the
+// transaction has already ended, the change is reverted right away.
+func (s *Store) onRollback(db interface{}, undo func()) error {
+	sqlTx, ok := db.(*sql.Tx)
+	if !ok {
+		return nil
+	}
+	if s.tx == nil || ended(sqlTx) {
+		undo()
+		return errors.E(errors.Op("memory.onRollback"), sql.ErrTxDone)
+	}
+	s.tx.undo = append(s.tx.undo, undo)
+	return nil
+}
+
+// ended reports whether tx is committed or rolled back. Statements of transactions that
+// haven't ended reach the connection, which rejects them.
+func ended(tx *sql.Tx) bool {
+	_, err := tx.PrepareContext(context.Background(), "")
+	return errors.Is(err, sql.ErrTxDone)
+}
+
+type connector struct {
+	s *Store
+}
+
+func (c connector) Connect(context.Context) (driver.Conn, error) { return conn{s: c.s}, nil }
+func (c connector) Driver() driver.Driver                        { return drv{s: c.s} }
+
+type drv struct {
+	s *Store
+}
+
+func (d drv) Open(string) (driver.Conn, error) { return conn{s: d.s}, nil }
+
+// conn begins and ends the transactions of the store, it runs no queries.
+type conn struct {
+	s *Store
+}
+
+func (conn) Prepare(string) (driver.Stmt, error) { return nil, errNoQueries }
+func (conn) Close() error                        { return nil }
+
+func (c conn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c conn) BeginTx(ctx context.Context, _ driver.TxOptions) (driver.Tx, error) {
+	t, err := c.s.begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return connTx{s: c.s, t: t}, nil
+}
+
+type connTx struct {
+	s *Store
+	t *tx
+}
+
+func (tx connTx) Commit() error {
+	tx.s.end(tx.t, true)
+	return nil
+}
+
+func (tx connTx) Rollback() error {
+	tx.s.end(tx.t, false)
+	return nil
+}
@@ -0,0 +1,74 @@
+package memory_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mtekmir/warehouse-service/internal/article"
+	"github.com/mtekmir/warehouse-service/internal/memory"
+)
+
+func TestTransactions(t *testing.T) {
+	s := memory.NewStore()
+	db := memory.NewDB(s)
+	defer db.Close()
+	r := memory.NewArticleRepo(s)
+	ctx := context.Background()
+
+	stock := func() int {
+		t.Helper()
+		aa, err := r.FindAll(ctx, db, nil)
+		if err != nil || len(aa) != 1 {
+			t.Fatalf("Unable to find the article. %v", err)
+		}
+		return aa[0].Stock
+	}
+	add := func(db article.Executor) error {
+		return r.AdjustQuantities(ctx, db, article.QtyAdjustmentAdd, []*article.QtyAdjustment{{ID: 1, Qty: 1}})
+	}
+	if _, err := r.BatchInsert(ctx, db, []*article.Article{{ArtID: "1", Name: "leg", Stock: 1}}); err != nil {
+		t.Fatalf("Unable to insert articles. %v", err)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatalf("Unable to begin a transaction. %v", err)
+	}
+	if err := add(tx); err != nil {
+		t.Fatalf("Unable to adjust quantities. %v", err)
+	}
+
+	// Transactions wait for the open one to end.
+	waitCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if _, err := db.BeginTx(waitCtx, nil); err == nil {
+		t.Error("Expected the transaction to wait for the open one")
+	}
+
+	if err := tx.Rollback(); err != nil {
+		t.Fatalf("Unable to roll back. %v", err)
+	}
+	if got := stock(); got != 1 {
+		t.Errorf("Expected the change to be reverted. Got stock %d", got)
+	}
+
+	// Changes made on an ended transaction are reverted right away.
+	tx2, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatalf("Unable to begin a transaction. %v", err)
+	}
+	defer tx2.Rollback()
+	if err := add(tx); err == nil {
+		t.Error("Expected an error for a change on an ended transaction")
+	}
+	if err := add(tx2); err != nil {
+		t.Fatalf("Unable to adjust quantities. %v", err)
+	}
+	if err := tx2.Commit(); err != nil {
+		t.Fatalf("Unable to commit. %v", err)
+	}
+	if got := stock(); got != 2 {
+		t.Errorf("Expected the committed change only. Got stock %d", got)
+	}
+}
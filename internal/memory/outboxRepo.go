@@ -0,0 +1,176 @@
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/mtekmir/warehouse-service/internal/errors"
+	"github.com/mtekmir/warehouse-service/internal/outbox"
+)
+
+// outboxRow is an event of the outbox with its delivery state.
+type outboxRow struct {
+	outbox.Event
+	lockedUntil *time.Time
+	deliveredAt *time.Time
+	deadAt      *time.Time
+	attempts    int
+	lastError   string
+}
+
+type outboxRepo struct {
+	s *Store
+}
+
+// Insert stores the events in the outbox.
+func (r outboxRepo) Insert(ctx context.Context, db outbox.Executor, ee []*outbox.Event) error {
+	var op errors.Op = "memoryOutboxRepo.insert"
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	now := time.Now()
+	rows := make(map[*outboxRow]bool, len(ee))
+	for _, e := range ee {
+		r.s.lastOutboxID++
+		row := &outboxRow{Event: *copyOutboxEvent(e)}
+		row.ID = r.s.lastOutboxID
+		row.CreatedAt = now
+		r.s.outbox = append(r.s.outbox, row)
+		rows[row] = true
+	}
+	err := r.s.onRollback(db, func() {
+		kept := r.s.outbox[:0]
+		for _, row := range r.s.outbox {
+			if !rows[row] {
+				kept = append(kept, row)
+			}
+		}
+		r.s.outbox = kept
+	})
+	if err != nil {
+		return errors.E(op, err)
+	}
+	return nil
+}
+
+// Claim leases the oldest pending events that aren't leased.
+func (r outboxRepo) Claim(ctx context.Context, db outbox.Executor, limit int, now, until time.Time) ([]*outbox.Event, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	ee := []*outbox.Event{}
+	for _, row := range r.s.outbox {
+		if len(ee) == limit {
+			break
+		}
+		if row.deliveredAt != nil || row.deadAt != nil || (row.lockedUntil != nil && row.lockedUntil.After(now)) {
+			continue
+		}
+		u := until
+		row.lockedUntil = &u
+		ee = append(ee, copyOutboxEvent(&row.Event))
+	}
+	return ee, nil
+}
+
+// MarkDelivered marks the events as delivered.
+func (r outboxRepo) MarkDelivered(ctx context.Context, db outbox.Executor, IDs []outbox.EventID, at time.Time) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for _, row := range r.s.outboxRows(IDs) {
+		t := at
+		row.deliveredAt = &t
+		row.lockedUntil = nil
+		row.attempts++
+	}
+	return nil
+}
+
+// Release ends the leases of the events and records the failed attempt. Events that
+// reach maxAttempts are dead-lettered.
+func (r outboxRepo) Release(ctx context.Context, db outbox.Executor, IDs []outbox.EventID, reason string, maxAttempts int) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	now := time.Now()
+	for _, row := range r.s.outboxRows(IDs) {
+		row.lockedUntil = nil
+		row.attempts++
+		row.lastError = reason
+		if maxAttempts > 0 && row.attempts >= maxAttempts {
+			row.deadAt = &now
+		}
+	}
+	return nil
+}
+
+// Prune deletes delivered events stored before the time, and pending ones if pending
+// is set.
+func (r outboxRepo) Prune(ctx context.Context, db outbox.Executor, before time.Time, pending bool, limit int) (int, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	n := 0
+	kept := r.s.outbox[:0]
+	for _, row := range r.s.outbox {
+		if n < limit && row.CreatedAt.Before(before) && (row.deliveredAt != nil || (pending && row.deadAt == nil)) {
+			n++
+			continue
+		}
+		kept = append(kept, row)
+	}
+	r.s.outbox = kept
+	return n, nil
+}
+
+// FindAfter returns the events with ids bigger than after.
+func (r outboxRepo) FindAfter(ctx context.Context, db outbox.Executor, after outbox.EventID, limit int) ([]*outbox.Event, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	ee := []*outbox.Event{}
+	for _, row := range r.s.outbox {
+		if len(ee) == limit {
+			break
+		}
+		if row.ID > after {
+			ee = append(ee, copyOutboxEvent(&row.Event))
+		}
+	}
+	return ee, nil
+}
+
+// LastID returns the id of the latest event.
+func (r outboxRepo) LastID(ctx context.Context, db outbox.Executor) (outbox.EventID, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	return r.s.lastOutboxID, nil
+}
+
+// outboxRows returns the rows of the events with the ids. The lock must be held.
+func (s *Store) outboxRows(IDs []outbox.EventID) []*outboxRow {
+	rows := []*outboxRow{}
+	for _, row := range s.outbox {
+		for _, ID := range IDs {
+			if row.ID == ID {
+				rows = append(rows, row)
+				break
+			}
+		}
+	}
+	return rows
+}
+
+func copyOutboxEvent(e *outbox.Event) *outbox.Event {
+	c := *e
+	c.Payload = append(json.RawMessage{}, e.Payload...)
+	return &c
+}
+
+// NewOutboxRepo returns a memory repo for the outbox.
+func NewOutboxRepo(s *Store) outbox.Repo {
+	return outboxRepo{s: s}
+}
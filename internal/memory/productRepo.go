@@ -0,0 +1,407 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/mtekmir/warehouse-service/internal/article"
+	"github.com/mtekmir/warehouse-service/internal/errors"
+	"github.com/mtekmir/warehouse-service/internal/product"
+)
+
+type productRepo struct {
+	s *Store
+}
+
+// ExistingProductsMap returns a map of the barcodes of the existing products to their ids.
+func (r productRepo) ExistingProductsMap(ctx context.Context, db product.Executor, bb []*product.Barcode) (map[product.Barcode]product.ID, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	m := make(map[product.Barcode]product.ID, len(bb))
+	for _, b := range bb {
+		if ID, ok := r.s.barcodes[*b]; ok {
+			m[*b] = ID
+		}
+	}
+	return m, nil
+}
+
+// FindAll returns the products with their stock information. Products without articles
+// are left out, like the join of the postgres repo does.
+func (r productRepo) FindAll(ctx context.Context, db product.Executor, ff *product.Filters) ([]*product.StockInfo, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	var barcodes map[product.Barcode]bool
+	if ff.BB != nil {
+		barcodes = make(map[product.Barcode]bool, len(*ff.BB))
+		for _, b := range *ff.BB {
+			barcodes[b] = true
+		}
+	}
+
+	var artIDs map[article.ArtID]bool
+	if ff.ArtIDs != nil {
+		artIDs = make(map[article.ArtID]bool, len(*ff.ArtIDs))
+		for _, artID := range *ff.ArtIDs {
+			artIDs[artID] = true
+		}
+	}
+
+	now := time.Now()
+	res := []*product.StockInfo{}
+	for ID, p := range r.s.products {
+		rows, revision := r.s.currentBOM(ID, now)
+		if len(rows) == 0 {
+			continue
+		}
+		if barcodes != nil && !barcodes[p.Barcode] {
+			continue
+		}
+		if artIDs != nil && !r.s.containsAny(rows, artIDs) {
+			continue
+		}
+		if ff.ID != nil && *ff.ID != ID {
+			continue
+		}
+		if !hasStatus(ff.Statuses, p.status) {
+			continue
+		}
+		qty := r.s.availableQty(rows, now)
+		if ff.InStock && qty <= 0 {
+			continue
+		}
+
+		si := &product.StockInfo{ID: p.ID, Barcode: p.Barcode, Name: p.Name, Status: p.status, Revision: revision, AvailableQty: qty}
+		if p.archivedAt != nil {
+			at := *p.archivedAt
+			si.ArchivedAt = &at
+		}
+		for _, row := range rows {
+			a := r.s.articles[row.ID]
+			si.Articles = append(si.Articles, &product.ArticleStock{
+				ID:             a.ID,
+				ArtID:          a.ArtID,
+				Name:           a.Name,
+				Stock:          a.Stock,
+				RequiredAmount: row.Amount,
+			})
+		}
+		res = append(res, si)
+	}
+
+	sort.Slice(res, less(res, ff.Sort))
+
+	if offset := ff.Offset; offset > 0 {
+		if offset > len(res) {
+			offset = len(res)
+		}
+		res = res[offset:]
+	}
+	if ff.Limit > 0 && ff.Limit < len(res) {
+		res = res[:ff.Limit]
+	}
+
+	return res, nil
+}
+
+// containsAny reports whether the rows contain any of the articles. The lock must be held.
+func (s *Store) containsAny(rows []*product.ArticleRow, artIDs map[article.ArtID]bool) bool {
+	for _, row := range rows {
+		if artIDs[s.articles[row.ID].ArtID] {
+			return true
+		}
+	}
+	return false
+}
+
+// hasStatus reports whether the status passes the statuses filter. Archived products are
+// left out if the filter is empty.
+func hasStatus(ss []product.Status, st product.Status) bool {
+	if len(ss) == 0 {
+		return st != product.StatusArchived
+	}
+	for _, s := range ss {
+		if s == st {
+			return true
+		}
+	}
+	return false
+}
+
+// less orders the products like the postgres repo, ids are the tie breaker.
+func less(pp []*product.StockInfo, s *product.Sort) func(i, j int) bool {
+	return func(i, j int) bool {
+		a, b := pp[i], pp[j]
+		if s == nil {
+			return a.ID < b.ID
+		}
+
+		var cmp int
+		switch s.Field {
+		case product.SortByName:
+			cmp = compare(a.Name < b.Name, a.Name > b.Name)
+		case product.SortByAvailability:
+			cmp = compare(a.AvailableQty < b.AvailableQty, a.AvailableQty > b.AvailableQty)
+		default:
+			cmp = compare(a.ID < b.ID, a.ID > b.ID)
+		}
+		if s.Desc {
+			cmp = -cmp
+		}
+		if cmp != 0 {
+			return cmp < 0
+		}
+		return a.ID < b.ID
+	}
+}
+
+func compare(lt, gt bool) int {
+	switch {
+	case lt:
+		return -1
+	case gt:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// availableQty is the number of products that can be built with the stock of the
+// articles that isn't expired at the time. The lock must be held.
+func (s *Store) availableQty(rows []*product.ArticleRow, at time.Time) int {
+	qty := -1
+	for _, row := range rows {
+		if q := s.usableStock(row.ID, at) / row.Amount; qty == -1 || q < qty {
+			qty = q
+		}
+	}
+	// Expired lots might hold more units than the stock left.
+	if qty < 0 {
+		return 0
+	}
+	return qty
+}
+
+// BatchInsert inserts products without their articles. Fails without inserting any if
+// a product exists.
+func (r productRepo) BatchInsert(ctx context.Context, db product.Executor, pp []*product.Product) ([]*product.Product, error) {
+	var op errors.Op = "memoryProductRepo.batchInsert"
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	seen := make(map[product.Barcode]bool, len(pp))
+	for _, p := range pp {
+		if _, ok := r.s.barcodes[p.Barcode]; ok || seen[p.Barcode] {
+			return nil, errors.E(op, errors.Duplicate, fmt.Sprintf("Product %s already exists", p.Barcode))
+		}
+		seen[p.Barcode] = true
+	}
+
+	inserted := make([]*product.Product, 0, len(pp))
+	for _, p := range pp {
+		r.s.lastProductID++
+		r.s.products[r.s.lastProductID] = &productRow{
+			Product: product.Product{ID: r.s.lastProductID, Barcode: p.Barcode, Name: p.Name},
+			status:  product.StatusActive,
+		}
+		r.s.barcodes[p.Barcode] = r.s.lastProductID
+		inserted = append(inserted, &product.Product{ID: r.s.lastProductID, Barcode: p.Barcode, Name: p.Name})
+	}
+
+	err := r.s.onRollback(db, func() {
+		for _, p := range inserted {
+			delete(r.s.barcodes, p.Barcode)
+			delete(r.s.products, p.ID)
+			delete(r.s.productArticles, p.ID)
+		}
+	})
+	if err != nil {
+		return nil, errors.E(op, err)
+	}
+	return inserted, nil
+}
+
+// InsertProductArticles associates articles with products. Fails without inserting any
+// if a product or an article doesn't exist.
+func (r productRepo) InsertProductArticles(ctx context.Context, db product.Executor, arts []*product.ArticleRow) error {
+	var op errors.Op = "memoryProductRepo.insertProductArticles"
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for _, a := range arts {
+		if _, ok := r.s.products[a.ProductID]; !ok {
+			return errors.E(op, errors.Invalid, fmt.Sprintf("Product %d doesn't exist", a.ProductID))
+		}
+		if _, ok := r.s.articles[a.ID]; !ok {
+			return errors.E(op, errors.Invalid, fmt.Sprintf("Article %d doesn't exist", a.ID))
+		}
+		if a.Amount <= 0 {
+			return errors.E(op, errors.Invalid, "Amount must be bigger than 0")
+		}
+	}
+
+	// Articles of new products are the first revision of their bill of materials.
+	now := time.Now().UTC()
+	rows := make(map[*bomRow]bool, len(arts))
+	for _, a := range arts {
+		row := &bomRow{ArticleRow: *a, revision: 1, effectiveFrom: now}
+		r.s.productArticles[a.ProductID] = append(r.s.productArticles[a.ProductID], row)
+		rows[row] = true
+	}
+	if err := r.s.onRollback(db, func() { r.s.deleteBOMRows(rows) }); err != nil {
+		return errors.E(op, err)
+	}
+	return nil
+}
+
+// Lock only checks that the product exists, transactions aren't isolated.
+func (r productRepo) Lock(ctx context.Context, db product.Executor, ID product.ID) error {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	if _, ok := r.s.products[ID]; !ok {
+		return errors.E(errors.Op("memoryProductRepo.lock"), errors.NotFound, "Product not found")
+	}
+	return nil
+}
+
+// FindRevisions returns the revisions of the bill of materials of a product, oldest first.
+func (r productRepo) FindRevisions(ctx context.Context, db product.Executor, ID product.ID) ([]*product.Revision, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	rr := []*product.Revision{}
+	var last *product.Revision
+	for _, row := range r.s.productArticles[ID] {
+		if last == nil || last.Number != row.revision {
+			last = &product.Revision{Number: row.revision, EffectiveFrom: row.effectiveFrom}
+			if row.effectiveTo != nil {
+				to := *row.effectiveTo
+				last.EffectiveTo = &to
+			}
+			rr = append(rr, last)
+		}
+		a := r.s.articles[row.ID]
+		last.Articles = append(last.Articles, &product.Article{ID: a.ID, ArtID: a.ArtID, Name: a.Name, Amount: row.Amount})
+	}
+	return rr, nil
+}
+
+// InsertRevision ends the latest revision of a product at the effective time of the new
+// revision and inserts the articles of the new revision. Fails without inserting any if
+// an article doesn't exist.
+func (r productRepo) InsertRevision(ctx context.Context, db product.Executor, ID product.ID, rev *product.Revision) error {
+	var op errors.Op = "memoryProductRepo.insertRevision"
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if _, ok := r.s.products[ID]; !ok {
+		return errors.E(op, errors.Invalid, fmt.Sprintf("Product %d doesn't exist", ID))
+	}
+	for _, a := range rev.Articles {
+		if _, ok := r.s.articles[a.ID]; !ok {
+			return errors.E(op, errors.Invalid, fmt.Sprintf("Article %d doesn't exist", a.ID))
+		}
+	}
+
+	var ended []*bomRow
+	for _, row := range r.s.productArticles[ID] {
+		if row.effectiveTo == nil {
+			to := rev.EffectiveFrom
+			row.effectiveTo = &to
+			ended = append(ended, row)
+		}
+	}
+	rows := make(map[*bomRow]bool, len(rev.Articles))
+	for _, a := range rev.Articles {
+		row := &bomRow{
+			ArticleRow:    product.ArticleRow{ID: a.ID, ProductID: ID, Amount: a.Amount},
+			revision:      rev.Number,
+			effectiveFrom: rev.EffectiveFrom,
+		}
+		r.s.productArticles[ID] = append(r.s.productArticles[ID], row)
+		rows[row] = true
+	}
+	err := r.s.onRollback(db, func() {
+		r.s.deleteBOMRows(rows)
+		for _, row := range ended {
+			row.effectiveTo = nil
+		}
+	})
+	if err != nil {
+		return errors.E(op, err)
+	}
+	return nil
+}
+
+// InsertRemoval records the removal of units of a product.
+func (r productRepo) InsertRemoval(ctx context.Context, db product.Executor, rm *product.Removal) error {
+	var op errors.Op = "memoryProductRepo.insertRemoval"
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	cp := *rm
+	r.s.removals = append(r.s.removals, &cp)
+	err := r.s.onRollback(db, func() {
+		for i, rm := range r.s.removals {
+			if rm == &cp {
+				r.s.removals = append(r.s.removals[:i], r.s.removals[i+1:]...)
+				break
+			}
+		}
+	})
+	if err != nil {
+		return errors.E(op, err)
+	}
+	return nil
+}
+
+// UpdateStatus moves a product from a status to another. Archiving sets the archive
+// time, other states clear it.
+func (r productRepo) UpdateStatus(ctx context.Context, db product.Executor, ID product.ID, from, to product.Status) error {
+	var op errors.Op = "memoryProductRepo.updateStatus"
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	p, ok := r.s.products[ID]
+	if !ok {
+		return errors.E(op, errors.NotFound, "Product not found")
+	}
+	if p.status != from {
+		return errors.E(op, errors.Invalid, fmt.Sprintf("Product is no longer %s", from))
+	}
+
+	oldStatus, oldArchivedAt := p.status, p.archivedAt
+	p.status = to
+	p.archivedAt = nil
+	if to == product.StatusArchived {
+		now := time.Now().UTC()
+		p.archivedAt = &now
+	}
+	if err := r.s.onRollback(db, func() { p.status, p.archivedAt = oldStatus, oldArchivedAt }); err != nil {
+		return errors.E(op, err)
+	}
+	return nil
+}
+
+// deleteBOMRows deletes the rows from the bills of materials. The lock must be held.
+func (s *Store) deleteBOMRows(rows map[*bomRow]bool) {
+	for ID, bom := range s.productArticles {
+		kept := bom[:0]
+		for _, row := range bom {
+			if !rows[row] {
+				kept = append(kept, row)
+			}
+		}
+		s.productArticles[ID] = kept
+	}
+}
+
+// NewProductRepo returns a memory repo for products.
+func NewProductRepo(s *Store) product.Repo {
+	return productRepo{s: s}
+}
@@ -0,0 +1,86 @@
+package memory_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mtekmir/warehouse-service/internal/memory"
+	"github.com/mtekmir/warehouse-service/internal/product"
+	"github.com/mtekmir/warehouse-service/test"
+	"github.com/sirupsen/logrus"
+)
+
+func TestProductService(t *testing.T) {
+	s := memory.NewStore()
+	db := memory.NewDB(s)
+	ar := memory.NewArticleRepo(s)
+	pr := memory.NewProductRepo(s)
+	ps := product.NewService(logrus.New(), db, pr, ar, nil)
+	ctx := context.Background()
+
+	err := ps.Import(ctx, []*product.Product{
+		{Barcode: "chair", Name: "Chair", Articles: []*product.Article{{ArtID: "leg", Name: "Leg", Amount: 4}, {ArtID: "seat", Name: "Seat", Amount: 1}}},
+		{Barcode: "table", Name: "Table", Articles: []*product.Article{{ArtID: "leg", Name: "Leg", Amount: 4}, {ArtID: "top", Name: "Top", Amount: 1}}},
+	})
+	if err != nil {
+		t.Fatalf("Unable to import products. %v", err)
+	}
+	// Stocks are now leg 8, seat 1, top 1.
+
+	pp, err := ps.FindAll(ctx, &product.Filters{Sort: &product.Sort{Field: product.SortByName, Desc: true}})
+	if err != nil {
+		t.Fatalf("Unable to find products. %v", err)
+	}
+	expected := []*product.StockInfo{
+		{ID: 2, Barcode: "table", Name: "Table", Status: product.StatusActive, Revision: 1, AvailableQty: 1, Articles: []*product.ArticleStock{
+			{ID: 1, ArtID: "leg", Name: "Leg", Stock: 8, RequiredAmount: 4},
+			{ID: 3, ArtID: "top", Name: "Top", Stock: 1, RequiredAmount: 1},
+		}},
+		{ID: 1, Barcode: "chair", Name: "Chair", Status: product.StatusActive, Revision: 1, AvailableQty: 1, Articles: []*product.ArticleStock{
+			{ID: 1, ArtID: "leg", Name: "Leg", Stock: 8, RequiredAmount: 4},
+			{ID: 2, ArtID: "seat", Name: "Seat", Stock: 1, RequiredAmount: 1},
+		}},
+	}
+	test.Compare(t, "products", expected, pp)
+
+	if _, err := ps.Remove(ctx, 1, 2); err == nil {
+		t.Error("Expected an error when there is not enough stock")
+	}
+	if _, err := ps.Remove(ctx, 1, 1); err != nil {
+		t.Fatalf("Unable to remove a product. %v", err)
+	}
+
+	pp, err = ps.FindAll(ctx, &product.Filters{InStock: true})
+	if err != nil {
+		t.Fatalf("Unable to find products. %v", err)
+	}
+	if len(pp) != 1 || pp[0].Barcode != "table" || pp[0].AvailableQty != 1 {
+		t.Errorf("Expected only the table to be in stock. Got %+v", pp)
+	}
+
+	pp, err = ps.FindAll(ctx, &product.Filters{Limit: 1, Offset: 1})
+	if err != nil {
+		t.Fatalf("Unable to find products. %v", err)
+	}
+	if len(pp) != 1 || pp[0].ID != 2 {
+		t.Errorf("Expected the second page to have the table. Got %+v", pp)
+	}
+
+	outOfStock, units, err := s.InventoryStats(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if outOfStock != 1 || units != 5 {
+		t.Errorf("Expected 1 product out of stock and 5 units. Got %d and %d", outOfStock, units)
+	}
+
+	_, err = pr.BatchInsert(ctx, db, []*product.Product{{Barcode: "stool", Name: "Stool"}, {Barcode: "chair", Name: "Chair"}})
+	if err == nil {
+		t.Error("Expected inserting an existing barcode to fail")
+	}
+	if m, _ := pr.ExistingProductsMap(ctx, db, []*product.Barcode{ptr("stool")}); len(m) != 0 {
+		t.Error("Expected no products to be inserted by the failed batch")
+	}
+}
+
+func ptr(b product.Barcode) *product.Barcode { return &b }
@@ -0,0 +1,208 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "warehouse"
+
+// Registry holds the collectors of the service.
+var Registry = prometheus.NewRegistry()
+
+// Collectors of the service.
+var (
+	HTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "Number of http requests by route, method and status code.",
+	}, []string{"route", "method", "code"})
+
+	HTTPDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Latency of http requests by route and method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method"})
+
+	RateLimited = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_rate_limited_total",
+		Help:      "Number of http requests rejected by the rate limiter by route.",
+	}, []string{"route"})
+
+	DBDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "db_query_duration_seconds",
+		Help:      "Duration of db queries by repo and method.",
+		Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+	}, []string{"repo", "method"})
+
+	ImportRows = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "import_rows_total",
+		Help:      "Number of imported rows by kind, articles or products.",
+	}, []string{"kind"})
+
+	ImportDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "import_duration_seconds",
+		Help:      "Duration of imports by kind, articles or products.",
+		Buckets:   []float64{.01, .05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+	}, []string{"kind"})
+
+	OutboxPublished = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "outbox_published_total",
+		Help:      "Number of events published by the outbox relay.",
+	})
+
+	OutboxPublishFailures = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "outbox_publish_failures_total",
+		Help:      "Number of batches of events the outbox relay failed to publish.",
+	})
+
+	OutboxEventFailures = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "outbox_event_failures_total",
+		Help:      "Number of events of published batches that failed on their own.",
+	})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		HTTPRequests,
+		HTTPDuration,
+		RateLimited,
+		DBDuration,
+		ImportRows,
+		ImportDuration,
+		OutboxPublished,
+		OutboxPublishFailures,
+		OutboxEventFailures,
+	)
+}
+
+// Handler serves the metrics of the registry in the prometheus text format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// ObserveDB records the duration of a db query since start.
+func ObserveDB(repo, method string, start time.Time) {
+	DBDuration.WithLabelValues(repo, method).Observe(time.Since(start).Seconds())
+}
+
+// ObserveImport records the duration of an import since start and the number of
+// imported rows. Rows are only counted if the import succeeded.
+func ObserveImport(kind string, rows int, start time.Time, err error) {
+	ImportDuration.WithLabelValues(kind).Observe(time.Since(start).Seconds())
+	if err == nil {
+		ImportRows.WithLabelValues(kind).Add(float64(rows))
+	}
+}
+
+// Inventory is the state of the inventory exposed as gauges.
+type Inventory struct {
+	OutOfStockProducts int
+	ArticleUnits       int
+}
+
+// inventoryCollector queries the state of the inventory when metrics are scraped.
+type inventoryCollector struct {
+	query      func(context.Context) (*Inventory, error)
+	timeout    time.Duration
+	outOfStock *prometheus.Desc
+	units      *prometheus.Desc
+}
+
+func (c *inventoryCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.outOfStock
+	ch <- c.units
+}
+
+func (c *inventoryCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	inv, err := c.query(ctx)
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(c.outOfStock, err)
+		ch <- prometheus.NewInvalidMetric(c.units, err)
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(c.outOfStock, prometheus.GaugeValue, float64(inv.OutOfStockProducts))
+	ch <- prometheus.MustNewConstMetric(c.units, prometheus.GaugeValue, float64(inv.ArticleUnits))
+}
+
+// RegisterInventory registers gauges of the inventory. query is called on every scrape
+// and has to finish within the timeout.
+func RegisterInventory(query func(context.Context) (*Inventory, error), timeout time.Duration) error {
+	return Registry.Register(&inventoryCollector{
+		query:   query,
+		timeout: timeout,
+		outOfStock: prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "out_of_stock_products"),
+			"Number of products with no available quantity.", nil, nil),
+		units: prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "article_units"),
+			"Total units of articles in stock.", nil, nil),
+	})
+}
+
+// Cache is the state of the read-through cache.
+type Cache struct {
+	Entries       int
+	Hits          uint64
+	Misses        uint64
+	Evictions     uint64
+	Invalidations uint64
+}
+
+// cacheCollector reads the counters of the cache when metrics are scraped.
+type cacheCollector struct {
+	stats         func() *Cache
+	entries       *prometheus.Desc
+	hits          *prometheus.Desc
+	misses        *prometheus.Desc
+	evictions     *prometheus.Desc
+	invalidations *prometheus.Desc
+}
+
+func (c *cacheCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.entries
+	ch <- c.hits
+	ch <- c.misses
+	ch <- c.evictions
+	ch <- c.invalidations
+}
+
+func (c *cacheCollector) Collect(ch chan<- prometheus.Metric) {
+	s := c.stats()
+	ch <- prometheus.MustNewConstMetric(c.entries, prometheus.GaugeValue, float64(s.Entries))
+	ch <- prometheus.MustNewConstMetric(c.hits, prometheus.CounterValue, float64(s.Hits))
+	ch <- prometheus.MustNewConstMetric(c.misses, prometheus.CounterValue, float64(s.Misses))
+	ch <- prometheus.MustNewConstMetric(c.evictions, prometheus.CounterValue, float64(s.Evictions))
+	ch <- prometheus.MustNewConstMetric(c.invalidations, prometheus.CounterValue, float64(s.Invalidations))
+}
+
+// RegisterCache registers the counters of the cache. stats is called on every scrape.
+func RegisterCache(stats func() *Cache) error {
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(namespace, "cache", name), help, nil, nil)
+	}
+	return Registry.Register(&cacheCollector{
+		stats:         stats,
+		entries:       desc("entries", "Number of cached queries."),
+		hits:          desc("hits_total", "Number of reads served from the cache."),
+		misses:        desc("misses_total", "Number of reads that missed the cache."),
+		evictions:     desc("evictions_total", "Number of entries evicted from the full cache."),
+		invalidations: desc("invalidations_total", "Number of entries invalidated by writes."),
+	})
+}
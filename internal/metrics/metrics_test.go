@@ -0,0 +1,72 @@
+package metrics_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mtekmir/warehouse-service/internal/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestObserveImport(t *testing.T) {
+	before := testutil.ToFloat64(metrics.ImportRows.WithLabelValues("articles"))
+
+	metrics.ObserveImport("articles", 3, time.Now(), nil)
+	metrics.ObserveImport("articles", 5, time.Now(), errors.New("failed"))
+
+	if got := testutil.ToFloat64(metrics.ImportRows.WithLabelValues("articles")) - before; got != 3 {
+		t.Errorf("Expected 3 imported rows, got %v", got)
+	}
+}
+
+func TestRegisterInventory(t *testing.T) {
+	err := metrics.RegisterInventory(func(context.Context) (*metrics.Inventory, error) {
+		return &metrics.Inventory{OutOfStockProducts: 2, ArticleUnits: 120}, nil
+	}, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `
+		# HELP warehouse_article_units Total units of articles in stock.
+		# TYPE warehouse_article_units gauge
+		warehouse_article_units 120
+		# HELP warehouse_out_of_stock_products Number of products with no available quantity.
+		# TYPE warehouse_out_of_stock_products gauge
+		warehouse_out_of_stock_products 2
+	`
+	err = testutil.GatherAndCompare(metrics.Registry, strings.NewReader(expected),
+		"warehouse_article_units", "warehouse_out_of_stock_products")
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRegisterCache(t *testing.T) {
+	err := metrics.RegisterCache(func() *metrics.Cache {
+		return &metrics.Cache{Entries: 3, Hits: 10, Misses: 4, Evictions: 1, Invalidations: 2}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `
+		# HELP warehouse_cache_entries Number of cached queries.
+		# TYPE warehouse_cache_entries gauge
+		warehouse_cache_entries 3
+		# HELP warehouse_cache_hits_total Number of reads served from the cache.
+		# TYPE warehouse_cache_hits_total counter
+		warehouse_cache_hits_total 10
+		# HELP warehouse_cache_misses_total Number of reads that missed the cache.
+		# TYPE warehouse_cache_misses_total counter
+		warehouse_cache_misses_total 4
+	`
+	err = testutil.GatherAndCompare(metrics.Registry, strings.NewReader(expected),
+		"warehouse_cache_entries", "warehouse_cache_hits_total", "warehouse_cache_misses_total")
+	if err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,212 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/mtekmir/warehouse-service/internal/article"
+	"github.com/mtekmir/warehouse-service/internal/audit"
+	"github.com/mtekmir/warehouse-service/internal/auth"
+	"github.com/mtekmir/warehouse-service/internal/outbox"
+	"github.com/mtekmir/warehouse-service/internal/product"
+)
+
+type productRepo struct {
+	repo product.Repo
+}
+
+// ProductRepo wraps a product repo and records the duration of its queries.
+func ProductRepo(r product.Repo) product.Repo {
+	return &productRepo{repo: r}
+}
+
+func (r *productRepo) FindAll(ctx context.Context, db product.Executor, ff *product.Filters) ([]*product.StockInfo, error) {
+	defer ObserveDB("product", "FindAll", time.Now())
+	return r.repo.FindAll(ctx, db, ff)
+}
+
+func (r *productRepo) BatchInsert(ctx context.Context, db product.Executor, pp []*product.Product) ([]*product.Product, error) {
+	defer ObserveDB("product", "BatchInsert", time.Now())
+	return r.repo.BatchInsert(ctx, db, pp)
+}
+
+func (r *productRepo) InsertProductArticles(ctx context.Context, db product.Executor, arts []*product.ArticleRow) error {
+	defer ObserveDB("product", "InsertProductArticles", time.Now())
+	return r.repo.InsertProductArticles(ctx, db, arts)
+}
+
+func (r *productRepo) ExistingProductsMap(ctx context.Context, db product.Executor, bb []*product.Barcode) (map[product.Barcode]product.ID, error) {
+	defer ObserveDB("product", "ExistingProductsMap", time.Now())
+	return r.repo.ExistingProductsMap(ctx, db, bb)
+}
+
+func (r *productRepo) UpdateStatus(ctx context.Context, db product.Executor, ID product.ID, from, to product.Status) error {
+	defer ObserveDB("product", "UpdateStatus", time.Now())
+	return r.repo.UpdateStatus(ctx, db, ID, from, to)
+}
+
+func (r *productRepo) Lock(ctx context.Context, db product.Executor, ID product.ID) error {
+	defer ObserveDB("product", "Lock", time.Now())
+	return r.repo.Lock(ctx, db, ID)
+}
+
+func (r *productRepo) FindRevisions(ctx context.Context, db product.Executor, ID product.ID) ([]*product.Revision, error) {
+	defer ObserveDB("product", "FindRevisions", time.Now())
+	return r.repo.FindRevisions(ctx, db, ID)
+}
+
+func (r *productRepo) InsertRevision(ctx context.Context, db product.Executor, ID product.ID, rev *product.Revision) error {
+	defer ObserveDB("product", "InsertRevision", time.Now())
+	return r.repo.InsertRevision(ctx, db, ID, rev)
+}
+
+func (r *productRepo) InsertRemoval(ctx context.Context, db product.Executor, rm *product.Removal) error {
+	defer ObserveDB("product", "InsertRemoval", time.Now())
+	return r.repo.InsertRemoval(ctx, db, rm)
+}
+
+type articleRepo struct {
+	repo article.Repo
+}
+
+// ArticleRepo wraps an article repo and records the duration of its queries.
+func ArticleRepo(r article.Repo) article.Repo {
+	return &articleRepo{repo: r}
+}
+
+func (r *articleRepo) FindAll(ctx context.Context, db article.Executor, artIDs *[]article.ArtID) ([]*article.Article, error) {
+	defer ObserveDB("article", "FindAll", time.Now())
+	return r.repo.FindAll(ctx, db, artIDs)
+}
+
+func (r *articleRepo) BatchInsert(ctx context.Context, db article.Executor, aa []*article.Article) ([]*article.Article, error) {
+	defer ObserveDB("article", "BatchInsert", time.Now())
+	return r.repo.BatchInsert(ctx, db, aa)
+}
+
+func (r *articleRepo) AdjustQuantities(ctx context.Context, db article.Executor, kind article.QtyAdjustmentKind, adjs []*article.QtyAdjustment) error {
+	defer ObserveDB("article", "AdjustQuantities", time.Now())
+	return r.repo.AdjustQuantities(ctx, db, kind, adjs)
+}
+
+func (r *articleRepo) Import(ctx context.Context, db article.Executor, aa []*article.Article) ([]*article.Article, error) {
+	defer ObserveDB("article", "Import", time.Now())
+	return r.repo.Import(ctx, db, aa)
+}
+
+func (r *articleRepo) InsertLots(ctx context.Context, db article.Executor, lots []*article.Lot) error {
+	defer ObserveDB("article", "InsertLots", time.Now())
+	return r.repo.InsertLots(ctx, db, lots)
+}
+
+func (r *articleRepo) ConsumeLots(ctx context.Context, db article.Executor, changes []*article.QtyAdjustment, at time.Time) error {
+	defer ObserveDB("article", "ConsumeLots", time.Now())
+	return r.repo.ConsumeLots(ctx, db, changes, at)
+}
+
+func (r *articleRepo) FindLots(ctx context.Context, db article.Executor, before time.Time) ([]*article.Lot, error) {
+	defer ObserveDB("article", "FindLots", time.Now())
+	return r.repo.FindLots(ctx, db, before)
+}
+
+type apiKeyRepo struct {
+	repo auth.Repo
+}
+
+// APIKeyRepo wraps an api key repo and records the duration of its queries.
+func APIKeyRepo(r auth.Repo) auth.Repo {
+	return &apiKeyRepo{repo: r}
+}
+
+func (r *apiKeyRepo) Insert(ctx context.Context, db auth.Executor, k *auth.Key) (*auth.Key, error) {
+	defer ObserveDB("apiKey", "Insert", time.Now())
+	return r.repo.Insert(ctx, db, k)
+}
+
+func (r *apiKeyRepo) FindByHash(ctx context.Context, db auth.Executor, hash string) (*auth.Key, error) {
+	defer ObserveDB("apiKey", "FindByHash", time.Now())
+	return r.repo.FindByHash(ctx, db, hash)
+}
+
+func (r *apiKeyRepo) FindByID(ctx context.Context, db auth.Executor, ID auth.KeyID) (*auth.Key, error) {
+	defer ObserveDB("apiKey", "FindByID", time.Now())
+	return r.repo.FindByID(ctx, db, ID)
+}
+
+func (r *apiKeyRepo) FindAll(ctx context.Context, db auth.Executor) ([]*auth.Key, error) {
+	defer ObserveDB("apiKey", "FindAll", time.Now())
+	return r.repo.FindAll(ctx, db)
+}
+
+func (r *apiKeyRepo) UpdateHash(ctx context.Context, db auth.Executor, ID auth.KeyID, prefix, hash string, rotatedAt time.Time) (*auth.Key, error) {
+	defer ObserveDB("apiKey", "UpdateHash", time.Now())
+	return r.repo.UpdateHash(ctx, db, ID, prefix, hash, rotatedAt)
+}
+
+func (r *apiKeyRepo) Revoke(ctx context.Context, db auth.Executor, ID auth.KeyID, revokedAt time.Time) (*auth.Key, error) {
+	defer ObserveDB("apiKey", "Revoke", time.Now())
+	return r.repo.Revoke(ctx, db, ID, revokedAt)
+}
+
+type auditRepo struct {
+	repo audit.Repo
+}
+
+// AuditRepo wraps an audit repo and records the duration of its queries.
+func AuditRepo(r audit.Repo) audit.Repo {
+	return &auditRepo{repo: r}
+}
+
+func (r *auditRepo) Insert(ctx context.Context, db audit.Executor, e *audit.Event) (*audit.Event, error) {
+	defer ObserveDB("audit", "Insert", time.Now())
+	return r.repo.Insert(ctx, db, e)
+}
+
+func (r *auditRepo) FindAll(ctx context.Context, db audit.Executor, ff *audit.Filters) ([]*audit.Event, error) {
+	defer ObserveDB("audit", "FindAll", time.Now())
+	return r.repo.FindAll(ctx, db, ff)
+}
+
+type outboxRepo struct {
+	repo outbox.Repo
+}
+
+// OutboxRepo wraps an outbox repo and records the duration of its queries.
+func OutboxRepo(r outbox.Repo) outbox.Repo {
+	return &outboxRepo{repo: r}
+}
+
+func (r *outboxRepo) Insert(ctx context.Context, db outbox.Executor, ee []*outbox.Event) error {
+	defer ObserveDB("outbox", "Insert", time.Now())
+	return r.repo.Insert(ctx, db, ee)
+}
+
+func (r *outboxRepo) Claim(ctx context.Context, db outbox.Executor, limit int, now, until time.Time) ([]*outbox.Event, error) {
+	defer ObserveDB("outbox", "Claim", time.Now())
+	return r.repo.Claim(ctx, db, limit, now, until)
+}
+
+func (r *outboxRepo) MarkDelivered(ctx context.Context, db outbox.Executor, IDs []outbox.EventID, at time.Time) error {
+	defer ObserveDB("outbox", "MarkDelivered", time.Now())
+	return r.repo.MarkDelivered(ctx, db, IDs, at)
+}
+
+func (r *outboxRepo) Release(ctx context.Context, db outbox.Executor, IDs []outbox.EventID, reason string, maxAttempts int) error {
+	defer ObserveDB("outbox", "Release", time.Now())
+	return r.repo.Release(ctx, db, IDs, reason, maxAttempts)
+}
+
+func (r *outboxRepo) Prune(ctx context.Context, db outbox.Executor, before time.Time, pending bool, limit int) (int, error) {
+	defer ObserveDB("outbox", "Prune", time.Now())
+	return r.repo.Prune(ctx, db, before, pending, limit)
+}
+
+func (r *outboxRepo) FindAfter(ctx context.Context, db outbox.Executor, after outbox.EventID, limit int) ([]*outbox.Event, error) {
+	defer ObserveDB("outbox", "FindAfter", time.Now())
+	return r.repo.FindAfter(ctx, db, after, limit)
+}
+
+func (r *outboxRepo) LastID(ctx context.Context, db outbox.Executor) (outbox.EventID, error) {
+	defer ObserveDB("outbox", "LastID", time.Now())
+	return r.repo.LastID(ctx, db)
+}
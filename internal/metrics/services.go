@@ -0,0 +1,55 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/mtekmir/warehouse-service/internal/article"
+	"github.com/mtekmir/warehouse-service/internal/errors"
+	"github.com/mtekmir/warehouse-service/internal/outbox"
+	"github.com/mtekmir/warehouse-service/internal/product"
+)
+
+// ProductService wraps a product service and records the rows and durations of imports.
+type ProductService struct {
+	*product.Service
+}
+
+// Import imports the products with the wrapped service.
+func (s ProductService) Import(ctx context.Context, rows []*product.Product) (err error) {
+	defer func(start time.Time) { ObserveImport("products", len(rows), start, err) }(time.Now())
+	return s.Service.Import(ctx, rows)
+}
+
+// ArticleService wraps an article service and records the rows and durations of imports.
+type ArticleService struct {
+	*article.Service
+}
+
+// Import imports the articles with the wrapped service.
+func (s ArticleService) Import(ctx context.Context, rows []*article.Article) (aa []*article.Article, err error) {
+	defer func(start time.Time) { ObserveImport("articles", len(rows), start, err) }(time.Now())
+	return s.Service.Import(ctx, rows)
+}
+
+type publisher struct {
+	pub outbox.Publisher
+}
+
+// Publisher wraps an outbox publisher and counts the published events, the failed
+// batches and the events that failed on their own.
+func Publisher(p outbox.Publisher) outbox.Publisher {
+	return &publisher{pub: p}
+}
+
+func (p *publisher) Publish(ctx context.Context, ee []*outbox.Event) error {
+	err := p.pub.Publish(ctx, ee)
+	var failed outbox.PublishError
+	if err != nil && !errors.As(err, &failed) {
+		OutboxPublishFailures.Inc()
+		return err
+	}
+	OutboxEventFailures.Add(float64(len(failed)))
+	OutboxPublished.Add(float64(len(ee) - len(failed)))
+	return err
+}
@@ -0,0 +1,361 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mtekmir/warehouse-service/internal/errors"
+)
+
+// Document is the subset of an OpenAPI 3 document that is used to validate requests.
+type Document struct {
+	OpenAPI    string               `json:"openapi"`
+	Paths      map[string]*PathItem `json:"paths"`
+	Components struct {
+		Schemas    map[string]*Schema    `json:"schemas"`
+		Parameters map[string]*Parameter `json:"parameters"`
+	} `json:"components"`
+}
+
+// PathItem describes the operations available on a single path.
+type PathItem struct {
+	Get    *Operation `json:"get"`
+	Post   *Operation `json:"post"`
+	Put    *Operation `json:"put"`
+	Patch  *Operation `json:"patch"`
+	Delete *Operation `json:"delete"`
+}
+
+// Operation describes a single api operation on a path.
+type Operation struct {
+	OperationID string       `json:"operationId"`
+	Parameters  []*Parameter `json:"parameters"`
+	RequestBody *RequestBody `json:"requestBody"`
+}
+
+// Parameter describes a path or query parameter of an operation.
+type Parameter struct {
+	Ref      string  `json:"$ref"`
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Required bool    `json:"required"`
+	Schema   *Schema `json:"schema"`
+}
+
+// RequestBody describes the request body of an operation.
+type RequestBody struct {
+	Required bool `json:"required"`
+	Content  map[string]struct {
+		Schema *Schema `json:"schema"`
+	} `json:"content"`
+}
+
+// Schema is the subset of the JSON schema keywords that are validated.
+type Schema struct {
+	Ref        string             `json:"$ref"`
+	Type       string             `json:"type"`
+	Properties map[string]*Schema `json:"properties"`
+	Required   []string           `json:"required"`
+	Items      *Schema            `json:"items"`
+	Enum       []interface{}      `json:"enum"`
+	Pattern    string             `json:"pattern"`
+	Minimum    *float64           `json:"minimum"`
+	MinLength  *int               `json:"minLength"`
+	MinItems   *int               `json:"minItems"`
+
+	re *regexp.Regexp
+}
+
+// Violation describes why a field of a request doesn't conform to the schema.
+type Violation struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Parse parses an OpenAPI document. Schema references are resolved and patterns are
+// compiled up front, so invalid documents are rejected here rather than per request.
+func Parse(data []byte) (*Document, error) {
+	var op errors.Op = "openapi.parse"
+
+	var d Document
+	if err := json.Unmarshal(data, &d); err != nil {
+		return nil, errors.E(op, err)
+	}
+
+	var prepare func(s *Schema) error
+	prepare = func(s *Schema) error {
+		if s == nil {
+			return nil
+		}
+		if s.Ref != "" {
+			name := strings.TrimPrefix(s.Ref, "#/components/schemas/")
+			if _, ok := d.Components.Schemas[name]; !ok {
+				return fmt.Errorf("unresolved reference %s", s.Ref)
+			}
+			return nil
+		}
+		if s.Pattern != "" {
+			re, err := regexp.Compile(s.Pattern)
+			if err != nil {
+				return err
+			}
+			s.re = re
+		}
+		for _, p := range s.Properties {
+			if err := prepare(p); err != nil {
+				return err
+			}
+		}
+		return prepare(s.Items)
+	}
+
+	for _, s := range d.Components.Schemas {
+		if err := prepare(s); err != nil {
+			return nil, errors.E(op, err)
+		}
+	}
+	for _, item := range d.Paths {
+		for _, o := range item.Operations() {
+			for i, p := range o.Parameters {
+				if p.Ref != "" {
+					ref, ok := d.Components.Parameters[strings.TrimPrefix(p.Ref, "#/components/parameters/")]
+					if !ok {
+						return nil, errors.E(op, fmt.Errorf("unresolved reference %s", p.Ref))
+					}
+					o.Parameters[i], p = ref, ref
+				}
+				if err := prepare(p.Schema); err != nil {
+					return nil, errors.E(op, err)
+				}
+			}
+			if o.RequestBody != nil {
+				for _, c := range o.RequestBody.Content {
+					if err := prepare(c.Schema); err != nil {
+						return nil, errors.E(op, err)
+					}
+				}
+			}
+		}
+	}
+
+	return &d, nil
+}
+
+// Operations returns the defined operations of the path.
+func (p *PathItem) Operations() []*Operation {
+	oo := []*Operation{}
+	for _, o := range []*Operation{p.Get, p.Post, p.Put, p.Patch, p.Delete} {
+		if o != nil {
+			oo = append(oo, o)
+		}
+	}
+	return oo
+}
+
+// Operation returns the operation of the path template and the http method.
+func (d *Document) Operation(path, method string) *Operation {
+	item, ok := d.Paths[path]
+	if !ok {
+		return nil
+	}
+	switch strings.ToUpper(method) {
+	case "GET":
+		return item.Get
+	case "POST":
+		return item.Post
+	case "PUT":
+		return item.Put
+	case "PATCH":
+		return item.Patch
+	case "DELETE":
+		return item.Delete
+	}
+	return nil
+}
+
+// ValidateRequest validates the path parameters, query parameters and the json body
+// of a request against the operation.
+func (d *Document) ValidateRequest(o *Operation, pathParams map[string]string, query url.Values, body []byte) []Violation {
+	vv := []Violation{}
+
+	for _, p := range o.Parameters {
+		var val string
+		var ok bool
+		switch p.In {
+		case "path":
+			val, ok = pathParams[p.Name]
+		case "query":
+			ok = query.Get(p.Name) != ""
+			val = query.Get(p.Name)
+		default:
+			continue
+		}
+		field := p.In + "." + p.Name
+		if !ok {
+			if p.Required {
+				vv = append(vv, Violation{field, "is required"})
+			}
+			continue
+		}
+		vv = append(vv, d.validateParam(field, p.Schema, val)...)
+	}
+
+	if o.RequestBody == nil {
+		return vv
+	}
+
+	c, ok := o.RequestBody.Content["application/json"]
+	if !ok || c.Schema == nil {
+		return vv
+	}
+
+	if len(bytes.TrimSpace(body)) == 0 {
+		if o.RequestBody.Required {
+			vv = append(vv, Violation{"body", "is required"})
+		}
+		return vv
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return append(vv, Violation{"body", "must be valid json"})
+	}
+
+	return append(vv, d.validate("body", c.Schema, v)...)
+}
+
+// validateParam converts the parameter to the type of the schema before validating it.
+func (d *Document) validateParam(field string, s *Schema, val string) []Violation {
+	s = d.resolve(s)
+	if s == nil {
+		return nil
+	}
+
+	var v interface{} = val
+	switch s.Type {
+	case "integer", "number":
+		if _, err := strconv.ParseFloat(val, 64); err != nil {
+			return []Violation{{field, fmt.Sprintf("must be of type %s", s.Type)}}
+		}
+		v = json.Number(val)
+	case "boolean":
+		b, err := strconv.ParseBool(val)
+		if err != nil {
+			return []Violation{{field, "must be of type boolean"}}
+		}
+		v = b
+	}
+
+	return d.validate(field, s, v)
+}
+
+func (d *Document) resolve(s *Schema) *Schema {
+	if s != nil && s.Ref != "" {
+		return d.Components.Schemas[strings.TrimPrefix(s.Ref, "#/components/schemas/")]
+	}
+	return s
+}
+
+func (d *Document) validate(field string, s *Schema, v interface{}) []Violation {
+	s = d.resolve(s)
+	if s == nil {
+		return nil
+	}
+
+	if v == nil {
+		return []Violation{{field, "must not be null"}}
+	}
+
+	vv := []Violation{}
+
+	switch s.Type {
+	case "object":
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return []Violation{{field, "must be of type object"}}
+		}
+		for _, r := range s.Required {
+			if _, ok := obj[r]; !ok {
+				vv = append(vv, Violation{field + "." + r, "is required"})
+			}
+		}
+		keys := make([]string, 0, len(obj))
+		for k := range obj {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if ps, ok := s.Properties[k]; ok {
+				vv = append(vv, d.validate(field+"."+k, ps, obj[k])...)
+			}
+		}
+
+	case "array":
+		arr, ok := v.([]interface{})
+		if !ok {
+			return []Violation{{field, "must be of type array"}}
+		}
+		if s.MinItems != nil && len(arr) < *s.MinItems {
+			vv = append(vv, Violation{field, fmt.Sprintf("must contain at least %d items", *s.MinItems)})
+		}
+		for i, item := range arr {
+			vv = append(vv, d.validate(fmt.Sprintf("%s[%d]", field, i), s.Items, item)...)
+		}
+
+	case "string":
+		str, ok := v.(string)
+		if !ok {
+			return []Violation{{field, "must be of type string"}}
+		}
+		if s.MinLength != nil && len(str) < *s.MinLength {
+			vv = append(vv, Violation{field, fmt.Sprintf("must be at least %d characters long", *s.MinLength)})
+		}
+		if s.re != nil && !s.re.MatchString(str) {
+			vv = append(vv, Violation{field, fmt.Sprintf("must match pattern %s", s.Pattern)})
+		}
+
+	case "integer", "number":
+		n, ok := v.(json.Number)
+		if !ok {
+			return []Violation{{field, fmt.Sprintf("must be of type %s", s.Type)}}
+		}
+		f, err := n.Float64()
+		if err != nil {
+			return []Violation{{field, fmt.Sprintf("must be of type %s", s.Type)}}
+		}
+		if _, err := n.Int64(); s.Type == "integer" && err != nil {
+			return []Violation{{field, "must be of type integer"}}
+		}
+		if s.Minimum != nil && f < *s.Minimum {
+			vv = append(vv, Violation{field, fmt.Sprintf("must be greater than or equal to %v", *s.Minimum)})
+		}
+
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			return []Violation{{field, "must be of type boolean"}}
+		}
+	}
+
+	if len(s.Enum) > 0 && !inEnum(s.Enum, v) {
+		vv = append(vv, Violation{field, fmt.Sprintf("must be one of %v", s.Enum)})
+	}
+
+	return vv
+}
+
+func inEnum(enum []interface{}, v interface{}) bool {
+	for _, e := range enum {
+		if fmt.Sprint(e) == fmt.Sprint(v) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,136 @@
+package openapi
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/mtekmir/warehouse-service/test"
+)
+
+const doc = `{
+  "openapi": "3.0.3",
+  "paths": {
+    "/items/{id}": {
+      "post": {
+        "parameters": [
+          { "$ref": "#/components/parameters/ID" },
+          { "name": "sort", "in": "query", "schema": { "type": "string", "enum": ["name", "-name"] } },
+          { "name": "limit", "in": "query", "schema": { "type": "integer", "minimum": 0 } },
+          { "name": "all", "in": "query", "schema": { "type": "boolean" } }
+        ],
+        "requestBody": {
+          "required": true,
+          "content": {
+            "application/json": {
+              "schema": {
+                "type": "object",
+                "required": ["items"],
+                "properties": {
+                  "items": { "type": "array", "minItems": 1, "items": { "$ref": "#/components/schemas/Item" } }
+                }
+              }
+            }
+          }
+        }
+      }
+    }
+  },
+  "components": {
+    "parameters": {
+      "ID": { "name": "id", "in": "path", "required": true, "schema": { "type": "integer", "minimum": 1 } }
+    },
+    "schemas": {
+      "Item": {
+        "type": "object",
+        "required": ["name", "qty"],
+        "properties": {
+          "name": { "type": "string", "minLength": 1 },
+          "qty": { "type": "string", "pattern": "^[0-9]+$" },
+          "tags": { "type": "array", "items": { "type": "string" } }
+        }
+      }
+    }
+  }
+}`
+
+func TestValidateRequest(t *testing.T) {
+	d, err := Parse([]byte(doc))
+	if err != nil {
+		t.Fatalf("Unable to parse document. %v", err)
+	}
+
+	o := d.Operation("/items/{id}", "POST")
+	if o == nil {
+		t.Fatal("Expected to find the operation")
+	}
+
+	tests := []struct {
+		name     string
+		params   map[string]string
+		query    string
+		body     string
+		expected []Violation
+	}{
+		{
+			name:     "valid",
+			params:   map[string]string{"id": "1"},
+			query:    "sort=-name&limit=10&all=true",
+			body:     `{"items": [{"name": "leg", "qty": "4", "tags": ["a"]}]}`,
+			expected: []Violation{},
+		},
+		{
+			name:   "invalid params",
+			params: map[string]string{"id": "0"},
+			query:  "sort=price&limit=ten&all=maybe",
+			body:   `{"items": [{"name": "leg", "qty": "4"}]}`,
+			expected: []Violation{
+				{"path.id", "must be greater than or equal to 1"},
+				{"query.sort", "must be one of [name -name]"},
+				{"query.limit", "must be of type integer"},
+				{"query.all", "must be of type boolean"},
+			},
+		},
+		{
+			name:     "missing body",
+			params:   map[string]string{"id": "1"},
+			expected: []Violation{{"body", "is required"}},
+		},
+		{
+			name:     "malformed body",
+			params:   map[string]string{"id": "1"},
+			body:     `{"items": `,
+			expected: []Violation{{"body", "must be valid json"}},
+		},
+		{
+			name:   "invalid body",
+			params: map[string]string{"id": "1"},
+			body:   `{"items": [{"name": "", "qty": 4, "tags": [1]}, {"qty": "x"}]}`,
+			expected: []Violation{
+				{"body.items[0].name", "must be at least 1 characters long"},
+				{"body.items[0].qty", "must be of type string"},
+				{"body.items[0].tags[0]", "must be of type string"},
+				{"body.items[1].name", "is required"},
+				{"body.items[1].qty", "must match pattern ^[0-9]+$"},
+			},
+		},
+		{
+			name:     "empty array",
+			params:   map[string]string{"id": "1"},
+			body:     `{"items": []}`,
+			expected: []Violation{{"body.items", "must contain at least 1 items"}},
+		},
+	}
+
+	for _, tt := range tests {
+		q, _ := url.ParseQuery(tt.query)
+		vv := d.ValidateRequest(o, tt.params, q, []byte(tt.body))
+		test.Compare(t, "violation", tt.expected, vv)
+	}
+}
+
+func TestParse_UnresolvedRef(t *testing.T) {
+	_, err := Parse([]byte(`{"components": {"schemas": {"A": {"type": "array", "items": {"$ref": "#/components/schemas/B"}}}}}`))
+	if err == nil {
+		t.Error("Expected unresolved reference to return an error")
+	}
+}
@@ -0,0 +1,141 @@
+// Package outbox publishes domain events reliably. Events are stored in the outbox
+// table in the transactions of the changes that they describe, so they are stored if
+// and only if the changes are committed. A relay then delivers them to a publisher at
+// least once.
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+// EventID is the ID of an event. Ids increase in the order the events are stored, which
+// isn't necessarily the order their transactions commit in.
+type EventID int
+
+// Types of events.
+const (
+	TypeStockChanged    = "stock.changed"    // Stocks of articles changed.
+	TypeProductRemoved  = "product.removed"  // Units of a product were removed from the stock.
+	TypeImportCompleted = "import.completed" // Articles or products were imported.
+)
+
+// Event is a domain event. Events may be delivered more than once, consumers should
+// deduplicate them by their ids.
+type Event struct {
+	ID        EventID         `json:"id"`
+	Type      string          `json:"type"`
+	Payload   json.RawMessage `json:"payload"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// Payload is the payload of an event of a type.
+type Payload interface {
+	EventType() string
+}
+
+// NewEvent returns an event carrying the JSON encoding of the payload.
+func NewEvent(p Payload) (*Event, error) {
+	b, err := json.Marshal(p)
+	if err != nil {
+		return nil, err
+	}
+	return &Event{Type: p.EventType(), Payload: b}, nil
+}
+
+// Add stores events carrying the payloads in the repo with db. Does nothing if the repo
+// is nil, for services that don't publish events.
+func Add(ctx context.Context, r Repo, db Executor, pp ...Payload) error {
+	if r == nil || len(pp) == 0 {
+		return nil
+	}
+
+	ee := make([]*Event, 0, len(pp))
+	for _, p := range pp {
+		e, err := NewEvent(p)
+		if err != nil {
+			return err
+		}
+		ee = append(ee, e)
+	}
+	return r.Insert(ctx, db, ee)
+}
+
+// Reasons of stock changes.
+const (
+	ReasonImport  = "import"
+	ReasonRemoval = "removal"
+)
+
+// StockChanged is the payload of stock.changed events.
+type StockChanged struct {
+	Reason   string          `json:"reason"`
+	Articles []*ArticleStock `json:"articles"`
+}
+
+// EventType implements Payload.
+func (*StockChanged) EventType() string { return TypeStockChanged }
+
+// ArticleStock is the stock of an article after a change.
+type ArticleStock struct {
+	ArtID string `json:"art_id"`
+	Stock int    `json:"stock"`
+}
+
+// ProductRemoved is the payload of product.removed events.
+type ProductRemoved struct {
+	ProductID    int    `json:"product_id"`
+	Barcode      string `json:"barcode"`
+	Revision     int    `json:"revision"` // Revision of the bill of materials that was consumed.
+	Qty          int    `json:"qty"`
+	AvailableQty int    `json:"available_quantity"` // Available quantity after the removal.
+}
+
+// EventType implements Payload.
+func (*ProductRemoved) EventType() string { return TypeProductRemoved }
+
+// ImportCompleted is the payload of import.completed events.
+type ImportCompleted struct {
+	Kind string `json:"kind"` // articles or products.
+	Rows int    `json:"rows"` // Number of imported rows.
+}
+
+// EventType implements Payload.
+func (*ImportCompleted) EventType() string { return TypeImportCompleted }
+
+// Executor provides an interface for required db methods.
+type Executor interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// Repo provides methods for managing the events of the outbox in a db.
+type Repo interface {
+	// Insert stores the events, it's called with the transaction of the changes.
+	Insert(context.Context, Executor, []*Event) error
+	// Claim leases up to limit of the oldest pending events, which are neither delivered
+	// nor dead-lettered, that aren't leased at now until the given time, so that relays
+	// of other replicas skip them. Events are returned in the order of their ids.
+	Claim(ctx context.Context, db Executor, limit int, now, until time.Time) ([]*Event, error)
+	// MarkDelivered marks the events as delivered at the time.
+	MarkDelivered(ctx context.Context, db Executor, IDs []EventID, at time.Time) error
+	// Release ends the leases of events that couldn't be delivered, recording the reason.
+	// Events that were attempted maxAttempts times are dead-lettered and aren't claimed
+	// anymore, zero doesn't limit the attempts.
+	Release(ctx context.Context, db Executor, IDs []EventID, reason string, maxAttempts int) error
+	// Prune deletes up to limit delivered events that were stored before the given time,
+	// pending ones too if pending is set. Returns the number of deleted events.
+	Prune(ctx context.Context, db Executor, before time.Time, pending bool, limit int) (int, error)
+	// FindAfter returns up to limit events that follow the event with the id after,
+	// whether they are delivered or not. Events are returned in the order they were
+	// committed and only once no event can be committed before them anymore, so that
+	// readers following the returned ids don't miss any. Zero and the ids of pruned
+	// events are followed by all the events.
+	FindAfter(ctx context.Context, db Executor, after EventID, limit int) ([]*Event, error)
+	// LastID returns the id of the latest event FindAfter returns, zero if there are no
+	// events.
+	LastID(ctx context.Context, db Executor) (EventID, error)
+}
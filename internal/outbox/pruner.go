@@ -0,0 +1,75 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/mtekmir/warehouse-service/internal/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	pruneInterval  = 10 * time.Minute // Interval of pruning the outbox.
+	pruneBatchSize = 1000             // Max number of events deleted at once.
+)
+
+// Pruner deletes the events that are older than the retention. Only delivered events
+// are deleted, unless the outbox has no relay and pending is set. Dead-lettered events
+// are kept for inspection.
+type Pruner struct {
+	log       *logrus.Logger
+	db        *sql.DB
+	repo      Repo
+	retention time.Duration
+	pending   bool
+}
+
+// Run prunes the outbox every pruneInterval until ctx is done.
+func (p *Pruner) Run(ctx context.Context) {
+	t := time.NewTicker(pruneInterval)
+	defer t.Stop()
+
+	for {
+		if _, err := p.Prune(ctx); err != nil && ctx.Err() == nil {
+			p.log.Printf("Unable to prune the outbox: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// Prune deletes the events stored before the retention, in batches so that the rows
+// aren't locked for long. Returns the number of deleted events.
+func (p *Pruner) Prune(ctx context.Context) (int, error) {
+	var op errors.Op = "outboxPruner.prune"
+
+	before := time.Now().Add(-p.retention)
+	total := 0
+	for {
+		n, err := p.repo.Prune(ctx, p.db, before, p.pending, pruneBatchSize)
+		if err != nil {
+			return total, errors.E(op, err)
+		}
+		total += n
+		if n < pruneBatchSize {
+			return total, nil
+		}
+	}
+}
+
+// NewPruner creates a pruner that keeps the events for retention. Pending events are
+// pruned too if pending is set, for outboxes that are only read by the event stream.
+func NewPruner(l *logrus.Logger, db *sql.DB, r Repo, retention time.Duration, pending bool) *Pruner {
+	return &Pruner{
+		log:       l,
+		db:        db,
+		repo:      r,
+		retention: retention,
+		pending:   pending,
+	}
+}
@@ -0,0 +1,195 @@
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/mtekmir/warehouse-service/internal/errors"
+)
+
+// encode returns the events as newline delimited JSON. Events that can't be encoded,
+// e.g. with invalid payloads, are left out and returned in a PublishError.
+func encode(ee []*Event) ([]byte, error) {
+	var b bytes.Buffer
+	failed := PublishError{}
+	for _, e := range ee {
+		line, err := json.Marshal(e)
+		if err != nil {
+			failed[e.ID] = err
+			continue
+		}
+		b.Write(line)
+		b.WriteByte('\n')
+	}
+	if len(failed) > 0 {
+		return b.Bytes(), failed
+	}
+	return b.Bytes(), nil
+}
+
+// WriterPublisher writes events to a writer as newline delimited JSON, one event per
+// line. It's safe for concurrent use.
+type WriterPublisher struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// Publish writes the batch with a single write.
+func (p *WriterPublisher) Publish(_ context.Context, ee []*Event) error {
+	b, encErr := encode(ee)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, err := p.w.Write(b); err != nil {
+		return err
+	}
+	return encErr
+}
+
+// NewWriterPublisher returns a publisher writing to w, e.g. os.Stdout.
+func NewWriterPublisher(w io.Writer) *WriterPublisher {
+	return &WriterPublisher{w: w}
+}
+
+// FilePublisher appends events to a file as newline delimited JSON. The file is synced
+// after every batch so that published events survive crashes.
+type FilePublisher struct {
+	WriterPublisher
+	f *os.File
+}
+
+// Publish appends the batch to the file and syncs it.
+func (p *FilePublisher) Publish(ctx context.Context, ee []*Event) error {
+	err := p.WriterPublisher.Publish(ctx, ee)
+	var failed PublishError
+	if err != nil && !errors.As(err, &failed) {
+		return err
+	}
+	if err := p.f.Sync(); err != nil {
+		return err
+	}
+	return err
+}
+
+// Close closes the file.
+func (p *FilePublisher) Close() error {
+	return p.f.Close()
+}
+
+// NewFilePublisher opens the file for appending, creating it if it doesn't exist.
+func NewFilePublisher(name string) (*FilePublisher, error) {
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		return nil, err
+	}
+	return &FilePublisher{WriterPublisher: WriterPublisher{w: f}, f: f}, nil
+}
+
+// HTTPPublisher posts batches of events to an endpoint as newline delimited JSON.
+// Batches that aren't answered with a 2xx status are retried. Batches the endpoint
+// rejects with a 4xx status are posted again event by event, so that the events it
+// rejects don't block the others.
+type HTTPPublisher struct {
+	url    string
+	client *http.Client
+}
+
+// Publish posts the batch to the endpoint.
+func (p *HTTPPublisher) Publish(ctx context.Context, ee []*Event) error {
+	failed := PublishError{}
+	b, err := encode(ee)
+	if errors.As(err, &failed) && len(failed) == len(ee) {
+		return failed
+	}
+
+	err = p.post(ctx, b)
+	var rejected rejectedError
+	if errors.As(err, &rejected) {
+		return p.publishEach(ctx, ee, failed, err)
+	}
+	if err != nil {
+		return err
+	}
+	if len(failed) > 0 {
+		return failed
+	}
+	return nil
+}
+
+// publishEach posts the events of a rejected batch one by one, so that only the events
+// the endpoint rejects fail.
+func (p *HTTPPublisher) publishEach(ctx context.Context, ee []*Event, failed PublishError, rejected error) error {
+	pending := make([]*Event, 0, len(ee))
+	for _, e := range ee {
+		if _, ok := failed[e.ID]; !ok {
+			pending = append(pending, e)
+		}
+	}
+
+	for _, e := range pending {
+		err := rejected
+		if len(pending) > 1 {
+			b, _ := encode([]*Event{e})
+			err = p.post(ctx, b)
+		}
+		var r rejectedError
+		if errors.As(err, &r) {
+			failed[e.ID] = err
+		} else if err != nil {
+			return err
+		}
+	}
+	if len(failed) > 0 {
+		return failed
+	}
+	return nil
+}
+
+// rejectedError is returned when the endpoint rejects the events with a 4xx status,
+// other than the statuses of requests that may succeed when they are retried.
+type rejectedError struct {
+	status string
+}
+
+func (e rejectedError) Error() string {
+	return fmt.Sprintf("endpoint rejected the events with %s", e.status)
+}
+
+// post posts the encoded events to the endpoint.
+func (p *HTTPPublisher) post(ctx context.Context, b []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+
+	res, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, res.Body)
+
+	switch {
+	case res.StatusCode >= 200 && res.StatusCode <= 299:
+	case res.StatusCode >= 400 && res.StatusCode <= 499 &&
+		res.StatusCode != http.StatusRequestTimeout && res.StatusCode != http.StatusTooManyRequests:
+		return rejectedError{status: res.Status}
+	default:
+		return fmt.Errorf("endpoint responded with %s", res.Status)
+	}
+	return nil
+}
+
+// NewHTTPPublisher returns a publisher posting to the url. Requests time out after
+// timeout.
+func NewHTTPPublisher(url string, timeout time.Duration) *HTTPPublisher {
+	return &HTTPPublisher{url: url, client: &http.Client{Timeout: timeout}}
+}
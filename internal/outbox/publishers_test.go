@@ -0,0 +1,150 @@
+package outbox_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mtekmir/warehouse-service/internal/outbox"
+	"github.com/mtekmir/warehouse-service/test"
+)
+
+func events() []*outbox.Event {
+	created := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	return []*outbox.Event{
+		{ID: 1, Type: outbox.TypeStockChanged, Payload: json.RawMessage(`{"reason":"import","articles":[]}`), CreatedAt: created},
+		{ID: 2, Type: outbox.TypeImportCompleted, Payload: json.RawMessage(`{"kind":"articles","rows":2}`), CreatedAt: created},
+	}
+}
+
+// decode returns the events of newline delimited JSON.
+func decode(t *testing.T, r io.Reader) []*outbox.Event {
+	t.Helper()
+	ee := []*outbox.Event{}
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		var e outbox.Event
+		if err := json.Unmarshal(s.Bytes(), &e); err != nil {
+			t.Fatalf("Unable to decode line %q. %v", s.Text(), err)
+		}
+		ee = append(ee, &e)
+	}
+	return ee
+}
+
+func TestWriterPublisher(t *testing.T) {
+	t.Parallel()
+	var b bytes.Buffer
+	p := outbox.NewWriterPublisher(&b)
+
+	if err := p.Publish(context.Background(), events()); err != nil {
+		t.Fatalf("Unable to publish events. %v", err)
+	}
+	test.Compare(t, "events", events(), decode(t, &b))
+}
+
+func TestFilePublisher(t *testing.T) {
+	t.Parallel()
+	name := filepath.Join(t.TempDir(), "events.ndjson")
+
+	// Events are appended to the file across restarts.
+	for i := 0; i < 2; i++ {
+		p, err := outbox.NewFilePublisher(name)
+		if err != nil {
+			t.Fatalf("Unable to open file. %v", err)
+		}
+		if err := p.Publish(context.Background(), events()); err != nil {
+			t.Fatalf("Unable to publish events. %v", err)
+		}
+		if err := p.Close(); err != nil {
+			t.Fatalf("Unable to close file. %v", err)
+		}
+	}
+
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatalf("Unable to open file. %v", err)
+	}
+	defer f.Close()
+	test.Compare(t, "events", append(events(), events()...), decode(t, f))
+}
+
+func TestHTTPPublisher(t *testing.T) {
+	t.Parallel()
+	var received []*outbox.Event
+	status := http.StatusNoContent
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ct := r.Header.Get("Content-Type"); ct != "application/x-ndjson" {
+			t.Errorf("Expected content type application/x-ndjson, got %s", ct)
+		}
+		received = decode(t, r.Body)
+		w.WriteHeader(status)
+	}))
+	defer ts.Close()
+
+	p := outbox.NewHTTPPublisher(ts.URL, time.Second)
+	if err := p.Publish(context.Background(), events()); err != nil {
+		t.Fatalf("Unable to publish events. %v", err)
+	}
+	test.Compare(t, "events", events(), received)
+
+	status = http.StatusServiceUnavailable
+	if err := p.Publish(context.Background(), events()); err == nil {
+		t.Error("Expected an error when the endpoint fails")
+	}
+}
+
+func TestWriterPublisher_InvalidPayload(t *testing.T) {
+	t.Parallel()
+	var b bytes.Buffer
+	p := outbox.NewWriterPublisher(&b)
+	ee := events()
+	ee[0].Payload = json.RawMessage(`{`)
+
+	err := p.Publish(context.Background(), ee)
+	var failed outbox.PublishError
+	if !errors.As(err, &failed) || len(failed) != 1 || failed[1] == nil {
+		t.Fatalf("Expected event 1 to fail, got %v", err)
+	}
+	test.Compare(t, "events", events()[1:], decode(t, &b))
+}
+
+func TestHTTPPublisher_Rejected(t *testing.T) {
+	t.Parallel()
+	var requests int
+	var received []*outbox.Event
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		ee := decode(t, r.Body)
+		for _, e := range ee {
+			if e.ID == 1 {
+				w.WriteHeader(http.StatusUnprocessableEntity)
+				return
+			}
+		}
+		received = append(received, ee...)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+
+	// The batch is posted again event by event, only the rejected event fails.
+	p := outbox.NewHTTPPublisher(ts.URL, time.Second)
+	err := p.Publish(context.Background(), events())
+	var failed outbox.PublishError
+	if !errors.As(err, &failed) || len(failed) != 1 || failed[1] == nil {
+		t.Fatalf("Expected event 1 to fail, got %v", err)
+	}
+	test.Compare(t, "events", events()[1:], received)
+	if requests != 3 {
+		t.Errorf("Expected 3 requests, got %d", requests)
+	}
+}
@@ -0,0 +1,139 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/mtekmir/warehouse-service/internal/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Publisher delivers batches of events to their consumers. A batch is retried as a
+// whole if publishing it fails, publishers that publish some of the events of a batch
+// return a PublishError with the ones that failed.
+type Publisher interface {
+	Publish(ctx context.Context, ee []*Event) error
+}
+
+// PublishError holds the errors of the events of a batch that weren't published. The
+// other events of the batch were published.
+type PublishError map[EventID]error
+
+func (e PublishError) Error() string {
+	return fmt.Sprintf("%d events of the batch weren't published", len(e))
+}
+
+// lease is how long claimed events are skipped by other relays. Events of a relay that
+// stops before delivering them are delivered by another relay when the lease ends.
+const lease = time.Minute
+
+// Relay delivers the events of the outbox to a publisher. Events are marked delivered
+// after they are published, so they are published again if the relay stops or marking
+// them fails in between. Events that fail on their own are dead-lettered after
+// maxAttempts attempts, failures of whole batches, e.g. while the consumers are down,
+// don't dead-letter them.
+type Relay struct {
+	log         *logrus.Logger
+	db          *sql.DB
+	repo        Repo
+	pub         Publisher
+	interval    time.Duration
+	batchSize   int
+	maxAttempts int
+}
+
+// Run delivers the pending events every interval until ctx is done. Batches are
+// delivered back to back while there are more pending events.
+func (r *Relay) Run(ctx context.Context) {
+	t := time.NewTicker(r.interval)
+	defer t.Stop()
+
+	for {
+		for {
+			n, err := r.Deliver(ctx)
+			if err != nil {
+				if ctx.Err() == nil {
+					r.log.Printf("Unable to deliver events: %v", err)
+				}
+				break
+			}
+			if n < r.batchSize {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// Deliver publishes a batch of pending events and marks the published ones delivered.
+// Returns the number of delivered events.
+func (r *Relay) Deliver(ctx context.Context) (int, error) {
+	var op errors.Op = "outboxRelay.deliver"
+
+	now := time.Now()
+	ee, err := r.repo.Claim(ctx, r.db, r.batchSize, now, now.Add(lease))
+	if err != nil {
+		return 0, errors.E(op, err)
+	}
+	if len(ee) == 0 {
+		return 0, nil
+	}
+
+	// The events are claimed again once released, or when the lease ends if releasing
+	// them fails too.
+	release := func(IDs []EventID, reason string, maxAttempts int) {
+		if err := r.repo.Release(context.WithoutCancel(ctx), r.db, IDs, reason, maxAttempts); err != nil {
+			r.log.Printf("Unable to release events %d to %d: %v", IDs[0], IDs[len(IDs)-1], err)
+		}
+	}
+
+	var failed PublishError
+	if err := r.pub.Publish(ctx, ee); err != nil && !errors.As(err, &failed) {
+		IDs := make([]EventID, 0, len(ee))
+		for _, e := range ee {
+			IDs = append(IDs, e.ID)
+		}
+		release(IDs, err.Error(), 0)
+		return 0, errors.E(op, err)
+	}
+
+	IDs := make([]EventID, 0, len(ee))
+	for _, e := range ee {
+		if err, ok := failed[e.ID]; ok {
+			r.log.Printf("Unable to publish event %d: %v", e.ID, err)
+			release([]EventID{e.ID}, err.Error(), r.maxAttempts)
+			continue
+		}
+		IDs = append(IDs, e.ID)
+	}
+	if len(IDs) == 0 {
+		return 0, nil
+	}
+
+	if err := r.repo.MarkDelivered(context.WithoutCancel(ctx), r.db, IDs, time.Now()); err != nil {
+		return 0, errors.E(op, err)
+	}
+
+	return len(IDs), nil
+}
+
+// NewRelay creates a relay that delivers up to batchSize events at once. Zero
+// maxAttempts retries events without limit.
+func NewRelay(l *logrus.Logger, db *sql.DB, r Repo, p Publisher, interval time.Duration, batchSize, maxAttempts int) *Relay {
+	return &Relay{
+		log:         l,
+		db:          db,
+		repo:        r,
+		pub:         p,
+		interval:    interval,
+		batchSize:   batchSize,
+		maxAttempts: maxAttempts,
+	}
+}
@@ -0,0 +1,139 @@
+package outbox_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mtekmir/warehouse-service/internal/memory"
+	"github.com/mtekmir/warehouse-service/internal/outbox"
+	"github.com/mtekmir/warehouse-service/test"
+	"github.com/sirupsen/logrus"
+)
+
+// publisher records the ids of the published events. It fails while err is set, and
+// always fails the rejected events.
+type publisher struct {
+	mu       sync.Mutex
+	IDs      []outbox.EventID
+	err      error
+	rejected map[outbox.EventID]bool
+}
+
+func (p *publisher) Publish(_ context.Context, ee []*outbox.Event) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.err != nil {
+		return p.err
+	}
+	failed := outbox.PublishError{}
+	for _, e := range ee {
+		if p.rejected[e.ID] {
+			failed[e.ID] = fmt.Errorf("event %d is rejected", e.ID)
+			continue
+		}
+		p.IDs = append(p.IDs, e.ID)
+	}
+	if len(failed) > 0 {
+		return failed
+	}
+	return nil
+}
+
+func (p *publisher) published() []outbox.EventID {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]outbox.EventID{}, p.IDs...)
+}
+
+func setupRelay(t *testing.T, n int, p outbox.Publisher, interval time.Duration) *outbox.Relay {
+	t.Helper()
+	s := memory.NewStore()
+	db := memory.NewDB(s)
+	t.Cleanup(func() { db.Close() })
+	r := memory.NewOutboxRepo(s)
+
+	pp := make([]outbox.Payload, 0, n)
+	for i := 0; i < n; i++ {
+		pp = append(pp, &outbox.ImportCompleted{Kind: "articles", Rows: i})
+	}
+	if err := outbox.Add(context.Background(), r, db, pp...); err != nil {
+		t.Fatalf("Unable to add events. %v", err)
+	}
+	return outbox.NewRelay(logrus.New(), db, r, p, interval, 2, 2)
+}
+
+func TestRelayDeliver(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	p := &publisher{err: fmt.Errorf("endpoint is down")}
+	r := setupRelay(t, 3, p, time.Hour)
+
+	if _, err := r.Deliver(ctx); err == nil {
+		t.Fatal("Expected an error when publishing fails")
+	}
+
+	// Events that failed are released and delivered again.
+	p.err = nil
+	for _, expected := range []int{2, 1, 0} {
+		n, err := r.Deliver(ctx)
+		if err != nil {
+			t.Fatalf("Unable to deliver events. %v", err)
+		}
+		if n != expected {
+			t.Errorf("Expected %d events to be delivered, got %d", expected, n)
+		}
+	}
+	test.Compare(t, "published", []outbox.EventID{1, 2, 3}, p.published())
+}
+
+func TestRelayDeliver_DeadLetters(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	p := &publisher{err: fmt.Errorf("endpoint is down"), rejected: map[outbox.EventID]bool{1: true}}
+	r := setupRelay(t, 3, p, time.Hour)
+
+	// Failures of whole batches don't count towards the attempts.
+	for i := 0; i < 3; i++ {
+		if _, err := r.Deliver(ctx); err == nil {
+			t.Fatal("Expected an error when publishing fails")
+		}
+	}
+
+	// The rejected event doesn't block the others, and is dead-lettered after 2 attempts.
+	p.err = nil
+	for _, expected := range []int{1, 1, 0} {
+		n, err := r.Deliver(ctx)
+		if err != nil {
+			t.Fatalf("Unable to deliver events. %v", err)
+		}
+		if n != expected {
+			t.Errorf("Expected %d events to be delivered, got %d", expected, n)
+		}
+	}
+	test.Compare(t, "published", []outbox.EventID{2, 3}, p.published())
+}
+
+func TestRelayRun(t *testing.T) {
+	t.Parallel()
+	p := &publisher{}
+	// Pending batches are delivered back to back without waiting for the interval.
+	r := setupRelay(t, 5, p, time.Hour)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		r.Run(ctx)
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(p.published()) < 5 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	<-done
+	test.Compare(t, "published", []outbox.EventID{1, 2, 3, 4, 5}, p.published())
+}
@@ -2,25 +2,30 @@ package postgres
 
 import (
 	"context"
+	"database/sql"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/mtekmir/warehouse-service/internal/article"
 	"github.com/mtekmir/warehouse-service/internal/errors"
+	"github.com/mtekmir/warehouse-service/internal/tracing"
 )
 
 type articleRepo struct{}
 
 // Imports articles to db. Create and update operations run on separate goroutines.
-func (r articleRepo) Import(ctx context.Context, db article.Executor, aa []*article.Article) ([]*article.Article, error) {
+func (r articleRepo) Import(ctx context.Context, db article.Executor, aa []*article.Article) (_ []*article.Article, err error) {
 	var op errors.Op = "articleRepo.import"
+	ctx, db, span := traceOp(ctx, db, op)
+	defer func() { tracing.End(span, err) }()
 
 	// Handle duplicates
 	order := make([]article.ArtID, 0, len(aa))
 	rowMap := make(map[article.ArtID][]*article.Article)
 	for _, art := range aa {
 		if existing, ok := rowMap[art.ArtID]; ok {
-			existing = append(existing, art)
+			rowMap[art.ArtID] = append(existing, art)
 			continue
 		}
 		order = append(order, art.ArtID)
@@ -45,7 +50,7 @@ func (r articleRepo) Import(ctx context.Context, db article.Executor, aa []*arti
 	}
 	existing, err := r.FindAll(ctx, db, &artIDs)
 	if err != nil {
-		return nil, errors.E(op, err)
+		return nil, dbError(op, err)
 	}
 
 	existingM := make(map[article.ArtID]*article.Article, len(existing))
@@ -118,14 +123,14 @@ func (r articleRepo) Import(ctx context.Context, db article.Executor, aa []*arti
 			return nil, errors.E(op, ctx.Err())
 		case res := <-createdC:
 			if res.Err != nil {
-				return nil, errors.E(op, res.Err)
+				return nil, dbError(op, res.Err)
 			}
 			if res.Arts != nil {
 				results = append(results, res.Arts...)
 			}
 		case res := <-updatedC:
 			if res.Err != nil {
-				return nil, errors.E(op, res.Err)
+				return nil, dbError(op, res.Err)
 			}
 			if res.Arts != nil {
 				results = append(results, res.Arts...)
@@ -137,8 +142,10 @@ func (r articleRepo) Import(ctx context.Context, db article.Executor, aa []*arti
 }
 
 // BatchInsert inserts an article slice into db. Does not handle duplicates.
-func (articleRepo) BatchInsert(ctx context.Context, db article.Executor, arts []*article.Article) ([]*article.Article, error) {
+func (articleRepo) BatchInsert(ctx context.Context, db article.Executor, arts []*article.Article) (_ []*article.Article, err error) {
 	var op errors.Op = "articleRepo.batchInsert"
+	ctx, db, span := traceOp(ctx, db, op)
+	defer func() { tracing.End(span, err) }()
 
 	values := make([]interface{}, 0, len(arts))
 	pHolders := make([]string, 0, len(arts))
@@ -155,7 +162,7 @@ func (articleRepo) BatchInsert(ctx context.Context, db article.Executor, arts []
 
 	rows, err := db.QueryContext(ctx, stmt, values...)
 	if err != nil {
-		return nil, errors.E(op, err)
+		return nil, dbError(op, err)
 	}
 	defer rows.Close()
 
@@ -164,7 +171,7 @@ func (articleRepo) BatchInsert(ctx context.Context, db article.Executor, arts []
 	for rows.Next() {
 		var art article.Article
 		if err := rows.Scan(&art.ID, &art.ArtID, &art.Name, &art.Stock); err != nil {
-			return nil, errors.E(op, err)
+			return nil, dbError(op, err)
 		}
 		inserted = append(inserted, &art)
 	}
@@ -173,8 +180,10 @@ func (articleRepo) BatchInsert(ctx context.Context, db article.Executor, arts []
 }
 
 // AdjustQuantities is for updating quantities of articles.
-func (articleRepo) AdjustQuantities(ctx context.Context, db article.Executor, t article.QtyAdjustmentKind, changes []*article.QtyAdjustment) error {
+func (articleRepo) AdjustQuantities(ctx context.Context, db article.Executor, t article.QtyAdjustmentKind, changes []*article.QtyAdjustment) (err error) {
 	var op errors.Op = "articleRepo.adjustQuantities"
+	ctx, db, span := traceOp(ctx, db, op)
+	defer func() { tracing.End(span, err) }()
 
 	pHolders := make([]string, 0, len(changes))
 	values := make([]interface{}, 0, len(changes)*2)
@@ -199,11 +208,11 @@ func (articleRepo) AdjustQuantities(ctx context.Context, db article.Executor, t
 
 	res, err := db.ExecContext(ctx, stmt, values...)
 	if err != nil {
-		return errors.E(op, err)
+		return dbError(op, err)
 	}
 	count, err := res.RowsAffected()
 	if err != nil {
-		return errors.E(op, err)
+		return dbError(op, err)
 	}
 	if int(count) != len(changes) {
 		return errors.E(op, "Updated rows don't match with articles length")
@@ -211,8 +220,10 @@ func (articleRepo) AdjustQuantities(ctx context.Context, db article.Executor, t
 	return nil
 }
 
-func (articleRepo) FindAll(ctx context.Context, db article.Executor, bb *[]article.ArtID) ([]*article.Article, error) {
+func (articleRepo) FindAll(ctx context.Context, db article.Executor, bb *[]article.ArtID) (_ []*article.Article, err error) {
 	var op errors.Op = "articleRepo.findAll"
+	ctx, db, span := traceOp(ctx, db, op)
+	defer func() { tracing.End(span, err) }()
 
 	var artIDQuery string
 	var values []interface{}
@@ -234,7 +245,7 @@ func (articleRepo) FindAll(ctx context.Context, db article.Executor, bb *[]artic
 
 	rows, err := db.QueryContext(ctx, stmt, values...)
 	if err != nil {
-		return nil, errors.E(op, err)
+		return nil, dbError(op, err)
 	}
 	defer rows.Close()
 
@@ -244,7 +255,7 @@ func (articleRepo) FindAll(ctx context.Context, db article.Executor, bb *[]artic
 		var art article.Article
 
 		if err := rows.Scan(&art.ID, &art.Name, &art.ArtID, &art.Stock); err != nil {
-			return nil, errors.E(op, err)
+			return nil, dbError(op, err)
 		}
 		articles = append(articles, &art)
 	}
@@ -252,6 +263,116 @@ func (articleRepo) FindAll(ctx context.Context, db article.Executor, bb *[]artic
 	return articles, nil
 }
 
+// InsertLots adds the quantities of the lots to the existing lots with the same numbers
+// or inserts them.
+func (articleRepo) InsertLots(ctx context.Context, db article.Executor, lots []*article.Lot) (err error) {
+	var op errors.Op = "articleRepo.insertLots"
+	ctx, db, span := traceOp(ctx, db, op)
+	defer func() { tracing.End(span, err) }()
+
+	values := make([]interface{}, 0, len(lots)*5)
+	pHolders := make([]string, 0, len(lots))
+	for i, l := range lots {
+		pHolders = append(pHolders, fmt.Sprintf("($%d, $%d, $%d, $%d, $%d)", i*5+1, i*5+2, i*5+3, i*5+4, i*5+5))
+		values = append(values, l.ArticleID, l.Number, l.ReceivedAt, l.ExpiresAt, l.Qty)
+	}
+
+	stmt := fmt.Sprintf(`
+		INSERT INTO lots(article_id, number, received_at, expires_at, qty) VALUES %s
+		ON CONFLICT (article_id, number) DO UPDATE SET qty = lots.qty + excluded.qty
+	`, strings.Join(pHolders, ", "))
+
+	if _, err := db.ExecContext(ctx, stmt, values...); err != nil {
+		return dbError(op, err)
+	}
+	return nil
+}
+
+// ConsumeLots subtracts the quantities from the lots that aren't expired at the time,
+// first expired first out, and deletes the emptied lots. Every lot gives the part of the
+// quantity that the lots before it don't cover.
+func (articleRepo) ConsumeLots(ctx context.Context, db article.Executor, changes []*article.QtyAdjustment, at time.Time) (err error) {
+	var op errors.Op = "articleRepo.consumeLots"
+	ctx, db, span := traceOp(ctx, db, op)
+	defer func() { tracing.End(span, err) }()
+
+	values := []interface{}{at}
+	pHolders := make([]string, 0, len(changes))
+	for _, c := range changes {
+		values = append(values, c.ID, c.Qty)
+		pHolders = append(pHolders, fmt.Sprintf("($%d::bigint, $%d::int)", len(values)-1, len(values)))
+	}
+
+	stmt := fmt.Sprintf(`
+		WITH c(article_id, q) AS (VALUES %s),
+		l AS (
+			SELECT l.id, c.q, SUM(l.qty) OVER (
+				PARTITION BY l.article_id ORDER BY l.expires_at NULLS LAST, l.received_at, l.id
+			) - l.qty AS ahead
+			FROM lots l
+			JOIN c ON c.article_id = l.article_id
+			WHERE l.expires_at IS NULL OR l.expires_at > $1
+		)
+		UPDATE lots SET qty = lots.qty - LEAST(lots.qty, l.q - l.ahead)
+		FROM l
+		WHERE lots.id = l.id AND l.ahead < l.q
+	`, strings.Join(pHolders, ", "))
+
+	if _, err := db.ExecContext(ctx, stmt, values...); err != nil {
+		return dbError(op, err)
+	}
+
+	// Only the lots of the changed articles, so that other articles aren't locked.
+	IDs := make([]interface{}, 0, len(changes))
+	pHolders = make([]string, 0, len(changes))
+	for _, c := range changes {
+		IDs = append(IDs, c.ID)
+		pHolders = append(pHolders, fmt.Sprintf("$%d", len(IDs)))
+	}
+	stmt = fmt.Sprintf("DELETE FROM lots WHERE article_id IN (%s) AND qty <= 0", strings.Join(pHolders, ","))
+	if _, err := db.ExecContext(ctx, stmt, IDs...); err != nil {
+		return dbError(op, err)
+	}
+	return nil
+}
+
+// FindLots returns the lots expiring at or before the time, soonest first.
+func (articleRepo) FindLots(ctx context.Context, db article.Executor, before time.Time) (_ []*article.Lot, err error) {
+	var op errors.Op = "articleRepo.findLots"
+	ctx, db, span := traceOp(ctx, db, op)
+	defer func() { tracing.End(span, err) }()
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT l.id, l.article_id, a.art_id, l.number, l.received_at, l.expires_at, l.qty
+		FROM lots l
+		JOIN articles a ON a.id = l.article_id
+		WHERE l.expires_at <= $1
+		ORDER BY l.expires_at, a.art_id, l.number
+	`, before)
+	if err != nil {
+		return nil, dbError(op, err)
+	}
+	defer rows.Close()
+
+	lots := []*article.Lot{}
+	for rows.Next() {
+		var l article.Lot
+		var expiresAt sql.NullTime
+		if err := rows.Scan(&l.ID, &l.ArticleID, &l.ArtID, &l.Number, &l.ReceivedAt, &expiresAt, &l.Qty); err != nil {
+			return nil, dbError(op, err)
+		}
+		if expiresAt.Valid {
+			l.ExpiresAt = &expiresAt.Time
+		}
+		lots = append(lots, &l)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, dbError(op, err)
+	}
+
+	return lots, nil
+}
+
 // NewArticleRepo returns a postgres repo for articles.
 func NewArticleRepo() article.Repo {
 	return articleRepo{}
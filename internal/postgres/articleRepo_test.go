@@ -3,6 +3,7 @@ package postgres_test
 import (
 	"context"
 	"fmt"
+	"sort"
 	"testing"
 
 	"github.com/mtekmir/warehouse-service/internal/article"
@@ -223,6 +224,48 @@ func TestImportArticles_WithExisting(t *testing.T) {
 	test.Compare(t, "article", expectedArts, found)
 }
 
+func TestImportArticles_WithDuplicates(t *testing.T) {
+	db, dbTidy := test.SetupTX(t)
+	defer dbTidy()
+
+	test.CreateArticleTable(t, db)
+	r := postgres.NewArticleRepo()
+	ctx := context.Background()
+
+	if _, err := r.Import(ctx, db, createArticles(1)); err != nil {
+		t.Errorf("Unable to import articles. %v", err)
+	}
+
+	// Stocks of every duplicate are summed, for existing and new articles.
+	aa := []*article.Article{
+		{Name: "Name_1", ArtID: "ArtID_1", Stock: 1},
+		{Name: "Name_2", ArtID: "ArtID_2", Stock: 2},
+		{Name: "Name_1", ArtID: "ArtID_1", Stock: 3},
+		{Name: "Name_2", ArtID: "ArtID_2", Stock: 4},
+		{Name: "Name_1", ArtID: "ArtID_1", Stock: 5},
+	}
+	imported, err := r.Import(ctx, db, aa)
+	if err != nil {
+		t.Errorf("Unable to import articles. %v", err)
+	}
+
+	expectedArts := []*article.Article{
+		{ID: 1, Name: "Name_1", ArtID: "ArtID_1", Stock: 10},
+		{ID: 2, Name: "Name_2", ArtID: "ArtID_2", Stock: 6},
+	}
+
+	// Created and updated articles are returned in the order their queries finish.
+	sort.Slice(imported, func(i, j int) bool { return imported[i].ID < imported[j].ID })
+	test.Compare(t, "article", expectedArts, imported)
+
+	found, err := r.FindAll(ctx, db, nil)
+	if err != nil {
+		t.Errorf("Unable to find articles. %v", err)
+	}
+
+	test.Compare(t, "article", expectedArts, found)
+}
+
 func createArticles(n int) []*article.Article {
 	aa := make([]*article.Article, 0, n)
 	for i := 0; i < n; i++ {
@@ -0,0 +1,110 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/mtekmir/warehouse-service/internal/audit"
+	"github.com/mtekmir/warehouse-service/internal/errors"
+	"github.com/mtekmir/warehouse-service/internal/tracing"
+)
+
+type auditRepo struct{}
+
+const auditEventColumns = "id, actor, action, targets, payload_digest, result, request_id, created_at"
+
+func scanAuditEvent(row scanner) (*audit.Event, error) {
+	var e audit.Event
+	var targets string
+	if err := row.Scan(&e.ID, &e.Actor, &e.Action, &targets, &e.PayloadDigest, &e.Result, &e.RequestID, &e.CreatedAt); err != nil {
+		return nil, err
+	}
+	e.Targets = audit.SplitTargets(targets)
+	return &e, nil
+}
+
+// Insert inserts an audit event into db.
+func (auditRepo) Insert(ctx context.Context, db audit.Executor, e *audit.Event) (_ *audit.Event, err error) {
+	var op errors.Op = "auditRepo.insert"
+	ctx, db, span := traceOp(ctx, db, op)
+	defer func() { tracing.End(span, err) }()
+
+	row := db.QueryRowContext(ctx, `
+		INSERT INTO audit_events (actor, action, targets, payload_digest, result, request_id, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING `+auditEventColumns,
+		e.Actor, e.Action, audit.JoinTargets(e.Targets), e.PayloadDigest, e.Result, e.RequestID, e.CreatedAt,
+	)
+
+	inserted, err := scanAuditEvent(row)
+	if err != nil {
+		return nil, dbError(op, err)
+	}
+
+	return inserted, nil
+}
+
+// FindAll returns the audit events matching the filters, newest first.
+func (auditRepo) FindAll(ctx context.Context, db audit.Executor, ff *audit.Filters) (_ []*audit.Event, err error) {
+	var op errors.Op = "auditRepo.findAll"
+	ctx, db, span := traceOp(ctx, db, op)
+	defer func() { tracing.End(span, err) }()
+
+	where, args := []string{}, []interface{}{}
+	add := func(cond string, arg interface{}) {
+		args = append(args, arg)
+		where = append(where, fmt.Sprintf(cond, len(args)))
+	}
+	if ff.Actor != "" {
+		add("actor = $%d", ff.Actor)
+	}
+	if ff.Action != "" {
+		add("action = $%d", ff.Action)
+	}
+	if ff.Target != "" {
+		add("$%d = ANY(string_to_array(targets, ' '))", ff.Target)
+	}
+	if ff.From != nil {
+		add("created_at >= $%d", *ff.From)
+	}
+	if ff.To != nil {
+		add("created_at < $%d", *ff.To)
+	}
+
+	query := `SELECT ` + auditEventColumns + ` FROM audit_events`
+	if len(where) > 0 {
+		query += ` WHERE ` + strings.Join(where, " AND ")
+	}
+	query += ` ORDER BY created_at DESC, id DESC`
+	if ff.Limit > 0 {
+		args = append(args, ff.Limit)
+		query += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+	if ff.Offset > 0 {
+		args = append(args, ff.Offset)
+		query += fmt.Sprintf(" OFFSET $%d", len(args))
+	}
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, dbError(op, err)
+	}
+	defer rows.Close()
+
+	ee := []*audit.Event{}
+	for rows.Next() {
+		e, err := scanAuditEvent(rows)
+		if err != nil {
+			return nil, dbError(op, err)
+		}
+		ee = append(ee, e)
+	}
+
+	return ee, nil
+}
+
+// NewAuditRepo returns a postgres repo for audit events.
+func NewAuditRepo() audit.Repo {
+	return auditRepo{}
+}
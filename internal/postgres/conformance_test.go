@@ -0,0 +1,26 @@
+package postgres_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mtekmir/warehouse-service/internal/postgres"
+	"github.com/mtekmir/warehouse-service/test"
+	"github.com/mtekmir/warehouse-service/test/repotest"
+	"github.com/sirupsen/logrus"
+)
+
+func TestConformance(t *testing.T) {
+	repotest.Run(t, func(t *testing.T) *repotest.Backend {
+		db, dbTidy := test.SetupDB(t)
+		t.Cleanup(dbTidy)
+
+		if err := postgres.Migrate(logrus.New(), db, postgres.Migrations("")); err != nil {
+			t.Fatalf("Unable to migrate. %v", err)
+		}
+		return &repotest.Backend{
+			DB: db, Articles: postgres.NewArticleRepo(), Products: postgres.NewProductRepo(), Audit: postgres.NewAuditRepo(), Outbox: postgres.NewOutboxRepo(),
+			Inventory: func(ctx context.Context) (int, int, error) { return postgres.InventoryStats(ctx, db) },
+		}
+	})
+}
@@ -0,0 +1,123 @@
+package postgres
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+
+	"github.com/jackc/pgconn"
+	"github.com/mtekmir/warehouse-service/internal/errors"
+)
+
+// Codes of the postgres errors that are translated.
+// https://www.postgresql.org/docs/current/errcodes-appendix.html
+const (
+	codeUniqueViolation     = "23505"
+	codeForeignKeyViolation = "23503"
+	codeCheckViolation      = "23514"
+	codeNotNullViolation    = "23502"
+	codeInvalidText         = "22P02"
+	codeOutOfRange          = "22003"
+	codeStringTooLong       = "22001"
+	codeSerialization       = "40001"
+	codeDeadlock            = "40P01"
+	codeTooManyConnections  = "53300"
+)
+
+// entities names the rows of the tables in messages.
+var entities = map[string]string{
+	"articles":         "Article",
+	"products":         "Product",
+	"product_articles": "Product article",
+	"api_keys":         "Api key",
+	"lots":             "Lot",
+	"removals":         "Removal",
+	"audit_events":     "Audit event",
+	"outbox":           "Outbox event",
+}
+
+// Details of key violations, e.g. `Key (art_id)=(1) already exists.` and
+// `Key (article_id)=(5) is not present in table "articles".`
+var (
+	keyExists     = regexp.MustCompile(`^Key \((.+)\)=\((.*)\) already exists\.$`)
+	keyNotPresent = regexp.MustCompile(`^Key \((.+)\)=\((.*)\) is not present in table "(.+)"\.$`)
+	keyReferenced = regexp.MustCompile(`^Key \((.+)\)=\((.*)\) is still referenced from table "(.+)"\.$`)
+)
+
+// dbError wraps an error of the db into a domain error. Constraint violations become
+// Duplicate or Invalid errors with messages for the client and connection failures
+// become Unavailable errors. Other errors are wrapped as they are.
+func dbError(op errors.Op, err error) error {
+	// Errors of nested repo calls are already translated.
+	var e *errors.Error
+	if errors.As(err, &e) {
+		return errors.E(op, err)
+	}
+
+	var pe *pgconn.PgError
+	if !errors.As(err, &pe) {
+		if unavailable(err) {
+			return errors.E(op, errors.Unavailable, "Database is unavailable", err)
+		}
+		return errors.E(op, err)
+	}
+
+	switch {
+	case pe.Code == codeUniqueViolation:
+		return errors.E(op, errors.Duplicate, duplicateMessage(pe), err)
+	case pe.Code == codeForeignKeyViolation:
+		return errors.E(op, errors.Invalid, foreignKeyMessage(pe), err)
+	case pe.Code == codeCheckViolation:
+		return errors.E(op, errors.Invalid, fmt.Sprintf("%s violates the %s constraint", entity(pe.TableName), pe.ConstraintName), err)
+	case pe.Code == codeNotNullViolation:
+		return errors.E(op, errors.Invalid, fmt.Sprintf("%s %s must not be empty", entity(pe.TableName), pe.ColumnName), err)
+	case pe.Code == codeInvalidText, pe.Code == codeOutOfRange, pe.Code == codeStringTooLong:
+		return errors.E(op, errors.Invalid, "Invalid value, "+pe.Message, err)
+	case pe.Code == codeSerialization, pe.Code == codeDeadlock:
+		return errors.E(op, errors.Unavailable, "Conflicting with a concurrent update, try again", err)
+	// Class 08 is connection exceptions and 57P01-57P03 are shutdowns and restarts.
+	case strings.HasPrefix(pe.Code, "08"), strings.HasPrefix(pe.Code, "57P"), pe.Code == codeTooManyConnections:
+		return errors.E(op, errors.Unavailable, "Database is unavailable", err)
+	default:
+		return errors.E(op, err)
+	}
+}
+
+// unavailable reports whether err is a failure to reach the db.
+func unavailable(err error) bool {
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, sql.ErrConnDone) {
+		return true
+	}
+	var ne net.Error
+	return errors.As(err, &ne)
+}
+
+func duplicateMessage(pe *pgconn.PgError) string {
+	name := entity(pe.TableName)
+	m := keyExists.FindStringSubmatch(pe.Detail)
+	// Api keys are identified by their hashes, which aren't shown.
+	if m == nil || pe.TableName == "api_keys" {
+		return name + " already exists"
+	}
+	return fmt.Sprintf("%s %s already exists", name, m[2])
+}
+
+func foreignKeyMessage(pe *pgconn.PgError) string {
+	if m := keyNotPresent.FindStringSubmatch(pe.Detail); m != nil {
+		return fmt.Sprintf("%s %s doesn't exist", entity(m[3]), m[2])
+	}
+	if m := keyReferenced.FindStringSubmatch(pe.Detail); m != nil {
+		return fmt.Sprintf("%s %s is still used by %s", entity(pe.TableName), m[2], strings.ToLower(entity(m[3]))+"s")
+	}
+	return fmt.Sprintf("%s refers to a row that doesn't exist", entity(pe.TableName))
+}
+
+func entity(table string) string {
+	if name, ok := entities[table]; ok {
+		return name
+	}
+	return "Row"
+}
@@ -0,0 +1,155 @@
+package postgres
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/jackc/pgconn"
+	"github.com/mtekmir/warehouse-service/internal/errors"
+)
+
+func TestDBError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		kind errors.Kind
+		msg  string
+	}{
+		{
+			name: "duplicate article",
+			err:  &pgconn.PgError{Code: "23505", TableName: "articles", ConstraintName: "articles_art_id_key", Detail: "Key (art_id)=(1) already exists."},
+			kind: errors.Duplicate,
+			msg:  "Article 1 already exists",
+		},
+		{
+			name: "duplicate product",
+			err:  &pgconn.PgError{Code: "23505", TableName: "products", ConstraintName: "products_barcode_key", Detail: "Key (barcode)=(b1) already exists."},
+			kind: errors.Duplicate,
+			msg:  "Product b1 already exists",
+		},
+		{
+			name: "duplicate api key hides the hash",
+			err:  &pgconn.PgError{Code: "23505", TableName: "api_keys", Detail: "Key (key_hash)=(abc) already exists."},
+			kind: errors.Duplicate,
+			msg:  "Api key already exists",
+		},
+		{
+			name: "missing article",
+			err:  &pgconn.PgError{Code: "23503", TableName: "product_articles", Detail: `Key (article_id)=(5) is not present in table "articles".`},
+			kind: errors.Invalid,
+			msg:  "Article 5 doesn't exist",
+		},
+		{
+			name: "referenced product",
+			err:  &pgconn.PgError{Code: "23503", TableName: "products", Detail: `Key (id)=(1) is still referenced from table "product_articles".`},
+			kind: errors.Invalid,
+			msg:  "Product 1 is still used by product articles",
+		},
+		{
+			name: "duplicate lot",
+			err:  &pgconn.PgError{Code: "23505", TableName: "lots", ConstraintName: "lots_article_id_number_key", Detail: "Key (article_id, number)=(1, L1) already exists."},
+			kind: errors.Duplicate,
+			msg:  "Lot 1, L1 already exists",
+		},
+		{
+			name: "article referenced by lots",
+			err:  &pgconn.PgError{Code: "23503", TableName: "articles", Detail: `Key (id)=(1) is still referenced from table "lots".`},
+			kind: errors.Invalid,
+			msg:  "Article 1 is still used by lots",
+		},
+		{
+			name: "removal not null violation",
+			err:  &pgconn.PgError{Code: "23502", TableName: "removals", ColumnName: "revision"},
+			kind: errors.Invalid,
+			msg:  "Removal revision must not be empty",
+		},
+		{
+			name: "audit event not null violation",
+			err:  &pgconn.PgError{Code: "23502", TableName: "audit_events", ColumnName: "action"},
+			kind: errors.Invalid,
+			msg:  "Audit event action must not be empty",
+		},
+		{
+			name: "outbox check violation",
+			err:  &pgconn.PgError{Code: "23514", TableName: "outbox", ConstraintName: "outbox_attempts_check"},
+			kind: errors.Invalid,
+			msg:  "Outbox event violates the outbox_attempts_check constraint",
+		},
+		{
+			name: "check violation",
+			err:  &pgconn.PgError{Code: "23514", TableName: "articles", ConstraintName: "articles_stock_check"},
+			kind: errors.Invalid,
+			msg:  "Article violates the articles_stock_check constraint",
+		},
+		{
+			name: "not null violation",
+			err:  &pgconn.PgError{Code: "23502", TableName: "products", ColumnName: "name"},
+			kind: errors.Invalid,
+			msg:  "Product name must not be empty",
+		},
+		{
+			name: "out of range",
+			err:  &pgconn.PgError{Code: "22003", Message: `value "9999999999" is out of range for type integer`},
+			kind: errors.Invalid,
+			msg:  `Invalid value, value "9999999999" is out of range for type integer`,
+		},
+		{
+			name: "deadlock",
+			err:  &pgconn.PgError{Code: "40P01"},
+			kind: errors.Unavailable,
+			msg:  "Conflicting with a concurrent update, try again",
+		},
+		{
+			name: "shutdown",
+			err:  &pgconn.PgError{Code: "57P01"},
+			kind: errors.Unavailable,
+			msg:  "Database is unavailable",
+		},
+		{
+			name: "dial",
+			err:  fmt.Errorf("failed to connect: %w", &net.OpError{Op: "dial", Err: fmt.Errorf("connection refused")}),
+			kind: errors.Unavailable,
+			msg:  "Database is unavailable",
+		},
+		{
+			name: "bad conn",
+			err:  driver.ErrBadConn,
+			kind: errors.Unavailable,
+			msg:  "Database is unavailable",
+		},
+		{
+			name: "other",
+			err:  &pgconn.PgError{Code: "42P01", Message: `relation "lots" does not exist`},
+			kind: errors.Other,
+		},
+		{
+			name: "cancelled",
+			err:  context.Canceled,
+			kind: errors.Other,
+		},
+		{
+			name: "translated",
+			err:  errors.E(errors.Op("inner"), errors.Duplicate, "Product b1 already exists"),
+			kind: errors.Duplicate,
+			msg:  "Product b1 already exists",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, ok := dbError(errors.Op("op"), tt.err).(*errors.Error)
+			if !ok {
+				t.Fatalf("Expected an *errors.Error")
+			}
+			if e.Kind != tt.kind || e.Message != tt.msg {
+				t.Errorf("Expected %v %q, got %v %q", tt.kind, tt.msg, e.Kind, e.Message)
+			}
+			if _, translated := tt.err.(*errors.Error); !translated && !errors.Is(e, tt.err) {
+				t.Errorf("Expected the cause to be kept")
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/mtekmir/warehouse-service/internal/errors"
+	"github.com/mtekmir/warehouse-service/internal/tracing"
+)
+
+// Issue is a violation of an integrity check.
+type Issue struct {
+	Check  string `json:"check"`
+	Detail string `json:"detail"`
+}
+
+// integrityChecks are queries returning a detail row per violation.
+var integrityChecks = []struct {
+	name  string
+	query string
+}{
+	{
+		name:  "negative_article_stock",
+		query: `SELECT 'article ' || art_id || ' has stock ' || stock FROM articles WHERE stock < 0 ORDER BY id`,
+	},
+	{
+		name: "lots_exceed_article_stock",
+		query: `
+			SELECT 'article ' || a.art_id || ' has stock ' || a.stock || ' but ' || SUM(l.qty) || ' in lots'
+			FROM articles AS a
+			JOIN lots AS l ON l.article_id = a.id
+			GROUP BY a.id, a.art_id, a.stock
+			HAVING SUM(l.qty) > a.stock
+			ORDER BY a.id
+		`,
+	},
+	{
+		// Rows of ended revisions don't count, a product needs a revision in effect now.
+		name: "product_without_articles",
+		query: `
+			SELECT 'product ' || p.barcode || ' has no articles in effect'
+			FROM products AS p
+			WHERE NOT EXISTS (
+				SELECT 1 FROM product_articles AS pa
+				WHERE pa.product_id = p.id
+					AND pa.effective_from <= now() AND (pa.effective_to IS NULL OR pa.effective_to > now())
+			)
+			ORDER BY p.id
+		`,
+	},
+	{
+		name: "non_positive_article_amount",
+		query: `
+			SELECT 'product ' || p.barcode || ' requires ' || pa.amount || ' of article ' || a.art_id
+			FROM product_articles AS pa
+			JOIN products AS p ON p.id = pa.product_id
+			JOIN articles AS a ON a.id = pa.article_id
+			WHERE pa.amount <= 0
+			ORDER BY pa.id
+		`,
+	},
+}
+
+// CheckIntegrity runs the integrity checks of the catalogue and returns the issues found.
+func CheckIntegrity(ctx context.Context, db *sql.DB) (_ []*Issue, err error) {
+	var op errors.Op = "postgres.checkIntegrity"
+	ctx, tdb, span := traceOp(ctx, db, op)
+	defer func() { tracing.End(span, err) }()
+
+	var issues []*Issue
+	for _, c := range integrityChecks {
+		rows, err := tdb.QueryContext(ctx, c.query)
+		if err != nil {
+			return nil, dbError(op, err)
+		}
+		for rows.Next() {
+			i := &Issue{Check: c.name}
+			if err := rows.Scan(&i.Detail); err != nil {
+				rows.Close()
+				return nil, dbError(op, err)
+			}
+			issues = append(issues, i)
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, dbError(op, err)
+		}
+	}
+
+	return issues, nil
+}
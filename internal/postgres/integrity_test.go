@@ -0,0 +1,63 @@
+package postgres_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mtekmir/warehouse-service/internal/article"
+	"github.com/mtekmir/warehouse-service/internal/postgres"
+	"github.com/mtekmir/warehouse-service/internal/product"
+	"github.com/mtekmir/warehouse-service/test"
+)
+
+func TestCheckIntegrity_Revisions(t *testing.T) {
+	db, dbTidy := test.SetupDB(t)
+	defer dbTidy()
+
+	test.CreateProductTables(t, db)
+	ar := postgres.NewArticleRepo()
+	pr := postgres.NewProductRepo()
+	ctx := context.Background()
+
+	arts, err := ar.BatchInsert(ctx, db, []*article.Article{
+		{ArtID: "1", Name: "leg", Stock: 12},
+		{ArtID: "2", Name: "screw", Stock: 30},
+	})
+	if err != nil {
+		t.Fatalf("Unable to insert articles. %v", err)
+	}
+	pp, err := pr.BatchInsert(ctx, db, []*product.Product{{Barcode: "b1", Name: "chair"}, {Barcode: "b2", Name: "stool"}})
+	if err != nil {
+		t.Fatalf("Unable to insert products. %v", err)
+	}
+	err = pr.InsertProductArticles(ctx, db, []*product.ArticleRow{
+		{ProductID: pp[0].ID, ID: arts[0].ID, Amount: 4},
+		{ProductID: pp[1].ID, ID: arts[0].ID, Amount: 3},
+	})
+	if err != nil {
+		t.Fatalf("Unable to insert product articles. %v", err)
+	}
+
+	// The revision lists the article of the first revision again.
+	now := time.Now().UTC()
+	err = pr.InsertRevision(ctx, db, pp[0].ID, &product.Revision{Number: 2, EffectiveFrom: now.Add(-time.Minute), Articles: []*product.Article{
+		{ID: arts[0].ID, Amount: 2},
+		{ID: arts[1].ID, Amount: 8},
+	}})
+	if err != nil {
+		t.Fatalf("Unable to insert a revision. %v", err)
+	}
+	// The only revision of the stool has ended.
+	if _, err := db.ExecContext(ctx, "UPDATE product_articles SET effective_to = $1 WHERE product_id = $2", now.Add(-time.Minute), pp[1].ID); err != nil {
+		t.Fatalf("Unable to end the revision. %v", err)
+	}
+
+	issues, err := postgres.CheckIntegrity(ctx, db)
+	if err != nil {
+		t.Fatalf("Unable to check integrity. %v", err)
+	}
+	test.Compare(t, "issues", []*postgres.Issue{
+		{Check: "product_without_articles", Detail: "product b2 has no articles in effect"},
+	}, issues)
+}
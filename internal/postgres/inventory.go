@@ -0,0 +1,42 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/mtekmir/warehouse-service/internal/errors"
+	"github.com/mtekmir/warehouse-service/internal/tracing"
+)
+
+// InventoryStats returns the number of products that can't be built with the current
+// stock and the total units of articles in stock. Archived products aren't counted and
+// products are built with the revisions of their bills of materials in effect, without
+// the units of expired lots.
+func InventoryStats(ctx context.Context, db *sql.DB) (outOfStock, units int, err error) {
+	var op errors.Op = "postgres.inventoryStats"
+	ctx, tdb, span := traceOp(ctx, db, op)
+	defer func() { tracing.End(span, err) }()
+
+	q := `
+		SELECT
+			(SELECT COUNT(*) FROM (
+				SELECT pa.product_id
+				FROM product_articles AS pa
+				JOIN articles AS a ON a.id = pa.article_id
+				JOIN products AS p ON p.id = pa.product_id
+				LEFT JOIN (
+					SELECT article_id, SUM(qty) AS qty FROM lots WHERE expires_at <= now() GROUP BY article_id
+				) AS e ON e.article_id = a.id
+				WHERE p.status <> 'archived'
+				AND pa.effective_from <= now() AND (pa.effective_to IS NULL OR pa.effective_to > now())
+				GROUP BY pa.product_id
+				HAVING MIN((a.stock - COALESCE(e.qty, 0)) / pa.amount) <= 0
+			) AS p),
+			(SELECT COALESCE(SUM(stock), 0) FROM articles)
+	`
+	if err := tdb.QueryRowContext(ctx, q).Scan(&outOfStock, &units); err != nil {
+		return 0, 0, dbError(op, err)
+	}
+
+	return outOfStock, units, nil
+}
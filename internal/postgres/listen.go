@@ -0,0 +1,52 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/stdlib"
+	"github.com/mtekmir/warehouse-service/internal/errors"
+)
+
+// Listen listens to the channel and calls notify for every notification until ctx is
+// done or the connection fails. Notify is also called once listening starts, since
+// notifications sent before that are missed. A connection of the pool is used and closed
+// when listening ends.
+func Listen(ctx context.Context, db *sql.DB, channel string, notify func()) error {
+	var op errors.Op = "postgres.listen"
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return errors.E(op, err)
+	}
+	defer conn.Close()
+
+	err = conn.Raw(func(driverConn interface{}) error {
+		c, ok := driverConn.(*stdlib.Conn)
+		if !ok {
+			return fmt.Errorf("unexpected driver connection %T", driverConn)
+		}
+		pc := c.Conn()
+		// The connection is closed rather than returned to the pool while listening.
+		defer pc.Close(context.Background())
+
+		if _, err := pc.Exec(ctx, "LISTEN "+pgx.Identifier{channel}.Sanitize()); err != nil {
+			return err
+		}
+		notify()
+
+		for {
+			if _, err := pc.WaitForNotification(ctx); err != nil {
+				return err
+			}
+			notify()
+		}
+	})
+	if err != nil {
+		return errors.E(op, err)
+	}
+
+	return nil
+}
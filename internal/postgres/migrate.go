@@ -1,74 +1,355 @@
 package postgres
 
 import (
+	"context"
+	"crypto/sha256"
 	"database/sql"
-	"errors"
-	"io/ioutil"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
 	"os"
-	"path"
+	"path/filepath"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/sirupsen/logrus"
 )
 
+//go:embed migrations/*.sql
+var embedded embed.FS
+
+// Migrations returns the migrations in the directory at path. The migrations embedded
+// in the binary are returned if path is empty.
+func Migrations(path string) fs.FS {
+	if path != "" {
+		return os.DirFS(path)
+	}
+	sub, _ := fs.Sub(embedded, "migrations")
+	return sub
+}
+
+// migrationLockID is the key of the advisory lock that is held while migrating, so that
+// instances starting at the same time don't migrate concurrently.
+const migrationLockID int64 = 7_246_193_820
+
 type migration struct {
 	version     int
 	description string
 	filename    string
 	script      string
+	checksum    string // Hex encoded sha256 of the script.
+	down        string // Script of the U### migration that reverts this one, if any.
 }
 
-// Migrate runs db migrations. Applied db migrations will be stored in 
-// schema_version table. If no new migrations it doesn't do anything.
-func Migrate(log *logrus.Logger, d *sql.DB, migrationsPath string) error {
-	mm, err := parseMigrations(migrationsPath)
+// txBeginner is implemented by both *sql.DB and *sql.Conn.
+type txBeginner interface {
+	BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
+}
+
+// Migrate runs db migrations. Applied db migrations will be stored in
+// schema_version table along with their checksums. If no new migrations it doesn't do
+// anything. Each migration runs in a transaction and an advisory lock is held while
+// migrating. Fails if an applied migration was edited.
+func Migrate(log *logrus.Logger, d *sql.DB, migrations fs.FS) error {
+	mm, err := parseMigrations(migrations)
 	if err != nil {
 		return err
 	}
 
-	err = createVersTable(d)
+	return withMigrationLock(d, func(conn *sql.Conn) error {
+		if err := createVersTable(conn); err != nil {
+			return err
+		}
+		if err := verifyChecksums(log, conn, mm); err != nil {
+			return err
+		}
+
+		mm, err := migrationsToExecute(conn, mm)
+		if err != nil {
+			return err
+		}
+		if len(mm) == 0 {
+			log.Println("Db up to date")
+			return nil
+		}
+
+		for _, m := range mm {
+			if err := executeMigration(log, conn, m); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// MigrateDown reverts the last steps applied migrations with their U### migrations,
+// newest first. Fails without reverting anything if one of them has no down migration.
+func MigrateDown(log *logrus.Logger, d *sql.DB, migrations fs.FS, steps int) error {
+	mm, err := parseMigrations(migrations)
 	if err != nil {
 		return err
 	}
+	byVersion := make(map[int]migration, len(mm))
+	for _, m := range mm {
+		byVersion[m.version] = m
+	}
+
+	return withMigrationLock(d, func(conn *sql.Conn) error {
+		if err := createVersTable(conn); err != nil {
+			return err
+		}
 
-	mm, err = migrationsToExecute(d, mm)
+		applied, err := appliedMigrations(conn)
+		if err != nil {
+			return err
+		}
+		if steps > len(applied) {
+			steps = len(applied)
+		}
+
+		toRevert := make([]migration, 0, steps)
+		for i := len(applied) - 1; i >= len(applied)-steps; i-- {
+			m, ok := byVersion[applied[i].version]
+			if !ok {
+				return fmt.Errorf("migration %03d is applied but unknown", applied[i].version)
+			}
+			if m.down == "" {
+				return fmt.Errorf("migration %s has no down migration", m.filename)
+			}
+			toRevert = append(toRevert, m)
+		}
+
+		for _, m := range toRevert {
+			if err := revertMigration(log, conn, m); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// withMigrationLock runs fn on a single connection holding the migration lock.
+func withMigrationLock(d *sql.DB, fn func(*sql.Conn) error) error {
+	ctx := context.Background()
+	conn, err := d.Conn(ctx)
 	if err != nil {
 		return err
 	}
-	if len(mm) == 0 {
-		log.Println("Db up to date")
-		return nil
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", migrationLockID); err != nil {
+		return fmt.Errorf("unable to acquire the migration lock: %w", err)
 	}
+	defer conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", migrationLockID)
 
+	return fn(conn)
+}
+
+// SchemaVersion returns the version of the last applied migration.
+func SchemaVersion(ctx context.Context, d executor) (int, error) {
+	var version int
+	err := d.QueryRowContext(ctx, "SELECT version FROM schema_version ORDER BY id DESC LIMIT 1").Scan(&version)
+	if err != nil && err != sql.ErrNoRows {
+		return 0, err
+	}
+	return version, nil
+}
+
+// LatestVersion returns the version of the latest migration.
+func LatestVersion(migrations fs.FS) (int, error) {
+	mm, err := parseMigrations(migrations)
+	if err != nil {
+		return 0, err
+	}
+
+	var version int
 	for _, m := range mm {
-		err = executeMigration(log, d, m)
-		if err != nil {
-			return err
+		if m.version > version {
+			version = m.version
 		}
 	}
-
-	return nil
+	return version, nil
 }
 
-func createVersTable(d *sql.DB) error {
-	_, err := d.Exec(`
+func createVersTable(d executor) error {
+	ctx := context.Background()
+	_, err := d.ExecContext(ctx, `
 		create table if not exists schema_version(
 			id serial unique primary key,
 			version int not null,
 			description varchar not null,
 			filename varchar not null,
-			applied_on timestamp
+			applied_on timestamp,
+			checksum varchar
 		)
 	`)
+	if err != nil {
+		return err
+	}
+	// Tables created before checksums were stored don't have the column.
+	_, err = d.ExecContext(ctx, "alter table schema_version add column if not exists checksum varchar")
 	return err
 }
 
-func migrationsToExecute(d *sql.DB, migrations []migration) ([]migration, error) {
-	var version int
-	err := d.QueryRow("SELECT version FROM schema_version ORDER BY id DESC LIMIT 1").Scan(&version)
-	if err != nil && err != sql.ErrNoRows {
+type appliedMigration struct {
+	version     int
+	description string
+	filename    string
+	appliedOn   sql.NullTime
+	checksum    sql.NullString
+}
+
+func appliedMigrations(d executor) ([]appliedMigration, error) {
+	rows, err := d.QueryContext(context.Background(), "SELECT version, description, filename, applied_on, checksum FROM schema_version ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var applied []appliedMigration
+	for rows.Next() {
+		var a appliedMigration
+		if err := rows.Scan(&a.version, &a.description, &a.filename, &a.appliedOn, &a.checksum); err != nil {
+			return nil, err
+		}
+		applied = append(applied, a)
+	}
+	return applied, rows.Err()
+}
+
+// verifyChecksums checks that the applied migrations weren't edited. Migrations that
+// were applied before checksums were stored get the checksums of their current scripts.
+func verifyChecksums(log *logrus.Logger, d executor, migrations []migration) error {
+	applied, err := appliedMigrations(d)
+	if err != nil {
+		return err
+	}
+	byVersion := make(map[int]migration, len(migrations))
+	for _, m := range migrations {
+		byVersion[m.version] = m
+	}
+
+	for _, a := range applied {
+		m, ok := byVersion[a.version]
+		if !ok {
+			log.Printf("Applied migration %03d is unknown, the schema may be newer than the service", a.version)
+			continue
+		}
+		if !a.checksum.Valid {
+			_, err := d.ExecContext(context.Background(), "UPDATE schema_version SET checksum = $1 WHERE version = $2", m.checksum, m.version)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if a.checksum.String != m.checksum {
+			return fmt.Errorf("migration %s was edited after it was applied, checksum %s doesn't match the applied %s", m.filename, m.checksum, a.checksum.String)
+		}
+	}
+	return nil
+}
+
+// MigrationState is the state of a migration in the db.
+type MigrationState struct {
+	Version     int
+	Description string
+	Filename    string
+	Applied     bool
+	AppliedOn   *time.Time
+	Edited      bool // The script changed after it was applied.
+	Unknown     bool // The migration is applied but its file is missing.
+	Reversible  bool // The migration has a down migration.
+}
+
+// MigrationStatus returns the states of the migrations and of the applied migrations
+// that are missing from migrations, sorted by version. It doesn't modify the db.
+func MigrationStatus(ctx context.Context, d *sql.DB, migrations fs.FS) ([]*MigrationState, error) {
+	mm, err := parseMigrations(migrations)
+	if err != nil {
+		return nil, err
+	}
+
+	states := make(map[int]*MigrationState, len(mm))
+	for _, m := range mm {
+		states[m.version] = &MigrationState{
+			Version:     m.version,
+			Description: m.description,
+			Filename:    m.filename,
+			Reversible:  m.down != "",
+		}
+	}
+
+	var exists bool
+	if err := d.QueryRowContext(ctx, "SELECT to_regclass('schema_version') IS NOT NULL").Scan(&exists); err != nil {
+		return nil, err
+	}
+	if exists {
+		applied, err := appliedMigrations(d)
+		if err != nil {
+			return nil, err
+		}
+		sums := make(map[int]string, len(mm))
+		for _, m := range mm {
+			sums[m.version] = m.checksum
+		}
+
+		for _, a := range applied {
+			st, ok := states[a.version]
+			if !ok {
+				st = &MigrationState{Version: a.version, Description: a.description, Filename: a.filename, Unknown: true}
+				states[a.version] = st
+			}
+			st.Applied = true
+			if a.appliedOn.Valid {
+				st.AppliedOn = &a.appliedOn.Time
+			}
+			st.Edited = ok && a.checksum.Valid && a.checksum.String != sums[a.version]
+		}
+	}
+
+	ss := make([]*MigrationState, 0, len(states))
+	for _, st := range states {
+		ss = append(ss, st)
+	}
+	sort.Slice(ss, func(i, j int) bool { return ss[i].Version < ss[j].Version })
+	return ss, nil
+}
+
+// NewMigration creates empty V### and U### files for the next migration in dir and
+// returns their paths. Spaces and dashes in the description are replaced by underscores.
+func NewMigration(dir, description string) (up, down string, err error) {
+	name := strings.NewReplacer(" ", "_", "-", "_").Replace(strings.TrimSpace(description))
+	if !regexp.MustCompile(`^[a-zA-Z_]+$`).MatchString(name) {
+		return "", "", fmt.Errorf("migration description must only contain letters, spaces, dashes and underscores, got %q", description)
+	}
+
+	latest, err := LatestVersion(os.DirFS(dir))
+	if err != nil {
+		return "", "", fmt.Errorf("unable to read the migrations in %s: %w", dir, err)
+	}
+	if latest >= 999 {
+		return "", "", fmt.Errorf("migration versions are exhausted")
+	}
+
+	up = filepath.Join(dir, fmt.Sprintf("V%03d__%s.sql", latest+1, name))
+	down = filepath.Join(dir, fmt.Sprintf("U%03d__%s.sql", latest+1, name))
+	for _, p := range []string{up, down} {
+		f, err := os.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if err != nil {
+			return "", "", err
+		}
+		f.Close()
+	}
+	return up, down, nil
+}
+
+func migrationsToExecute(d executor, migrations []migration) ([]migration, error) {
+	version, err := SchemaVersion(context.Background(), d)
+	if err != nil {
 		return nil, err
 	}
 
@@ -82,46 +363,75 @@ func migrationsToExecute(d *sql.DB, migrations []migration) ([]migration, error)
 	return mm, nil
 }
 
-func parseMigrations(migrationsPath string) ([]migration, error) {
-	ff, err := ioutil.ReadDir(migrationsPath)
+var (
+	upMigration   = regexp.MustCompile(`^V([0-9]{3})__([a-zA-Z_]*)\.sql$`)
+	downMigration = regexp.MustCompile(`^U([0-9]{3})__([a-zA-Z_]*)\.sql$`)
+)
+
+// parseMigrations parses the V### migrations and their U### down migrations, sorted
+// by version.
+func parseMigrations(migrations fs.FS) ([]migration, error) {
+	ff, err := fs.ReadDir(migrations, ".")
 	if err != nil {
 		return nil, err
 	}
 
-	var migrations []migration
-	reg := "^V[0-9]{3}__[^0-9]*.sql$"
-	r, _ := regexp.Compile(reg)
-
+	byVersion := make(map[int]*migration)
+	downs := make(map[int]string)
 	for _, file := range ff {
-		if !r.Match([]byte(file.Name())) {
-			return nil, errors.New("Migration file names should match " + reg)
+		name := file.Name()
+		switch {
+		case upMigration.MatchString(name):
+			m, err := parseMigration(migrations, name)
+			if err != nil {
+				return nil, err
+			}
+			if dup, ok := byVersion[m.version]; ok {
+				return nil, fmt.Errorf("migrations %s and %s have the same version", dup.filename, name)
+			}
+			byVersion[m.version] = &m
+		case downMigration.MatchString(name):
+			version, _ := strconv.Atoi(downMigration.FindStringSubmatch(name)[1])
+			script, err := fs.ReadFile(migrations, name)
+			if err != nil {
+				return nil, err
+			}
+			downs[version] = string(script)
+		default:
+			return nil, fmt.Errorf("migration file names should match %s or %s, got %s", upMigration, downMigration, name)
 		}
-		m, err := parseMigration(migrationsPath, file.Name())
-		if err != nil {
-			return nil, err
+	}
+
+	for version, script := range downs {
+		m, ok := byVersion[version]
+		if !ok {
+			return nil, fmt.Errorf("down migration %03d has no V%03d migration", version, version)
 		}
-		migrations = append(migrations, m)
+		m.down = script
 	}
-	return migrations, nil
+
+	mm := make([]migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		mm = append(mm, *m)
+	}
+	sort.Slice(mm, func(i, j int) bool { return mm[i].version < mm[j].version })
+	return mm, nil
 }
 
-func parseMigration(migrationsPath, filename string) (migration, error) {
+func parseMigration(migrations fs.FS, filename string) (migration, error) {
 	m := migration{}
-	r, _ := regexp.Compile("^V([0-9]*)__([a-zA-Z_]*).sql$")
-	parts := r.FindStringSubmatch(filename)
-
-	version, err := strconv.Atoi(parts[1][1:])
-	if err != nil {
-		return m, nil
+	parts := upMigration.FindStringSubmatch(filename)
+	if parts == nil {
+		return m, fmt.Errorf("migration file names should match %s, got %s", upMigration, filename)
 	}
-	description := strings.Join(strings.Split(parts[2], "_"), " ")
 
-	file, err := os.Open(path.Join(migrationsPath, filename))
+	version, err := strconv.Atoi(parts[1])
 	if err != nil {
 		return m, err
 	}
+	description := strings.Join(strings.Split(parts[2], "_"), " ")
 
-	script, err := ioutil.ReadAll(file)
+	script, err := fs.ReadFile(migrations, filename)
 	if err != nil {
 		return m, err
 	}
@@ -130,21 +440,59 @@ func parseMigration(migrationsPath, filename string) (migration, error) {
 	m.description = description
 	m.filename = filename
 	m.script = string(script)
+	m.checksum = checksum(m.script)
 	return m, nil
 }
 
-func executeMigration(log *logrus.Logger, d *sql.DB, m migration) error {
+func checksum(script string) string {
+	sum := sha256.Sum256([]byte(script))
+	return hex.EncodeToString(sum[:])
+}
+
+// executeMigration runs the script and records the migration in one transaction.
+func executeMigration(log *logrus.Logger, d txBeginner, m migration) error {
 	log.Println("Executing migration", m.filename)
-	_, err := d.Exec(m.script)
+	ctx := context.Background()
+	tx, err := d.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
-	_, err = d.Exec(`
-		INSERT INTO schema_version (version, description, filename, applied_on)
-		VALUES ($1, $2, $3, CURRENT_TIMESTAMP)
-	`, m.version, m.description, m.filename)
+
+	_, err = tx.ExecContext(ctx, m.script)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("migration %s failed: %w", m.filename, err)
+	}
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO schema_version (version, description, filename, applied_on, checksum)
+		VALUES ($1, $2, $3, CURRENT_TIMESTAMP, $4)
+	`, m.version, m.description, m.filename, m.checksum)
 	if err != nil {
+		tx.Rollback()
 		return err
 	}
-	return nil
+	return tx.Commit()
+}
+
+// revertMigration runs the down script and removes the migration from schema_version
+// in one transaction.
+func revertMigration(log *logrus.Logger, d txBeginner, m migration) error {
+	log.Println("Reverting migration", m.filename)
+	ctx := context.Background()
+	tx, err := d.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, m.down)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("down migration of %s failed: %w", m.filename, err)
+	}
+	_, err = tx.ExecContext(ctx, "DELETE FROM schema_version WHERE version = $1", m.version)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
 }
@@ -1,10 +1,12 @@
 package postgres
 
 import (
-	"fmt"
+	"context"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"testing/fstest"
 
 	"github.com/mtekmir/warehouse-service/test"
 	"github.com/sirupsen/logrus"
@@ -12,62 +14,59 @@ import (
 
 func TestParseMigration(t *testing.T) {
 	t.Parallel()
-	dir := "."
 	filename := "V001__some_migration.sql"
 	script := "Some sql script"
-	file, err := os.Create(fmt.Sprintf("%s/%s", dir, filename))
-	if err != nil {
-		t.Error(err.Error())
-		return
-	}
-	defer os.Remove(fmt.Sprintf("%s/%s", dir, filename))
-	_, err = file.Write([]byte(script))
+	fsys := fstest.MapFS{filename: {Data: []byte(script)}}
+
+	m, err := parseMigration(fsys, filename)
 	if err != nil {
-		t.Error(err.Error())
-		return
+		t.Fatal(err)
 	}
-
-	m, err := parseMigration(dir, filename)
-	expected := migration{version: 1, description: "some migration", filename: filename, script: script}
+	expected := migration{version: 1, description: "some migration", filename: filename, script: script, checksum: checksum(script)}
 	if m != expected {
 		t.Errorf("Expected: %v\n", expected)
 		t.Errorf("Got: %v\n", m)
 	}
+
+	m, err = parseMigration(fstest.MapFS{"V120__big_version.sql": {}}, "V120__big_version.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.version != 120 {
+		t.Errorf("Expected version to be 120. Got %d", m.version)
+	}
 }
 
 func TestParseMigrations(t *testing.T) {
 	t.Parallel()
-	dir := "./testmigrations"
 	script := "bla bla bla"
+	down := "drop bla"
 	filenames := []string{"V001__some_migration.sql", "V002__another_migration.sql"}
-	err := os.MkdirAll(dir, os.ModePerm)
-	if err != nil {
-		t.Fatal(err.Error())
-	}
-	defer func() {
-		os.RemoveAll(dir)
-		os.Remove(dir)
-	}()
 
-	file, err := os.Create("./testmigrations/somefile.sql")
-	if err != nil {
-		t.Fatal(err.Error())
-	}
-	_, err = parseMigrations(dir)
+	_, err := parseMigrations(fstest.MapFS{"somefile.sql": {}})
 	if err == nil {
 		t.Error("Invalid file name should return error")
 	}
-	os.Remove(file.Name())
-	for _, f := range filenames {
-		file, err := os.Create(fmt.Sprintf("%s/%s", dir, f))
-		if err != nil {
-			t.Fatal(err.Error())
-		}
-		file.Write([]byte(script))
+	_, err = parseMigrations(fstest.MapFS{"U003__orphan.sql": {}})
+	if err == nil {
+		t.Error("Down migration without an up migration should return error")
+	}
+	_, err = parseMigrations(fstest.MapFS{"V001__one.sql": {}, "V001__two.sql": {}})
+	if err == nil {
+		t.Error("Duplicate versions should return error")
+	}
+
+	fsys := fstest.MapFS{
+		filenames[1]:                 {Data: []byte(script)},
+		filenames[0]:                 {Data: []byte(script)},
+		"U002__another_rollback.sql": {Data: []byte(down)},
+	}
+	mm, err := parseMigrations(fsys)
+	if err != nil {
+		t.Fatal(err)
 	}
-	mm, err := parseMigrations(dir)
-	m0 := migration{version: 1, description: "some migration", filename: filenames[0], script: script}
-	m1 := migration{version: 2, description: "another migration", filename: filenames[1], script: script}
+	m0 := migration{version: 1, description: "some migration", filename: filenames[0], script: script, checksum: checksum(script)}
+	m1 := migration{version: 2, description: "another migration", filename: filenames[1], script: script, checksum: checksum(script), down: down}
 
 	if mm[0] != m0 {
 		t.Errorf("Expected: %v\n", m0)
@@ -79,6 +78,48 @@ func TestParseMigrations(t *testing.T) {
 	}
 }
 
+func TestNewMigration(t *testing.T) {
+	dir := t.TempDir()
+	for _, f := range []string{"V001__create_things_table.sql", "V002__add_thing_names.sql"} {
+		if err := os.WriteFile(filepath.Join(dir, f), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	up, down, err := NewMigration(dir, "add thing-colors")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Base(up) != "V003__add_thing_colors.sql" || filepath.Base(down) != "U003__add_thing_colors.sql" {
+		t.Errorf("Unexpected migration files %s and %s", up, down)
+	}
+	if _, err := parseMigrations(os.DirFS(dir)); err != nil {
+		t.Errorf("Expected new migrations to be valid. Got %v", err)
+	}
+
+	if _, _, err := NewMigration(dir, "add 2 things"); err == nil {
+		t.Error("Expected an error for a description with digits")
+	}
+}
+
+func TestEmbeddedMigrations(t *testing.T) {
+	mm, err := parseMigrations(Migrations(""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mm) == 0 {
+		t.Fatal("Expected migrations to be embedded")
+	}
+	for i, m := range mm {
+		if m.version != i+1 {
+			t.Errorf("Expected version of %s to be %d", m.filename, i+1)
+		}
+		if m.down == "" {
+			t.Errorf("Expected %s to have a down migration", m.filename)
+		}
+	}
+}
+
 func TestCreateVersTable(t *testing.T) {
 	t.Parallel()
 	db, dbTidy := test.SetupDB(t)
@@ -117,7 +158,7 @@ func TestExecuteMigration(t *testing.T) {
 		t.Fatalf("Error while creating schema_version table. Err: %s", err.Error())
 	}
 
-	mm, err := parseMigrations("testdata")
+	mm, err := parseMigrations(os.DirFS("testdata"))
 	if err != nil {
 		t.Fatalf("Error while parsing test migration files. Err: %s", err.Error())
 	}
@@ -182,7 +223,7 @@ func TestMigrationsToExecute(t *testing.T) {
 		t.Fatalf("Error while creating schema_version table. Err: %s", err.Error())
 	}
 
-	mm, err := parseMigrations("testdata")
+	mm, err := parseMigrations(os.DirFS("testdata"))
 	if err != nil {
 		t.Fatalf("Error while parsing test migration files. Err: %s", err.Error())
 	}
@@ -216,12 +257,12 @@ func TestMigrate(t *testing.T) {
 	db, dbTidy := test.SetupDB(t)
 	defer dbTidy()
 	log := logrus.New()
-	err := Migrate(log, db, "nonexistent")
+	err := Migrate(log, db, os.DirFS("nonexistent"))
 	if err == nil {
 		t.Errorf("Expected to get ENOTFOUND. Got nil.")
 	}
 
-	err = Migrate(log, db, "testdata")
+	err = Migrate(log, db, os.DirFS("testdata"))
 
 	tablesToCheck := []string{"products", "articles"}
 	for _, n := range tablesToCheck {
@@ -246,7 +287,7 @@ func TestMigrate(t *testing.T) {
 	if currentV != 2 {
 		t.Errorf("Expected schema version to be 2. Got %d", currentV)
 	}
-	mm, err := parseMigrations("testdata")
+	mm, err := parseMigrations(os.DirFS("testdata"))
 	if err != nil {
 		t.Fatalf("Error while parsing test migration files. Err: %s", err.Error())
 	}
@@ -259,3 +300,84 @@ func TestMigrate(t *testing.T) {
 		t.Errorf("Expected migrations to execute to be 0 after running migrations. Got %d", len(mm))
 	}
 }
+
+func TestLatestVersion(t *testing.T) {
+	v, err := LatestVersion(os.DirFS("testdata"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != 2 {
+		t.Errorf("Expected latest version to be 2, got %d", v)
+	}
+}
+
+func TestMigrateChecksum(t *testing.T) {
+	db, dbTidy := test.SetupDB(t)
+	defer dbTidy()
+	log := logrus.New()
+
+	fsys := fstest.MapFS{"V001__create_things_table.sql": {Data: []byte("create table things(id int)")}}
+	if err := Migrate(log, db, fsys); err != nil {
+		t.Fatal(err)
+	}
+
+	fsys["V001__create_things_table.sql"] = &fstest.MapFile{Data: []byte("create table things(id bigint)")}
+	err := Migrate(log, db, fsys)
+	if err == nil || !strings.Contains(err.Error(), "was edited after it was applied") {
+		t.Errorf("Expected checksum mismatch error. Got %v", err)
+	}
+}
+
+func TestMigrateRollsBackFailedMigration(t *testing.T) {
+	db, dbTidy := test.SetupDB(t)
+	defer dbTidy()
+	log := logrus.New()
+
+	fsys := fstest.MapFS{"V001__broken.sql": {Data: []byte("create table things(id int); select * from nonexistent")}}
+	if err := Migrate(log, db, fsys); err == nil {
+		t.Fatal("Expected the migration to fail")
+	}
+
+	var exists bool
+	db.QueryRow("SELECT EXISTS (SELECT FROM pg_tables WHERE schemaname = $1 AND tablename = 'things')", strings.ToLower(t.Name())).Scan(&exists)
+	if exists {
+		t.Error("Expected the failed migration to be rolled back")
+	}
+	v, err := SchemaVersion(context.Background(), db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != 0 {
+		t.Errorf("Expected schema version to be 0. Got %d", v)
+	}
+}
+
+func TestMigrateDown(t *testing.T) {
+	db, dbTidy := test.SetupDB(t)
+	defer dbTidy()
+	log := logrus.New()
+
+	if err := Migrate(log, db, os.DirFS("testdata")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := MigrateDown(log, db, os.DirFS("testdata"), 2); err == nil {
+		t.Error("Expected an error since V001 has no down migration")
+	}
+	if err := MigrateDown(log, db, os.DirFS("testdata"), 1); err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := SchemaVersion(context.Background(), db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != 1 {
+		t.Errorf("Expected schema version to be 1. Got %d", v)
+	}
+	var exists bool
+	db.QueryRow("SELECT EXISTS (SELECT FROM pg_tables WHERE schemaname = $1 AND tablename = 'products')", strings.ToLower(t.Name())).Scan(&exists)
+	if exists {
+		t.Error("Expected products table to be dropped")
+	}
+}
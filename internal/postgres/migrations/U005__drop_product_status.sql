@@ -0,0 +1,3 @@
+alter table products
+  drop column if exists status,
+  drop column if exists archived_at
\ No newline at end of file
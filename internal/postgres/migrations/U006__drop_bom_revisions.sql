@@ -0,0 +1,5 @@
+delete from product_articles where revision > 1;
+alter table product_articles
+  drop column if exists revision,
+  drop column if exists effective_from,
+  drop column if exists effective_to
\ No newline at end of file
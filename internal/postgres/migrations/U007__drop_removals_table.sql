@@ -0,0 +1 @@
+drop table if exists removals
\ No newline at end of file
@@ -0,0 +1 @@
+drop table if exists outbox
\ No newline at end of file
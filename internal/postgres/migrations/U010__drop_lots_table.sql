@@ -0,0 +1 @@
+drop table if exists lots
\ No newline at end of file
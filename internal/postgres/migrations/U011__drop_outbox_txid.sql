@@ -0,0 +1,2 @@
+drop index if exists outbox_txid_idx;
+alter table outbox drop column if exists txid
\ No newline at end of file
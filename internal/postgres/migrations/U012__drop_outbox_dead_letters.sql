@@ -0,0 +1,4 @@
+drop index if exists outbox_created_at_idx;
+drop index if exists outbox_pending_idx;
+alter table outbox drop column if exists dead_at;
+create index if not exists outbox_pending_idx on outbox(id) where delivered_at is null
\ No newline at end of file
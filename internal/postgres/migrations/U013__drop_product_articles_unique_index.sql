@@ -0,0 +1 @@
+drop index if exists product_articles_revision_article_idx
\ No newline at end of file
@@ -0,0 +1,10 @@
+create table if not exists api_keys(
+  id bigserial unique primary key,
+  name varchar not null,
+  prefix varchar not null,
+  key_hash varchar unique not null,
+  scopes varchar not null,
+  created_at timestamptz not null default current_timestamp,
+  rotated_at timestamptz,
+  revoked_at timestamptz
+)
\ No newline at end of file
@@ -0,0 +1,4 @@
+alter table products
+  add column if not exists status varchar not null default 'active'
+    check (status in ('draft', 'active', 'discontinued', 'archived')),
+  add column if not exists archived_at timestamptz
\ No newline at end of file
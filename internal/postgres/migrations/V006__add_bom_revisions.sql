@@ -0,0 +1,4 @@
+alter table product_articles
+  add column if not exists revision int not null default 1,
+  add column if not exists effective_from timestamptz not null default current_timestamp,
+  add column if not exists effective_to timestamptz
\ No newline at end of file
@@ -0,0 +1,7 @@
+create table if not exists removals(
+  id bigserial unique primary key,
+  product_id bigint not null references products(id),
+  revision int not null,
+  qty int not null,
+  removed_at timestamptz not null default current_timestamp
+)
\ No newline at end of file
@@ -0,0 +1,11 @@
+create table if not exists audit_events(
+  id bigserial unique primary key,
+  actor varchar not null,
+  action varchar not null,
+  targets varchar not null,
+  payload_digest varchar not null,
+  result varchar not null,
+  request_id varchar not null,
+  created_at timestamptz not null default current_timestamp
+);
+create index if not exists audit_events_created_at_idx on audit_events(created_at)
\ No newline at end of file
@@ -0,0 +1,11 @@
+create table if not exists outbox(
+  id bigserial unique primary key,
+  type varchar not null,
+  payload jsonb not null,
+  created_at timestamptz not null default current_timestamp,
+  locked_until timestamptz,
+  delivered_at timestamptz,
+  attempts int not null default 0,
+  last_error varchar
+);
+create index if not exists outbox_pending_idx on outbox(id) where delivered_at is null
\ No newline at end of file
@@ -0,0 +1,10 @@
+create table if not exists lots(
+  id bigserial unique primary key,
+  article_id bigint not null references articles(id),
+  number varchar not null,
+  received_at timestamptz not null,
+  expires_at timestamptz,
+  qty int not null,
+  unique (article_id, number)
+);
+create index if not exists lots_expires_at_idx on lots(expires_at)
\ No newline at end of file
@@ -0,0 +1,3 @@
+alter table outbox
+  add column if not exists txid xid8 not null default pg_current_xact_id();
+create index if not exists outbox_txid_idx on outbox(txid, id)
\ No newline at end of file
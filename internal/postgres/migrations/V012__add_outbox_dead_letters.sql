@@ -0,0 +1,4 @@
+alter table outbox add column if not exists dead_at timestamptz;
+drop index if exists outbox_pending_idx;
+create index if not exists outbox_pending_idx on outbox(id) where delivered_at is null and dead_at is null;
+create index if not exists outbox_created_at_idx on outbox(created_at)
\ No newline at end of file
@@ -0,0 +1,11 @@
+update product_articles as pa set amount = d.amount
+from (
+  select min(id) as id, sum(amount) as amount from product_articles
+  group by product_id, revision, article_id
+  having count(*) > 1
+) as d
+where pa.id = d.id;
+delete from product_articles as pa
+using product_articles as kept
+where kept.product_id = pa.product_id and kept.revision = pa.revision and kept.article_id = pa.article_id and kept.id < pa.id;
+create unique index if not exists product_articles_revision_article_idx on product_articles(product_id, revision, article_id)
\ No newline at end of file
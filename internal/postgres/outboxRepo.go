@@ -0,0 +1,225 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mtekmir/warehouse-service/internal/errors"
+	"github.com/mtekmir/warehouse-service/internal/outbox"
+	"github.com/mtekmir/warehouse-service/internal/tracing"
+)
+
+type outboxRepo struct{}
+
+// OutboxChannel is the channel that is notified when events are stored in the outbox.
+// Notifications are sent when the transactions that store the events commit.
+const OutboxChannel = "outbox"
+
+// visible is the condition of the events that FindAfter and LastID return. Ids of events
+// are taken from a sequence, so a transaction with a smaller id can commit after one
+// with a bigger id, and the events are ordered by the ids of the transactions that
+// stored them instead. Only events of transactions older than the oldest running one
+// are visible, since all the transactions before them have ended and no event can be
+// stored before them anymore.
+const visible = "txid < pg_snapshot_xmin(pg_current_snapshot())"
+
+// Insert stores the events in the outbox and notifies OutboxChannel.
+func (outboxRepo) Insert(ctx context.Context, db outbox.Executor, ee []*outbox.Event) (err error) {
+	var op errors.Op = "outboxRepo.insert"
+	ctx, db, span := traceOp(ctx, db, op)
+	defer func() { tracing.End(span, err) }()
+
+	if len(ee) == 0 {
+		return nil
+	}
+
+	values := make([]interface{}, 0, len(ee)*2)
+	pHolders := make([]string, 0, len(ee))
+	for i, e := range ee {
+		pHolders = append(pHolders, fmt.Sprintf("($%d, $%d)", i*2+1, i*2+2))
+		values = append(values, e.Type, string(e.Payload))
+	}
+
+	stmt := fmt.Sprintf("INSERT INTO outbox (type, payload) VALUES %s", strings.Join(pHolders, ", "))
+	if _, err := db.ExecContext(ctx, stmt, values...); err != nil {
+		return dbError(op, err)
+	}
+
+	if _, err := db.ExecContext(ctx, "SELECT pg_notify($1, '')", OutboxChannel); err != nil {
+		return dbError(op, err)
+	}
+
+	return nil
+}
+
+// Claim leases the oldest undelivered events that aren't leased. Rows locked by the
+// claims of other replicas are skipped.
+func (outboxRepo) Claim(ctx context.Context, db outbox.Executor, limit int, now, until time.Time) (_ []*outbox.Event, err error) {
+	var op errors.Op = "outboxRepo.claim"
+	ctx, db, span := traceOp(ctx, db, op)
+	defer func() { tracing.End(span, err) }()
+
+	rows, err := db.QueryContext(ctx, `
+		UPDATE outbox SET locked_until = $3
+		WHERE id IN (
+			SELECT id FROM outbox
+			WHERE delivered_at IS NULL AND dead_at IS NULL AND (locked_until IS NULL OR locked_until <= $2)
+			ORDER BY id
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, type, payload, created_at`,
+		limit, now, until,
+	)
+	if err != nil {
+		return nil, dbError(op, err)
+	}
+	ee, err := scanOutboxEvents(rows)
+	if err != nil {
+		return nil, dbError(op, err)
+	}
+
+	// Rows returned by an update aren't ordered.
+	sort.Slice(ee, func(i, j int) bool { return ee[i].ID < ee[j].ID })
+	return ee, nil
+}
+
+// MarkDelivered marks the events as delivered.
+func (outboxRepo) MarkDelivered(ctx context.Context, db outbox.Executor, IDs []outbox.EventID, at time.Time) (err error) {
+	var op errors.Op = "outboxRepo.markDelivered"
+	ctx, db, span := traceOp(ctx, db, op)
+	defer func() { tracing.End(span, err) }()
+
+	pHolders, values := eventIDs(IDs, at)
+	_, err = db.ExecContext(ctx, "UPDATE outbox SET delivered_at = $1, locked_until = NULL, attempts = attempts + 1 WHERE id IN ("+pHolders+")", values...)
+	if err != nil {
+		return dbError(op, err)
+	}
+
+	return nil
+}
+
+// Release ends the leases of the events and records the failed attempt. Events that
+// reach maxAttempts are dead-lettered.
+func (outboxRepo) Release(ctx context.Context, db outbox.Executor, IDs []outbox.EventID, reason string, maxAttempts int) (err error) {
+	var op errors.Op = "outboxRepo.release"
+	ctx, db, span := traceOp(ctx, db, op)
+	defer func() { tracing.End(span, err) }()
+
+	pHolders, values := eventIDs(IDs, reason, maxAttempts)
+	_, err = db.ExecContext(ctx, `
+		UPDATE outbox SET locked_until = NULL, attempts = attempts + 1, last_error = $1,
+		dead_at = CASE WHEN $2 > 0 AND attempts + 1 >= $2 THEN current_timestamp END
+		WHERE id IN (`+pHolders+")", values...)
+	if err != nil {
+		return dbError(op, err)
+	}
+
+	return nil
+}
+
+// Prune deletes delivered events stored before the time, and pending ones if pending
+// is set.
+func (outboxRepo) Prune(ctx context.Context, db outbox.Executor, before time.Time, pending bool, limit int) (_ int, err error) {
+	var op errors.Op = "outboxRepo.prune"
+	ctx, db, span := traceOp(ctx, db, op)
+	defer func() { tracing.End(span, err) }()
+
+	res, err := db.ExecContext(ctx, `
+		DELETE FROM outbox WHERE id IN (
+			SELECT id FROM outbox
+			WHERE created_at < $1 AND (delivered_at IS NOT NULL OR ($2 AND dead_at IS NULL))
+			LIMIT $3
+		)`,
+		before, pending, limit,
+	)
+	if err != nil {
+		return 0, dbError(op, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, dbError(op, err)
+	}
+
+	return int(n), nil
+}
+
+// FindAfter returns the visible events that follow the event with the id after. All
+// the events follow an event that isn't found, e.g. because it was pruned.
+func (outboxRepo) FindAfter(ctx context.Context, db outbox.Executor, after outbox.EventID, limit int) (_ []*outbox.Event, err error) {
+	var op errors.Op = "outboxRepo.findAfter"
+	ctx, db, span := traceOp(ctx, db, op)
+	defer func() { tracing.End(span, err) }()
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT id, type, payload, created_at FROM outbox
+		WHERE (txid, id) > (COALESCE((SELECT txid FROM outbox WHERE id = $1), '0'::xid8), $1) AND `+visible+`
+		ORDER BY txid, id
+		LIMIT $2`,
+		after, limit,
+	)
+	if err != nil {
+		return nil, dbError(op, err)
+	}
+	ee, err := scanOutboxEvents(rows)
+	if err != nil {
+		return nil, dbError(op, err)
+	}
+
+	return ee, nil
+}
+
+// LastID returns the id of the latest visible event.
+func (outboxRepo) LastID(ctx context.Context, db outbox.Executor) (_ outbox.EventID, err error) {
+	var op errors.Op = "outboxRepo.lastID"
+	ctx, db, span := traceOp(ctx, db, op)
+	defer func() { tracing.End(span, err) }()
+
+	var ID outbox.EventID
+	err = db.QueryRowContext(ctx, "SELECT COALESCE((SELECT id FROM outbox WHERE "+visible+" ORDER BY txid DESC, id DESC LIMIT 1), 0)").Scan(&ID)
+	if err != nil {
+		return 0, dbError(op, err)
+	}
+
+	return ID, nil
+}
+
+// scanOutboxEvents scans the id, type, payload and created_at columns of the rows and
+// closes them.
+func scanOutboxEvents(rows *sql.Rows) ([]*outbox.Event, error) {
+	defer rows.Close()
+
+	ee := []*outbox.Event{}
+	for rows.Next() {
+		var e outbox.Event
+		var payload []byte
+		if err := rows.Scan(&e.ID, &e.Type, &payload, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		e.Payload = json.RawMessage(payload)
+		ee = append(ee, &e)
+	}
+	return ee, rows.Err()
+}
+
+// eventIDs returns the placeholders of the ids and the values, following the leading
+// values.
+func eventIDs(IDs []outbox.EventID, leading ...interface{}) (string, []interface{}) {
+	pHolders := make([]string, 0, len(IDs))
+	values := append(make([]interface{}, 0, len(IDs)+len(leading)), leading...)
+	for _, ID := range IDs {
+		values = append(values, ID)
+		pHolders = append(pHolders, fmt.Sprintf("$%d", len(values)))
+	}
+	return strings.Join(pHolders, ", "), values
+}
+
+// NewOutboxRepo returns a postgres repo for the outbox.
+func NewOutboxRepo() outbox.Repo {
+	return outboxRepo{}
+}
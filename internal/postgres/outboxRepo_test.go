@@ -0,0 +1,72 @@
+package postgres_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/mtekmir/warehouse-service/internal/outbox"
+	"github.com/mtekmir/warehouse-service/internal/postgres"
+	"github.com/mtekmir/warehouse-service/test"
+	"github.com/sirupsen/logrus"
+)
+
+func TestOutboxRepo_CommitOrder(t *testing.T) {
+	db, dbTidy := test.SetupDB(t)
+	defer dbTidy()
+
+	if err := postgres.Migrate(logrus.New(), db, postgres.Migrations("")); err != nil {
+		t.Fatalf("Unable to migrate. %v", err)
+	}
+	r := postgres.NewOutboxRepo()
+	ctx := context.Background()
+	events := func() []*outbox.Event {
+		return []*outbox.Event{{Type: outbox.TypeImportCompleted, Payload: json.RawMessage(`{"rows": 1}`)}}
+	}
+	find := func(after outbox.EventID) []outbox.EventID {
+		t.Helper()
+		ee, err := r.FindAfter(ctx, db, after, 10)
+		if err != nil {
+			t.Fatalf("Unable to find events. %v", err)
+		}
+		IDs := []outbox.EventID{}
+		for _, e := range ee {
+			IDs = append(IDs, e.ID)
+		}
+		return IDs
+	}
+
+	// The transaction starts writing before the event 1 is stored, and stores the event 2
+	// after it's committed.
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatalf("Unable to begin a transaction. %v", err)
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, "SELECT pg_current_xact_id()"); err != nil {
+		t.Fatalf("Unable to assign a transaction id. %v", err)
+	}
+	if err := r.Insert(ctx, db, events()); err != nil {
+		t.Fatalf("Unable to insert events. %v", err)
+	}
+
+	// The event 2 could still be committed before the event 1.
+	test.Compare(t, "found", []outbox.EventID{}, find(0))
+	if last, err := r.LastID(ctx, db); err != nil || last != 0 {
+		t.Errorf("Expected no last id while the transaction is open. Got %d, %v", last, err)
+	}
+
+	if err := r.Insert(ctx, tx, events()); err != nil {
+		t.Fatalf("Unable to insert events. %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Unable to commit. %v", err)
+	}
+
+	test.Compare(t, "found", []outbox.EventID{2, 1}, find(0))
+	test.Compare(t, "found", []outbox.EventID{1}, find(2))
+	test.Compare(t, "found", []outbox.EventID{}, find(1))
+	if last, err := r.LastID(ctx, db); err != nil || last != 1 {
+		t.Errorf("Expected the last id to be 1. Got %d, %v", last, err)
+	}
+}
@@ -2,20 +2,23 @@ package postgres
 
 import (
 	"context"
+	"database/sql"
 	"fmt"
-	"math"
 	"strings"
 
 	"github.com/mtekmir/warehouse-service/internal/errors"
 	"github.com/mtekmir/warehouse-service/internal/product"
+	"github.com/mtekmir/warehouse-service/internal/tracing"
 )
 
 type productRepo struct{}
 
 // ExistingProductsMap is used while importing products. It takes in a barcodes slice and returns 
 // a map of found products barcodes to ids.
-func (productRepo) ExistingProductsMap(ctx context.Context, db product.Executor, bb []*product.Barcode) (map[product.Barcode]product.ID, error) {
+func (productRepo) ExistingProductsMap(ctx context.Context, db product.Executor, bb []*product.Barcode) (_ map[product.Barcode]product.ID, err error) {
 	var op errors.Op = "productRepo.existingProductsMap"
+	ctx, db, span := traceOp(ctx, db, op)
+	defer func() { tracing.End(span, err) }()
 
 	pHolders := make([]string, 0, len(bb))
 	values := make([]interface{}, 0, len(bb))
@@ -27,7 +30,7 @@ func (productRepo) ExistingProductsMap(ctx context.Context, db product.Executor,
 	stmt := fmt.Sprintf(`SELECT id, barcode FROM products WHERE barcode IN (%s)`, strings.Join(pHolders, ","))
 	rows, err := db.QueryContext(ctx, stmt, values...)
 	if err != nil {
-		return nil, errors.E(op, err)
+		return nil, dbError(op, err)
 	}
 	defer rows.Close()
 
@@ -36,7 +39,7 @@ func (productRepo) ExistingProductsMap(ctx context.Context, db product.Executor,
 		var p product.Product
 		err := rows.Scan(&p.ID, &p.Barcode)
 		if err != nil {
-			return nil, errors.E(op, err)
+			return nil, dbError(op, err)
 		}
 		m[p.Barcode] = p.ID
 	}
@@ -44,23 +47,51 @@ func (productRepo) ExistingProductsMap(ctx context.Context, db product.Executor,
 	return m, nil
 }
 
-func (productRepo) FindAll(ctx context.Context, db product.Executor, ff *product.Filters) ([]*product.StockInfo, error) {
+// FindAll returns the products with their stock information. Available quantities are
+// calculated in the db so that products can be filtered, sorted and paginated by them.
+func (productRepo) FindAll(ctx context.Context, db product.Executor, ff *product.Filters) (_ []*product.StockInfo, err error) {
 	var op errors.Op = "productRepo.findAll"
+	ctx, db, span := traceOp(ctx, db, op)
+	defer func() { tracing.End(span, err) }()
 
-	filterQueries := make([]string, 0, 2)
+	filterQueries := make([]string, 0, 3)
 	var values []interface{}
 
 	if ff.BB != nil {
 		pHolders := make([]string, 0, len(*ff.BB))
-		for i, b := range *ff.BB {
-			pHolders = append(pHolders, fmt.Sprintf("$%d", i+1))
+		for _, b := range *ff.BB {
 			values = append(values, b)
+			pHolders = append(pHolders, fmt.Sprintf("$%d", len(values)))
 		}
 		filterQueries = append(filterQueries, fmt.Sprintf("p.barcode IN (%s)", strings.Join(pHolders, ",")))
 	}
 
 	if ff.ID != nil {
-		filterQueries = append(filterQueries, fmt.Sprintf("p.id = %d", len(values)+1))
+		values = append(values, *ff.ID)
+		filterQueries = append(filterQueries, fmt.Sprintf("p.id = $%d", len(values)))
+	}
+
+	if ff.ArtIDs != nil {
+		pHolders := make([]string, 0, len(*ff.ArtIDs))
+		for _, artID := range *ff.ArtIDs {
+			values = append(values, artID)
+			pHolders = append(pHolders, fmt.Sprintf("$%d", len(values)))
+		}
+		filterQueries = append(filterQueries, fmt.Sprintf(
+			"p.id IN (SELECT cpa.product_id FROM current_pa cpa JOIN articles ca ON ca.id = cpa.article_id WHERE ca.art_id IN (%s))",
+			strings.Join(pHolders, ","),
+		))
+	}
+
+	if len(ff.Statuses) > 0 {
+		pHolders := make([]string, 0, len(ff.Statuses))
+		for _, st := range ff.Statuses {
+			values = append(values, st)
+			pHolders = append(pHolders, fmt.Sprintf("$%d", len(values)))
+		}
+		filterQueries = append(filterQueries, fmt.Sprintf("p.status IN (%s)", strings.Join(pHolders, ",")))
+	} else {
+		filterQueries = append(filterQueries, "p.status <> 'archived'")
 	}
 
 	var filters string
@@ -68,60 +99,116 @@ func (productRepo) FindAll(ctx context.Context, db product.Executor, ff *product
 		filters = fmt.Sprintf("WHERE %s", strings.Join(filterQueries, " AND "))
 	}
 
+	var having string
+	if ff.InStock {
+		having = "HAVING MIN((a.stock - COALESCE(e.qty, 0)) / pa.amount) > 0"
+	}
+
+	order := productsOrder(ff.Sort)
+
+	var pagination string
+	if ff.Limit > 0 {
+		values = append(values, ff.Limit)
+		pagination = fmt.Sprintf("LIMIT $%d", len(values))
+	}
+	if ff.Offset > 0 {
+		values = append(values, ff.Offset)
+		pagination += fmt.Sprintf(" OFFSET $%d", len(values))
+	}
+
 	stmt := fmt.Sprintf(`
-		SELECT p.id, p.barcode, p.name, 
+		WITH current_pa AS (
+			SELECT * FROM product_articles WHERE effective_from <= now() AND (effective_to IS NULL OR effective_to > now())
+		),
+		expired AS (
+			SELECT article_id, SUM(qty) AS qty FROM lots WHERE expires_at <= now() GROUP BY article_id
+		),
+		p AS (
+			SELECT p.id, p.barcode, p.name, p.status, p.archived_at, MAX(pa.revision) AS revision,
+			GREATEST(MIN((a.stock - COALESCE(e.qty, 0)) / pa.amount), 0) AS available_quantity
+			FROM products p
+			JOIN current_pa pa ON p.id = pa.product_id
+			JOIN articles a ON a.id = pa.article_id
+			LEFT JOIN expired e ON e.article_id = a.id
+			%s
+			GROUP BY p.id
+			%s
+			ORDER BY %s
+			%s
+		)
+		SELECT p.id, p.barcode, p.name, p.status, p.archived_at, p.revision, p.available_quantity,
 		a.id, a.art_id, a.name, pa.amount, a.stock
-		FROM products p
-		JOIN product_articles pa ON p.id = pa.product_id
+		FROM p
+		JOIN current_pa pa ON p.id = pa.product_id
 		JOIN articles a ON a.id = pa.article_id
-		%s
-	`, filters)
+		ORDER BY %s, pa.id
+	`, filters, having, order, pagination, order)
 
 	rows, err := db.QueryContext(ctx, stmt, values...)
 	if err != nil {
-		return nil, errors.E(op, err)
+		return nil, dbError(op, err)
 	}
 	defer rows.Close()
 
-	pp := map[product.ID]*product.StockInfo{}
-	var order []product.ID
+	res := []*product.StockInfo{}
+	var last *product.StockInfo
 
 	for rows.Next() {
 		var p product.StockInfo
 		var art product.ArticleStock
+		var archivedAt sql.NullTime
 
-		err := rows.Scan(&p.ID, &p.Barcode, &p.Name, &art.ID, &art.ArtID, &art.Name, &art.RequiredAmount, &art.Stock)
+		err := rows.Scan(&p.ID, &p.Barcode, &p.Name, &p.Status, &archivedAt, &p.Revision, &p.AvailableQty, &art.ID, &art.ArtID, &art.Name, &art.RequiredAmount, &art.Stock)
 		if err != nil {
-			return nil, errors.E(op, err)
+			return nil, dbError(op, err)
 		}
 
-		if found, ok := pp[p.ID]; ok {
-			found.Articles = append(found.Articles, &art)
+		if archivedAt.Valid {
+			p.ArchivedAt = &archivedAt.Time
+		}
+
+		// Rows of a product are adjacent since they are ordered by product first.
+		if last != nil && last.ID == p.ID {
+			last.Articles = append(last.Articles, &art)
 			continue
 		}
 		p.Articles = []*product.ArticleStock{&art}
-		pp[p.ID] = &p
-		order = append(order, p.ID)
-	}
-
-	res := make([]*product.StockInfo, 0, len(order))
-	for _, id := range order {
-		p := pp[id]
-		minStock := math.MaxInt64
-		for _, art := range p.Articles {
-			if art.Stock/art.RequiredAmount < minStock {
-				minStock = art.Stock / art.RequiredAmount
-			}
-		}
-		p.AvailableQty = minStock
-		res = append(res, p)
+		last = &p
+		res = append(res, &p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, dbError(op, err)
 	}
 
 	return res, nil
 }
 
-func (productRepo) BatchInsert(ctx context.Context, db product.Executor, pp []*product.Product) ([]*product.Product, error) {
+// productsOrder returns the ORDER BY clause for the products cte. IDs are used as a
+// tie breaker so that pagination is stable.
+func productsOrder(s *product.Sort) string {
+	if s == nil {
+		return "p.id"
+	}
+
+	dir := "ASC"
+	if s.Desc {
+		dir = "DESC"
+	}
+
+	switch s.Field {
+	case product.SortByName:
+		return fmt.Sprintf("p.name %s, p.id", dir)
+	case product.SortByAvailability:
+		return fmt.Sprintf("available_quantity %s, p.id", dir)
+	default:
+		return fmt.Sprintf("p.id %s", dir)
+	}
+}
+
+func (productRepo) BatchInsert(ctx context.Context, db product.Executor, pp []*product.Product) (_ []*product.Product, err error) {
 	var op errors.Op = "productRepo.batchInsert"
+	ctx, db, span := traceOp(ctx, db, op)
+	defer func() { tracing.End(span, err) }()
 
 	values := make([]interface{}, 0, len(pp))
 	pHolders := make([]string, 0, len(pp))
@@ -138,7 +225,7 @@ func (productRepo) BatchInsert(ctx context.Context, db product.Executor, pp []*p
 
 	rows, err := db.QueryContext(ctx, stmt, values...)
 	if err != nil {
-		return nil, errors.E(op, err)
+		return nil, dbError(op, err)
 	}
 	defer rows.Close()
 
@@ -147,7 +234,7 @@ func (productRepo) BatchInsert(ctx context.Context, db product.Executor, pp []*p
 	for rows.Next() {
 		var art product.Product
 		if err := rows.Scan(&art.ID, &art.Barcode, &art.Name); err != nil {
-			return nil, errors.E(op, err)
+			return nil, dbError(op, err)
 		}
 		inserted = append(inserted, &art)
 	}
@@ -156,8 +243,10 @@ func (productRepo) BatchInsert(ctx context.Context, db product.Executor, pp []*p
 }
 
 // InsertProductArticles puts the articles of products into product_articles table.
-func (productRepo) InsertProductArticles(ctx context.Context, db product.Executor, arts []*product.ArticleRow) error {
+func (productRepo) InsertProductArticles(ctx context.Context, db product.Executor, arts []*product.ArticleRow) (err error) {
 	var op errors.Op = "productRepo.insertProductArticles"
+	ctx, db, span := traceOp(ctx, db, op)
+	defer func() { tracing.End(span, err) }()
 
 	pHolders := make([]string, 0, len(arts))
 	values := make([]interface{}, 0, len(arts)*3)
@@ -174,9 +263,147 @@ func (productRepo) InsertProductArticles(ctx context.Context, db product.Executo
 		INSERT INTO product_articles (amount, product_id, article_id) VALUES %s
 	`, strings.Join(pHolders, ", "))
 
-	_, err := db.ExecContext(ctx, stmt, values...)
+	_, err = db.ExecContext(ctx, stmt, values...)
+	if err != nil {
+		return dbError(op, err)
+	}
+
+	return nil
+}
+
+// UpdateStatus moves a product from a status to another. Archiving sets the archive
+// time, other states clear it.
+func (productRepo) UpdateStatus(ctx context.Context, db product.Executor, ID product.ID, from, to product.Status) (err error) {
+	var op errors.Op = "productRepo.updateStatus"
+	ctx, db, span := traceOp(ctx, db, op)
+	defer func() { tracing.End(span, err) }()
+
+	res, err := db.ExecContext(ctx, `
+		UPDATE products SET status = $1, archived_at = CASE WHEN $2 THEN current_timestamp END
+		WHERE id = $3 AND status = $4
+	`, to, to == product.StatusArchived, ID, from)
+	if err != nil {
+		return dbError(op, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return dbError(op, err)
+	}
+	if n > 0 {
+		return nil
+	}
+
+	var st product.Status
+	err = db.QueryRowContext(ctx, "SELECT status FROM products WHERE id = $1", ID).Scan(&st)
+	if err == sql.ErrNoRows {
+		return errors.E(op, errors.NotFound, "Product not found")
+	}
+	if err != nil {
+		return dbError(op, err)
+	}
+	return errors.E(op, errors.Invalid, fmt.Sprintf("Product is no longer %s", from))
+}
+
+// Lock locks the row of the product until the transaction of db ends.
+func (productRepo) Lock(ctx context.Context, db product.Executor, ID product.ID) (err error) {
+	var op errors.Op = "productRepo.lock"
+	ctx, db, span := traceOp(ctx, db, op)
+	defer func() { tracing.End(span, err) }()
+
+	var locked product.ID
+	err = db.QueryRowContext(ctx, "SELECT id FROM products WHERE id = $1 FOR UPDATE", ID).Scan(&locked)
+	if err == sql.ErrNoRows {
+		return errors.E(op, errors.NotFound, "Product not found")
+	}
+	if err != nil {
+		return dbError(op, err)
+	}
+
+	return nil
+}
+
+// FindRevisions returns the revisions of the bill of materials of a product, oldest first.
+func (productRepo) FindRevisions(ctx context.Context, db product.Executor, ID product.ID) (_ []*product.Revision, err error) {
+	var op errors.Op = "productRepo.findRevisions"
+	ctx, db, span := traceOp(ctx, db, op)
+	defer func() { tracing.End(span, err) }()
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT pa.revision, pa.effective_from, pa.effective_to, a.id, a.art_id, a.name, pa.amount
+		FROM product_articles pa
+		JOIN articles a ON a.id = pa.article_id
+		WHERE pa.product_id = $1
+		ORDER BY pa.revision, pa.id
+	`, ID)
+	if err != nil {
+		return nil, dbError(op, err)
+	}
+	defer rows.Close()
+
+	rr := []*product.Revision{}
+	var last *product.Revision
+	for rows.Next() {
+		var r product.Revision
+		var a product.Article
+		var effectiveTo sql.NullTime
+		if err := rows.Scan(&r.Number, &r.EffectiveFrom, &effectiveTo, &a.ID, &a.ArtID, &a.Name, &a.Amount); err != nil {
+			return nil, dbError(op, err)
+		}
+
+		if last != nil && last.Number == r.Number {
+			last.Articles = append(last.Articles, &a)
+			continue
+		}
+		if effectiveTo.Valid {
+			r.EffectiveTo = &effectiveTo.Time
+		}
+		r.Articles = []*product.Article{&a}
+		last = &r
+		rr = append(rr, &r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, dbError(op, err)
+	}
+
+	return rr, nil
+}
+
+// InsertRevision ends the latest revision of a product at the effective time of the new
+// revision and inserts the articles of the new revision.
+func (productRepo) InsertRevision(ctx context.Context, db product.Executor, ID product.ID, rev *product.Revision) (err error) {
+	var op errors.Op = "productRepo.insertRevision"
+	ctx, db, span := traceOp(ctx, db, op)
+	defer func() { tracing.End(span, err) }()
+
+	_, err = db.ExecContext(ctx, "UPDATE product_articles SET effective_to = $1 WHERE product_id = $2 AND effective_to IS NULL", rev.EffectiveFrom, ID)
+	if err != nil {
+		return dbError(op, err)
+	}
+
+	pHolders := make([]string, 0, len(rev.Articles))
+	values := []interface{}{rev.EffectiveFrom, ID, rev.Number}
+	for _, a := range rev.Articles {
+		values = append(values, a.Amount, a.ID)
+		pHolders = append(pHolders, fmt.Sprintf("($%d, $2, $%d, $3, $1)", len(values)-1, len(values)))
+	}
+
+	stmt := "INSERT INTO product_articles (amount, product_id, article_id, revision, effective_from) VALUES " + strings.Join(pHolders, ", ")
+	if _, err := db.ExecContext(ctx, stmt, values...); err != nil {
+		return dbError(op, err)
+	}
+
+	return nil
+}
+
+// InsertRemoval records the removal of units of a product.
+func (productRepo) InsertRemoval(ctx context.Context, db product.Executor, rm *product.Removal) (err error) {
+	var op errors.Op = "productRepo.insertRemoval"
+	ctx, db, span := traceOp(ctx, db, op)
+	defer func() { tracing.End(span, err) }()
+
+	_, err = db.ExecContext(ctx, "INSERT INTO removals (product_id, revision, qty) VALUES ($1, $2, $3)", rm.ProductID, rm.Revision, rm.Qty)
 	if err != nil {
-		return errors.E(op, err)
+		return dbError(op, err)
 	}
 
 	return nil
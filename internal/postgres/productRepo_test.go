@@ -0,0 +1,272 @@
+package postgres_test
+
+import (
+	"context"
+	"math"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/mtekmir/warehouse-service/internal/article"
+	"github.com/mtekmir/warehouse-service/internal/errors"
+	"github.com/mtekmir/warehouse-service/internal/postgres"
+	"github.com/mtekmir/warehouse-service/internal/product"
+	"github.com/mtekmir/warehouse-service/test"
+)
+
+func TestFindAllProducts(t *testing.T) {
+	db, dbTidy := test.SetupDB(t)
+	defer dbTidy()
+
+	test.CreateProductTables(t, db)
+	ar := postgres.NewArticleRepo()
+	pr := postgres.NewProductRepo()
+	ctx := context.Background()
+
+	arts, err := ar.BatchInsert(ctx, db, []*article.Article{
+		{ArtID: "1", Name: "leg", Stock: 12},
+		{ArtID: "2", Name: "screw", Stock: 30},
+		{ArtID: "3", Name: "board", Stock: 0},
+	})
+	if err != nil {
+		t.Fatalf("Unable to insert articles. %v", err)
+	}
+
+	pp, err := pr.BatchInsert(ctx, db, []*product.Product{
+		{Barcode: "b1", Name: "chair"},
+		{Barcode: "b2", Name: "stool"},
+		{Barcode: "b3", Name: "table"},
+	})
+	if err != nil {
+		t.Fatalf("Unable to insert products. %v", err)
+	}
+
+	err = pr.InsertProductArticles(ctx, db, []*product.ArticleRow{
+		{ProductID: pp[0].ID, ID: arts[0].ID, Amount: 4},
+		{ProductID: pp[0].ID, ID: arts[1].ID, Amount: 8},
+		{ProductID: pp[1].ID, ID: arts[0].ID, Amount: 3},
+		{ProductID: pp[2].ID, ID: arts[0].ID, Amount: 4},
+		{ProductID: pp[2].ID, ID: arts[2].ID, Amount: 1},
+	})
+	if err != nil {
+		t.Fatalf("Unable to insert product articles. %v", err)
+	}
+
+	chair := &product.StockInfo{ID: pp[0].ID, Barcode: "b1", Name: "chair", Status: product.StatusActive, Revision: 1, AvailableQty: 3, Articles: []*product.ArticleStock{
+		{ID: arts[0].ID, ArtID: "1", Name: "leg", Stock: 12, RequiredAmount: 4},
+		{ID: arts[1].ID, ArtID: "2", Name: "screw", Stock: 30, RequiredAmount: 8},
+	}}
+	stool := &product.StockInfo{ID: pp[1].ID, Barcode: "b2", Name: "stool", Status: product.StatusActive, Revision: 1, AvailableQty: 4, Articles: []*product.ArticleStock{
+		{ID: arts[0].ID, ArtID: "1", Name: "leg", Stock: 12, RequiredAmount: 3},
+	}}
+	table := &product.StockInfo{ID: pp[2].ID, Barcode: "b3", Name: "table", Status: product.StatusActive, Revision: 1, AvailableQty: 0, Articles: []*product.ArticleStock{
+		{ID: arts[0].ID, ArtID: "1", Name: "leg", Stock: 12, RequiredAmount: 4},
+		{ID: arts[2].ID, ArtID: "3", Name: "board", Stock: 0, RequiredAmount: 1},
+	}}
+
+	tests := []struct {
+		name     string
+		ff       *product.Filters
+		expected []*product.StockInfo
+	}{
+		{"all", &product.Filters{}, []*product.StockInfo{chair, stool, table}},
+		{"by id", &product.Filters{ID: &pp[1].ID}, []*product.StockInfo{stool}},
+		{"by barcodes", &product.Filters{BB: &[]product.Barcode{"b1", "b3"}}, []*product.StockInfo{chair, table}},
+		{"in stock", &product.Filters{InStock: true}, []*product.StockInfo{chair, stool}},
+		{"by availability", &product.Filters{Sort: &product.Sort{Field: product.SortByAvailability, Desc: true}}, []*product.StockInfo{stool, chair, table}},
+		{"by name desc", &product.Filters{Sort: &product.Sort{Field: product.SortByName, Desc: true}}, []*product.StockInfo{table, stool, chair}},
+		{"paginated", &product.Filters{Limit: 1, Offset: 1}, []*product.StockInfo{stool}},
+	}
+
+	for _, tt := range tests {
+		found, err := pr.FindAll(ctx, db, tt.ff)
+		if err != nil {
+			t.Errorf("Unable to find products (%s). %v", tt.name, err)
+			continue
+		}
+		test.Compare(t, "product", tt.expected, found)
+	}
+}
+
+// BenchmarkFindAllProducts compares calculating available quantities in the db
+// against calculating them in go, on a catalogue of 100k products.
+func BenchmarkFindAllProducts(b *testing.B) {
+	db, dbTidy := test.SetupDB(b)
+	defer dbTidy()
+
+	test.CreateProductTables(b, db)
+
+	stmts := []string{
+		`INSERT INTO articles (art_id, name, stock)
+		SELECT i::varchar, 'article_' || i, (i * 7919) % 500 FROM generate_series(1, 1000) i`,
+		`INSERT INTO products (barcode, name)
+		SELECT i::varchar, 'product_' || i FROM generate_series(1, 100000) i`,
+		`INSERT INTO product_articles (amount, product_id, article_id)
+		SELECT (p + a) % 10 + 1, p, (p * a) % 1000 + 1
+		FROM generate_series(1, 100000) p, generate_series(1, 3) a`,
+		`ANALYZE`,
+	}
+	for _, s := range stmts {
+		if _, err := db.Exec(s); err != nil {
+			b.Fatalf("Unable to seed the catalogue. %v", err)
+		}
+	}
+
+	pr := postgres.NewProductRepo()
+	ctx := context.Background()
+
+	page := &product.Filters{
+		InStock: true,
+		Sort:    &product.Sort{Field: product.SortByAvailability, Desc: true},
+		Limit:   50,
+		Offset:  100,
+	}
+
+	benchmarks := []struct {
+		name    string
+		findAll func(context.Context, product.Executor, *product.Filters) ([]*product.StockInfo, error)
+		ff      *product.Filters
+	}{
+		{"sql/all", pr.FindAll, &product.Filters{}},
+		{"go/all", findAllInGo, &product.Filters{}},
+		{"sql/in_stock_page", pr.FindAll, page},
+		{"go/in_stock_page", findAllInGo, page},
+	}
+
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := bm.findAll(ctx, db, bm.ff); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// findAllInGo is the former implementation of productRepo.FindAll which fetches every
+// product article row and calculates available quantities in go. Filtering, sorting and
+// pagination by availability have to happen after all the rows are loaded.
+func findAllInGo(ctx context.Context, db product.Executor, ff *product.Filters) ([]*product.StockInfo, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT p.id, p.barcode, p.name,
+		a.id, a.art_id, a.name, pa.amount, a.stock
+		FROM products p
+		JOIN product_articles pa ON p.id = pa.product_id
+		JOIN articles a ON a.id = pa.article_id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	pp := map[product.ID]*product.StockInfo{}
+	var order []product.ID
+
+	for rows.Next() {
+		var p product.StockInfo
+		var art product.ArticleStock
+
+		err := rows.Scan(&p.ID, &p.Barcode, &p.Name, &art.ID, &art.ArtID, &art.Name, &art.RequiredAmount, &art.Stock)
+		if err != nil {
+			return nil, err
+		}
+
+		if found, ok := pp[p.ID]; ok {
+			found.Articles = append(found.Articles, &art)
+			continue
+		}
+		p.Articles = []*product.ArticleStock{&art}
+		pp[p.ID] = &p
+		order = append(order, p.ID)
+	}
+
+	res := make([]*product.StockInfo, 0, len(order))
+	for _, id := range order {
+		p := pp[id]
+		minStock := math.MaxInt64
+		for _, art := range p.Articles {
+			if art.Stock/art.RequiredAmount < minStock {
+				minStock = art.Stock / art.RequiredAmount
+			}
+		}
+		p.AvailableQty = minStock
+		if ff.InStock && p.AvailableQty <= 0 {
+			continue
+		}
+		res = append(res, p)
+	}
+
+	if ff.Sort != nil && ff.Sort.Field == product.SortByAvailability {
+		sort.SliceStable(res, func(i, j int) bool {
+			if ff.Sort.Desc {
+				return res[i].AvailableQty > res[j].AvailableQty
+			}
+			return res[i].AvailableQty < res[j].AvailableQty
+		})
+	}
+
+	if offset := ff.Offset; offset > 0 {
+		if offset > len(res) {
+			offset = len(res)
+		}
+		res = res[offset:]
+	}
+	if ff.Limit > 0 && ff.Limit < len(res) {
+		res = res[:ff.Limit]
+	}
+
+	return res, nil
+}
+
+func TestProductRepo_Lock(t *testing.T) {
+	db, dbTidy := test.SetupDB(t)
+	defer dbTidy()
+
+	test.CreateProductTables(t, db)
+	pr := postgres.NewProductRepo()
+	ctx := context.Background()
+
+	pp, err := pr.BatchInsert(ctx, db, []*product.Product{{Barcode: "b1", Name: "chair"}})
+	if err != nil {
+		t.Fatalf("Unable to insert products. %v", err)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatalf("Unable to begin a transaction. %v", err)
+	}
+	defer tx.Rollback()
+	if err := pr.Lock(ctx, tx, pp[0].ID); err != nil {
+		t.Fatalf("Unable to lock the product. %v", err)
+	}
+
+	// The second lock waits for the first transaction.
+	locked := make(chan error, 1)
+	go func() {
+		tx2, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			locked <- err
+			return
+		}
+		defer tx2.Rollback()
+		locked <- pr.Lock(ctx, tx2, pp[0].ID)
+	}()
+	select {
+	case err := <-locked:
+		t.Fatalf("Expected the second lock to wait. Got %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Unable to commit. %v", err)
+	}
+	if err := <-locked; err != nil {
+		t.Errorf("Unable to lock the product. %v", err)
+	}
+
+	err = pr.Lock(ctx, db, 100)
+	if e, ok := err.(*errors.Error); !ok || e.Kind != errors.NotFound {
+		t.Errorf("Expected a NotFound error for a missing product. Got %v", err)
+	}
+}
@@ -2,15 +2,21 @@ package postgres
 
 import (
 	"database/sql"
+	"io/fs"
 
 	// Postgres driver
 	_ "github.com/jackc/pgx/v4/stdlib"
 	"github.com/sirupsen/logrus"
 )
 
+// Open opens the db without running the migrations.
+func Open(dbURL string) (*sql.DB, error) {
+	return sql.Open("pgx", dbURL)
+}
+
 // Setup sets up the db runs migrations and returns a func to close it.
-func Setup(log *logrus.Logger, dbURL, migrationsPath string) (*sql.DB, func(), error) {
-	db, err := sql.Open("pgx", dbURL)
+func Setup(log *logrus.Logger, dbURL string, migrations fs.FS) (*sql.DB, func(), error) {
+	db, err := Open(dbURL)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -18,7 +24,7 @@ func Setup(log *logrus.Logger, dbURL, migrationsPath string) (*sql.DB, func(), e
 
 	dbTidy := func() { db.Close() }
 
-	if err := Migrate(log, db, migrationsPath); err != nil {
+	if err := Migrate(log, db, migrations); err != nil {
 		return nil, dbTidy, err
 	}
 
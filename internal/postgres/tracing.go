@@ -0,0 +1,67 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"github.com/mtekmir/warehouse-service/internal/errors"
+	"github.com/mtekmir/warehouse-service/internal/tracing"
+	semconv "go.opentelemetry.io/otel/semconv/v1.43.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// executor is the common method set of the executors of the domain packages.
+type executor interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// tracedExecutor records every query as a span carrying the statement.
+type tracedExecutor struct {
+	db executor
+}
+
+// traceOp starts the span of a repo method and returns an executor that records the
+// queries of the method as child spans.
+func traceOp(ctx context.Context, db executor, op errors.Op) (context.Context, executor, trace.Span) {
+	if t, ok := db.(tracedExecutor); ok {
+		db = t.db
+	}
+	ctx, span := tracing.Start(ctx, string(op))
+	return ctx, tracedExecutor{db: db}, span
+}
+
+func startQuery(ctx context.Context, stmt string) (context.Context, trace.Span) {
+	operation := "QUERY"
+	if f := strings.Fields(stmt); len(f) > 0 {
+		operation = strings.ToUpper(f[0])
+	}
+	return tracing.StartClient(ctx, operation,
+		semconv.DBSystemNamePostgreSQL,
+		semconv.DBOperationName(operation),
+		semconv.DBQueryText(stmt),
+	)
+}
+
+func (t tracedExecutor) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	ctx, span := startQuery(ctx, query)
+	row := t.db.QueryRowContext(ctx, query, args...)
+	tracing.End(span, row.Err())
+	return row
+}
+
+func (t tracedExecutor) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	ctx, span := startQuery(ctx, query)
+	res, err := t.db.ExecContext(ctx, query, args...)
+	tracing.End(span, err)
+	return res, err
+}
+
+func (t tracedExecutor) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	ctx, span := startQuery(ctx, query)
+	rows, err := t.db.QueryContext(ctx, query, args...)
+	tracing.End(span, err)
+	return rows, err
+}
@@ -0,0 +1,63 @@
+package product
+
+import (
+	"sort"
+	"time"
+
+	"github.com/mtekmir/warehouse-service/internal/article"
+)
+
+// Revision is a version of the bill of materials of a product. A revision is in effect
+// from its effective time until the effective time of the next revision. Imported
+// products start with revision 1.
+type Revision struct {
+	Number        int          `json:"revision"`
+	EffectiveFrom time.Time    `json:"effective_from"`
+	EffectiveTo   *time.Time   `json:"effective_to,omitempty"` // Nil for the latest revision.
+	Articles      []*Article   `json:"articles"`
+	Changes       []*BOMChange `json:"changes"` // Changes from the previous revision.
+}
+
+// BOMChange is a change of the required amount of an article between two revisions.
+type BOMChange struct {
+	ArtID article.ArtID `json:"art_id"`
+	Name  string        `json:"name"`
+	From  int           `json:"from_amount"` // Zero if the article was added.
+	To    int           `json:"to_amount"`   // Zero if the article was removed.
+}
+
+// Diff returns the changes of the articles from one revision to another, ordered by
+// art ids. A nil from revision means that all the articles were added.
+func Diff(from, to *Revision) []*BOMChange {
+	changes := map[article.ArtID]*BOMChange{}
+	if from != nil {
+		for _, a := range from.Articles {
+			changes[a.ArtID] = &BOMChange{ArtID: a.ArtID, Name: a.Name, From: a.Amount}
+		}
+	}
+	for _, a := range to.Articles {
+		c, ok := changes[a.ArtID]
+		if !ok {
+			c = &BOMChange{ArtID: a.ArtID, Name: a.Name}
+			changes[a.ArtID] = c
+		}
+		c.To = a.Amount
+	}
+
+	res := []*BOMChange{}
+	for _, c := range changes {
+		if c.From != c.To {
+			res = append(res, c)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].ArtID < res[j].ArtID })
+	return res
+}
+
+// Removal records units of a product that were removed from the stock and the revision
+// of the bill of materials that they consumed.
+type Removal struct {
+	ProductID ID
+	Revision  int
+	Qty       int
+}
@@ -0,0 +1,36 @@
+package product_test
+
+import (
+	"testing"
+
+	"github.com/mtekmir/warehouse-service/internal/product"
+	"github.com/mtekmir/warehouse-service/test"
+)
+
+func TestDiff(t *testing.T) {
+	t.Parallel()
+	from := &product.Revision{Number: 1, Articles: []*product.Article{
+		{ArtID: "3", Name: "top", Amount: 1},
+		{ArtID: "1", Name: "leg", Amount: 4},
+		{ArtID: "2", Name: "screw", Amount: 8},
+	}}
+	to := &product.Revision{Number: 2, Articles: []*product.Article{
+		{ArtID: "1", Name: "leg", Amount: 4},
+		{ArtID: "2", Name: "screw", Amount: 12},
+		{ArtID: "4", Name: "glass top", Amount: 1},
+	}}
+
+	test.Compare(t, "changes", []*product.BOMChange{
+		{ArtID: "2", Name: "screw", From: 8, To: 12},
+		{ArtID: "3", Name: "top", From: 1, To: 0},
+		{ArtID: "4", Name: "glass top", From: 0, To: 1},
+	}, product.Diff(from, to))
+
+	test.Compare(t, "first revision", []*product.BOMChange{
+		{ArtID: "1", Name: "leg", To: 4},
+		{ArtID: "2", Name: "screw", To: 8},
+		{ArtID: "3", Name: "top", To: 1},
+	}, product.Diff(nil, from))
+
+	test.Compare(t, "no changes", []*product.BOMChange{}, product.Diff(to, to))
+}
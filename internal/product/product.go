@@ -2,7 +2,9 @@ package product
 
 import (
 	"encoding/json"
+	"fmt"
 	"strconv"
+	"time"
 
 	"github.com/mtekmir/warehouse-service/internal/article"
 	"github.com/mtekmir/warehouse-service/internal/errors"
@@ -14,6 +16,50 @@ type ID int
 // Barcode of a product.
 type Barcode string
 
+// Status is the lifecycle state of a product.
+type Status string
+
+// Lifecycle states of products. Products are created active.
+const (
+	StatusDraft        Status = "draft"        // Not released yet, can't be removed from the stock.
+	StatusActive       Status = "active"       // Released, can be removed from the stock.
+	StatusDiscontinued Status = "discontinued" // Not made anymore, can't be removed from the stock.
+	StatusArchived     Status = "archived"     // Soft deleted, left out of listings by default.
+)
+
+// Statuses are all the lifecycle states.
+var Statuses = []Status{StatusDraft, StatusActive, StatusDiscontinued, StatusArchived}
+
+// transitions are the states that products in a state can move to.
+var transitions = map[Status][]Status{
+	StatusDraft:        {StatusActive, StatusArchived},
+	StatusActive:       {StatusDiscontinued, StatusArchived},
+	StatusDiscontinued: {StatusActive, StatusArchived},
+	StatusArchived:     {StatusDraft},
+}
+
+// CanTransition reports whether a product in the state can move to the to state.
+func (s Status) CanTransition(to Status) bool {
+	for _, t := range transitions[s] {
+		if t == to {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseStatus parses a lifecycle state.
+func ParseStatus(s string) (Status, error) {
+	var op errors.Op = "product.parseStatus"
+
+	for _, st := range Statuses {
+		if Status(s) == st {
+			return st, nil
+		}
+	}
+	return "", errors.E(op, errors.Invalid, fmt.Sprintf("Unknown product status %s", s))
+}
+
 // Product represents a product that is made of a set of articles.
 type Product struct {
 	ID       ID         `json:"id"`
@@ -34,18 +80,35 @@ func (prd *Product) UnmarshalJSON(data []byte) error {
 		return errors.E(op, err)
 	}
 
-	if p.Barcode == "" {
+	if err := prd.Validate(); err != nil {
+		return errors.E(op, err)
+	}
+
+	return nil
+}
+
+// Validate checks that the product has the required fields.
+func (prd *Product) Validate() error {
+	var op errors.Op = "product.validate"
+
+	if prd.Barcode == "" {
 		return errors.E(op, "Barcode must not be empty", errors.Invalid)
 	}
 
-	if p.Name == "" {
+	if prd.Name == "" {
 		return errors.E(op, "Product name must not be empty", errors.Invalid)
 	}
 
-	if len(p.Articles) == 0 {
+	if len(prd.Articles) == 0 {
 		return errors.E(op, "Product must contain at least one article", errors.Invalid)
 	}
 
+	for _, a := range prd.Articles {
+		if a.Amount <= 0 {
+			return errors.E(op, errors.Invalid, "Amount must be bigger than 0")
+		}
+	}
+
 	return nil
 }
 
@@ -108,6 +171,9 @@ type StockInfo struct {
 	ID           ID              `json:"id"`
 	Barcode      Barcode         `json:"barcode"`
 	Name         string          `json:"name"`
-	AvailableQty int             `json:"available_quantity"`
+	Status       Status          `json:"status"`
+	ArchivedAt   *time.Time      `json:"archived_at,omitempty"` // Set while the product is archived.
+	Revision     int             `json:"revision"`              // Revision of the bill of materials in effect.
+	AvailableQty int             `json:"available_quantity"`    // Units of expired lots aren't used.
 	Articles     []*ArticleStock `json:"contain_articles"`
 }
@@ -4,10 +4,18 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/mtekmir/warehouse-service/internal/article"
+	"github.com/mtekmir/warehouse-service/internal/audit"
 	"github.com/mtekmir/warehouse-service/internal/errors"
+	"github.com/mtekmir/warehouse-service/internal/logs"
+	"github.com/mtekmir/warehouse-service/internal/outbox"
+	"github.com/mtekmir/warehouse-service/internal/tracing"
+	"github.com/mtekmir/warehouse-service/internal/txhook"
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // Executor provides an interface for required db methods.
@@ -19,8 +27,44 @@ type Executor interface {
 
 // Filters are used to filter get products queries.
 type Filters struct {
-	BB *[]Barcode
-	ID *ID
+	BB       *[]Barcode
+	ID       *ID
+	ArtIDs   *[]article.ArtID // Only products whose bills of materials in effect contain any of the articles.
+	Statuses []Status         // Defaults to all states but archived.
+	InStock  bool             // Only return products with available quantity bigger than 0.
+	Sort     *Sort            // Defaults to ascending order of IDs.
+	Limit    int              // Zero means no limit.
+	Offset   int
+}
+
+// SortField is a field that products can be sorted by.
+type SortField string
+
+// Sort fields of products.
+const (
+	SortByID           SortField = "id"
+	SortByName         SortField = "name"
+	SortByAvailability SortField = "available_quantity"
+)
+
+// Sort describes the order of the products.
+type Sort struct {
+	Field SortField
+	Desc  bool
+}
+
+// ParseSort parses a sort query such as "available_quantity" or "-name". A leading
+// "-" means descending order.
+func ParseSort(s string) (*Sort, error) {
+	var op errors.Op = "product.parseSort"
+
+	sort := &Sort{Field: SortField(strings.TrimPrefix(s, "-")), Desc: strings.HasPrefix(s, "-")}
+	switch sort.Field {
+	case SortByID, SortByName, SortByAvailability:
+		return sort, nil
+	default:
+		return nil, errors.E(op, errors.Invalid, fmt.Sprintf("Unable to sort by %s", sort.Field))
+	}
 }
 
 // Repo provides methods for managing products in a db.
@@ -29,6 +73,22 @@ type Repo interface {
 	BatchInsert(context.Context, Executor, []*Product) ([]*Product, error)
 	InsertProductArticles(context.Context, Executor, []*ArticleRow) error
 	ExistingProductsMap(context.Context, Executor, []*Barcode) (map[Barcode]ID, error)
+	// UpdateStatus moves a product from a status to another, archiving sets the archive
+	// time and other states clear it. Returns a NotFound error if the product doesn't
+	// exist and an Invalid error if it's no longer in the from status.
+	UpdateStatus(ctx context.Context, db Executor, ID ID, from, to Status) error
+	// Lock locks a product until the transaction of db ends, so that concurrent
+	// transactions change it one after another. Returns a NotFound error if the product
+	// doesn't exist.
+	Lock(context.Context, Executor, ID) error
+	// FindRevisions returns the revisions of the bill of materials of a product, oldest
+	// first. Changes of the revisions aren't set.
+	FindRevisions(context.Context, Executor, ID) ([]*Revision, error)
+	// InsertRevision ends the latest revision of a product at the effective time of the
+	// new revision and inserts the articles of the new revision.
+	InsertRevision(context.Context, Executor, ID, *Revision) error
+	// InsertRemoval records the removal of units of a product.
+	InsertRemoval(context.Context, Executor, *Removal) error
 }
 
 // Service exposes methods on products.
@@ -37,12 +97,15 @@ type Service struct {
 	db          *sql.DB
 	productRepo Repo
 	articleRepo article.Repo
+	outbox      outbox.Repo
 }
 
 // FindAll returns a slice of products with stock information. If barcodes slice is null
 // all products will be returned.
-func (s *Service) FindAll(ctx context.Context, ff *Filters) ([]*StockInfo, error) {
+func (s *Service) FindAll(ctx context.Context, ff *Filters) (_ []*StockInfo, err error) {
 	var op errors.Op = "productService.findAll"
+	ctx, span := tracing.Start(ctx, string(op))
+	defer func() { tracing.End(span, err) }()
 
 	pp, err := s.productRepo.FindAll(ctx, s.db, ff)
 	if err != nil {
@@ -53,8 +116,10 @@ func (s *Service) FindAll(ctx context.Context, ff *Filters) ([]*StockInfo, error
 }
 
 // Find returns a product with stock information. If not found an error is returned.
-func (s *Service) Find(ctx context.Context, ID ID) (*StockInfo, error) {
+func (s *Service) Find(ctx context.Context, ID ID) (_ *StockInfo, err error) {
 	var op errors.Op = "productService.find"
+	ctx, span := tracing.Start(ctx, string(op))
+	defer func() { tracing.End(span, err) }()
 
 	pp, err := s.productRepo.FindAll(ctx, s.db, &Filters{ID: &ID})
 	if err != nil {
@@ -69,14 +134,38 @@ func (s *Service) Find(ctx context.Context, ID ID) (*StockInfo, error) {
 }
 
 // Remove subtracts the quantities of the articles of the product from the repository and returns
-// the updated stock information of the product.
-func (s *Service) Remove(ctx context.Context, ID ID, qty int) (*StockInfo, error) {
+// the updated stock information of the product. Lots of the articles are consumed first expired
+// first out. The removal is recorded along with the revision of the bill of materials that it
+// consumed, stock.changed and product.removed events are stored in the outbox with it.
+func (s *Service) Remove(ctx context.Context, ID ID, qty int) (_ *StockInfo, err error) {
 	var op errors.Op = "productService.remove"
+	ctx, span := tracing.Start(ctx, string(op))
+	defer func() { tracing.End(span, err) }()
+
+	if qty < 1 {
+		return nil, errors.E(op, errors.Invalid, "Quantity must be at least 1")
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, errors.E(op, err)
+	}
+	defer txhook.Ended(tx, s.productRepo, s.articleRepo)
+	defer tx.Rollback()
 
-	p, err := s.Find(ctx, ID)
+	pp, err := s.productRepo.FindAll(ctx, tx, &Filters{ID: &ID})
 	if err != nil {
 		return nil, errors.E(op, err)
 	}
+	if len(pp) == 0 {
+		return nil, errors.E(op, errors.NotFound, "Product not found")
+	}
+	p := pp[0]
+
+	// Drafts aren't released yet and discontinued products aren't made anymore.
+	if p.Status != StatusActive {
+		return nil, errors.E(op, errors.Invalid, fmt.Sprintf("Product is %s, only active products can be removed", p.Status))
+	}
 
 	if p.AvailableQty < qty {
 		return nil, errors.E(op, errors.Invalid, fmt.Sprintf("Insufficient stock quantity. Max available quantity: %d", p.AvailableQty))
@@ -87,29 +176,212 @@ func (s *Service) Remove(ctx context.Context, ID ID, qty int) (*StockInfo, error
 		qtyAdjs = append(qtyAdjs, &article.QtyAdjustment{ID: art.ID, Qty: qty * art.RequiredAmount})
 	}
 
-	if err := s.articleRepo.AdjustQuantities(ctx, s.db, article.QtyAdjustmentSubtract, qtyAdjs); err != nil {
+	if err := s.articleRepo.AdjustQuantities(ctx, tx, article.QtyAdjustmentSubtract, qtyAdjs); err != nil {
+		return nil, errors.E(op, err)
+	}
+	if err := s.articleRepo.ConsumeLots(ctx, tx, qtyAdjs, time.Now()); err != nil {
+		return nil, errors.E(op, err)
+	}
+
+	if err := s.productRepo.InsertRemoval(ctx, tx, &Removal{ProductID: ID, Revision: p.Revision, Qty: qty}); err != nil {
 		return nil, errors.E(op, err)
 	}
 
 	p.AvailableQty -= qty
+	changed := &outbox.StockChanged{Reason: outbox.ReasonRemoval, Articles: make([]*outbox.ArticleStock, 0, len(p.Articles))}
 	for _, art := range p.Articles {
 		art.Stock -= art.RequiredAmount * qty
+		changed.Articles = append(changed.Articles, &outbox.ArticleStock{ArtID: string(art.ArtID), Stock: art.Stock})
+	}
+	removed := &outbox.ProductRemoved{ProductID: int(ID), Barcode: string(p.Barcode), Revision: p.Revision, Qty: qty, AvailableQty: p.AvailableQty}
+	if err := outbox.Add(ctx, s.outbox, tx, changed, removed); err != nil {
+		return nil, errors.E(op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, errors.E(op, err)
+	}
+
+	audit.AddTargets(ctx, audit.Target("product", ID))
+	for _, art := range p.Articles {
+		audit.AddTargets(ctx, audit.Target("article", art.ID))
 	}
 
 	return p, nil
 }
 
+// Transition moves the product to the lifecycle state and returns its stock information.
+// Moving a product to its current state does nothing.
+func (s *Service) Transition(ctx context.Context, ID ID, to Status) (_ *StockInfo, err error) {
+	var op errors.Op = "productService.transition"
+	ctx, span := tracing.Start(ctx, string(op), attribute.String("status", string(to)))
+	defer func() { tracing.End(span, err) }()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, errors.E(op, err)
+	}
+	defer txhook.Ended(tx, s.productRepo, s.articleRepo)
+	defer tx.Rollback()
+
+	ff := &Filters{ID: &ID, Statuses: Statuses}
+	pp, err := s.productRepo.FindAll(ctx, tx, ff)
+	if err != nil {
+		return nil, errors.E(op, err)
+	}
+	if len(pp) == 0 {
+		return nil, errors.E(op, errors.NotFound, "Product not found")
+	}
+	if pp[0].Status == to {
+		return pp[0], nil
+	}
+	if !pp[0].Status.CanTransition(to) {
+		return nil, errors.E(op, errors.Invalid, fmt.Sprintf("Product can't be moved from %s to %s", pp[0].Status, to))
+	}
+
+	// The status is only updated if it's still the one checked, so that concurrent
+	// transitions can't skip the checks.
+	if err := s.productRepo.UpdateStatus(ctx, tx, ID, pp[0].Status, to); err != nil {
+		return nil, errors.E(op, err)
+	}
+	if pp, err = s.productRepo.FindAll(ctx, tx, ff); err != nil {
+		return nil, errors.E(op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, errors.E(op, err)
+	}
+	logs.FromContext(ctx, s.log).Printf("Product %d moved to %s", ID, to)
+	audit.AddTargets(ctx, audit.Target("product", ID))
+
+	return pp[0], nil
+}
+
+// Revisions returns the revisions of the bill of materials of the product, oldest first,
+// with their changes from the previous revisions.
+func (s *Service) Revisions(ctx context.Context, ID ID) (_ []*Revision, err error) {
+	var op errors.Op = "productService.revisions"
+	ctx, span := tracing.Start(ctx, string(op))
+	defer func() { tracing.End(span, err) }()
+
+	rr, err := s.productRepo.FindRevisions(ctx, s.db, ID)
+	if err != nil {
+		return nil, errors.E(op, err)
+	}
+	if len(rr) == 0 {
+		return nil, errors.E(op, errors.NotFound, "Product not found")
+	}
+
+	var prev *Revision
+	for _, r := range rr {
+		r.Changes = Diff(prev, r)
+		prev = r
+	}
+
+	return rr, nil
+}
+
+// Revise adds a revision to the bill of materials of the product that takes effect at
+// effectiveFrom, or now if it's zero. The revision must take effect after the latest
+// revision does and not in the past. Articles of the revision must exist.
+func (s *Service) Revise(ctx context.Context, ID ID, effectiveFrom time.Time, arts []*Article) (_ *Revision, err error) {
+	var op errors.Op = "productService.revise"
+	ctx, span := tracing.Start(ctx, string(op), attribute.Int("articles", len(arts)))
+	defer func() { tracing.End(span, err) }()
+
+	if len(arts) == 0 {
+		return nil, errors.E(op, errors.Invalid, "Revision must contain at least one article")
+	}
+	artIDs := make([]article.ArtID, 0, len(arts))
+	seen := make(map[article.ArtID]bool, len(arts))
+	for _, a := range arts {
+		if a.Amount <= 0 {
+			return nil, errors.E(op, errors.Invalid, "Amount must be bigger than 0")
+		}
+		if seen[a.ArtID] {
+			return nil, errors.E(op, errors.Invalid, fmt.Sprintf("Article %s is listed more than once", a.ArtID))
+		}
+		seen[a.ArtID] = true
+		artIDs = append(artIDs, a.ArtID)
+	}
+	now := time.Now()
+	if effectiveFrom.IsZero() {
+		effectiveFrom = now
+	}
+	if effectiveFrom.Before(now) {
+		return nil, errors.E(op, errors.Invalid, "Revision can't take effect in the past")
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, errors.E(op, err)
+	}
+	defer txhook.Ended(tx, s.productRepo, s.articleRepo)
+	defer tx.Rollback()
+
+	// Concurrent revisions of the product would both follow the same latest revision.
+	if err := s.productRepo.Lock(ctx, tx, ID); err != nil {
+		return nil, errors.E(op, err)
+	}
+	rr, err := s.productRepo.FindRevisions(ctx, tx, ID)
+	if err != nil {
+		return nil, errors.E(op, err)
+	}
+	if len(rr) == 0 {
+		return nil, errors.E(op, errors.NotFound, "Product not found")
+	}
+	latest := rr[len(rr)-1]
+	if !effectiveFrom.After(latest.EffectiveFrom) {
+		return nil, errors.E(op, errors.Invalid, fmt.Sprintf("Revision must take effect after revision %d, at %s", latest.Number, latest.EffectiveFrom.Format(time.RFC3339)))
+	}
+
+	found, err := s.articleRepo.FindAll(ctx, tx, &artIDs)
+	if err != nil {
+		return nil, errors.E(op, err)
+	}
+	byArtID := make(map[article.ArtID]*article.Article, len(found))
+	for _, a := range found {
+		byArtID[a.ArtID] = a
+	}
+
+	rev := &Revision{Number: latest.Number + 1, EffectiveFrom: effectiveFrom.UTC(), Articles: make([]*Article, 0, len(arts))}
+	for _, a := range arts {
+		fa, ok := byArtID[a.ArtID]
+		if !ok {
+			return nil, errors.E(op, errors.Invalid, fmt.Sprintf("Article %s doesn't exist", a.ArtID))
+		}
+		rev.Articles = append(rev.Articles, &Article{ID: fa.ID, ArtID: fa.ArtID, Name: fa.Name, Amount: a.Amount})
+	}
+
+	if err := s.productRepo.InsertRevision(ctx, tx, ID, rev); err != nil {
+		return nil, errors.E(op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, errors.E(op, err)
+	}
+	logs.FromContext(ctx, s.log).Printf("Product %d revised to revision %d", ID, rev.Number)
+	audit.AddTargets(ctx, audit.Target("product", ID))
+
+	rev.Changes = Diff(latest, rev)
+	return rev, nil
+}
+
 // Import products. Handles duplicate products. Imports the articles as well.
 // If the product exists, it only updates the quantities of the articles.
 // If it's a new product, it adds the product and associates the articles with it.
-func (s *Service) Import(ctx context.Context, rows []*Product) error {
+// stock.changed and import.completed events are stored in the outbox with the import.
+func (s *Service) Import(ctx context.Context, rows []*Product) (err error) {
 	var op errors.Op = "productService.import"
-	s.log.Printf("Importing %d products", len(rows))
+	ctx, span := tracing.Start(ctx, string(op), attribute.Int("rows", len(rows)))
+	defer func() { tracing.End(span, err) }()
+	logs.FromContext(ctx, s.log).Printf("Importing %d products", len(rows))
 
 	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
 		return errors.E(op, err)
 	}
+	defer txhook.Ended(tx, s.productRepo, s.articleRepo)
 
 	// Find existing products
 	barcodes := make([]*Barcode, 0, len(rows))     // For finding existing products
@@ -135,8 +407,13 @@ func (s *Service) Import(ctx context.Context, rows []*Product) error {
 		return errors.E(op, err)
 	}
 	artIDtoID := make(map[article.ArtID]article.ID, len(insertedArts))
+	targets := make([]string, 0, len(existingM)+len(insertedArts))
+	for _, pID := range existingM {
+		targets = append(targets, audit.Target("product", pID))
+	}
 	for _, art := range insertedArts {
 		artIDtoID[art.ArtID] = art.ID
+		targets = append(targets, audit.Target("article", art.ID))
 	}
 
 	// Filter out non-existing products
@@ -159,13 +436,27 @@ func (s *Service) Import(ctx context.Context, rows []*Product) error {
 		createdBarcodeToID := make(map[Barcode]ID, len(created))
 		for _, p := range created {
 			createdBarcodeToID[p.Barcode] = p.ID
+			targets = append(targets, audit.Target("product", p.ID))
 		}
 
+		// Articles listed more than once for a product are merged, revisions list every
+		// article once.
+		type productArticle struct {
+			productID ID
+			articleID article.ID
+		}
 		pArts := make([]*ArticleRow, 0, len(rows))
+		listed := make(map[productArticle]*ArticleRow, len(rows))
 		for _, p := range rows {
 			if pID, ok := createdBarcodeToID[p.Barcode]; ok {
 				for _, a := range p.Articles {
-					pArts = append(pArts, &ArticleRow{ID: artIDtoID[a.ArtID], ProductID: pID, Amount: a.Amount})
+					k := productArticle{pID, artIDtoID[a.ArtID]}
+					if row, ok := listed[k]; ok {
+						row.Amount += a.Amount
+						continue
+					}
+					listed[k] = &ArticleRow{ID: k.articleID, ProductID: pID, Amount: a.Amount}
+					pArts = append(pArts, listed[k])
 				}
 			}
 		}
@@ -179,19 +470,30 @@ func (s *Service) Import(ctx context.Context, rows []*Product) error {
 
 	}
 
+	if err := outbox.Add(ctx, s.outbox, tx,
+		article.StockChanged(outbox.ReasonImport, insertedArts),
+		&outbox.ImportCompleted{Kind: "products", Rows: len(rows)},
+	); err != nil {
+		tx.Rollback()
+		return errors.E(op, err)
+	}
+
 	if err := tx.Commit(); err != nil {
 		return errors.E(op, err)
 	}
+	audit.AddTargets(ctx, targets...)
 
 	return nil
 }
 
-// NewService creates a new service with required dependencies.
-func NewService(l *logrus.Logger, db *sql.DB, pr Repo, ar article.Repo) *Service {
+// NewService creates a new service with required dependencies. Events aren't stored if
+// the outbox repo is nil.
+func NewService(l *logrus.Logger, db *sql.DB, pr Repo, ar article.Repo, or outbox.Repo) *Service {
 	return &Service{
 		log:         l,
 		db:          db,
 		productRepo: pr,
 		articleRepo: ar,
+		outbox:      or,
 	}
 }
@@ -22,7 +22,7 @@ func TestImportProducts(t *testing.T) {
 
 	ar := postgres.NewArticleRepo()
 	pr := postgres.NewProductRepo()
-	s := product.NewService(log, db, pr, ar)
+	s := product.NewService(log, db, pr, ar, nil)
 	pp := createArticles(2)
 	ctx := context.Background()
 
@@ -44,10 +44,10 @@ func TestImportProducts(t *testing.T) {
 	test.Compare(t, "article", expectedArts, foundArts)
 
 	expectedPP := []*product.StockInfo{
-		{ID: 1, Name: "Name_1", Barcode: "Barcode_1", AvailableQty: 1, Articles: []*product.ArticleStock{
+		{ID: 1, Name: "Name_1", Barcode: "Barcode_1", Status: product.StatusActive, Revision: 1, AvailableQty: 1, Articles: []*product.ArticleStock{
 			{ID: 1, Name: "Article_1_1", ArtID: "Art_ArtID_1_1", Stock: 5, RequiredAmount: 5},
 		}},
-		{ID: 2, Name: "Name_2", Barcode: "Barcode_2", AvailableQty: 1, Articles: []*product.ArticleStock{
+		{ID: 2, Name: "Name_2", Barcode: "Barcode_2", Status: product.StatusActive, Revision: 1, AvailableQty: 1, Articles: []*product.ArticleStock{
 			{ID: 2, Name: "Article_1_2", ArtID: "Art_ArtID_1_2", Stock: 5, RequiredAmount: 5},
 		}},
 	}
@@ -70,7 +70,7 @@ func TestRemove(t *testing.T) {
 
 	ar := postgres.NewArticleRepo()
 	pr := postgres.NewProductRepo()
-	s := product.NewService(log, db, pr, ar)
+	s := product.NewService(log, db, pr, ar, nil)
 
 	ctx := context.Background()
 
@@ -90,7 +90,7 @@ func TestRemove(t *testing.T) {
 	}
 
 	expectedStockInfo := &product.StockInfo{
-		ID: 1, Barcode: "barcode", Name: "name", AvailableQty: 1, Articles: []*product.ArticleStock{
+		ID: 1, Barcode: "barcode", Name: "name", Status: product.StatusActive, Revision: 1, AvailableQty: 1, Articles: []*product.ArticleStock{
 			{ArtID: "art_id1", Name: "name_1", Stock: 5, RequiredAmount: 5},
 			{ArtID: "art_id2", Name: "name_2", Stock: 3, RequiredAmount: 3},
 			{ArtID: "art_id3", Name: "name_3", Stock: 2, RequiredAmount: 2},
@@ -99,6 +99,19 @@ func TestRemove(t *testing.T) {
 
 	test.Compare(t, "stockInfo", expectedStockInfo, foundP, cmpopts.IgnoreFields(product.ArticleStock{}, "ID"))
 
+	// Drafts can't be removed even with enough stock.
+	for _, st := range []product.Status{product.StatusArchived, product.StatusDraft} {
+		if _, err := s.Transition(ctx, 1, st); err != nil {
+			t.Fatalf("Unable to move the product to %s. %v", st, err)
+		}
+	}
+	if _, err := s.Remove(ctx, 1, 1); err == nil {
+		t.Errorf("Should return an error when the product is a draft")
+	}
+	if _, err := s.Transition(ctx, 1, product.StatusActive); err != nil {
+		t.Fatalf("Unable to activate the product. %v", err)
+	}
+
 	if _, err := s.Remove(ctx, 1, 2); err == nil {
 		t.Errorf("Should return an error when there is not enough stock")
 	}
@@ -109,7 +122,7 @@ func TestRemove(t *testing.T) {
 	}
 
 	expectedStockInfo = &product.StockInfo{
-		ID: 1, Barcode: "barcode", Name: "name", AvailableQty: 0, Articles: []*product.ArticleStock{
+		ID: 1, Barcode: "barcode", Name: "name", Status: product.StatusActive, Revision: 1, AvailableQty: 0, Articles: []*product.ArticleStock{
 			{ArtID: "art_id1", Name: "name_1", Stock: 0, RequiredAmount: 5},
 			{ArtID: "art_id2", Name: "name_2", Stock: 0, RequiredAmount: 3},
 			{ArtID: "art_id3", Name: "name_3", Stock: 0, RequiredAmount: 2},
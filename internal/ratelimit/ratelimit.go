@@ -0,0 +1,201 @@
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Rate is the number of requests allowed per period. Clients can burst up to Limit
+// requests, the bucket is refilled at Limit/Per. A zero Limit means unlimited.
+type Rate struct {
+	Limit int
+	Per   time.Duration
+}
+
+var units = map[string]time.Duration{"s": time.Second, "m": time.Minute, "h": time.Hour}
+
+func (r Rate) String() string {
+	if r.Limit == 0 {
+		return "0"
+	}
+	for u, d := range units {
+		if d == r.Per {
+			return fmt.Sprintf("%d/%s", r.Limit, u)
+		}
+	}
+	return fmt.Sprintf("%d/%s", r.Limit, r.Per)
+}
+
+// ParseRate parses rates such as 10/s, 100/m or 1000/h. An empty string or 0 is
+// parsed as unlimited.
+func ParseRate(s string) (Rate, error) {
+	s = strings.TrimSpace(s)
+	if s == "" || s == "0" {
+		return Rate{}, nil
+	}
+
+	parts := strings.Split(s, "/")
+	if len(parts) != 2 {
+		return Rate{}, fmt.Errorf("invalid rate %q, expected <limit>/<s|m|h>", s)
+	}
+	limit, err := strconv.Atoi(parts[0])
+	if err != nil || limit < 0 {
+		return Rate{}, fmt.Errorf("invalid rate %q, limit must be a positive number", s)
+	}
+	per, ok := units[parts[1]]
+	if !ok {
+		return Rate{}, fmt.Errorf("invalid rate %q, unit must be one of s, m or h", s)
+	}
+
+	return Rate{Limit: limit, Per: per}, nil
+}
+
+// ParseRoutes parses comma separated per route rates such as
+// "GET /products=5/s,POST /products/import=10/m". Routes are the method followed by
+// the path template of the route.
+func ParseRoutes(s string) (map[string]Rate, error) {
+	rr := make(map[string]Rate)
+	for _, part := range strings.Split(s, ",") {
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+		i := strings.LastIndex(part, "=")
+		if i < 0 {
+			return nil, fmt.Errorf("invalid route rate %q, expected <method> <path>=<rate>", part)
+		}
+		route := strings.Join(strings.Fields(part[:i]), " ")
+		if len(strings.Fields(route)) != 2 {
+			return nil, fmt.Errorf("invalid route rate %q, expected <method> <path>=<rate>", part)
+		}
+		r, err := ParseRate(part[i+1:])
+		if err != nil {
+			return nil, err
+		}
+		rr[route] = r
+	}
+	return rr, nil
+}
+
+// AnyRoute is the route of the requests of limiters that count the requests of clients
+// to all routes together.
+const AnyRoute = "*"
+
+// Result is the outcome of a request to the limiter.
+type Result struct {
+	Allowed    bool
+	Limit      int           // Zero if the route is unlimited.
+	Remaining  int           // Tokens left in the bucket.
+	Reset      time.Duration // Time until the bucket is full again.
+	RetryAfter time.Duration // Time until the next token, zero if the request is allowed.
+}
+
+type bucket struct {
+	route   string
+	tokens  float64
+	updated time.Time
+}
+
+// Limiter limits the requests of clients with token buckets. Every route has a rate,
+// either its own or the default one, and every client gets a bucket per route.
+type Limiter struct {
+	mu        sync.Mutex
+	def       Rate
+	routes    map[string]Rate
+	buckets   map[string]*bucket // route + client -> bucket
+	rejected  map[string]uint64  // route -> count
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// Stats conveys the counters of the limiter.
+type Stats struct {
+	Buckets  int               `json:"buckets"`
+	Rejected map[string]uint64 `json:"rejected"`
+}
+
+// Stats returns the number of active buckets and the rejected requests per route.
+func (l *Limiter) Stats() Stats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	rejected := make(map[string]uint64, len(l.rejected))
+	for r, n := range l.rejected {
+		rejected[r] = n
+	}
+	return Stats{Buckets: len(l.buckets), Rejected: rejected}
+}
+
+func (l *Limiter) rate(route string) Rate {
+	if r, ok := l.routes[route]; ok {
+		return r
+	}
+	return l.def
+}
+
+// Allow takes a token from the bucket of the client for the route.
+func (l *Limiter) Allow(route, client string) Result {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	rate := l.rate(route)
+	if rate.Limit == 0 {
+		return Result{Allowed: true}
+	}
+
+	now := l.now()
+	l.sweep(now)
+
+	key := route + "|" + client
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{route: route, tokens: float64(rate.Limit), updated: now}
+		l.buckets[key] = b
+	}
+
+	perToken := rate.Per / time.Duration(rate.Limit)
+	b.tokens = math.Min(float64(rate.Limit), b.tokens+float64(now.Sub(b.updated))/float64(perToken))
+	b.updated = now
+
+	res := Result{Allowed: b.tokens >= 1, Limit: rate.Limit}
+	if res.Allowed {
+		b.tokens--
+	} else {
+		res.RetryAfter = time.Duration((1 - b.tokens) * float64(perToken))
+		l.rejected[route]++
+	}
+	res.Remaining = int(b.tokens)
+	res.Reset = time.Duration((float64(rate.Limit) - b.tokens) * float64(perToken))
+
+	return res
+}
+
+// sweep removes the buckets that are full, they are recreated on the next request.
+// It runs at most once a minute so that idle clients don't pile up.
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < time.Minute {
+		return
+	}
+	l.lastSweep = now
+
+	for key, b := range l.buckets {
+		if now.Sub(b.updated) >= l.rate(b.route).Per {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// New returns a limiter applying the rates of routes, and def to the other routes.
+func New(def Rate, routes map[string]Rate) *Limiter {
+	return &Limiter{
+		def:       def,
+		routes:    routes,
+		buckets:   make(map[string]*bucket),
+		rejected:  make(map[string]uint64),
+		lastSweep: time.Now(),
+		now:       time.Now,
+	}
+}
@@ -0,0 +1,77 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseRoutes(t *testing.T) {
+	rr, err := ParseRoutes("GET /products=5/s, POST  /products/import=10/m,GET /articles=0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]Rate{
+		"GET /products":         {Limit: 5, Per: time.Second},
+		"POST /products/import": {Limit: 10, Per: time.Minute},
+		"GET /articles":         {},
+	}
+	if diff := cmp.Diff(expected, rr); diff != "" {
+		t.Errorf("Routes are not equal (-want +got):\n%s", diff)
+	}
+
+	for _, s := range []string{"GET /products", "/products=5/s", "GET /products=5", "GET /products=5/d", "GET /products=-1/s"} {
+		if _, err := ParseRoutes(s); err == nil {
+			t.Errorf("Expected %q to be invalid", s)
+		}
+	}
+}
+
+func TestAllow(t *testing.T) {
+	now := time.Now()
+	l := New(Rate{Limit: 2, Per: time.Second}, map[string]Rate{"GET /articles": {}})
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		if res := l.Allow("GET /products", "a"); !res.Allowed || res.Remaining != 1-i {
+			t.Fatalf("Expected request %d to be allowed with %d remaining, got %+v", i, 1-i, res)
+		}
+	}
+
+	res := l.Allow("GET /products", "a")
+	if res.Allowed {
+		t.Fatal("Expected the bucket to be empty")
+	}
+	if res.RetryAfter != 500*time.Millisecond || res.Reset != time.Second {
+		t.Errorf("Expected retry after 500ms and reset in 1s, got %+v", res)
+	}
+
+	if !l.Allow("GET /products", "b").Allowed {
+		t.Error("Expected clients to have their own buckets")
+	}
+	if !l.Allow("GET /products/{id}", "a").Allowed {
+		t.Error("Expected routes to have their own buckets")
+	}
+	for i := 0; i < 5; i++ {
+		if res := l.Allow("GET /articles", "a"); !res.Allowed || res.Limit != 0 {
+			t.Fatalf("Expected unlimited route to allow every request, got %+v", res)
+		}
+	}
+
+	now = now.Add(500 * time.Millisecond)
+	if !l.Allow("GET /products", "a").Allowed {
+		t.Error("Expected the bucket to be refilled")
+	}
+
+	if diff := cmp.Diff(Stats{Buckets: 3, Rejected: map[string]uint64{"GET /products": 1}}, l.Stats()); diff != "" {
+		t.Errorf("Stats are not equal (-want +got):\n%s", diff)
+	}
+
+	now = now.Add(2 * time.Minute)
+	l.Allow("GET /products", "a")
+	if n := l.Stats().Buckets; n != 1 {
+		t.Errorf("Expected idle buckets to be removed, got %d buckets", n)
+	}
+}
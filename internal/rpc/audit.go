@@ -0,0 +1,62 @@
+package rpc
+
+import (
+	"context"
+
+	"github.com/mtekmir/warehouse-service/internal/audit"
+	"github.com/mtekmir/warehouse-service/internal/errors"
+	"github.com/mtekmir/warehouse-service/internal/rpc/pb"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+)
+
+type auditRecorder interface {
+	Record(ctx context.Context, e *audit.Event) error
+}
+
+// methodActions are the audit actions of the methods that change the inventory.
+var methodActions = map[string]string{
+	pb.WarehouseService_ImportArticles_FullMethodName: "article.import",
+	pb.WarehouseService_ImportProducts_FullMethodName: "product.import",
+	pb.WarehouseService_RemoveProduct_FullMethodName:  "product.remove",
+}
+
+// unaryAuditInterceptor records an audit event for the calls of the methods with an
+// action, whether they succeed or not. The payload digest is the digest of the
+// deterministic encoding of the request. It runs before the auth interceptor so that
+// rejected calls are recorded too, the auth interceptor sets the api key of the event. A
+// nil recorder disables auditing.
+func unaryAuditInterceptor(l *logrus.Logger, a auditRecorder) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (res interface{}, err error) {
+		action, ok := methodActions[info.FullMethod]
+		if a == nil || !ok {
+			return handler(ctx, req)
+		}
+
+		e := &audit.Event{Actor: audit.IPActor(peerIP(ctx)), Action: action, Targets: []string{}}
+		if m, ok := req.(proto.Message); ok {
+			if b, err := (proto.MarshalOptions{Deterministic: true}).Marshal(m); err == nil {
+				e.PayloadDigest = audit.Digest(b)
+			}
+		}
+		if r, ok := req.(*pb.RemoveProductRequest); ok {
+			e.AddTargets(audit.Target("product", r.Id))
+		}
+
+		done := false
+		defer func() {
+			// Calls that panicked aren't done and fail with an internal error.
+			e.Result = audit.Result(err)
+			if !done {
+				e.Result = errors.Other.Code()
+			}
+			if err := a.Record(ctx, e); err != nil {
+				l.Printf("Unable to record the audit event of %s: %v", e.Action, err)
+			}
+		}()
+		res, err = handler(audit.WithEvent(ctx, e), req)
+		done = true
+		return res, err
+	}
+}
@@ -0,0 +1,77 @@
+package rpc
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/mtekmir/warehouse-service/internal/audit"
+	"github.com/mtekmir/warehouse-service/internal/auth"
+	"github.com/mtekmir/warehouse-service/internal/errors"
+	"github.com/mtekmir/warehouse-service/internal/rpc/pb"
+	"github.com/mtekmir/warehouse-service/test"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestUnaryAuditInterceptor(t *testing.T) {
+	rec := test.NewMockAuditService()
+	audited := unaryAuditInterceptor(logrus.New(), rec)
+	authenticated := unaryAuthInterceptor(test.NewMockAuthService(map[string]*auth.Key{
+		"writer": {ID: 3, Scopes: []auth.Scope{auth.ScopeProductsRead, auth.ScopeProductsRemove}},
+		"reader": {ID: 4, Scopes: []auth.Scope{auth.ScopeProductsRead}},
+	}))
+	// The audit interceptor runs before the auth interceptor, as in the server.
+	intercept := func(key string, req interface{}, method string, handler grpc.UnaryHandler) error {
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-api-key", key))
+		ctx = peer.NewContext(ctx, &peer.Peer{Addr: &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 5000}})
+		info := &grpc.UnaryServerInfo{FullMethod: method}
+		_, err := audited(ctx, req, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+			return authenticated(ctx, req, info, handler)
+		})
+		return err
+	}
+
+	req := &pb.RemoveProductRequest{Id: 7, Qty: 2}
+	err := intercept("writer", req, pb.WarehouseService_RemoveProduct_FullMethodName, func(ctx context.Context, _ interface{}) (interface{}, error) {
+		audit.AddTargets(ctx, audit.Target("article", 1))
+		return &pb.ProductStock{}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = intercept("writer", req, pb.WarehouseService_RemoveProduct_FullMethodName, func(context.Context, interface{}) (interface{}, error) {
+		return nil, errors.E(errors.Op("test"), errors.Invalid, "Insufficient stock quantity")
+	})
+	if err == nil {
+		t.Fatal("Expected the error of the handler")
+	}
+
+	// Rejected calls are recorded, by ip if the key isn't valid.
+	ok := func(context.Context, interface{}) (interface{}, error) { return &pb.ProductStock{}, nil }
+	if err := intercept("reader", req, pb.WarehouseService_RemoveProduct_FullMethodName, ok); err == nil {
+		t.Fatal("Expected the call to be forbidden")
+	}
+	if err := intercept("invalid", req, pb.WarehouseService_RemoveProduct_FullMethodName, ok); err == nil {
+		t.Fatal("Expected the call to be unauthorized")
+	}
+
+	// Reads aren't audited.
+	intercept("writer", &pb.FindProductRequest{Id: 7}, pb.WarehouseService_FindProduct_FullMethodName, ok)
+
+	b, err := proto.MarshalOptions{Deterministic: true}.Marshal(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := audit.Digest(b)
+	test.Compare(t, "events", []*audit.Event{
+		{Actor: "key:3", Action: "product.remove", Targets: []string{"product:7", "article:1"}, PayloadDigest: digest, Result: "ok"},
+		{Actor: "key:3", Action: "product.remove", Targets: []string{"product:7"}, PayloadDigest: digest, Result: "invalid"},
+		{Actor: "key:4", Action: "product.remove", Targets: []string{"product:7"}, PayloadDigest: digest, Result: "forbidden"},
+		{Actor: "ip:10.0.0.1", Action: "product.remove", Targets: []string{"product:7"}, PayloadDigest: digest, Result: "unauthorized"},
+	}, rec.Recorded())
+}
@@ -0,0 +1,89 @@
+package rpc
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/mtekmir/warehouse-service/internal/audit"
+	"github.com/mtekmir/warehouse-service/internal/auth"
+	"github.com/mtekmir/warehouse-service/internal/errors"
+	"github.com/mtekmir/warehouse-service/internal/rpc/pb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+type authenticator interface {
+	Authenticate(ctx context.Context, token string) (*auth.Key, error)
+}
+
+// methodScopes are the scopes required to call the methods of the service.
+var methodScopes = map[string]auth.Scope{
+	pb.WarehouseService_ImportArticles_FullMethodName: auth.ScopeArticlesWrite,
+	pb.WarehouseService_ListArticles_FullMethodName:   auth.ScopeArticlesRead,
+	pb.WarehouseService_ImportProducts_FullMethodName: auth.ScopeProductsWrite,
+	pb.WarehouseService_FindProduct_FullMethodName:    auth.ScopeProductsRead,
+	pb.WarehouseService_ListProducts_FullMethodName:   auth.ScopeProductsRead,
+	pb.WarehouseService_RemoveProduct_FullMethodName:  auth.ScopeProductsRemove,
+}
+
+// authenticate checks that the api key in the metadata is granted the scope of the method.
+// Keys are read from the authorization metadata as bearer tokens or from x-api-key.
+func authenticate(ctx context.Context, a authenticator, method string) (context.Context, error) {
+	var op errors.Op = "rpc.authenticate"
+
+	scope, ok := methodScopes[method]
+	if !ok {
+		return nil, errors.E(op, errors.Forbidden, "Unknown method")
+	}
+
+	var token string
+	md, _ := metadata.FromIncomingContext(ctx)
+	if v := md.Get("x-api-key"); len(v) > 0 {
+		token = v[0]
+	}
+	if v := md.Get("authorization"); len(v) > 0 && strings.HasPrefix(v[0], "Bearer ") {
+		token = strings.TrimPrefix(v[0], "Bearer ")
+	}
+
+	k, err := a.Authenticate(ctx, token)
+	if err != nil {
+		return nil, errors.E(op, err)
+	}
+	if e, ok := audit.FromContext(ctx); ok {
+		e.Actor = audit.KeyActor(int(k.ID))
+	}
+	if !k.HasScope(scope) {
+		return nil, errors.E(op, errors.Forbidden, fmt.Sprintf("Api key is missing the %s scope", scope))
+	}
+
+	return auth.WithKey(ctx, k), nil
+}
+
+func unaryAuthInterceptor(a authenticator) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := authenticate(ctx, a, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// authStream overrides the context of a server stream with the authenticated one.
+type authStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authStream) Context() context.Context { return s.ctx }
+
+func streamAuthInterceptor(a authenticator) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := authenticate(ss.Context(), a, info.FullMethod)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &authStream{ServerStream: ss, ctx: ctx})
+	}
+}
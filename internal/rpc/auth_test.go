@@ -0,0 +1,48 @@
+package rpc
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mtekmir/warehouse-service/internal/auth"
+	"github.com/mtekmir/warehouse-service/internal/errors"
+	"github.com/mtekmir/warehouse-service/internal/rpc/pb"
+	"github.com/mtekmir/warehouse-service/test"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestAuthenticate(t *testing.T) {
+	a := test.NewMockAuthService(map[string]*auth.Key{
+		"reader": {Name: "reader", Scopes: []auth.Scope{auth.ScopeProductsRead}},
+	})
+
+	tests := []struct {
+		name   string
+		md     metadata.MD
+		method string
+		kind   errors.Kind
+	}{
+		{"missing key", metadata.MD{}, pb.WarehouseService_FindProduct_FullMethodName, errors.Unauthorized},
+		{"api key", metadata.Pairs("x-api-key", "reader"), pb.WarehouseService_FindProduct_FullMethodName, 0},
+		{"bearer token", metadata.Pairs("authorization", "Bearer reader"), pb.WarehouseService_ListProducts_FullMethodName, 0},
+		{"missing scope", metadata.Pairs("x-api-key", "reader"), pb.WarehouseService_RemoveProduct_FullMethodName, errors.Forbidden},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, err := authenticate(metadata.NewIncomingContext(context.Background(), tc.md), a, tc.method)
+			if tc.kind == 0 {
+				if err != nil {
+					t.Fatalf("Expected no error, got %v", err)
+				}
+				if k, ok := auth.FromContext(ctx); !ok || k.Name != "reader" {
+					t.Errorf("Expected the key to be in the context")
+				}
+				return
+			}
+			if e, ok := err.(*errors.Error); !ok || e.Kind != tc.kind {
+				t.Errorf("Expected error of kind %d, got %v", tc.kind, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package rpc
+
+import (
+	"context"
+
+	"github.com/mtekmir/warehouse-service/internal/errors"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// code maps error kinds to grpc status codes.
+func code(k errors.Kind) codes.Code {
+	switch k {
+	case errors.Unauthorized:
+		return codes.Unauthenticated
+	case errors.Forbidden:
+		return codes.PermissionDenied
+	case errors.NotFound:
+		return codes.NotFound
+	case errors.Duplicate:
+		return codes.AlreadyExists
+	case errors.Invalid:
+		return codes.InvalidArgument
+	case errors.Unavailable:
+		return codes.Unavailable
+	case errors.RateLimited:
+		return codes.ResourceExhausted
+	default:
+		return codes.Internal
+	}
+}
+
+// toStatus logs the error and converts it to a grpc status error. Messages of
+// unclassified errors are not sent to the client, cancelled and timed out requests are
+// reported with their own codes.
+func toStatus(l *logrus.Logger, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	switch {
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, "Request was cancelled.")
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, "Request timed out.")
+	}
+
+	var e *errors.Error
+	if !errors.As(err, &e) {
+		l.Printf("An unexpected error occurred: %v\n", err)
+		return status.Error(codes.Internal, "Something went wrong.")
+	}
+	l.Print(e.Error())
+
+	m := e.Message
+	if m == "" {
+		m = "Something went wrong."
+	}
+	return status.Error(code(e.Kind), m)
+}
+
+func unaryErrorInterceptor(l *logrus.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (res interface{}, err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				l.Printf("An unexpected error occurred: %v\n", r)
+				err = status.Error(codes.Internal, "Something went wrong.")
+			}
+		}()
+
+		res, err = handler(ctx, req)
+		return res, toStatus(l, err)
+	}
+}
+
+func streamErrorInterceptor(l *logrus.Logger) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				l.Printf("An unexpected error occurred: %v\n", r)
+				err = status.Error(codes.Internal, "Something went wrong.")
+			}
+		}()
+
+		return toStatus(l, handler(srv, ss))
+	}
+}
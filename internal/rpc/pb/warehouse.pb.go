@@ -0,0 +1,837 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.12
+// 	protoc        (unknown)
+// source: warehouse.proto
+
+package pb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type Article struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	ArtId         string                 `protobuf:"bytes,1,opt,name=art_id,json=artId,proto3" json:"art_id,omitempty"`
+	Name          string                 `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	Stock         int64                  `protobuf:"varint,3,opt,name=stock,proto3" json:"stock,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Article) Reset() {
+	*x = Article{}
+	mi := &file_warehouse_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Article) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Article) ProtoMessage() {}
+
+func (x *Article) ProtoReflect() protoreflect.Message {
+	mi := &file_warehouse_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Article.ProtoReflect.Descriptor instead.
+func (*Article) Descriptor() ([]byte, []int) {
+	return file_warehouse_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Article) GetArtId() string {
+	if x != nil {
+		return x.ArtId
+	}
+	return ""
+}
+
+func (x *Article) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Article) GetStock() int64 {
+	if x != nil {
+		return x.Stock
+	}
+	return 0
+}
+
+type ImportArticlesRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Articles      []*Article             `protobuf:"bytes,1,rep,name=articles,proto3" json:"articles,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ImportArticlesRequest) Reset() {
+	*x = ImportArticlesRequest{}
+	mi := &file_warehouse_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ImportArticlesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ImportArticlesRequest) ProtoMessage() {}
+
+func (x *ImportArticlesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_warehouse_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ImportArticlesRequest.ProtoReflect.Descriptor instead.
+func (*ImportArticlesRequest) Descriptor() ([]byte, []int) {
+	return file_warehouse_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *ImportArticlesRequest) GetArticles() []*Article {
+	if x != nil {
+		return x.Articles
+	}
+	return nil
+}
+
+type ImportArticlesResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Articles      []*Article             `protobuf:"bytes,1,rep,name=articles,proto3" json:"articles,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ImportArticlesResponse) Reset() {
+	*x = ImportArticlesResponse{}
+	mi := &file_warehouse_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ImportArticlesResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ImportArticlesResponse) ProtoMessage() {}
+
+func (x *ImportArticlesResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_warehouse_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ImportArticlesResponse.ProtoReflect.Descriptor instead.
+func (*ImportArticlesResponse) Descriptor() ([]byte, []int) {
+	return file_warehouse_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *ImportArticlesResponse) GetArticles() []*Article {
+	if x != nil {
+		return x.Articles
+	}
+	return nil
+}
+
+type ListArticlesRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListArticlesRequest) Reset() {
+	*x = ListArticlesRequest{}
+	mi := &file_warehouse_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListArticlesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListArticlesRequest) ProtoMessage() {}
+
+func (x *ListArticlesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_warehouse_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListArticlesRequest.ProtoReflect.Descriptor instead.
+func (*ListArticlesRequest) Descriptor() ([]byte, []int) {
+	return file_warehouse_proto_rawDescGZIP(), []int{3}
+}
+
+type ProductArticle struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	ArtId         string                 `protobuf:"bytes,1,opt,name=art_id,json=artId,proto3" json:"art_id,omitempty"`
+	Name          string                 `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	Amount        int64                  `protobuf:"varint,3,opt,name=amount,proto3" json:"amount,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ProductArticle) Reset() {
+	*x = ProductArticle{}
+	mi := &file_warehouse_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ProductArticle) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ProductArticle) ProtoMessage() {}
+
+func (x *ProductArticle) ProtoReflect() protoreflect.Message {
+	mi := &file_warehouse_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ProductArticle.ProtoReflect.Descriptor instead.
+func (*ProductArticle) Descriptor() ([]byte, []int) {
+	return file_warehouse_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *ProductArticle) GetArtId() string {
+	if x != nil {
+		return x.ArtId
+	}
+	return ""
+}
+
+func (x *ProductArticle) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *ProductArticle) GetAmount() int64 {
+	if x != nil {
+		return x.Amount
+	}
+	return 0
+}
+
+type Product struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Barcode       string                 `protobuf:"bytes,1,opt,name=barcode,proto3" json:"barcode,omitempty"`
+	Name          string                 `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	Articles      []*ProductArticle      `protobuf:"bytes,3,rep,name=articles,proto3" json:"articles,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Product) Reset() {
+	*x = Product{}
+	mi := &file_warehouse_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Product) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Product) ProtoMessage() {}
+
+func (x *Product) ProtoReflect() protoreflect.Message {
+	mi := &file_warehouse_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Product.ProtoReflect.Descriptor instead.
+func (*Product) Descriptor() ([]byte, []int) {
+	return file_warehouse_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *Product) GetBarcode() string {
+	if x != nil {
+		return x.Barcode
+	}
+	return ""
+}
+
+func (x *Product) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Product) GetArticles() []*ProductArticle {
+	if x != nil {
+		return x.Articles
+	}
+	return nil
+}
+
+type ImportProductsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Products      []*Product             `protobuf:"bytes,1,rep,name=products,proto3" json:"products,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ImportProductsRequest) Reset() {
+	*x = ImportProductsRequest{}
+	mi := &file_warehouse_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ImportProductsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ImportProductsRequest) ProtoMessage() {}
+
+func (x *ImportProductsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_warehouse_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ImportProductsRequest.ProtoReflect.Descriptor instead.
+func (*ImportProductsRequest) Descriptor() ([]byte, []int) {
+	return file_warehouse_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *ImportProductsRequest) GetProducts() []*Product {
+	if x != nil {
+		return x.Products
+	}
+	return nil
+}
+
+type ImportProductsResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ImportProductsResponse) Reset() {
+	*x = ImportProductsResponse{}
+	mi := &file_warehouse_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ImportProductsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ImportProductsResponse) ProtoMessage() {}
+
+func (x *ImportProductsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_warehouse_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ImportProductsResponse.ProtoReflect.Descriptor instead.
+func (*ImportProductsResponse) Descriptor() ([]byte, []int) {
+	return file_warehouse_proto_rawDescGZIP(), []int{7}
+}
+
+type ArticleStock struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	ArtId          string                 `protobuf:"bytes,1,opt,name=art_id,json=artId,proto3" json:"art_id,omitempty"`
+	Name           string                 `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	Stock          int64                  `protobuf:"varint,3,opt,name=stock,proto3" json:"stock,omitempty"`
+	RequiredAmount int64                  `protobuf:"varint,4,opt,name=required_amount,json=requiredAmount,proto3" json:"required_amount,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *ArticleStock) Reset() {
+	*x = ArticleStock{}
+	mi := &file_warehouse_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ArticleStock) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ArticleStock) ProtoMessage() {}
+
+func (x *ArticleStock) ProtoReflect() protoreflect.Message {
+	mi := &file_warehouse_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ArticleStock.ProtoReflect.Descriptor instead.
+func (*ArticleStock) Descriptor() ([]byte, []int) {
+	return file_warehouse_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *ArticleStock) GetArtId() string {
+	if x != nil {
+		return x.ArtId
+	}
+	return ""
+}
+
+func (x *ArticleStock) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *ArticleStock) GetStock() int64 {
+	if x != nil {
+		return x.Stock
+	}
+	return 0
+}
+
+func (x *ArticleStock) GetRequiredAmount() int64 {
+	if x != nil {
+		return x.RequiredAmount
+	}
+	return 0
+}
+
+type ProductStock struct {
+	state             protoimpl.MessageState `protogen:"open.v1"`
+	Id                int64                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	Barcode           string                 `protobuf:"bytes,2,opt,name=barcode,proto3" json:"barcode,omitempty"`
+	Name              string                 `protobuf:"bytes,3,opt,name=name,proto3" json:"name,omitempty"`
+	AvailableQuantity int64                  `protobuf:"varint,4,opt,name=available_quantity,json=availableQuantity,proto3" json:"available_quantity,omitempty"`
+	Articles          []*ArticleStock        `protobuf:"bytes,5,rep,name=articles,proto3" json:"articles,omitempty"`
+	unknownFields     protoimpl.UnknownFields
+	sizeCache         protoimpl.SizeCache
+}
+
+func (x *ProductStock) Reset() {
+	*x = ProductStock{}
+	mi := &file_warehouse_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ProductStock) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ProductStock) ProtoMessage() {}
+
+func (x *ProductStock) ProtoReflect() protoreflect.Message {
+	mi := &file_warehouse_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ProductStock.ProtoReflect.Descriptor instead.
+func (*ProductStock) Descriptor() ([]byte, []int) {
+	return file_warehouse_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *ProductStock) GetId() int64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *ProductStock) GetBarcode() string {
+	if x != nil {
+		return x.Barcode
+	}
+	return ""
+}
+
+func (x *ProductStock) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *ProductStock) GetAvailableQuantity() int64 {
+	if x != nil {
+		return x.AvailableQuantity
+	}
+	return 0
+}
+
+func (x *ProductStock) GetArticles() []*ArticleStock {
+	if x != nil {
+		return x.Articles
+	}
+	return nil
+}
+
+type FindProductRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            int64                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *FindProductRequest) Reset() {
+	*x = FindProductRequest{}
+	mi := &file_warehouse_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FindProductRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FindProductRequest) ProtoMessage() {}
+
+func (x *FindProductRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_warehouse_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FindProductRequest.ProtoReflect.Descriptor instead.
+func (*FindProductRequest) Descriptor() ([]byte, []int) {
+	return file_warehouse_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *FindProductRequest) GetId() int64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+type ListProductsRequest struct {
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	Barcodes []string               `protobuf:"bytes,1,rep,name=barcodes,proto3" json:"barcodes,omitempty"`
+	InStock  bool                   `protobuf:"varint,2,opt,name=in_stock,json=inStock,proto3" json:"in_stock,omitempty"`
+	// One of id, name, available_quantity. Prefix with - for descending order.
+	Sort          string `protobuf:"bytes,3,opt,name=sort,proto3" json:"sort,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListProductsRequest) Reset() {
+	*x = ListProductsRequest{}
+	mi := &file_warehouse_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListProductsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListProductsRequest) ProtoMessage() {}
+
+func (x *ListProductsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_warehouse_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListProductsRequest.ProtoReflect.Descriptor instead.
+func (*ListProductsRequest) Descriptor() ([]byte, []int) {
+	return file_warehouse_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *ListProductsRequest) GetBarcodes() []string {
+	if x != nil {
+		return x.Barcodes
+	}
+	return nil
+}
+
+func (x *ListProductsRequest) GetInStock() bool {
+	if x != nil {
+		return x.InStock
+	}
+	return false
+}
+
+func (x *ListProductsRequest) GetSort() string {
+	if x != nil {
+		return x.Sort
+	}
+	return ""
+}
+
+type RemoveProductRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            int64                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	Qty           int64                  `protobuf:"varint,2,opt,name=qty,proto3" json:"qty,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RemoveProductRequest) Reset() {
+	*x = RemoveProductRequest{}
+	mi := &file_warehouse_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RemoveProductRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RemoveProductRequest) ProtoMessage() {}
+
+func (x *RemoveProductRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_warehouse_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RemoveProductRequest.ProtoReflect.Descriptor instead.
+func (*RemoveProductRequest) Descriptor() ([]byte, []int) {
+	return file_warehouse_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *RemoveProductRequest) GetId() int64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *RemoveProductRequest) GetQty() int64 {
+	if x != nil {
+		return x.Qty
+	}
+	return 0
+}
+
+var File_warehouse_proto protoreflect.FileDescriptor
+
+const file_warehouse_proto_rawDesc = "" +
+	"\n" +
+	"\x0fwarehouse.proto\x12\fwarehouse.v1\"J\n" +
+	"\aArticle\x12\x15\n" +
+	"\x06art_id\x18\x01 \x01(\tR\x05artId\x12\x12\n" +
+	"\x04name\x18\x02 \x01(\tR\x04name\x12\x14\n" +
+	"\x05stock\x18\x03 \x01(\x03R\x05stock\"J\n" +
+	"\x15ImportArticlesRequest\x121\n" +
+	"\barticles\x18\x01 \x03(\v2\x15.warehouse.v1.ArticleR\barticles\"K\n" +
+	"\x16ImportArticlesResponse\x121\n" +
+	"\barticles\x18\x01 \x03(\v2\x15.warehouse.v1.ArticleR\barticles\"\x15\n" +
+	"\x13ListArticlesRequest\"S\n" +
+	"\x0eProductArticle\x12\x15\n" +
+	"\x06art_id\x18\x01 \x01(\tR\x05artId\x12\x12\n" +
+	"\x04name\x18\x02 \x01(\tR\x04name\x12\x16\n" +
+	"\x06amount\x18\x03 \x01(\x03R\x06amount\"q\n" +
+	"\aProduct\x12\x18\n" +
+	"\abarcode\x18\x01 \x01(\tR\abarcode\x12\x12\n" +
+	"\x04name\x18\x02 \x01(\tR\x04name\x128\n" +
+	"\barticles\x18\x03 \x03(\v2\x1c.warehouse.v1.ProductArticleR\barticles\"J\n" +
+	"\x15ImportProductsRequest\x121\n" +
+	"\bproducts\x18\x01 \x03(\v2\x15.warehouse.v1.ProductR\bproducts\"\x18\n" +
+	"\x16ImportProductsResponse\"x\n" +
+	"\fArticleStock\x12\x15\n" +
+	"\x06art_id\x18\x01 \x01(\tR\x05artId\x12\x12\n" +
+	"\x04name\x18\x02 \x01(\tR\x04name\x12\x14\n" +
+	"\x05stock\x18\x03 \x01(\x03R\x05stock\x12'\n" +
+	"\x0frequired_amount\x18\x04 \x01(\x03R\x0erequiredAmount\"\xb3\x01\n" +
+	"\fProductStock\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x03R\x02id\x12\x18\n" +
+	"\abarcode\x18\x02 \x01(\tR\abarcode\x12\x12\n" +
+	"\x04name\x18\x03 \x01(\tR\x04name\x12-\n" +
+	"\x12available_quantity\x18\x04 \x01(\x03R\x11availableQuantity\x126\n" +
+	"\barticles\x18\x05 \x03(\v2\x1a.warehouse.v1.ArticleStockR\barticles\"$\n" +
+	"\x12FindProductRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x03R\x02id\"`\n" +
+	"\x13ListProductsRequest\x12\x1a\n" +
+	"\bbarcodes\x18\x01 \x03(\tR\bbarcodes\x12\x19\n" +
+	"\bin_stock\x18\x02 \x01(\bR\ainStock\x12\x12\n" +
+	"\x04sort\x18\x03 \x01(\tR\x04sort\"8\n" +
+	"\x14RemoveProductRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x03R\x02id\x12\x10\n" +
+	"\x03qty\x18\x02 \x01(\x03R\x03qty2\x87\x04\n" +
+	"\x10WarehouseService\x12[\n" +
+	"\x0eImportArticles\x12#.warehouse.v1.ImportArticlesRequest\x1a$.warehouse.v1.ImportArticlesResponse\x12J\n" +
+	"\fListArticles\x12!.warehouse.v1.ListArticlesRequest\x1a\x15.warehouse.v1.Article0\x01\x12[\n" +
+	"\x0eImportProducts\x12#.warehouse.v1.ImportProductsRequest\x1a$.warehouse.v1.ImportProductsResponse\x12K\n" +
+	"\vFindProduct\x12 .warehouse.v1.FindProductRequest\x1a\x1a.warehouse.v1.ProductStock\x12O\n" +
+	"\fListProducts\x12!.warehouse.v1.ListProductsRequest\x1a\x1a.warehouse.v1.ProductStock0\x01\x12O\n" +
+	"\rRemoveProduct\x12\".warehouse.v1.RemoveProductRequest\x1a\x1a.warehouse.v1.ProductStockB6Z4github.com/mtekmir/warehouse-service/internal/rpc/pbb\x06proto3"
+
+var (
+	file_warehouse_proto_rawDescOnce sync.Once
+	file_warehouse_proto_rawDescData []byte
+)
+
+func file_warehouse_proto_rawDescGZIP() []byte {
+	file_warehouse_proto_rawDescOnce.Do(func() {
+		file_warehouse_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_warehouse_proto_rawDesc), len(file_warehouse_proto_rawDesc)))
+	})
+	return file_warehouse_proto_rawDescData
+}
+
+var file_warehouse_proto_msgTypes = make([]protoimpl.MessageInfo, 13)
+var file_warehouse_proto_goTypes = []any{
+	(*Article)(nil),                // 0: warehouse.v1.Article
+	(*ImportArticlesRequest)(nil),  // 1: warehouse.v1.ImportArticlesRequest
+	(*ImportArticlesResponse)(nil), // 2: warehouse.v1.ImportArticlesResponse
+	(*ListArticlesRequest)(nil),    // 3: warehouse.v1.ListArticlesRequest
+	(*ProductArticle)(nil),         // 4: warehouse.v1.ProductArticle
+	(*Product)(nil),                // 5: warehouse.v1.Product
+	(*ImportProductsRequest)(nil),  // 6: warehouse.v1.ImportProductsRequest
+	(*ImportProductsResponse)(nil), // 7: warehouse.v1.ImportProductsResponse
+	(*ArticleStock)(nil),           // 8: warehouse.v1.ArticleStock
+	(*ProductStock)(nil),           // 9: warehouse.v1.ProductStock
+	(*FindProductRequest)(nil),     // 10: warehouse.v1.FindProductRequest
+	(*ListProductsRequest)(nil),    // 11: warehouse.v1.ListProductsRequest
+	(*RemoveProductRequest)(nil),   // 12: warehouse.v1.RemoveProductRequest
+}
+var file_warehouse_proto_depIdxs = []int32{
+	0,  // 0: warehouse.v1.ImportArticlesRequest.articles:type_name -> warehouse.v1.Article
+	0,  // 1: warehouse.v1.ImportArticlesResponse.articles:type_name -> warehouse.v1.Article
+	4,  // 2: warehouse.v1.Product.articles:type_name -> warehouse.v1.ProductArticle
+	5,  // 3: warehouse.v1.ImportProductsRequest.products:type_name -> warehouse.v1.Product
+	8,  // 4: warehouse.v1.ProductStock.articles:type_name -> warehouse.v1.ArticleStock
+	1,  // 5: warehouse.v1.WarehouseService.ImportArticles:input_type -> warehouse.v1.ImportArticlesRequest
+	3,  // 6: warehouse.v1.WarehouseService.ListArticles:input_type -> warehouse.v1.ListArticlesRequest
+	6,  // 7: warehouse.v1.WarehouseService.ImportProducts:input_type -> warehouse.v1.ImportProductsRequest
+	10, // 8: warehouse.v1.WarehouseService.FindProduct:input_type -> warehouse.v1.FindProductRequest
+	11, // 9: warehouse.v1.WarehouseService.ListProducts:input_type -> warehouse.v1.ListProductsRequest
+	12, // 10: warehouse.v1.WarehouseService.RemoveProduct:input_type -> warehouse.v1.RemoveProductRequest
+	2,  // 11: warehouse.v1.WarehouseService.ImportArticles:output_type -> warehouse.v1.ImportArticlesResponse
+	0,  // 12: warehouse.v1.WarehouseService.ListArticles:output_type -> warehouse.v1.Article
+	7,  // 13: warehouse.v1.WarehouseService.ImportProducts:output_type -> warehouse.v1.ImportProductsResponse
+	9,  // 14: warehouse.v1.WarehouseService.FindProduct:output_type -> warehouse.v1.ProductStock
+	9,  // 15: warehouse.v1.WarehouseService.ListProducts:output_type -> warehouse.v1.ProductStock
+	9,  // 16: warehouse.v1.WarehouseService.RemoveProduct:output_type -> warehouse.v1.ProductStock
+	11, // [11:17] is the sub-list for method output_type
+	5,  // [5:11] is the sub-list for method input_type
+	5,  // [5:5] is the sub-list for extension type_name
+	5,  // [5:5] is the sub-list for extension extendee
+	0,  // [0:5] is the sub-list for field type_name
+}
+
+func init() { file_warehouse_proto_init() }
+func file_warehouse_proto_init() {
+	if File_warehouse_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_warehouse_proto_rawDesc), len(file_warehouse_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   13,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_warehouse_proto_goTypes,
+		DependencyIndexes: file_warehouse_proto_depIdxs,
+		MessageInfos:      file_warehouse_proto_msgTypes,
+	}.Build()
+	File_warehouse_proto = out.File
+	file_warehouse_proto_goTypes = nil
+	file_warehouse_proto_depIdxs = nil
+}
@@ -0,0 +1,334 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.6.2
+// - protoc             (unknown)
+// source: warehouse.proto
+
+package pb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	WarehouseService_ImportArticles_FullMethodName = "/warehouse.v1.WarehouseService/ImportArticles"
+	WarehouseService_ListArticles_FullMethodName   = "/warehouse.v1.WarehouseService/ListArticles"
+	WarehouseService_ImportProducts_FullMethodName = "/warehouse.v1.WarehouseService/ImportProducts"
+	WarehouseService_FindProduct_FullMethodName    = "/warehouse.v1.WarehouseService/FindProduct"
+	WarehouseService_ListProducts_FullMethodName   = "/warehouse.v1.WarehouseService/ListProducts"
+	WarehouseService_RemoveProduct_FullMethodName  = "/warehouse.v1.WarehouseService/RemoveProduct"
+)
+
+// WarehouseServiceClient is the client API for WarehouseService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// WarehouseService exposes the article and product operations of the http api.
+type WarehouseServiceClient interface {
+	// ImportArticles imports articles and returns the new and updated articles.
+	ImportArticles(ctx context.Context, in *ImportArticlesRequest, opts ...grpc.CallOption) (*ImportArticlesResponse, error)
+	// ListArticles streams all the articles with stock information.
+	ListArticles(ctx context.Context, in *ListArticlesRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Article], error)
+	// ImportProducts imports products along with their articles.
+	ImportProducts(ctx context.Context, in *ImportProductsRequest, opts ...grpc.CallOption) (*ImportProductsResponse, error)
+	// FindProduct returns a product with stock information.
+	FindProduct(ctx context.Context, in *FindProductRequest, opts ...grpc.CallOption) (*ProductStock, error)
+	// ListProducts streams the products with stock information.
+	ListProducts(ctx context.Context, in *ListProductsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ProductStock], error)
+	// RemoveProduct removes the articles of a product from the inventory.
+	RemoveProduct(ctx context.Context, in *RemoveProductRequest, opts ...grpc.CallOption) (*ProductStock, error)
+}
+
+type warehouseServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewWarehouseServiceClient(cc grpc.ClientConnInterface) WarehouseServiceClient {
+	return &warehouseServiceClient{cc}
+}
+
+func (c *warehouseServiceClient) ImportArticles(ctx context.Context, in *ImportArticlesRequest, opts ...grpc.CallOption) (*ImportArticlesResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ImportArticlesResponse)
+	err := c.cc.Invoke(ctx, WarehouseService_ImportArticles_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *warehouseServiceClient) ListArticles(ctx context.Context, in *ListArticlesRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Article], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &WarehouseService_ServiceDesc.Streams[0], WarehouseService_ListArticles_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[ListArticlesRequest, Article]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type WarehouseService_ListArticlesClient = grpc.ServerStreamingClient[Article]
+
+func (c *warehouseServiceClient) ImportProducts(ctx context.Context, in *ImportProductsRequest, opts ...grpc.CallOption) (*ImportProductsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ImportProductsResponse)
+	err := c.cc.Invoke(ctx, WarehouseService_ImportProducts_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *warehouseServiceClient) FindProduct(ctx context.Context, in *FindProductRequest, opts ...grpc.CallOption) (*ProductStock, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ProductStock)
+	err := c.cc.Invoke(ctx, WarehouseService_FindProduct_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *warehouseServiceClient) ListProducts(ctx context.Context, in *ListProductsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ProductStock], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &WarehouseService_ServiceDesc.Streams[1], WarehouseService_ListProducts_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[ListProductsRequest, ProductStock]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type WarehouseService_ListProductsClient = grpc.ServerStreamingClient[ProductStock]
+
+func (c *warehouseServiceClient) RemoveProduct(ctx context.Context, in *RemoveProductRequest, opts ...grpc.CallOption) (*ProductStock, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ProductStock)
+	err := c.cc.Invoke(ctx, WarehouseService_RemoveProduct_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// WarehouseServiceServer is the server API for WarehouseService service.
+// All implementations must embed UnimplementedWarehouseServiceServer
+// for forward compatibility.
+//
+// WarehouseService exposes the article and product operations of the http api.
+type WarehouseServiceServer interface {
+	// ImportArticles imports articles and returns the new and updated articles.
+	ImportArticles(context.Context, *ImportArticlesRequest) (*ImportArticlesResponse, error)
+	// ListArticles streams all the articles with stock information.
+	ListArticles(*ListArticlesRequest, grpc.ServerStreamingServer[Article]) error
+	// ImportProducts imports products along with their articles.
+	ImportProducts(context.Context, *ImportProductsRequest) (*ImportProductsResponse, error)
+	// FindProduct returns a product with stock information.
+	FindProduct(context.Context, *FindProductRequest) (*ProductStock, error)
+	// ListProducts streams the products with stock information.
+	ListProducts(*ListProductsRequest, grpc.ServerStreamingServer[ProductStock]) error
+	// RemoveProduct removes the articles of a product from the inventory.
+	RemoveProduct(context.Context, *RemoveProductRequest) (*ProductStock, error)
+	mustEmbedUnimplementedWarehouseServiceServer()
+}
+
+// UnimplementedWarehouseServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedWarehouseServiceServer struct{}
+
+func (UnimplementedWarehouseServiceServer) ImportArticles(context.Context, *ImportArticlesRequest) (*ImportArticlesResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method ImportArticles not implemented")
+}
+func (UnimplementedWarehouseServiceServer) ListArticles(*ListArticlesRequest, grpc.ServerStreamingServer[Article]) error {
+	return status.Error(codes.Unimplemented, "method ListArticles not implemented")
+}
+func (UnimplementedWarehouseServiceServer) ImportProducts(context.Context, *ImportProductsRequest) (*ImportProductsResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method ImportProducts not implemented")
+}
+func (UnimplementedWarehouseServiceServer) FindProduct(context.Context, *FindProductRequest) (*ProductStock, error) {
+	return nil, status.Error(codes.Unimplemented, "method FindProduct not implemented")
+}
+func (UnimplementedWarehouseServiceServer) ListProducts(*ListProductsRequest, grpc.ServerStreamingServer[ProductStock]) error {
+	return status.Error(codes.Unimplemented, "method ListProducts not implemented")
+}
+func (UnimplementedWarehouseServiceServer) RemoveProduct(context.Context, *RemoveProductRequest) (*ProductStock, error) {
+	return nil, status.Error(codes.Unimplemented, "method RemoveProduct not implemented")
+}
+func (UnimplementedWarehouseServiceServer) mustEmbedUnimplementedWarehouseServiceServer() {}
+func (UnimplementedWarehouseServiceServer) testEmbeddedByValue()                          {}
+
+// UnsafeWarehouseServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to WarehouseServiceServer will
+// result in compilation errors.
+type UnsafeWarehouseServiceServer interface {
+	mustEmbedUnimplementedWarehouseServiceServer()
+}
+
+func RegisterWarehouseServiceServer(s grpc.ServiceRegistrar, srv WarehouseServiceServer) {
+	// If the following call panics, it indicates UnimplementedWarehouseServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&WarehouseService_ServiceDesc, srv)
+}
+
+func _WarehouseService_ImportArticles_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ImportArticlesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(WarehouseServiceServer).ImportArticles(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: WarehouseService_ImportArticles_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(WarehouseServiceServer).ImportArticles(ctx, req.(*ImportArticlesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _WarehouseService_ListArticles_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ListArticlesRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(WarehouseServiceServer).ListArticles(m, &grpc.GenericServerStream[ListArticlesRequest, Article]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type WarehouseService_ListArticlesServer = grpc.ServerStreamingServer[Article]
+
+func _WarehouseService_ImportProducts_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ImportProductsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(WarehouseServiceServer).ImportProducts(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: WarehouseService_ImportProducts_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(WarehouseServiceServer).ImportProducts(ctx, req.(*ImportProductsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _WarehouseService_FindProduct_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(FindProductRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(WarehouseServiceServer).FindProduct(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: WarehouseService_FindProduct_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(WarehouseServiceServer).FindProduct(ctx, req.(*FindProductRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _WarehouseService_ListProducts_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ListProductsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(WarehouseServiceServer).ListProducts(m, &grpc.GenericServerStream[ListProductsRequest, ProductStock]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type WarehouseService_ListProductsServer = grpc.ServerStreamingServer[ProductStock]
+
+func _WarehouseService_RemoveProduct_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RemoveProductRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(WarehouseServiceServer).RemoveProduct(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: WarehouseService_RemoveProduct_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(WarehouseServiceServer).RemoveProduct(ctx, req.(*RemoveProductRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// WarehouseService_ServiceDesc is the grpc.ServiceDesc for WarehouseService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var WarehouseService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "warehouse.v1.WarehouseService",
+	HandlerType: (*WarehouseServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ImportArticles",
+			Handler:    _WarehouseService_ImportArticles_Handler,
+		},
+		{
+			MethodName: "ImportProducts",
+			Handler:    _WarehouseService_ImportProducts_Handler,
+		},
+		{
+			MethodName: "FindProduct",
+			Handler:    _WarehouseService_FindProduct_Handler,
+		},
+		{
+			MethodName: "RemoveProduct",
+			Handler:    _WarehouseService_RemoveProduct_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "ListArticles",
+			Handler:       _WarehouseService_ListArticles_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "ListProducts",
+			Handler:       _WarehouseService_ListProducts_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "warehouse.proto",
+}
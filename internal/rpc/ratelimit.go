@@ -0,0 +1,101 @@
+package rpc
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+
+	"github.com/mtekmir/warehouse-service/internal/auth"
+	"github.com/mtekmir/warehouse-service/internal/errors"
+	"github.com/mtekmir/warehouse-service/internal/ratelimit"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/peer"
+)
+
+type limiter interface {
+	Allow(route, client string) ratelimit.Result
+}
+
+// methodRoute is the route of a method in the rates of routes, e.g.
+// "GRPC /warehouse.v1.WarehouseService/RemoveProduct".
+func methodRoute(method string) string {
+	return "GRPC " + method
+}
+
+// allow takes a token from the bucket of the client for the route. A nil limiter allows
+// every call.
+func allow(ctx context.Context, l limiter, route, client string) error {
+	var op errors.Op = "rpc.allow"
+	if l == nil {
+		return nil
+	}
+
+	res := l.Allow(route, client)
+	if !res.Allowed {
+		return errors.E(op, errors.RateLimited, fmt.Sprintf("Too many requests, retry in %ds", int(math.Ceil(res.RetryAfter.Seconds()))))
+	}
+	return nil
+}
+
+// client identifies the caller for rate limiting, by its api key once authenticated and
+// by its ip before.
+func client(ctx context.Context) string {
+	if k, ok := auth.FromContext(ctx); ok {
+		return fmt.Sprintf("key:%d", k.ID)
+	}
+	return "ip:" + peerIP(ctx)
+}
+
+// peerIP returns the ip of the caller.
+func peerIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+	return host
+}
+
+// unaryIPRateLimitInterceptor limits the calls of every ip to all the methods together.
+// It runs before authentication so that calls with invalid api keys are limited too.
+func unaryIPRateLimitInterceptor(l limiter) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if err := allow(ctx, l, ratelimit.AnyRoute, "ip:"+peerIP(ctx)); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+func streamIPRateLimitInterceptor(l limiter) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := allow(ss.Context(), l, ratelimit.AnyRoute, "ip:"+peerIP(ss.Context())); err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
+
+// unaryRateLimitInterceptor limits the calls of clients per method. It has to run after
+// authentication to identify the clients by their api keys.
+func unaryRateLimitInterceptor(l limiter) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if err := allow(ctx, l, methodRoute(info.FullMethod), client(ctx)); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+func streamRateLimitInterceptor(l limiter) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := allow(ss.Context(), l, methodRoute(info.FullMethod), client(ss.Context())); err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
@@ -0,0 +1,70 @@
+package rpc
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/mtekmir/warehouse-service/internal/auth"
+	"github.com/mtekmir/warehouse-service/internal/ratelimit"
+	"github.com/mtekmir/warehouse-service/internal/rpc/pb"
+	"github.com/mtekmir/warehouse-service/test"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestRateLimit(t *testing.T) {
+	s := &Server{
+		ProductService: test.NewMockProductService(),
+		AuthService: test.NewMockAuthService(map[string]*auth.Key{
+			"a": {ID: 1, Scopes: []auth.Scope{auth.ScopeProductsRead}},
+			"b": {ID: 2, Scopes: []auth.Scope{auth.ScopeProductsRead}},
+		}),
+		RateLimiter: ratelimit.New(ratelimit.Rate{}, map[string]ratelimit.Rate{
+			methodRoute(pb.WarehouseService_FindProduct_FullMethodName): {Limit: 1, Per: time.Minute},
+		}),
+		IPRateLimiter: ratelimit.New(ratelimit.Rate{Limit: 4, Per: time.Minute}, nil),
+		Log:           logrus.New(),
+	}
+
+	lis := bufconn.Listen(1 << 20)
+	srv := s.newGRPCServer()
+	go srv.Serve(lis)
+	defer srv.Stop()
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return lis.Dial() }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("Unable to dial grpc server. %v", err)
+	}
+	defer conn.Close()
+	c := pb.NewWarehouseServiceClient(conn)
+
+	find := func(key string) codes.Code {
+		t.Helper()
+		ctx := metadata.AppendToOutgoingContext(context.Background(), "x-api-key", key)
+		_, err := c.FindProduct(ctx, &pb.FindProductRequest{Id: 1})
+		return status.Code(err)
+	}
+
+	// Methods are limited per api key.
+	test.Compare(t, "codes", []codes.Code{codes.OK, codes.ResourceExhausted, codes.OK}, []codes.Code{find("a"), find("a"), find("b")})
+
+	// Calls with invalid keys count towards the limit of the ip, checked before the keys.
+	test.Compare(t, "codes", []codes.Code{codes.Unauthenticated, codes.ResourceExhausted}, []codes.Code{find("c"), find("c")})
+
+	stream, err := c.ListProducts(context.Background(), &pb.ListProductsRequest{})
+	if err == nil {
+		_, err = stream.Recv()
+	}
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("Expected streams to be limited by ip, got %v", err)
+	}
+}
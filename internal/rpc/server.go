@@ -0,0 +1,268 @@
+package rpc
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/mtekmir/warehouse-service/internal/article"
+	"github.com/mtekmir/warehouse-service/internal/errors"
+	"github.com/mtekmir/warehouse-service/internal/product"
+	"github.com/mtekmir/warehouse-service/internal/rpc/pb"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+)
+
+type productService interface {
+	Import(ctx context.Context, rows []*product.Product) error
+	Remove(ctx context.Context, ID product.ID, qty int) (*product.StockInfo, error)
+	Find(ctx context.Context, ID product.ID) (*product.StockInfo, error)
+	FindAll(ctx context.Context, ff *product.Filters) ([]*product.StockInfo, error)
+}
+
+type articleService interface {
+	Import(ctx context.Context, rows []*article.Article) ([]*article.Article, error)
+	FindAll(ctx context.Context) ([]*article.Article, error)
+}
+
+// listPageSize is the number of products fetched per query while streaming product listings.
+const listPageSize = 500
+
+// Server implements the WarehouseService grpc service. Calls aren't audited if
+// AuditService is nil. Calls aren't rate limited per client and method if RateLimiter
+// is nil, nor per ip before authentication if IPRateLimiter is nil.
+type Server struct {
+	pb.UnimplementedWarehouseServiceServer
+
+	ProductService productService
+	ArticleService articleService
+	AuthService    authenticator
+	AuditService   auditRecorder
+	RateLimiter    limiter
+	IPRateLimiter  limiter
+	Log            *logrus.Logger
+
+	mu  sync.Mutex
+	srv *grpc.Server
+}
+
+// ImportArticles imports articles and returns the new and updated articles.
+func (s *Server) ImportArticles(ctx context.Context, req *pb.ImportArticlesRequest) (*pb.ImportArticlesResponse, error) {
+	var op errors.Op = "rpc.importArticles"
+
+	rows := make([]*article.Article, 0, len(req.Articles))
+	for _, a := range req.Articles {
+		rows = append(rows, &article.Article{ArtID: article.ArtID(a.ArtId), Name: a.Name, Stock: int(a.Stock)})
+	}
+
+	arts, err := s.ArticleService.Import(ctx, rows)
+	if err != nil {
+		return nil, errors.E(op, err)
+	}
+
+	res := &pb.ImportArticlesResponse{Articles: make([]*pb.Article, 0, len(arts))}
+	for _, a := range arts {
+		res.Articles = append(res.Articles, toArticle(a))
+	}
+	return res, nil
+}
+
+// ListArticles streams all the articles.
+func (s *Server) ListArticles(_ *pb.ListArticlesRequest, stream pb.WarehouseService_ListArticlesServer) error {
+	var op errors.Op = "rpc.listArticles"
+
+	arts, err := s.ArticleService.FindAll(stream.Context())
+	if err != nil {
+		return errors.E(op, err)
+	}
+
+	for _, a := range arts {
+		if err := stream.Send(toArticle(a)); err != nil {
+			return errors.E(op, err)
+		}
+	}
+	return nil
+}
+
+// ImportProducts imports products along with their articles.
+func (s *Server) ImportProducts(ctx context.Context, req *pb.ImportProductsRequest) (*pb.ImportProductsResponse, error) {
+	var op errors.Op = "rpc.importProducts"
+
+	rows := make([]*product.Product, 0, len(req.Products))
+	for _, p := range req.Products {
+		prd := &product.Product{Barcode: product.Barcode(p.Barcode), Name: p.Name}
+		for _, a := range p.Articles {
+			prd.Articles = append(prd.Articles, &product.Article{ArtID: article.ArtID(a.ArtId), Name: a.Name, Amount: int(a.Amount)})
+		}
+		if err := prd.Validate(); err != nil {
+			return nil, errors.E(op, err)
+		}
+		rows = append(rows, prd)
+	}
+
+	if err := s.ProductService.Import(ctx, rows); err != nil {
+		return nil, errors.E(op, err)
+	}
+
+	return &pb.ImportProductsResponse{}, nil
+}
+
+// FindProduct returns a product with stock information.
+func (s *Server) FindProduct(ctx context.Context, req *pb.FindProductRequest) (*pb.ProductStock, error) {
+	var op errors.Op = "rpc.findProduct"
+
+	p, err := s.ProductService.Find(ctx, product.ID(req.Id))
+	if err != nil {
+		return nil, errors.E(op, err)
+	}
+
+	return toProductStock(p), nil
+}
+
+// ListProducts streams the products page by page so that large catalogues are not
+// loaded into memory at once.
+func (s *Server) ListProducts(req *pb.ListProductsRequest, stream pb.WarehouseService_ListProductsServer) error {
+	var op errors.Op = "rpc.listProducts"
+
+	ff := &product.Filters{InStock: req.InStock, Limit: listPageSize}
+	if len(req.Barcodes) > 0 {
+		bb := make([]product.Barcode, 0, len(req.Barcodes))
+		for _, b := range req.Barcodes {
+			bb = append(bb, product.Barcode(b))
+		}
+		ff.BB = &bb
+	}
+	if req.Sort != "" {
+		sort, err := product.ParseSort(req.Sort)
+		if err != nil {
+			return errors.E(op, err)
+		}
+		ff.Sort = sort
+	}
+
+	for {
+		pp, err := s.ProductService.FindAll(stream.Context(), ff)
+		if err != nil {
+			return errors.E(op, err)
+		}
+
+		for _, p := range pp {
+			if err := stream.Send(toProductStock(p)); err != nil {
+				return errors.E(op, err)
+			}
+		}
+
+		if len(pp) < ff.Limit {
+			return nil
+		}
+		ff.Offset += ff.Limit
+	}
+}
+
+// RemoveProduct removes the articles of a product from the inventory.
+func (s *Server) RemoveProduct(ctx context.Context, req *pb.RemoveProductRequest) (*pb.ProductStock, error) {
+	var op errors.Op = "rpc.removeProduct"
+
+	p, err := s.ProductService.Remove(ctx, product.ID(req.Id), int(req.Qty))
+	if err != nil {
+		return nil, errors.E(op, err)
+	}
+
+	return toProductStock(p), nil
+}
+
+// Start starts listening for grpc requests on the port.
+func (s *Server) Start(port string) error {
+	lis, err := net.Listen("tcp", fmt.Sprintf(":%s", port))
+	if err != nil {
+		return err
+	}
+
+	srv := s.newGRPCServer()
+	s.mu.Lock()
+	s.srv = srv
+	s.mu.Unlock()
+
+	return srv.Serve(lis)
+}
+
+// newGRPCServer returns a grpc server with the interceptors of the server that serves
+// the service.
+func (s *Server) newGRPCServer() *grpc.Server {
+	srv := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(
+			unaryErrorInterceptor(s.Log),
+			unaryIPRateLimitInterceptor(s.IPRateLimiter),
+			unaryAuditInterceptor(s.Log, s.AuditService),
+			unaryAuthInterceptor(s.AuthService),
+			unaryRateLimitInterceptor(s.RateLimiter),
+		),
+		grpc.ChainStreamInterceptor(
+			streamErrorInterceptor(s.Log),
+			streamIPRateLimitInterceptor(s.IPRateLimiter),
+			streamAuthInterceptor(s.AuthService),
+			streamRateLimitInterceptor(s.RateLimiter),
+		),
+	)
+	pb.RegisterWarehouseServiceServer(srv, s)
+	return srv
+}
+
+// Shutdown stops accepting connections and waits for the in-flight calls until ctx is
+// done. Calls that are still running then are cancelled.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	srv := s.srv
+	s.mu.Unlock()
+	if srv == nil {
+		return nil
+	}
+
+	done := make(chan struct{})
+	go func() {
+		srv.GracefulStop()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		srv.Stop()
+		return ctx.Err()
+	}
+}
+
+// NewServer returns a new grpc server instance with required dependencies.
+func NewServer(l *logrus.Logger, ps productService, as articleService, aus authenticator) *Server {
+	return &Server{
+		Log:            l,
+		ProductService: ps,
+		ArticleService: as,
+		AuthService:    aus,
+	}
+}
+
+func toArticle(a *article.Article) *pb.Article {
+	return &pb.Article{ArtId: string(a.ArtID), Name: a.Name, Stock: int64(a.Stock)}
+}
+
+func toProductStock(p *product.StockInfo) *pb.ProductStock {
+	res := &pb.ProductStock{
+		Id:                int64(p.ID),
+		Barcode:           string(p.Barcode),
+		Name:              p.Name,
+		AvailableQuantity: int64(p.AvailableQty),
+		Articles:          make([]*pb.ArticleStock, 0, len(p.Articles)),
+	}
+	for _, a := range p.Articles {
+		res.Articles = append(res.Articles, &pb.ArticleStock{
+			ArtId:          string(a.ArtID),
+			Name:           a.Name,
+			Stock:          int64(a.Stock),
+			RequiredAmount: int64(a.RequiredAmount),
+		})
+	}
+	return res
+}
@@ -0,0 +1,125 @@
+package rpc
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/mtekmir/warehouse-service/internal/errors"
+	"github.com/mtekmir/warehouse-service/internal/product"
+	"github.com/mtekmir/warehouse-service/internal/rpc/pb"
+	"github.com/mtekmir/warehouse-service/test"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func setup(t *testing.T, s *Server) (pb.WarehouseServiceClient, func()) {
+	t.Helper()
+
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(unaryErrorInterceptor(s.Log)),
+		grpc.ChainStreamInterceptor(streamErrorInterceptor(s.Log)),
+	)
+	pb.RegisterWarehouseServiceServer(srv, s)
+	go srv.Serve(lis)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return lis.Dial() }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("Unable to dial grpc server. %v", err)
+	}
+
+	return pb.NewWarehouseServiceClient(conn), func() {
+		conn.Close()
+		srv.Stop()
+	}
+}
+
+func TestProducts(t *testing.T) {
+	pSvc := test.NewMockProductService()
+	c, tidy := setup(t, &Server{ProductService: pSvc, Log: logrus.New()})
+	defer tidy()
+	ctx := context.Background()
+
+	_, err := c.ImportProducts(ctx, &pb.ImportProductsRequest{Products: []*pb.Product{
+		{Barcode: "123", Name: "chair", Articles: []*pb.ProductArticle{{ArtId: "1", Name: "leg", Amount: 4}}},
+	}})
+	if err != nil {
+		t.Fatalf("Unable to import products. %v", err)
+	}
+
+	expectedB := []*product.Product{{Barcode: "123", Name: "chair", Articles: []*product.Article{
+		{ArtID: "1", Name: "leg", Amount: 4},
+	}}}
+	test.Compare(t, "importCallArgs", expectedB, pSvc.Calls["Import"][0])
+
+	_, err = c.ImportProducts(ctx, &pb.ImportProductsRequest{Products: []*pb.Product{{Barcode: "123", Name: "chair"}}})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected InvalidArgument, got %v", err)
+	}
+
+	stream, err := c.ListProducts(ctx, &pb.ListProductsRequest{InStock: true, Sort: "-name"})
+	if err != nil {
+		t.Fatalf("Unable to list products. %v", err)
+	}
+	if _, err := stream.Recv(); err != io.EOF {
+		t.Errorf("Expected stream to end, got %v", err)
+	}
+
+	expectedFF := &product.Filters{InStock: true, Sort: &product.Sort{Field: product.SortByName, Desc: true}, Limit: listPageSize}
+	test.Compare(t, "findAllCallArgs", expectedFF, pSvc.Calls["FindAll"][0])
+
+	if _, err := c.RemoveProduct(ctx, &pb.RemoveProductRequest{Id: 1, Qty: 2}); err != nil {
+		t.Fatalf("Unable to remove product. %v", err)
+	}
+	test.Compare(t, "removeCallArgs", []interface{}{product.ID(1), 2}, pSvc.Calls["Remove"])
+}
+
+func TestRemoveProductInvalidQty(t *testing.T) {
+	// No db or repos, the quantity has to be rejected before they're used.
+	ps := product.NewService(logrus.New(), nil, nil, nil, nil)
+	c, tidy := setup(t, &Server{ProductService: ps, Log: logrus.New()})
+	defer tidy()
+	ctx := context.Background()
+
+	for _, qty := range []int64{0, -1} {
+		_, err := c.RemoveProduct(ctx, &pb.RemoveProductRequest{Id: 1, Qty: qty})
+		if status.Code(err) != codes.InvalidArgument {
+			t.Errorf("Expected InvalidArgument for qty %d, got %v", qty, err)
+		}
+	}
+}
+
+func TestToStatus(t *testing.T) {
+	tests := []struct {
+		err  error
+		code codes.Code
+		msg  string
+	}{
+		{errors.E(errors.Op("op"), errors.NotFound, "Product not found"), codes.NotFound, "Product not found"},
+		{errors.E(errors.Op("op"), errors.Duplicate, "Duplicate"), codes.AlreadyExists, "Duplicate"},
+		{errors.E(errors.Op("op"), errors.Invalid, "Invalid"), codes.InvalidArgument, "Invalid"},
+		{errors.E(errors.Op("op"), errors.Unavailable, "Unavailable"), codes.Unavailable, "Unavailable"},
+		{errors.E(errors.Op("op"), errors.Unauthorized, "Unauthorized"), codes.Unauthenticated, "Unauthorized"},
+		{errors.E(errors.Op("op"), io.EOF), codes.Internal, "Something went wrong."},
+		{io.EOF, codes.Internal, "Something went wrong."},
+		{errors.E(errors.Op("op"), errors.E(errors.Op("inner"), context.Canceled)), codes.Canceled, "Request was cancelled."},
+		{fmt.Errorf("query: %w", context.DeadlineExceeded), codes.DeadlineExceeded, "Request timed out."},
+	}
+
+	for _, tt := range tests {
+		s, _ := status.FromError(toStatus(logrus.New(), tt.err))
+		if s.Code() != tt.code || s.Message() != tt.msg {
+			t.Errorf("Expected %v %q, got %v %q", tt.code, tt.msg, s.Code(), s.Message())
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/mtekmir/warehouse-service/internal/auth"
+	"github.com/mtekmir/warehouse-service/internal/errors"
+)
+
+// keyWithToken is returned when a key is created or rotated. It's the only time the
+// token is sent to the client.
+type keyWithToken struct {
+	*auth.Key
+	Token string `json:"key"`
+}
+
+func (s *Server) handleGetAPIKeys(w http.ResponseWriter, r *http.Request) error {
+	var op errors.Op = "reqHandlers.handleGetAPIKeys"
+
+	kk, err := s.AuthService.FindAll(r.Context())
+	if err != nil {
+		return errors.E(op, err)
+	}
+
+	return json.NewEncoder(w).Encode(kk)
+}
+
+func (s *Server) handleCreateAPIKey(w http.ResponseWriter, r *http.Request) error {
+	var op errors.Op = "reqHandlers.handleCreateAPIKey"
+
+	body := struct {
+		Name   string       `json:"name"`
+		Scopes []auth.Scope `json:"scopes"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		return errors.E(op, errors.Invalid, "Unable to unmarshal json. Invalid format", err)
+	}
+
+	k, token, err := s.AuthService.Create(r.Context(), body.Name, body.Scopes)
+	if err != nil {
+		return errors.E(op, err)
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	return json.NewEncoder(w).Encode(keyWithToken{Key: k, Token: token})
+}
+
+func (s *Server) handleRotateAPIKey(w http.ResponseWriter, r *http.Request) error {
+	var op errors.Op = "reqHandlers.handleRotateAPIKey"
+
+	ID, err := idParam(r)
+	if err != nil {
+		return errors.E(op, err)
+	}
+
+	k, token, err := s.AuthService.Rotate(r.Context(), auth.KeyID(ID))
+	if err != nil {
+		return errors.E(op, err)
+	}
+
+	return json.NewEncoder(w).Encode(keyWithToken{Key: k, Token: token})
+}
+
+func (s *Server) handleRevokeAPIKey(w http.ResponseWriter, r *http.Request) error {
+	var op errors.Op = "reqHandlers.handleRevokeAPIKey"
+
+	ID, err := idParam(r)
+	if err != nil {
+		return errors.E(op, err)
+	}
+
+	k, err := s.AuthService.Revoke(r.Context(), auth.KeyID(ID))
+	if err != nil {
+		return errors.E(op, err)
+	}
+
+	return json.NewEncoder(w).Encode(k)
+}
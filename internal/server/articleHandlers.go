@@ -3,6 +3,7 @@ package server
 import (
 	"encoding/json"
 	"net/http"
+	"strconv"
 
 	"github.com/mtekmir/warehouse-service/internal/article"
 	"github.com/mtekmir/warehouse-service/internal/errors"
@@ -16,7 +17,7 @@ func (s *Server) handleImportArticles(w http.ResponseWriter, r *http.Request) er
 	var op errors.Op = "reqHandlers.handleImportArticles"
 
 	var b inv
-	if err := json.NewDecoder(r.Body).Decode(&b); err != nil {
+	if err := decodeJSON(r, &b); err != nil {
 		return errors.E(op, errors.Invalid, "Unable to unmarshal json. Invalid format", err)
 	}
 
@@ -40,3 +41,27 @@ func (s *Server) handleGetArticles(w http.ResponseWriter, r *http.Request) error
 	res.Inventory = arts
 	return json.NewEncoder(w).Encode(res)
 }
+
+// defaultExpiryDays is the number of days of the expiring lots report if the request
+// doesn't set it.
+const defaultExpiryDays = 30
+
+func (s *Server) handleGetExpiringLots(w http.ResponseWriter, r *http.Request) error {
+	var op errors.Op = "reqHandlers.handleGetExpiringLots"
+
+	days := defaultExpiryDays
+	if v := r.URL.Query().Get("days"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return errors.E(op, errors.Invalid, "days must be a non-negative integer")
+		}
+		days = n
+	}
+
+	lots, err := s.ArticleService.ExpiringLots(r.Context(), days)
+	if err != nil {
+		return errors.E(op, err)
+	}
+
+	return json.NewEncoder(w).Encode(lots)
+}
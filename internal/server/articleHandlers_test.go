@@ -4,10 +4,12 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/mtekmir/warehouse-service/internal/article"
 	"github.com/mtekmir/warehouse-service/internal/server"
 	"github.com/mtekmir/warehouse-service/test"
+	"github.com/sirupsen/logrus"
 )
 
 func TestArticleRoutes(t *testing.T) {
@@ -34,4 +36,45 @@ func TestArticleRoutes(t *testing.T) {
 
 	expectedB := []*article.Article{{ArtID: "19999", Name: "rear leg", Stock: 281}}
 	test.Compare(t, "importCallArgs", expectedB, aSvc.Calls["Import"])
+
+	// Stock defaults to the total quantity of the lots.
+	body = `{ "inventory": [{"art_id": "20000", "name": "glue", "lots": [
+		{"lot_number": "G1", "expires_at": "2027-01-01T00:00:00Z", "qty": 3},
+		{"lot_number": "G2", "received_at": "2026-10-01T00:00:00Z", "qty": 2}
+	]}] }`
+	res3 := testRequest(t, ts, "POST", "/articles/import", body, []reqHeader{})
+	if res3.StatusCode != http.StatusOK {
+		t.Errorf("Expected OK got %s", res3.Status)
+	}
+	expires, received := time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	test.Compare(t, "importCallArgs", []*article.Article{{ArtID: "20000", Name: "glue", Stock: 5, Lots: []*article.Lot{
+		{Number: "G1", ExpiresAt: &expires, Qty: 3},
+		{Number: "G2", ReceivedAt: received, Qty: 2},
+	}}}, aSvc.Calls["Import"])
+}
+
+func TestGetExpiringLots(t *testing.T) {
+	aSvc := test.NewMockArticleService()
+	srv := server.Server{ArticleService: aSvc, Log: logrus.New()}
+
+	ts := httptest.NewServer(http.HandlerFunc(srv.Router))
+	defer ts.Close()
+
+	res := testRequest(t, ts, "GET", "/articles/lots/expiring", nil, []reqHeader{})
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("Expected OK got %s", res.Status)
+	}
+	test.Compare(t, "days", 30, aSvc.Calls["ExpiringLots"])
+
+	res = testRequest(t, ts, "GET", "/articles/lots/expiring?days=7", nil, []reqHeader{})
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("Expected OK got %s", res.Status)
+	}
+	test.Compare(t, "days", 7, aSvc.Calls["ExpiringLots"])
+
+	res = testRequest(t, ts, "GET", "/articles/lots/expiring?days=-1", nil, []reqHeader{})
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected Bad Request got %s", res.Status)
+	}
+	checkErr(t, res, "days must be a non-negative integer")
 }
@@ -0,0 +1,72 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/mtekmir/warehouse-service/internal/audit"
+	"github.com/mtekmir/warehouse-service/internal/errors"
+)
+
+func (s *Server) handleGetAuditEvents(w http.ResponseWriter, r *http.Request) error {
+	var op errors.Op = "reqHandlers.handleGetAuditEvents"
+
+	if s.AuditService == nil {
+		return errors.E(op, errors.Unavailable, "Audit log is disabled")
+	}
+
+	ff, err := auditFilters(r.URL.Query())
+	if err != nil {
+		return errors.E(op, err)
+	}
+
+	ee, err := s.AuditService.FindAll(r.Context(), ff)
+	if err != nil {
+		return errors.E(op, err)
+	}
+
+	return json.NewEncoder(w).Encode(ee)
+}
+
+// auditFilters parses the query parameters of get audit events requests.
+func auditFilters(q url.Values) (*audit.Filters, error) {
+	var op errors.Op = "reqHandlers.auditFilters"
+
+	ff := &audit.Filters{Actor: q.Get("actor"), Action: q.Get("action"), Target: q.Get("target")}
+
+	for _, p := range []struct {
+		name string
+		val  **time.Time
+	}{{"from", &ff.From}, {"to", &ff.To}} {
+		v := q.Get(p.name)
+		if v == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return nil, errors.E(op, errors.Invalid, fmt.Sprintf("%s must be an RFC 3339 time", p.name), err)
+		}
+		*p.val = &t
+	}
+
+	for _, p := range []struct {
+		name string
+		val  *int
+	}{{"limit", &ff.Limit}, {"offset", &ff.Offset}} {
+		v := q.Get(p.name)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return nil, errors.E(op, errors.Invalid, fmt.Sprintf("%s must be a non-negative integer", p.name))
+		}
+		*p.val = n
+	}
+
+	return ff, nil
+}
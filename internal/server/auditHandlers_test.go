@@ -0,0 +1,45 @@
+package server_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mtekmir/warehouse-service/internal/audit"
+	"github.com/mtekmir/warehouse-service/internal/server"
+	"github.com/mtekmir/warehouse-service/test"
+	"github.com/sirupsen/logrus"
+)
+
+func TestGetAuditEvents(t *testing.T) {
+	audSvc := test.NewMockAuditService()
+	audSvc.Events = []*audit.Event{{ID: 1, Actor: "key:3", Action: "product.remove", Targets: []string{"product:7"}, Result: "ok"}}
+	srv := server.Server{AuditService: audSvc, Log: logrus.New()}
+
+	ts := httptest.NewServer(http.HandlerFunc(srv.Router))
+	defer ts.Close()
+
+	res := testRequest(t, ts, "GET", "/audit?actor=key:3&action=product.remove&target=product:7&from=2026-01-01T00:00:00Z&to=2026-02-01T00:00:00Z&limit=10&offset=5", nil, []reqHeader{})
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("Expected OK got %s", res.Status)
+	}
+	var ee []*audit.Event
+	if err := json.NewDecoder(res.Body).Decode(&ee); err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	test.Compare(t, "events", audSvc.Events, ee)
+
+	from, to := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)
+	test.Compare(t, "filters", &audit.Filters{
+		Actor: "key:3", Action: "product.remove", Target: "product:7", From: &from, To: &to, Limit: 10, Offset: 5,
+	}, audSvc.Filters)
+
+	res = testRequest(t, ts, "GET", "/audit?from=yesterday", nil, []reqHeader{})
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected Bad Request got %s", res.Status)
+	}
+	checkErr(t, res, "from must be an RFC 3339 time")
+}
@@ -0,0 +1,52 @@
+package server_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mtekmir/warehouse-service/internal/server"
+)
+
+func TestDebugHandler(t *testing.T) {
+	ts := httptest.NewServer(server.DebugHandler())
+	defer ts.Close()
+
+	res, err := http.Get(ts.URL + "/debug/vars")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("Expected OK got %s", res.Status)
+	}
+	vars := make(map[string]json.RawMessage)
+	if err := json.NewDecoder(res.Body).Decode(&vars); err != nil {
+		t.Fatalf("Unable to decode the vars. %v", err)
+	}
+	if _, ok := vars["memstats"]; !ok {
+		t.Error("Expected the vars to contain memstats")
+	}
+	if _, ok := vars["cmdline"]; ok {
+		t.Error("Expected the command line not to be served")
+	}
+
+	res2, err := http.Get(ts.URL + "/debug/pprof/cmdline")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res2.Body.Close()
+	if res2.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected Not Found for the pprof command line got %s", res2.Status)
+	}
+
+	res3, err := http.Get(ts.URL + "/debug/pprof/goroutine?debug=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res3.Body.Close()
+	if res3.StatusCode != http.StatusOK {
+		t.Errorf("Expected OK for the goroutine profile got %s", res3.Status)
+	}
+}
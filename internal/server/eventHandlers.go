@@ -0,0 +1,190 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mtekmir/warehouse-service/internal/article"
+	"github.com/mtekmir/warehouse-service/internal/auth"
+	"github.com/mtekmir/warehouse-service/internal/errors"
+	"github.com/mtekmir/warehouse-service/internal/outbox"
+	"github.com/mtekmir/warehouse-service/internal/product"
+	"github.com/mtekmir/warehouse-service/internal/stream"
+)
+
+// keepAliveInterval is how often comments are sent on idle streams, so that proxies don't
+// close them.
+const keepAliveInterval = 15 * time.Second
+
+// ticketCookie is the cookie that carries the ticket of the event stream, for clients
+// on the same site.
+const ticketCookie = "warehouse_stream_ticket"
+
+// handleCreateTicket issues a ticket of the api key of the request that authenticates
+// event stream requests, which can't carry headers when they are sent by the
+// EventSource of browsers. The ticket is returned and set as a cookie of the stream.
+func (s *Server) handleCreateTicket(w http.ResponseWriter, r *http.Request) error {
+	var op errors.Op = "reqHandlers.handleCreateTicket"
+
+	if s.Stream == nil {
+		return errors.E(op, errors.Unavailable, "Event stream is disabled")
+	}
+	k, ok := auth.FromContext(r.Context())
+	if !ok {
+		return errors.E(op, errors.Unauthorized, "Api key is required")
+	}
+
+	ticket, exp, err := s.AuthService.IssueTicket(r.Context(), k)
+	if err != nil {
+		return errors.E(op, err)
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     ticketCookie,
+		Value:    ticket,
+		Path:     "/events/stream",
+		Expires:  exp,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteStrictMode,
+	})
+	w.WriteHeader(http.StatusCreated)
+	return json.NewEncoder(w).Encode(struct {
+		Ticket    string    `json:"ticket"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}{ticket, exp})
+}
+
+func (s *Server) handleEventStream(w http.ResponseWriter, r *http.Request) error {
+	var op errors.Op = "reqHandlers.handleEventStream"
+
+	if s.Stream == nil {
+		return errors.E(op, errors.Unavailable, "Event stream is disabled")
+	}
+
+	f := streamFilter(r.URL.Query())
+	var after outbox.EventID
+	if v := r.Header.Get("Last-Event-ID"); v != "" {
+		ID, err := strconv.Atoi(v)
+		if err != nil || ID < 0 {
+			return errors.E(op, errors.Invalid, "Last-Event-ID must be the id of an event")
+		}
+		after = outbox.EventID(ID)
+	}
+
+	sub, err := s.Stream.Subscribe(f, after)
+	if err != nil {
+		return errors.E(op, err)
+	}
+	defer sub.Close()
+
+	// Streams outlive the timeouts of the server.
+	rc := http.NewResponseController(w)
+	rc.SetReadDeadline(time.Time{})
+	rc.SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		return nil
+	}
+
+	send := func(u *stream.Update) error {
+		if err := writeUpdate(w, u); err != nil {
+			return err
+		}
+		return rc.Flush()
+	}
+
+	// Write errors mean that the client is gone, there is no one to respond to.
+	if err := sub.Replay(r.Context(), send); err != nil {
+		logError(s.Log, r, err)
+		return nil
+	}
+
+	t := time.NewTicker(keepAliveInterval)
+	defer t.Stop()
+	closing := s.closing()
+	for {
+		select {
+		case <-r.Context().Done():
+			return nil
+		case <-closing:
+			return nil
+		case u, ok := <-sub.C:
+			// The subscriber fell behind, it resumes from the last update it received.
+			if !ok {
+				return nil
+			}
+			if err := send(u); err != nil {
+				return nil
+			}
+		case <-t.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return nil
+			}
+			if err := rc.Flush(); err != nil {
+				return nil
+			}
+		}
+	}
+}
+
+// writeUpdate writes the changes of the update as server-sent events. Only the last event
+// carries the id of the update, so that clients that disconnect in the middle of an
+// update resume from its beginning.
+func writeUpdate(w http.ResponseWriter, u *stream.Update) error {
+	type event struct {
+		name string
+		data interface{}
+	}
+	ee := make([]event, 0, len(u.Stocks)+len(u.Availabilities))
+	for _, st := range u.Stocks {
+		ee = append(ee, event{"stock", st})
+	}
+	for _, a := range u.Availabilities {
+		ee = append(ee, event{"availability", a})
+	}
+
+	var b strings.Builder
+	for i, e := range ee {
+		data, err := json.Marshal(e.data)
+		if err != nil {
+			return err
+		}
+		if i == len(ee)-1 {
+			fmt.Fprintf(&b, "id: %d\n", u.ID)
+		}
+		fmt.Fprintf(&b, "event: %s\ndata: %s\n\n", e.name, data)
+	}
+	_, err := fmt.Fprint(w, b.String())
+	return err
+}
+
+// streamFilter parses the query parameters of event stream requests. Returns nil if the
+// request doesn't filter the changes.
+func streamFilter(q url.Values) *stream.Filter {
+	if q.Get("barcodes") == "" && q.Get("art_ids") == "" {
+		return nil
+	}
+
+	f := &stream.Filter{ArtIDs: map[article.ArtID]bool{}, Barcodes: map[product.Barcode]bool{}}
+	for _, b := range strings.Split(q.Get("barcodes"), ",") {
+		if b != "" {
+			f.Barcodes[product.Barcode(b)] = true
+		}
+	}
+	for _, a := range strings.Split(q.Get("art_ids"), ",") {
+		if a != "" {
+			f.ArtIDs[article.ArtID(a)] = true
+		}
+	}
+	return f
+}
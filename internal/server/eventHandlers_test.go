@@ -0,0 +1,134 @@
+package server_test
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mtekmir/warehouse-service/internal/article"
+	"github.com/mtekmir/warehouse-service/internal/memory"
+	"github.com/mtekmir/warehouse-service/internal/product"
+	"github.com/mtekmir/warehouse-service/internal/server"
+	"github.com/mtekmir/warehouse-service/internal/stream"
+	"github.com/sirupsen/logrus"
+)
+
+// readEvent reads the lines of the next server-sent event.
+func readEvent(t *testing.T, r *bufio.Reader) []string {
+	t.Helper()
+	var lines []string
+	for {
+		l, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("Unable to read the stream. %v", err)
+		}
+		l = strings.TrimSuffix(l, "\n")
+		if l == "" {
+			return lines
+		}
+		lines = append(lines, l)
+	}
+}
+
+func TestEventStream(t *testing.T) {
+	s := memory.NewStore()
+	db := memory.NewDB(s)
+	defer db.Close()
+	or := memory.NewOutboxRepo(s)
+	ar := memory.NewArticleRepo(s)
+	ps := product.NewService(logrus.New(), db, memory.NewProductRepo(s), ar, or)
+	as := article.NewService(logrus.New(), db, ar, or)
+	hub := stream.NewHub(logrus.New(), db, or, ps, 10*time.Millisecond)
+
+	err := ps.Import(context.Background(), []*product.Product{
+		{Barcode: "b1", Name: "chair", Articles: []*product.Article{{ArtID: "1", Name: "leg", Amount: 4}, {ArtID: "2", Name: "seat", Amount: 1}}},
+	})
+	if err != nil {
+		t.Fatalf("Unable to import products. %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		hub.Run(ctx)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+	for {
+		sub, err := hub.Subscribe(nil, 0)
+		if err == nil {
+			sub.Close()
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	srv := server.Server{Stream: hub, Log: logrus.New()}
+	ts := httptest.NewServer(http.HandlerFunc(srv.Router))
+	defer ts.Close()
+
+	res := testRequest(t, ts, "GET", "/events/stream?barcodes=b1&art_ids=2", nil, []reqHeader{})
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("Expected OK got %s", res.Status)
+	}
+	if ct := res.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Expected content type text/event-stream got %s", ct)
+	}
+
+	if _, err := as.Import(context.Background(), []*article.Article{{ArtID: "2", Name: "seat", Stock: 1}}); err != nil {
+		t.Fatalf("Unable to import articles. %v", err)
+	}
+	r := bufio.NewReader(res.Body)
+	compareLines(t, "stock event", []string{`event: stock`, `data: {"art_id":"2","stock":2}`}, readEvent(t, r))
+	compareLines(t, "availability event", []string{`id: 3`, `event: availability`, `data: {"id":1,"barcode":"b1","available_quantity":1}`}, readEvent(t, r))
+
+	// Clients resume from the id of the last event they received.
+	res2 := testRequest(t, ts, "GET", "/events/stream?art_ids=2", nil, []reqHeader{{"Last-Event-ID", "2"}})
+	defer res2.Body.Close()
+	r2 := bufio.NewReader(res2.Body)
+	compareLines(t, "replayed event", []string{`id: 3`, `event: stock`, `data: {"art_id":"2","stock":2}`}, readEvent(t, r2))
+
+	res3 := testRequest(t, ts, "GET", "/events/stream", nil, []reqHeader{{"Last-Event-ID", "last"}})
+	if res3.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected Bad Request got %s", res3.Status)
+	}
+	checkErr(t, res3, "Last-Event-ID must be the id of an event")
+	res3.Body.Close()
+
+	// Streams end when the server shuts down.
+	if err := srv.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Unable to shutdown. %v", err)
+	}
+	if _, err := io.ReadAll(r); err != nil {
+		t.Errorf("Expected the stream to end. Got %v", err)
+	}
+}
+
+func TestEventStreamDisabled(t *testing.T) {
+	srv := server.Server{Log: logrus.New()}
+	ts := httptest.NewServer(http.HandlerFunc(srv.Router))
+	defer ts.Close()
+
+	res := testRequest(t, ts, "GET", "/events/stream", nil, []reqHeader{})
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Expected Service Unavailable got %s", res.Status)
+	}
+	checkErr(t, res, "Event stream is disabled")
+}
+
+func compareLines(t *testing.T, name string, expected, got []string) {
+	t.Helper()
+	if strings.Join(expected, "\n") != strings.Join(got, "\n") {
+		t.Errorf("Expected %s to be %q, got %q", name, expected, got)
+	}
+}
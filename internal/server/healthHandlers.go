@@ -0,0 +1,37 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// handleHealthz reports that the process is alive.
+func (s *Server) handleHealthz(w http.ResponseWriter, r *http.Request) error {
+	return json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// handleReadyz reports whether the server can handle requests. Responds with 503 if
+// any of the checks fail.
+func (s *Server) handleReadyz(w http.ResponseWriter, r *http.Request) error {
+	rd := s.Health.Ready(r.Context())
+	if !rd.Ready {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	return json.NewEncoder(w).Encode(rd)
+}
+
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) error {
+	return json.NewEncoder(w).Encode(s.Health.Status(r.Context()))
+}
+
+// probe serves a health endpoint. Probes bypass the middlewares so that they are not
+// authenticated, rate limited or logged.
+func (s *Server) probe(h handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		h.ServeHTTP(s.Log, w, r)
+	}
+}
@@ -0,0 +1,47 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mtekmir/warehouse-service/internal/health"
+	"github.com/sirupsen/logrus"
+)
+
+func TestReadyz(t *testing.T) {
+	hc := health.NewChecker(nil, nil, 0, time.Second, "dev")
+	srv := &Server{Health: hc, Log: logrus.New()}
+
+	ts := httptest.NewServer(srv.probe(srv.handleReadyz))
+	defer ts.Close()
+
+	res, err := http.Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("Expected OK got %s", res.Status)
+	}
+
+	hc.Drain()
+	res, err = http.Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Expected Service Unavailable got %s", res.Status)
+	}
+
+	var rd health.Readiness
+	if err := json.NewDecoder(res.Body).Decode(&rd); err != nil {
+		t.Fatal(err)
+	}
+	if rd.Ready || rd.Checks[0].OK {
+		t.Errorf("Expected draining check to fail, got %+v", rd.Checks[0])
+	}
+}
@@ -1,28 +1,71 @@
 package server
 
 import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net"
 	"net/http"
+	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/mtekmir/warehouse-service/internal/audit"
+	"github.com/mtekmir/warehouse-service/internal/auth"
+	"github.com/mtekmir/warehouse-service/internal/errors"
+	"github.com/mtekmir/warehouse-service/internal/logs"
+	"github.com/mtekmir/warehouse-service/internal/metrics"
+	"github.com/mtekmir/warehouse-service/internal/openapi"
+	"github.com/mtekmir/warehouse-service/internal/ratelimit"
+	"github.com/mtekmir/warehouse-service/internal/tracing"
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.43.0"
 )
 
-func corsMiddleware(clientURL string) func(http.Handler) http.Handler {
+// corsMiddleware allows browsers to send requests from the origins. Any origin is allowed
+// if origins includes "*", but then browsers don't send cookies. Preflight requests
+// are answered here, before they are authenticated.
+func corsMiddleware(origins []string) func(http.Handler) http.Handler {
+	allowed := make(map[string]bool, len(origins))
+	for _, o := range origins {
+		allowed[strings.TrimSpace(o)] = true
+	}
+
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			allowedOrigin := ""
-			if strings.TrimSpace(clientURL) == r.Header.Get("Origin") {
-				allowedOrigin = r.Header.Get("Origin")
+			origin := r.Header.Get("Origin")
+			switch {
+			case origin == "":
+				next.ServeHTTP(w, r)
+				return
+			case allowed["*"]:
+				w.Header().Set("Access-Control-Allow-Origin", "*")
+			case allowed[origin]:
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+				w.Header().Add("Vary", "Origin")
+			default:
+				w.Header().Add("Vary", "Origin")
+				next.ServeHTTP(w, r)
+				return
 			}
 
-			w.Header().Set("Access-Control-Allow-Origin", allowedOrigin)
-			w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
-			if r.Method == "OPTIONS" {
-				w.WriteHeader(http.StatusOK)
+			if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+				w.Header().Set("Access-Control-Allow-Methods", "GET, POST, DELETE, OPTIONS")
+				w.Header().Set("Access-Control-Allow-Headers", "Authorization, X-API-Key, Content-Type, Last-Event-ID, X-Request-ID")
+				w.Header().Set("Access-Control-Max-Age", "600")
+				w.WriteHeader(http.StatusNoContent)
 				return
 			}
+			w.Header().Set("Access-Control-Expose-Headers", "X-Request-ID, RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset, Retry-After")
 			next.ServeHTTP(w, r)
-			return
 		})
 	}
 }
@@ -33,9 +76,9 @@ func noPanicMiddleware(log *logrus.Logger) func(http.Handler) http.Handler {
 			defer func() {
 				err := recover()
 				if err != nil {
-					log.Printf("An unexpected error occurred: %v\n", err)
-					w.WriteHeader(500)
-					w.Write([]byte(`{"message": "Something went wrong."}`))
+					e := fmt.Errorf("panic: %v", err)
+					logError(log, r, e)
+					writeError(w, r, e)
 				}
 			}()
 			next.ServeHTTP(w, r)
@@ -43,9 +86,447 @@ func noPanicMiddleware(log *logrus.Logger) func(http.Handler) http.Handler {
 	}
 }
 
+// tracingMiddleware starts a span for every request, continuing the trace of the W3C
+// traceparent header if the request carries one. It should be the outermost middleware
+// so that the other middlewares are traced as well.
+func tracingMiddleware() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			name, attrs := r.Method, []attribute.KeyValue{semconv.HTTPRequestMethodKey.String(r.Method), semconv.URLPath(r.URL.Path)}
+			if rt, _ := match(r); rt != nil {
+				name = rt.method + " " + rt.path
+				attrs = append(attrs, semconv.HTTPRoute(rt.path))
+			}
+
+			ctx, span := tracing.StartServer(tracing.Extract(r.Context(), r.Header), name, attrs...)
+			defer span.End()
+
+			rec := &statusRecorder{ResponseWriter: w}
+			next.ServeHTTP(rec, r.WithContext(ctx))
+			if rec.status == 0 {
+				rec.status = http.StatusOK
+			}
+
+			span.SetAttributes(semconv.HTTPResponseStatusCode(rec.status))
+			if rec.status >= 500 {
+				span.SetStatus(codes.Error, http.StatusText(rec.status))
+			}
+		})
+	}
+}
+
+// requestLog is the state of a request reported in its access log line.
+type requestLog struct {
+	id  string // Id of the request, sent back in error responses.
+	err error
+}
+
+// statusRecorder records the status and the size of responses.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += n
+	return n, err
+}
+
+// Flush sends the buffered response to the client, for streamed responses.
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		if r.status == 0 {
+			r.status = http.StatusOK
+		}
+		f.Flush()
+	}
+}
+
+// Unwrap returns the recorded writer, so that http.ResponseController reaches it.
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// newRequestID returns a random 16 byte hex encoded id.
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%d", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
+// requestLogMiddleware propagates the X-Request-ID header of the request, or assigns
+// a new id, and stores a log entry carrying the id in the context. It logs one line
+// per request with the status, latency and size of the response, and the error of
+// failed requests. It should only be preceded by tracingMiddleware.
+func requestLogMiddleware(log *logrus.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+
+			id := r.Header.Get("X-Request-ID")
+			if !validRequestID.MatchString(id) {
+				id = newRequestID()
+			}
+			w.Header().Set("X-Request-ID", id)
+
+			entry := log.WithField("request_id", id)
+			if traceID, ok := tracing.TraceID(r.Context()); ok {
+				entry = entry.WithField("trace_id", traceID)
+			}
+			rl := &requestLog{id: id}
+			ctx := logs.WithEntry(r.Context(), entry)
+			ctx = context.WithValue(ctx, requestLogKey, rl)
+
+			rec := &statusRecorder{ResponseWriter: w}
+			next.ServeHTTP(rec, r.WithContext(ctx))
+			if rec.status == 0 {
+				rec.status = http.StatusOK
+			}
+
+			entry = entry.WithFields(logrus.Fields{
+				"method":     r.Method,
+				"path":       r.URL.Path,
+				"status":     rec.status,
+				"latency_ms": float64(time.Since(start).Microseconds()) / 1000,
+				"bytes":      rec.bytes,
+			})
+			if rl.err != nil {
+				entry = entry.WithFields(errorFields(rl.err))
+			}
+			if rec.status >= 500 {
+				entry.Error("request")
+				return
+			}
+			entry.Info("request")
+		})
+	}
+}
+
+// errorFields returns the log fields describing err.
+func errorFields(err error) logrus.Fields {
+	var e *errors.Error
+	if !errors.As(err, &e) {
+		return logrus.Fields{"error": err.Error()}
+	}
+
+	ff := logrus.Fields{"error_kind": e.Kind.String(), "ops": e.Ops()}
+	if e.Message != "" {
+		ff["error"] = e.Message
+	}
+	if c := e.Cause(); c != nil {
+		ff["cause"] = c.Error()
+	}
+	return ff
+}
+
+// metricsMiddleware records the count and the latency of requests per route.
+// Requests that don't match a route are recorded under the "unmatched" route and the
+// "other" method so that clients can't blow up the number of series.
+func metricsMiddleware() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			rec := &statusRecorder{ResponseWriter: w}
+			next.ServeHTTP(rec, r)
+			if rec.status == 0 {
+				rec.status = http.StatusOK
+			}
+
+			route, method := "unmatched", "other"
+			if rt, _ := match(r); rt != nil {
+				route, method = rt.path, rt.method
+			}
+			metrics.HTTPRequests.WithLabelValues(route, method, strconv.Itoa(rec.status)).Inc()
+			metrics.HTTPDuration.WithLabelValues(route, method).Observe(time.Since(start).Seconds())
+		})
+	}
+}
+
 func applyMiddlewares(h http.Handler, mm ...func(http.Handler) http.Handler) http.Handler {
 	for i := len(mm) - 1; i >= 0; i-- {
 		h = mm[i](h)
 	}
 	return h
 }
+
+// authMiddleware authenticates the api key of the request and checks that it's granted
+// the scope of the route. Keys are read from the Authorization header as bearer tokens
+// or from the X-API-Key header. Routes with tickets accept requests without a key that
+// carry a ticket in the ticket query parameter or the ticket cookie.
+func authMiddleware(log *logrus.Logger, svc authService) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var op errors.Op = "server.authMiddleware"
+
+			rt, _ := match(r)
+			if rt == nil || rt.scope == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			token := r.Header.Get("X-API-Key")
+			if h := r.Header.Get("Authorization"); strings.HasPrefix(h, "Bearer ") {
+				token = strings.TrimPrefix(h, "Bearer ")
+			}
+
+			var k *auth.Key
+			var err error
+			if ticket := requestTicket(r); token == "" && rt.tickets && ticket != "" {
+				k, err = svc.AuthenticateTicket(r.Context(), ticket)
+			} else {
+				k, err = svc.Authenticate(r.Context(), token)
+			}
+			if e, ok := audit.FromContext(r.Context()); ok && err == nil {
+				e.Actor = audit.KeyActor(int(k.ID))
+			}
+			if err == nil && !k.HasScope(rt.scope) {
+				err = errors.E(op, errors.Forbidden, fmt.Sprintf("Api key is missing the %s scope", rt.scope))
+			}
+			if err != nil {
+				handler(func(http.ResponseWriter, *http.Request) error {
+					return errors.E(op, err)
+				}).ServeHTTP(log, w, r)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(auth.WithKey(r.Context(), k)))
+		})
+	}
+}
+
+// requestTicket returns the ticket of the request, if any.
+func requestTicket(r *http.Request) string {
+	if t := r.URL.Query().Get("ticket"); t != "" {
+		return t
+	}
+	if c, err := r.Cookie(ticketCookie); err == nil {
+		return c.Value
+	}
+	return ""
+}
+
+// rateLimitMiddleware limits the requests of clients per route. Authenticated clients
+// are identified by their api key and the others by their ip, so it has to run after
+// authMiddleware. A nil limiter disables rate limiting.
+func rateLimitMiddleware(log *logrus.Logger, l limiter) func(http.Handler) http.Handler {
+	return limitMiddleware(log, l, func(r *http.Request, rt *route) (string, string) {
+		return rt.method + " " + rt.path, client(r)
+	})
+}
+
+// ipRateLimitMiddleware limits the requests of every ip to all the routes together. It
+// runs before authMiddleware so that requests with invalid api keys are limited too and
+// keys can't be guessed quickly. A nil limiter disables it.
+func ipRateLimitMiddleware(log *logrus.Logger, l limiter) func(http.Handler) http.Handler {
+	return limitMiddleware(log, l, func(r *http.Request, _ *route) (string, string) {
+		return ratelimit.AnyRoute, "ip:" + remoteIP(r)
+	})
+}
+
+// limitMiddleware takes a token from the bucket of the route and client that key returns
+// for the request, and rejects the request if the bucket is empty.
+func limitMiddleware(log *logrus.Logger, l limiter, key func(*http.Request, *route) (string, string)) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if l == nil {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rt, _ := match(r)
+			if rt == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			res := l.Allow(key(r, rt))
+			if res.Limit > 0 {
+				w.Header().Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+				w.Header().Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+				w.Header().Set("RateLimit-Reset", seconds(res.Reset))
+			}
+			if !res.Allowed {
+				metrics.RateLimited.WithLabelValues(rt.path).Inc()
+				w.Header().Set("Retry-After", seconds(res.RetryAfter))
+				handler(func(http.ResponseWriter, *http.Request) error {
+					return errors.E(errors.Op("server.rateLimitMiddleware"), errors.RateLimited, "Too many requests")
+				}).ServeHTTP(log, w, r)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// client identifies the client of the request for rate limiting.
+func client(r *http.Request) string {
+	if k, ok := auth.FromContext(r.Context()); ok {
+		return fmt.Sprintf("key:%d", k.ID)
+	}
+	return "ip:" + remoteIP(r)
+}
+
+// remoteIP returns the ip of the client of the request.
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// seconds rounds d up to whole seconds.
+func seconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
+
+// auditMiddleware records an audit event for the requests of the routes with an action,
+// whether they succeed or not. It runs before authMiddleware so that rejected requests
+// are recorded too, authMiddleware sets the api key of the event. The services add the
+// rows that they change to the events. A nil service disables auditing.
+func auditMiddleware(log *logrus.Logger, svc auditService) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if svc == nil {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rt, params := match(r)
+			if rt == nil || rt.action == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			body, r, err := readBody(w, r)
+			if err != nil {
+				handler(func(http.ResponseWriter, *http.Request) error {
+					return errors.E(errors.Op("server.auditMiddleware"), err)
+				}).ServeHTTP(log, w, r)
+				return
+			}
+
+			e := &audit.Event{Actor: audit.IPActor(remoteIP(r)), Action: rt.action, Targets: []string{}, PayloadDigest: audit.Digest(body)}
+			if ID, ok := params["id"]; ok {
+				e.AddTargets(audit.Target(strings.SplitN(rt.action, ".", 2)[0], ID))
+			}
+			rl, _ := r.Context().Value(requestLogKey).(*requestLog)
+			if rl != nil {
+				e.RequestID = rl.id
+			}
+
+			rec := &statusRecorder{ResponseWriter: w}
+			done := false
+			defer func() {
+				// Requests that panicked aren't done and fail with an internal error.
+				e.Result = audit.ResultOK
+				if !done || rec.status >= 400 {
+					e.Result = errors.Other.Code()
+					if rl != nil && rl.err != nil {
+						e.Result = audit.Result(rl.err)
+					}
+				}
+				if err := svc.Record(r.Context(), e); err != nil {
+					logs.FromContext(r.Context(), log).Printf("Unable to record the audit event of %s: %v", e.Action, err)
+				}
+			}()
+			next.ServeHTTP(rec, r.WithContext(audit.WithEvent(r.Context(), e)))
+			done = true
+		})
+	}
+}
+
+// maxBodySize is the size of the largest request body that the middlewares read.
+const maxBodySize = 32 << 20
+
+// readBody reads the body of the request, up to maxBodySize. The body is read once, the
+// returned request carries the copy for the middlewares after and its body reads the
+// copy again for the handlers.
+func readBody(w http.ResponseWriter, r *http.Request) ([]byte, *http.Request, error) {
+	var op errors.Op = "server.readBody"
+	if b, ok := r.Context().Value(bodyKey).([]byte); ok {
+		return b, r, nil
+	}
+	if r.Body == nil {
+		return nil, r, nil
+	}
+
+	b, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+	if err != nil {
+		var mbe *http.MaxBytesError
+		if errors.As(err, &mbe) {
+			return nil, r, errors.E(op, errors.Invalid, fmt.Sprintf("Request body is larger than %d bytes", maxBodySize), err)
+		}
+		return nil, r, errors.E(op, errors.Invalid, "Unable to read request body", err)
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(b))
+	return b, r.WithContext(context.WithValue(r.Context(), bodyKey, b)), nil
+}
+
+// validationMiddleware validates the parameters and the body of requests against the
+// OpenAPI document before they reach the handlers.
+func validationMiddleware(log *logrus.Logger, d *openapi.Document) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rt, params := match(r)
+			if rt == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+			o := d.Operation(rt.path, rt.method)
+			if o == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			var body []byte
+			if o.RequestBody != nil {
+				var err error
+				if body, r, err = readBody(w, r); err != nil {
+					handler(func(http.ResponseWriter, *http.Request) error {
+						return errors.E(errors.Op("server.validationMiddleware"), err)
+					}).ServeHTTP(log, w, r)
+					return
+				}
+			}
+
+			if vv := d.ValidateRequest(o, params, r.URL.Query(), body); len(vv) > 0 {
+				handler(func(http.ResponseWriter, *http.Request) error {
+					return errors.E(errors.Op("server.validationMiddleware"), errors.Invalid, violationsMessage(vv), violationDetails(vv))
+				}).ServeHTTP(log, w, r)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func violationDetails(vv []openapi.Violation) []errors.Detail {
+	dd := make([]errors.Detail, 0, len(vv))
+	for _, v := range vv {
+		dd = append(dd, errors.Detail{Field: v.Field, Message: v.Message})
+	}
+	return dd
+}
+
+func violationsMessage(vv []openapi.Violation) string {
+	ss := make([]string, 0, len(vv))
+	for _, v := range vv {
+		ss = append(ss, v.Field+" "+v.Message)
+	}
+	return "Invalid request: " + strings.Join(ss, ", ")
+}
@@ -0,0 +1,531 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mtekmir/warehouse-service/internal/audit"
+	"github.com/mtekmir/warehouse-service/internal/auth"
+	"github.com/mtekmir/warehouse-service/internal/errors"
+	"github.com/mtekmir/warehouse-service/internal/metrics"
+	"github.com/mtekmir/warehouse-service/internal/outbox"
+	"github.com/mtekmir/warehouse-service/internal/ratelimit"
+	"github.com/mtekmir/warehouse-service/internal/stream"
+	"github.com/mtekmir/warehouse-service/internal/tracing"
+	"github.com/mtekmir/warehouse-service/test"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+func TestAuthMiddleware(t *testing.T) {
+	aSvc := test.NewMockAuthService(map[string]*auth.Key{
+		"reader": {Name: "reader", Scopes: []auth.Scope{auth.ScopeProductsRead}},
+		"admin":  {Name: "admin", Scopes: []auth.Scope{auth.ScopeAdmin}},
+	})
+	srv := &Server{ProductService: test.NewMockProductService(), AuthService: aSvc, Log: logrus.New()}
+
+	ts := httptest.NewServer(applyMiddlewares(http.HandlerFunc(srv.Router), authMiddleware(srv.Log, aSvc)))
+	defer ts.Close()
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		header   string
+		value    string
+		expected int
+	}{
+		{"missing key", "GET", "/products", "", "", http.StatusUnauthorized},
+		{"unknown key", "GET", "/products", "X-API-Key", "unknown", http.StatusUnauthorized},
+		{"api key header", "GET", "/products", "X-API-Key", "reader", http.StatusOK},
+		{"bearer token", "GET", "/products/1", "Authorization", "Bearer reader", http.StatusOK},
+		{"missing scope", "POST", "/products/remove/1", "X-API-Key", "reader", http.StatusForbidden},
+		{"admin", "GET", "/admin/keys", "X-API-Key", "admin", http.StatusOK},
+		{"public route", "GET", "/openapi.json", "", "", http.StatusOK},
+		// The event stream is disabled, so authenticated stream requests are unavailable.
+		{"stream ticket", "GET", "/events/stream?ticket=ticket:reader", "", "", http.StatusServiceUnavailable},
+		{"stream ticket cookie", "GET", "/events/stream", "Cookie", ticketCookie + "=ticket:reader", http.StatusServiceUnavailable},
+		{"invalid ticket", "GET", "/events/stream?ticket=ticket:unknown", "", "", http.StatusUnauthorized},
+		{"ticket of another route", "GET", "/products?ticket=ticket:reader", "", "", http.StatusUnauthorized},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest(tc.method, ts.URL+tc.path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.header != "" {
+				req.Header.Set(tc.header, tc.value)
+			}
+			res, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			res.Body.Close()
+
+			if res.StatusCode != tc.expected {
+				t.Errorf("Expected status %d, got %d", tc.expected, res.StatusCode)
+			}
+		})
+	}
+}
+
+// stubHub rejects the subscriptions.
+type stubHub struct{}
+
+func (stubHub) Subscribe(*stream.Filter, outbox.EventID) (*stream.Subscription, error) {
+	return nil, errors.E(errors.Op("stubHub.subscribe"), errors.Unavailable, "Stream is starting")
+}
+
+func TestStreamTicket(t *testing.T) {
+	aSvc := test.NewMockAuthService(map[string]*auth.Key{
+		"reader": {Name: "reader", Scopes: []auth.Scope{auth.ScopeProductsRead}},
+	})
+	srv := &Server{AuthService: aSvc, Stream: stubHub{}, Log: logrus.New()}
+
+	ts := httptest.NewServer(applyMiddlewares(http.HandlerFunc(srv.Router), authMiddleware(srv.Log, aSvc)))
+	defer ts.Close()
+
+	req, _ := http.NewRequest("POST", ts.URL+"/events/tickets", nil)
+	req.Header.Set("X-API-Key", "reader")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d", res.StatusCode)
+	}
+	var body struct {
+		Ticket string `json:"ticket"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Ticket != "ticket:reader" {
+		t.Errorf("Expected the ticket of the key, got %q", body.Ticket)
+	}
+
+	cc := res.Cookies()
+	if len(cc) != 1 || cc[0].Name != ticketCookie || cc[0].Value != body.Ticket || !cc[0].HttpOnly || cc[0].Path != "/events/stream" {
+		t.Fatalf("Expected the ticket cookie of the stream, got %v", cc)
+	}
+
+	// The cookie authenticates the stream request, which reaches the hub.
+	req, _ = http.NewRequest("GET", ts.URL+"/events/stream", nil)
+	req.AddCookie(cc[0])
+	res, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	var e errors.Response
+	if err := json.NewDecoder(res.Body).Decode(&e); err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusServiceUnavailable || e.Message != "Stream is starting" {
+		t.Errorf("Expected the stream request to reach the hub, got %d %q", res.StatusCode, e.Message)
+	}
+}
+
+func TestCORSMiddleware(t *testing.T) {
+	tests := []struct {
+		name        string
+		origins     []string
+		method      string
+		origin      string
+		status      int
+		allowOrigin string
+		credentials bool
+	}{
+		{"any origin", []string{"*"}, "GET", "https://app.example.com", http.StatusOK, "*", false},
+		{"allowed origin", []string{"https://app.example.com"}, "GET", "https://app.example.com", http.StatusOK, "https://app.example.com", true},
+		{"other origin", []string{"https://app.example.com"}, "GET", "https://evil.example.com", http.StatusOK, "", false},
+		{"no origin", []string{"*"}, "GET", "", http.StatusOK, "", false},
+		{"preflight", []string{"https://app.example.com"}, "OPTIONS", "https://app.example.com", http.StatusNoContent, "https://app.example.com", true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+			ts := httptest.NewServer(corsMiddleware(tc.origins)(next))
+			defer ts.Close()
+
+			req, _ := http.NewRequest(tc.method, ts.URL+"/events/stream", nil)
+			if tc.origin != "" {
+				req.Header.Set("Origin", tc.origin)
+			}
+			if tc.method == "OPTIONS" {
+				req.Header.Set("Access-Control-Request-Method", "GET")
+				req.Header.Set("Access-Control-Request-Headers", "authorization, last-event-id")
+			}
+			res, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			res.Body.Close()
+
+			if res.StatusCode != tc.status {
+				t.Errorf("Expected status %d, got %d", tc.status, res.StatusCode)
+			}
+			if got := res.Header.Get("Access-Control-Allow-Origin"); got != tc.allowOrigin {
+				t.Errorf("Expected allowed origin %q, got %q", tc.allowOrigin, got)
+			}
+			if got := res.Header.Get("Access-Control-Allow-Credentials") == "true"; got != tc.credentials {
+				t.Errorf("Expected credentials to be allowed %t, got %t", tc.credentials, got)
+			}
+			if tc.method == "OPTIONS" {
+				for _, h := range []string{"Authorization", "Last-Event-ID"} {
+					if !strings.Contains(res.Header.Get("Access-Control-Allow-Headers"), h) {
+						t.Errorf("Expected %s to be allowed, got %q", h, res.Header.Get("Access-Control-Allow-Headers"))
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	aSvc := test.NewMockAuthService(map[string]*auth.Key{
+		"a": {ID: 1, Scopes: []auth.Scope{auth.ScopeProductsRead}},
+		"b": {ID: 2, Scopes: []auth.Scope{auth.ScopeProductsRead}},
+	})
+	rl := ratelimit.New(ratelimit.Rate{Limit: 1, Per: time.Minute}, map[string]ratelimit.Rate{
+		"GET /products/{id}": {Limit: 2, Per: time.Minute},
+	})
+	srv := &Server{ProductService: test.NewMockProductService(), AuthService: aSvc, RateLimiter: rl, Log: logrus.New()}
+
+	ts := httptest.NewServer(applyMiddlewares(
+		http.HandlerFunc(srv.Router),
+		authMiddleware(srv.Log, aSvc),
+		rateLimitMiddleware(srv.Log, rl),
+	))
+	defer ts.Close()
+
+	get := func(path, key string) *http.Response {
+		t.Helper()
+		req, err := http.NewRequest("GET", ts.URL+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("X-API-Key", key)
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		return res
+	}
+
+	res := get("/products", "a")
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("Expected OK got %s", res.Status)
+	}
+	test.Compare(t, "rateLimitHeaders", []string{"1", "0", "60"}, []string{
+		res.Header.Get("RateLimit-Limit"), res.Header.Get("RateLimit-Remaining"), res.Header.Get("RateLimit-Reset"),
+	})
+
+	res = get("/products", "a")
+	if res.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("Expected Too Many Requests got %s", res.Status)
+	}
+	if ra := res.Header.Get("Retry-After"); ra != "60" {
+		t.Errorf("Expected Retry-After to be 60, got %s", ra)
+	}
+
+	if res := get("/products", "b"); res.StatusCode != http.StatusOK {
+		t.Errorf("Expected other keys not to be limited, got %s", res.Status)
+	}
+	for i := 0; i < 2; i++ {
+		if res := get("/products/1", "a"); res.StatusCode != http.StatusOK {
+			t.Errorf("Expected route limit to apply, got %s", res.Status)
+		}
+	}
+
+	test.Compare(t, "rejected", map[string]uint64{"GET /products": 1}, rl.Stats().Rejected)
+}
+
+func TestIPRateLimitMiddleware(t *testing.T) {
+	aSvc := test.NewMockAuthService(map[string]*auth.Key{
+		"a": {ID: 1, Scopes: []auth.Scope{auth.ScopeProductsRead}},
+	})
+	ipl := ratelimit.New(ratelimit.Rate{Limit: 3, Per: time.Minute}, nil)
+	srv := &Server{ProductService: test.NewMockProductService(), AuthService: aSvc, Log: logrus.New()}
+
+	ts := httptest.NewServer(applyMiddlewares(
+		http.HandlerFunc(srv.Router),
+		ipRateLimitMiddleware(srv.Log, ipl),
+		authMiddleware(srv.Log, aSvc),
+	))
+	defer ts.Close()
+
+	get := func(path, key string) int {
+		t.Helper()
+		req, err := http.NewRequest("GET", ts.URL+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("X-API-Key", key)
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		return res.StatusCode
+	}
+
+	// Requests with invalid keys and to every route share the bucket of the ip.
+	test.Compare(t, "codes",
+		[]int{http.StatusUnauthorized, http.StatusUnauthorized, http.StatusOK, http.StatusTooManyRequests},
+		[]int{get("/products", "x"), get("/products/1", "y"), get("/products", "a"), get("/products", "a")},
+	)
+}
+
+func TestRequestLogMiddleware(t *testing.T) {
+	log, hook := logtest.NewNullLogger()
+	srv := &Server{ProductService: test.NewMockProductService(), Log: log}
+
+	ts := httptest.NewServer(applyMiddlewares(http.HandlerFunc(srv.Router), requestLogMiddleware(log), noPanicMiddleware(log)))
+	defer ts.Close()
+
+	req, err := http.NewRequest("GET", ts.URL+"/products/1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("X-Request-ID", "abc-123")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	if id := res.Header.Get("X-Request-ID"); id != "abc-123" {
+		t.Errorf("Expected request id to be propagated, got %s", id)
+	}
+	if n := len(hook.AllEntries()); n != 1 {
+		t.Fatalf("Expected 1 log line, got %d", n)
+	}
+	e := hook.LastEntry()
+	test.Compare(t, "accessLog", logrus.Fields{
+		"request_id": "abc-123",
+		"method":     "GET",
+		"path":       "/products/1",
+		"status":     http.StatusOK,
+		"bytes":      e.Data["bytes"],
+		"latency_ms": e.Data["latency_ms"],
+	}, e.Data)
+
+	hook.Reset()
+	res, err = http.Get(ts.URL + "/unknown")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var body errors.Response
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	id := res.Header.Get("X-Request-ID")
+	if len(id) != 32 {
+		t.Errorf("Expected a request id to be assigned, got %s", id)
+	}
+	test.Compare(t, "errorResponse", errors.Response{Code: "not_found", Message: "Route not found", RequestID: id}, body)
+	e = hook.LastEntry()
+	if e.Data["status"] != http.StatusNotFound || e.Data["error"] != "Route not found" {
+		t.Errorf("Expected the error to be logged, got %v", e.Data)
+	}
+	test.Compare(t, "ops", []errors.Op{"reqHandlers.handleNotFound"}, e.Data["ops"])
+}
+
+func TestStatusRecorderFlush(t *testing.T) {
+	w := httptest.NewRecorder()
+	rec := &statusRecorder{ResponseWriter: w}
+
+	if err := http.NewResponseController(rec).Flush(); err != nil {
+		t.Fatalf("Unable to flush. %v", err)
+	}
+	if !w.Flushed || rec.status != http.StatusOK {
+		t.Errorf("Expected the response to be flushed with OK, got flushed %v status %d", w.Flushed, rec.status)
+	}
+}
+
+func TestMetricsMiddleware(t *testing.T) {
+	srv := &Server{ProductService: test.NewMockProductService(), Log: logrus.New()}
+
+	ts := httptest.NewServer(applyMiddlewares(http.HandlerFunc(srv.Router), metricsMiddleware()))
+	defer ts.Close()
+
+	count := func(route, method, code string) float64 {
+		return testutil.ToFloat64(metrics.HTTPRequests.WithLabelValues(route, method, code))
+	}
+	ok, notFound := count("/products/{id}", "GET", "200"), count("unmatched", "other", "404")
+
+	for _, path := range []string{"/products/1", "/products/2", "/unknown"} {
+		res, err := http.Get(ts.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+	}
+
+	if got := count("/products/{id}", "GET", "200") - ok; got != 2 {
+		t.Errorf("Expected 2 requests to be counted for the route, got %v", got)
+	}
+	if got := count("unmatched", "other", "404") - notFound; got != 1 {
+		t.Errorf("Expected 1 unmatched request to be counted, got %v", got)
+	}
+}
+
+func TestTracingMiddleware(t *testing.T) {
+	if _, err := tracing.Setup(context.Background(), tracing.ExporterNone, ""); err != nil {
+		t.Fatal(err)
+	}
+	sr := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)))
+	defer otel.SetTracerProvider(noop.NewTracerProvider())
+
+	log, hook := logtest.NewNullLogger()
+	srv := &Server{ProductService: test.NewMockProductService(), Log: log}
+	ts := httptest.NewServer(applyMiddlewares(http.HandlerFunc(srv.Router), tracingMiddleware(), requestLogMiddleware(log)))
+	defer ts.Close()
+
+	traceID := "4bf92f3577b34da6a3ce929d0e0e4736"
+	req, err := http.NewRequest("GET", ts.URL+"/products/1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	spans := sr.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("Expected 1 span, got %d", len(spans))
+	}
+	s := spans[0]
+	if s.Name() != "GET /products/{id}" {
+		t.Errorf("Expected span to be named after the route, got %s", s.Name())
+	}
+	if s.SpanContext().TraceID().String() != traceID {
+		t.Errorf("Expected span to continue the trace of the request, got %s", s.SpanContext().TraceID())
+	}
+	if id := hook.LastEntry().Data["trace_id"]; id != traceID {
+		t.Errorf("Expected trace id to be logged, got %v", id)
+	}
+}
+
+func TestAuditMiddleware(t *testing.T) {
+	aSvc := test.NewMockAuthService(map[string]*auth.Key{
+		"writer": {ID: 3, Scopes: []auth.Scope{auth.ScopeProductsRead, auth.ScopeProductsRemove}},
+		"reader": {ID: 4, Scopes: []auth.Scope{auth.ScopeProductsRead}},
+	})
+	audSvc := test.NewMockAuditService()
+	srv := &Server{ProductService: test.NewMockProductService(), AuthService: aSvc, AuditService: audSvc, Log: logrus.New()}
+
+	ts := httptest.NewServer(applyMiddlewares(
+		http.HandlerFunc(srv.Router),
+		requestLogMiddleware(srv.Log),
+		auditMiddleware(srv.Log, audSvc),
+		authMiddleware(srv.Log, aSvc),
+		validationMiddleware(srv.Log, spec),
+	))
+	defer ts.Close()
+
+	do := func(method, path, key, body string) {
+		t.Helper()
+		req, err := http.NewRequest(method, ts.URL+path, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("X-API-Key", key)
+		req.Header.Set("X-Request-ID", "req-1")
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+	}
+
+	do("POST", "/products/remove/7", "writer", `{"qty": 2}`)
+	do("POST", "/products/remove/8", "writer", `{"qty": 0}`)
+	do("POST", "/products/remove/9", "reader", `{"qty": 1}`)
+	do("POST", "/products/remove/10", "invalid", `{"qty": 1}`) // Unauthenticated calls are recorded by ip.
+	do("GET", "/products", "writer", "")
+
+	test.Compare(t, "events", []*audit.Event{
+		{
+			Actor:         "key:3",
+			Action:        "product.remove",
+			Targets:       []string{"product:7"},
+			PayloadDigest: audit.Digest([]byte(`{"qty": 2}`)),
+			Result:        "ok",
+			RequestID:     "req-1",
+		},
+		{
+			Actor:         "key:3",
+			Action:        "product.remove",
+			Targets:       []string{"product:8"},
+			PayloadDigest: audit.Digest([]byte(`{"qty": 0}`)),
+			Result:        "invalid",
+			RequestID:     "req-1",
+		},
+		{
+			Actor:         "key:4",
+			Action:        "product.remove",
+			Targets:       []string{"product:9"},
+			PayloadDigest: audit.Digest([]byte(`{"qty": 1}`)),
+			Result:        "forbidden",
+			RequestID:     "req-1",
+		},
+		{
+			Actor:         "ip:127.0.0.1",
+			Action:        "product.remove",
+			Targets:       []string{"product:10"},
+			PayloadDigest: audit.Digest([]byte(`{"qty": 1}`)),
+			Result:        "unauthorized",
+			RequestID:     "req-1",
+		},
+	}, audSvc.Recorded())
+}
+
+func TestReadBody(t *testing.T) {
+	r := httptest.NewRequest("POST", "/products/remove/1", strings.NewReader(`{"qty": 1}`))
+	b, r, err := readBody(httptest.NewRecorder(), r)
+	if err != nil {
+		t.Fatalf("Unable to read the body. %v", err)
+	}
+	// The body is read once and shared.
+	shared, _, err := readBody(httptest.NewRecorder(), r)
+	if err != nil {
+		t.Fatalf("Unable to read the shared body. %v", err)
+	}
+	test.Compare(t, "body", string(b), string(shared))
+	rest, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.Compare(t, "handler body", `{"qty": 1}`, string(rest))
+
+	large := httptest.NewRequest("POST", "/products/import", strings.NewReader(strings.Repeat(" ", maxBodySize+1)))
+	_, _, err = readBody(httptest.NewRecorder(), large)
+	var e *errors.Error
+	if !errors.As(err, &e) || e.Kind != errors.Invalid {
+		t.Errorf("Expected an invalid error for a body over the limit. Got %v", err)
+	}
+}
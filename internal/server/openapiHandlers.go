@@ -0,0 +1,50 @@
+package server
+
+import (
+	_ "embed"
+	"net/http"
+
+	"github.com/mtekmir/warehouse-service/internal/openapi"
+)
+
+// openAPIDoc is the OpenAPI document of the http api. Every route must be described in it.
+//
+//go:embed openapi.json
+var openAPIDoc []byte
+
+var spec = mustParseSpec(openAPIDoc)
+
+func mustParseSpec(data []byte) *openapi.Document {
+	d, err := openapi.Parse(data)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+func (s *Server) handleGetOpenAPI(w http.ResponseWriter, r *http.Request) error {
+	_, err := w.Write(openAPIDoc)
+	return err
+}
+
+const docsPage = `<!DOCTYPE html>
+<html>
+<head>
+  <title>Warehouse Service</title>
+  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js"></script>
+  <script>
+    window.ui = SwaggerUIBundle({ url: "/openapi.json", dom_id: "#swagger-ui" });
+  </script>
+</body>
+</html>
+`
+
+func (s *Server) handleGetDocs(w http.ResponseWriter, r *http.Request) error {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, err := w.Write([]byte(docsPage))
+	return err
+}
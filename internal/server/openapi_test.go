@@ -0,0 +1,69 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mtekmir/warehouse-service/internal/errors"
+	"github.com/mtekmir/warehouse-service/internal/product"
+	"github.com/mtekmir/warehouse-service/test"
+	"github.com/sirupsen/logrus"
+)
+
+func TestSpecCoversRoutes(t *testing.T) {
+	documented := 0
+	for _, item := range spec.Paths {
+		documented += len(item.Operations())
+	}
+
+	for _, rt := range routes {
+		if spec.Operation(rt.path, rt.method) == nil {
+			t.Errorf("%s %s is not documented in openapi.json", rt.method, rt.path)
+		}
+	}
+
+	if documented != len(routes) {
+		t.Errorf("Expected %d documented operations, got %d", len(routes), documented)
+	}
+}
+
+func TestValidationMiddleware(t *testing.T) {
+	pSvc := test.NewMockProductService()
+	srv := &Server{ProductService: pSvc, Log: logrus.New()}
+
+	ts := httptest.NewServer(applyMiddlewares(http.HandlerFunc(srv.Router), validationMiddleware(srv.Log, spec)))
+	defer ts.Close()
+
+	res, err := http.Post(ts.URL+"/products/remove/1", "application/json", strings.NewReader(`{"qty": 0}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected Bad Request got %s", res.Status)
+	}
+	var body errors.Response
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	test.Compare(t, "errorResponse", errors.Response{
+		Code:    "invalid",
+		Message: "Invalid request: body.qty must be greater than or equal to 1",
+		Details: []errors.Detail{{Field: "body.qty", Message: "must be greater than or equal to 1"}},
+	}, body)
+	if _, ok := pSvc.Calls["Remove"]; ok {
+		t.Error("Expected invalid request not to reach the handler")
+	}
+
+	res, err = http.Post(ts.URL+"/products/remove/1", "application/json", strings.NewReader(`{"qty": 2}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("Expected OK got %s", res.Status)
+	}
+	test.Compare(t, "removeCallArgs", []interface{}{product.ID(1), 2}, pSvc.Calls["Remove"])
+}
@@ -2,9 +2,12 @@ package server
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/mtekmir/warehouse-service/internal/errors"
 	"github.com/mtekmir/warehouse-service/internal/product"
@@ -17,7 +20,7 @@ func (s *Server) handleImportProducts(w http.ResponseWriter, r *http.Request) er
 		Products []*product.Product `json:"products"`
 	}{}
 
-	if err := json.NewDecoder(r.Body).Decode(&b); err != nil {
+	if err := decodeJSON(r, &b); err != nil {
 		return errors.E(op, err)
 	}
 
@@ -32,11 +35,9 @@ func (s *Server) handleImportProducts(w http.ResponseWriter, r *http.Request) er
 func (s *Server) handleGetProducts(w http.ResponseWriter, r *http.Request) error {
 	var op errors.Op = "reqHandlers.handleGetProducts"
 
-	ff := &product.Filters{}
-	for _, b := range strings.Split(r.URL.Query().Get("barcodes"), ",") {
-		if b != "" {
-			*ff.BB = append(*ff.BB, product.Barcode(b))
-		}
+	ff, err := productFilters(r.URL.Query())
+	if err != nil {
+		return errors.E(op, err)
 	}
 
 	res, err := s.ProductService.FindAll(r.Context(), ff)
@@ -50,7 +51,7 @@ func (s *Server) handleGetProducts(w http.ResponseWriter, r *http.Request) error
 func (s *Server) handleGetProduct(w http.ResponseWriter, r *http.Request) error {
 	var op errors.Op = "reqHandlers.handleGetProduct"
 
-	ID, err := strconv.Atoi(string(productPath.FindSubmatch([]byte(r.URL.Path))[1]))
+	ID, err := idParam(r)
 	if err != nil {
 		return errors.E(op, err)
 	}
@@ -66,7 +67,7 @@ func (s *Server) handleGetProduct(w http.ResponseWriter, r *http.Request) error
 func (s *Server) handleRemoveProduct(w http.ResponseWriter, r *http.Request) error {
 	var op errors.Op = "reqHandlers.handleRemoveProduct"
 
-	ID, err := strconv.Atoi(string(removeProductsPath.FindSubmatch([]byte(r.URL.Path))[1]))
+	ID, err := idParam(r)
 	if err != nil {
 		return errors.E(op, err)
 	}
@@ -84,3 +85,130 @@ func (s *Server) handleRemoveProduct(w http.ResponseWriter, r *http.Request) err
 
 	return json.NewEncoder(w).Encode(p)
 }
+
+// transitionProduct returns a handler that moves products to the status. Deleting a
+// product archives it, the product can be restored as a draft.
+func transitionProduct(to product.Status) func(*Server, http.ResponseWriter, *http.Request) error {
+	return func(s *Server, w http.ResponseWriter, r *http.Request) error {
+		var op errors.Op = "reqHandlers.handleTransitionProduct"
+
+		ID, err := idParam(r)
+		if err != nil {
+			return errors.E(op, err)
+		}
+
+		p, err := s.ProductService.Transition(r.Context(), product.ID(ID), to)
+		if err != nil {
+			return errors.E(op, err)
+		}
+
+		return json.NewEncoder(w).Encode(p)
+	}
+}
+
+func (s *Server) handleGetRevisions(w http.ResponseWriter, r *http.Request) error {
+	var op errors.Op = "reqHandlers.handleGetRevisions"
+
+	ID, err := idParam(r)
+	if err != nil {
+		return errors.E(op, err)
+	}
+
+	rr, err := s.ProductService.Revisions(r.Context(), product.ID(ID))
+	if err != nil {
+		return errors.E(op, err)
+	}
+
+	return json.NewEncoder(w).Encode(rr)
+}
+
+func (s *Server) handleCreateRevision(w http.ResponseWriter, r *http.Request) error {
+	var op errors.Op = "reqHandlers.handleCreateRevision"
+
+	ID, err := idParam(r)
+	if err != nil {
+		return errors.E(op, err)
+	}
+
+	body := struct {
+		EffectiveFrom string             `json:"effective_from"`
+		Articles      []*product.Article `json:"articles"`
+	}{}
+	if err := decodeJSON(r, &body); err != nil {
+		return errors.E(op, err)
+	}
+
+	var effectiveFrom time.Time
+	if body.EffectiveFrom != "" {
+		if effectiveFrom, err = time.Parse(time.RFC3339, body.EffectiveFrom); err != nil {
+			return errors.E(op, errors.Invalid, "effective_from must be an RFC 3339 time", err)
+		}
+	}
+
+	rev, err := s.ProductService.Revise(r.Context(), product.ID(ID), effectiveFrom, body.Articles)
+	if err != nil {
+		return errors.E(op, err)
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	return json.NewEncoder(w).Encode(rev)
+}
+
+// productFilters parses the query parameters of get products requests.
+func productFilters(q url.Values) (*product.Filters, error) {
+	var op errors.Op = "reqHandlers.productFilters"
+
+	ff := &product.Filters{}
+	if q.Get("barcodes") != "" {
+		bb := []product.Barcode{}
+		for _, b := range strings.Split(q.Get("barcodes"), ",") {
+			if b != "" {
+				bb = append(bb, product.Barcode(b))
+			}
+		}
+		ff.BB = &bb
+	}
+
+	if v := q.Get("in_stock"); v != "" {
+		inStock, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, errors.E(op, errors.Invalid, "in_stock must be a boolean", err)
+		}
+		ff.InStock = inStock
+	}
+
+	if v := q.Get("status"); v != "" {
+		for _, st := range strings.Split(v, ",") {
+			status, err := product.ParseStatus(st)
+			if err != nil {
+				return nil, errors.E(op, err)
+			}
+			ff.Statuses = append(ff.Statuses, status)
+		}
+	}
+
+	if v := q.Get("sort"); v != "" {
+		sort, err := product.ParseSort(v)
+		if err != nil {
+			return nil, errors.E(op, err)
+		}
+		ff.Sort = sort
+	}
+
+	for _, p := range []struct {
+		name string
+		val  *int
+	}{{"limit", &ff.Limit}, {"offset", &ff.Offset}} {
+		v := q.Get(p.name)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return nil, errors.E(op, errors.Invalid, fmt.Sprintf("%s must be a non-negative integer", p.name))
+		}
+		*p.val = n
+	}
+
+	return ff, nil
+}
@@ -4,6 +4,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/mtekmir/warehouse-service/internal/product"
 	"github.com/mtekmir/warehouse-service/internal/server"
@@ -39,3 +40,102 @@ func TestImportProducts(t *testing.T) {
 	}}}
 	test.Compare(t, "importCallArgs", expectedB, pSvc.Calls["Import"][0])
 }
+
+func TestGetProducts(t *testing.T) {
+	pSvc := test.NewMockProductService()
+	srv := server.Server{ProductService: pSvc, Log: logrus.New()}
+
+	ts := httptest.NewServer(http.HandlerFunc(srv.Router))
+	defer ts.Close()
+
+	res := testRequest(t, ts, "GET", "/products?barcodes=1,2&in_stock=true&sort=-available_quantity&limit=10&offset=20", nil, []reqHeader{})
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("Expected OK got %s", res.Status)
+	}
+
+	expectedFF := &product.Filters{
+		BB:      &[]product.Barcode{"1", "2"},
+		InStock: true,
+		Sort:    &product.Sort{Field: product.SortByAvailability, Desc: true},
+		Limit:   10,
+		Offset:  20,
+	}
+	test.Compare(t, "filters", expectedFF, pSvc.Calls["FindAll"][0])
+
+	res = testRequest(t, ts, "GET", "/products?status=active,archived", nil, []reqHeader{})
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("Expected OK got %s", res.Status)
+	}
+	test.Compare(t, "filters", &product.Filters{Statuses: []product.Status{product.StatusActive, product.StatusArchived}}, pSvc.Calls["FindAll"][0])
+
+	res = testRequest(t, ts, "GET", "/products?status=deleted", nil, []reqHeader{})
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected Bad Request got %s", res.Status)
+	}
+	checkErr(t, res, "Unknown product status deleted")
+
+	res = testRequest(t, ts, "GET", "/products?sort=price", nil, []reqHeader{})
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected Bad Request got %s", res.Status)
+	}
+	checkErr(t, res, "Unable to sort by price")
+}
+
+func TestTransitionProduct(t *testing.T) {
+	pSvc := test.NewMockProductService()
+	srv := server.Server{ProductService: pSvc, Log: logrus.New()}
+
+	ts := httptest.NewServer(http.HandlerFunc(srv.Router))
+	defer ts.Close()
+
+	cases := []struct {
+		method   string
+		path     string
+		expected product.Status
+	}{
+		{"POST", "/products/3/activate", product.StatusActive},
+		{"POST", "/products/3/discontinue", product.StatusDiscontinued},
+		{"POST", "/products/3/archive", product.StatusArchived},
+		{"POST", "/products/3/restore", product.StatusDraft},
+		{"DELETE", "/products/3", product.StatusArchived},
+	}
+	for _, c := range cases {
+		res := testRequest(t, ts, c.method, c.path, nil, []reqHeader{})
+		if res.StatusCode != http.StatusOK {
+			t.Errorf("%s %s: Expected OK got %s", c.method, c.path, res.Status)
+		}
+		test.Compare(t, "transitionCallArgs", []interface{}{product.ID(3), c.expected}, pSvc.Calls["Transition"])
+	}
+}
+
+func TestRevisions(t *testing.T) {
+	pSvc := test.NewMockProductService()
+	srv := server.Server{ProductService: pSvc, Log: logrus.New()}
+
+	ts := httptest.NewServer(http.HandlerFunc(srv.Router))
+	defer ts.Close()
+
+	res := testRequest(t, ts, "GET", "/products/3/bom/revisions", nil, []reqHeader{})
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("Expected OK got %s", res.Status)
+	}
+	test.Compare(t, "revisionsCallArgs", []interface{}{product.ID(3)}, pSvc.Calls["Revisions"])
+
+	body := `{"effective_from": "2021-03-04T10:00:00+01:00", "articles": [{"art_id": "1", "amount_of": "2"}]}`
+	res = testRequest(t, ts, "POST", "/products/3/bom/revisions", body, []reqHeader{})
+	if res.StatusCode != http.StatusCreated {
+		t.Errorf("Expected Created got %s", res.Status)
+	}
+	from := time.Date(2021, 3, 4, 9, 0, 0, 0, time.UTC)
+	args := pSvc.Calls["Revise"]
+	if !args[1].(time.Time).Equal(from) {
+		t.Errorf("Expected the revision to take effect at %s. Got %s", from, args[1])
+	}
+	test.Compare(t, "reviseArticles", []*product.Article{{ArtID: "1", Amount: 2}}, args[2])
+
+	res = testRequest(t, ts, "POST", "/products/3/bom/revisions", `{"effective_from": "tomorrow", "articles": []}`, []reqHeader{})
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected Bad Request got %s", res.Status)
+	}
+	checkErr(t, res, "effective_from must be an RFC 3339 time")
+}
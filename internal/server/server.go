@@ -2,14 +2,28 @@ package server
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"regexp"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/mtekmir/warehouse-service/internal/article"
+	"github.com/mtekmir/warehouse-service/internal/audit"
+	"github.com/mtekmir/warehouse-service/internal/auth"
+	"github.com/mtekmir/warehouse-service/internal/errors"
+	"github.com/mtekmir/warehouse-service/internal/health"
+	"github.com/mtekmir/warehouse-service/internal/logs"
+	"github.com/mtekmir/warehouse-service/internal/metrics"
+	"github.com/mtekmir/warehouse-service/internal/outbox"
 	"github.com/mtekmir/warehouse-service/internal/product"
+	"github.com/mtekmir/warehouse-service/internal/ratelimit"
+	"github.com/mtekmir/warehouse-service/internal/stream"
+	"github.com/mtekmir/warehouse-service/internal/tracing"
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type productService interface {
@@ -17,77 +31,267 @@ type productService interface {
 	Remove(ctx context.Context, ID product.ID, qty int) (*product.StockInfo, error)
 	Find(ctx context.Context, ID product.ID) (*product.StockInfo, error)
 	FindAll(ctx context.Context, ff *product.Filters) ([]*product.StockInfo, error)
+	Transition(ctx context.Context, ID product.ID, to product.Status) (*product.StockInfo, error)
+	Revisions(ctx context.Context, ID product.ID) ([]*product.Revision, error)
+	Revise(ctx context.Context, ID product.ID, effectiveFrom time.Time, arts []*product.Article) (*product.Revision, error)
 }
 
 type articleService interface {
 	Import(ctx context.Context, rows []*article.Article) ([]*article.Article, error)
 	FindAll(ctx context.Context) ([]*article.Article, error)
+	ExpiringLots(ctx context.Context, days int) ([]*article.Lot, error)
+}
+
+type authService interface {
+	Authenticate(ctx context.Context, token string) (*auth.Key, error)
+	AuthenticateTicket(ctx context.Context, ticket string) (*auth.Key, error)
+	IssueTicket(ctx context.Context, k *auth.Key) (string, time.Time, error)
+	Create(ctx context.Context, name string, scopes []auth.Scope) (*auth.Key, string, error)
+	Rotate(ctx context.Context, ID auth.KeyID) (*auth.Key, string, error)
+	Revoke(ctx context.Context, ID auth.KeyID) (*auth.Key, error)
+	FindAll(ctx context.Context) ([]*auth.Key, error)
+}
+
+type auditService interface {
+	Record(ctx context.Context, e *audit.Event) error
+	FindAll(ctx context.Context, ff *audit.Filters) ([]*audit.Event, error)
+}
+
+type healthChecker interface {
+	Ready(ctx context.Context) *health.Readiness
+	Status(ctx context.Context) *health.Status
+}
+
+type limiter interface {
+	Allow(route, client string) ratelimit.Result
+}
+
+type streamHub interface {
+	Subscribe(f *stream.Filter, after outbox.EventID) (*stream.Subscription, error)
 }
 
 // Server is an abstraction that holds the dependencies for the http server
-// and handles routing.
+// and handles routing. Requests aren't rate limited per client and route if
+// RateLimiter is nil, nor per ip before authentication if IPRateLimiter is nil, and
+// aren't audited if AuditService is nil. The event stream is disabled if Stream is
+// nil. Browsers may only send requests from the origins of CORSOrigins, or from any
+// origin if it includes "*".
 type Server struct {
 	ProductService productService
 	ArticleService articleService
+	AuthService    authService
+	AuditService   auditService
+	Health         healthChecker
+	RateLimiter    limiter
+	IPRateLimiter  limiter
+	Stream         streamHub
+	CORSOrigins    []string
 	Log            *logrus.Logger
+
+	mu       sync.Mutex
+	srv      *http.Server
+	closingC chan struct{} // Closed when shutting down, ends the streams.
 }
 
-var productPath = regexp.MustCompile(`/products/([0-9]+)`)
-var removeProductsPath = regexp.MustCompile("/products/remove/([0-9]+)")
+// route describes an endpoint of the api. Paths are OpenAPI path templates, parameters
+// in braces match numeric ids. Routes without a scope are public. Requests of the routes
+// with an action are recorded in the audit log, the action is prefixed with the kind of
+// the rows that the id parameter refers to. Routes with tickets also accept the tickets
+// of api keys in place of the keys.
+type route struct {
+	method  string
+	path    string
+	scope   auth.Scope
+	action  string
+	tickets bool
+	handle  func(*Server, http.ResponseWriter, *http.Request) error
 
-const (
-	importProductsPath = "/products/import"
-	getProductsPath    = "/products"
+	re *regexp.Regexp
+}
 
-	importArticlesPath = "/articles/import"
-	getArticlesPath    = "/articles"
-)
+var routes = compileRoutes([]*route{
+	{method: http.MethodGet, path: "/products", scope: auth.ScopeProductsRead, handle: (*Server).handleGetProducts},
+	{method: http.MethodGet, path: "/products/{id}", scope: auth.ScopeProductsRead, handle: (*Server).handleGetProduct},
+	{method: http.MethodPost, path: "/products/remove/{id}", scope: auth.ScopeProductsRemove, action: "product.remove", handle: (*Server).handleRemoveProduct},
+	{method: http.MethodPost, path: "/products/import", scope: auth.ScopeProductsWrite, action: "product.import", handle: (*Server).handleImportProducts},
+	{method: http.MethodPost, path: "/products/{id}/activate", scope: auth.ScopeProductsWrite, action: "product.activate", handle: transitionProduct(product.StatusActive)},
+	{method: http.MethodPost, path: "/products/{id}/discontinue", scope: auth.ScopeProductsWrite, action: "product.discontinue", handle: transitionProduct(product.StatusDiscontinued)},
+	{method: http.MethodPost, path: "/products/{id}/archive", scope: auth.ScopeProductsWrite, action: "product.archive", handle: transitionProduct(product.StatusArchived)},
+	{method: http.MethodPost, path: "/products/{id}/restore", scope: auth.ScopeProductsWrite, action: "product.restore", handle: transitionProduct(product.StatusDraft)},
+	{method: http.MethodDelete, path: "/products/{id}", scope: auth.ScopeProductsWrite, action: "product.archive", handle: transitionProduct(product.StatusArchived)},
+	{method: http.MethodGet, path: "/products/{id}/bom/revisions", scope: auth.ScopeProductsRead, handle: (*Server).handleGetRevisions},
+	{method: http.MethodPost, path: "/products/{id}/bom/revisions", scope: auth.ScopeProductsWrite, action: "product.revise", handle: (*Server).handleCreateRevision},
 
-// Router is a request multiplexer.
-func (s *Server) Router(w http.ResponseWriter, r *http.Request) {
-	switch {
+	{method: http.MethodPost, path: "/articles/import", scope: auth.ScopeArticlesWrite, action: "article.import", handle: (*Server).handleImportArticles},
+	{method: http.MethodGet, path: "/articles", scope: auth.ScopeArticlesRead, handle: (*Server).handleGetArticles},
+	{method: http.MethodGet, path: "/articles/lots/expiring", scope: auth.ScopeArticlesRead, handle: (*Server).handleGetExpiringLots},
 
-	case r.Method == http.MethodGet && r.URL.Path == getProductsPath:
-		handler(s.handleGetProducts).ServeHTTP(s.Log, w, r)
+	{method: http.MethodGet, path: "/admin/keys", scope: auth.ScopeAdmin, handle: (*Server).handleGetAPIKeys},
+	{method: http.MethodPost, path: "/admin/keys", scope: auth.ScopeAdmin, action: "key.create", handle: (*Server).handleCreateAPIKey},
+	{method: http.MethodPost, path: "/admin/keys/{id}/rotate", scope: auth.ScopeAdmin, action: "key.rotate", handle: (*Server).handleRotateAPIKey},
+	{method: http.MethodPost, path: "/admin/keys/{id}/revoke", scope: auth.ScopeAdmin, action: "key.revoke", handle: (*Server).handleRevokeAPIKey},
 
-	case r.Method == http.MethodGet && productPath.MatchString(r.URL.Path):
-		handler(s.handleGetProduct).ServeHTTP(s.Log, w, r)
+	{method: http.MethodGet, path: "/audit", scope: auth.ScopeAuditRead, handle: (*Server).handleGetAuditEvents},
 
-	case r.Method == http.MethodPost && removeProductsPath.MatchString(r.URL.Path):
-		handler(s.handleRemoveProduct).ServeHTTP(s.Log, w, r)
+	{method: http.MethodPost, path: "/events/tickets", scope: auth.ScopeProductsRead, handle: (*Server).handleCreateTicket},
+	{method: http.MethodGet, path: "/events/stream", scope: auth.ScopeProductsRead, tickets: true, handle: (*Server).handleEventStream},
 
-	case r.Method == http.MethodPost && r.URL.Path == importProductsPath:
-		handler(s.handleImportProducts).ServeHTTP(s.Log, w, r)
+	{method: http.MethodGet, path: "/openapi.json", handle: (*Server).handleGetOpenAPI},
+	{method: http.MethodGet, path: "/docs", handle: (*Server).handleGetDocs},
+})
 
-	case r.Method == http.MethodPost && r.URL.Path == importArticlesPath:
-		handler(s.handleImportArticles).ServeHTTP(s.Log, w, r)
+var pathParam = regexp.MustCompile(`\{([a-z_]+)\}`)
 
-	case r.Method == http.MethodGet && r.URL.Path == getArticlesPath:
-		handler(s.handleGetArticles).ServeHTTP(s.Log, w, r)
+func compileRoutes(rr []*route) []*route {
+	for _, rt := range rr {
+		parts := pathParam.Split(rt.path, -1)
+		pattern := regexp.QuoteMeta(parts[0])
+		for i, m := range pathParam.FindAllStringSubmatch(rt.path, -1) {
+			pattern += fmt.Sprintf("(?P<%s>[0-9]+)", m[1]) + regexp.QuoteMeta(parts[i+1])
+		}
+		rt.re = regexp.MustCompile("^" + pattern + "$")
+	}
+	return rr
+}
 
+// match returns the route of the request along with the path parameters.
+func match(r *http.Request) (*route, map[string]string) {
+	for _, rt := range routes {
+		if rt.method != r.Method {
+			continue
+		}
+		m := rt.re.FindStringSubmatch(r.URL.Path)
+		if m == nil {
+			continue
+		}
+		params := make(map[string]string, len(m)-1)
+		for i, name := range rt.re.SubexpNames() {
+			if name != "" {
+				params[name] = m[i]
+			}
+		}
+		return rt, params
 	}
+	return nil, nil
 }
 
-// Start starts the server. Server sets up the routes and starts listening.
+type ctxKey int
+
+const (
+	pathParamsKey ctxKey = iota
+	requestLogKey
+	bodyKey // The body of the request read by the middlewares.
+)
+
+// idParam returns the id path parameter of the request.
+func idParam(r *http.Request) (int, error) {
+	params, _ := r.Context().Value(pathParamsKey).(map[string]string)
+	return strconv.Atoi(params["id"])
+}
+
+// Router is a request multiplexer.
+func (s *Server) Router(w http.ResponseWriter, r *http.Request) {
+	rt, params := match(r)
+	if rt == nil {
+		handler(handleNotFound).ServeHTTP(s.Log, w, r)
+		return
+	}
+
+	r = r.WithContext(context.WithValue(r.Context(), pathParamsKey, params))
+	handler(func(w http.ResponseWriter, r *http.Request) error {
+		return rt.handle(s, w, r)
+	}).ServeHTTP(s.Log, w, r)
+}
+
+func handleNotFound(w http.ResponseWriter, r *http.Request) error {
+	var op errors.Op = "reqHandlers.handleNotFound"
+	return errors.E(op, errors.NotFound, "Route not found")
+}
+
+// Start starts the server. Server sets up the routes and starts listening. The
+// handlers registered on http.DefaultServeMux, such as the debug handlers of pprof and
+// expvar, aren't served.
 func (s *Server) Start(port string, wTimeout, rTimeout, idleTimeout time.Duration) error {
-	http.Handle("/", applyMiddlewares(http.HandlerFunc(s.Router), noPanicMiddleware(s.Log), corsMiddleware("*")))
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	mux.HandleFunc("/healthz", s.probe(s.handleHealthz))
+	mux.HandleFunc("/readyz", s.probe(s.handleReadyz))
+	mux.HandleFunc("/status", s.probe(s.handleStatus))
+	mux.Handle("/", applyMiddlewares(
+		http.HandlerFunc(s.Router),
+		tracingMiddleware(),
+		requestLogMiddleware(s.Log),
+		metricsMiddleware(),
+		noPanicMiddleware(s.Log),
+		corsMiddleware(s.CORSOrigins),
+		ipRateLimitMiddleware(s.Log, s.IPRateLimiter),
+		auditMiddleware(s.Log, s.AuditService),
+		authMiddleware(s.Log, s.AuthService),
+		rateLimitMiddleware(s.Log, s.RateLimiter),
+		validationMiddleware(s.Log, spec),
+	))
 
-	srv := http.Server{
+	srv := &http.Server{
 		Addr:         fmt.Sprintf(":%s", port),
+		Handler:      mux,
 		WriteTimeout: wTimeout,
 		ReadTimeout:  rTimeout,
 		IdleTimeout:  idleTimeout,
 	}
+	s.mu.Lock()
+	s.srv = srv
+	s.mu.Unlock()
+
+	if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// Shutdown stops accepting connections and waits for the in-flight requests until ctx
+// is done. Requests that are still running then are cancelled by closing their
+// connections. Event streams end right away, clients reconnect to other replicas.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	srv := s.srv
+	if s.closingC == nil {
+		s.closingC = make(chan struct{})
+	}
+	select {
+	case <-s.closingC:
+	default:
+		close(s.closingC)
+	}
+	s.mu.Unlock()
+	if srv == nil {
+		return nil
+	}
+
+	if err := srv.Shutdown(ctx); err != nil {
+		srv.Close()
+		return err
+	}
+	return nil
+}
 
-	return srv.ListenAndServe()
+// closing returns a channel that is closed when the server starts shutting down.
+func (s *Server) closing() <-chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closingC == nil {
+		s.closingC = make(chan struct{})
+	}
+	return s.closingC
 }
 
 // NewServer returns a new server instance with required dependencies.
-func NewServer(l *logrus.Logger, ps productService, as articleService) *Server {
+func NewServer(l *logrus.Logger, ps productService, as articleService, aus authService, hc healthChecker) *Server {
 	return &Server{
 		Log:            l,
 		ProductService: ps,
 		ArticleService: as,
+		AuthService:    aus,
+		Health:         hc,
 	}
 }
 
@@ -97,21 +301,57 @@ type handler func(w http.ResponseWriter, r *http.Request) error
 type Error interface {
 	Error() string
 	Code() int
-	Body() []byte
+	Response(requestID string) *errors.Response
 }
 
 func (h handler) ServeHTTP(l *logrus.Logger, w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	if err := h(w, r); err != nil {
-		e, ok := err.(Error)
-		if !ok {
-			l.Printf("An unexpected error occurred: %v\n", err)
-			w.WriteHeader(500)
-			w.Write([]byte(`{"message": "Something went wrong."}`))
-			return
-		}
-		l.Print(e.Error())
-		w.WriteHeader(e.Code())
-		w.Write(e.Body())
+		logError(l, r, err)
+		writeError(w, r, err)
+	}
+}
+
+// writeError writes the error response of err. Errors that don't describe themselves
+// are sent as internal errors without their messages.
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	var id string
+	if rl, ok := r.Context().Value(requestLogKey).(*requestLog); ok {
+		id = rl.id
+	}
+
+	code := http.StatusInternalServerError
+	res := &errors.Response{Code: errors.Other.Code(), Message: "Something went wrong.", RequestID: id}
+	var e Error
+	if errors.As(err, &e) {
+		code, res = e.Code(), e.Response(id)
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(res)
+}
+
+// decodeJSON decodes the body of the request into v. Decoding is traced since import
+// bodies can be large.
+func decodeJSON(r *http.Request, v interface{}) error {
+	_, span := tracing.Start(r.Context(), "server.decodeJSON")
+	defer span.End()
+	return json.NewDecoder(r.Body).Decode(v)
+}
+
+// logError records the error on the span and in the access log line of the request.
+// Requests that aren't access logged log the error on their own.
+func logError(l *logrus.Logger, r *http.Request, err error) {
+	trace.SpanFromContext(r.Context()).RecordError(err)
+	if rl, ok := r.Context().Value(requestLogKey).(*requestLog); ok {
+		rl.err = err
+		return
+	}
+	var e Error
+	if !errors.As(err, &e) {
+		logs.FromContext(r.Context(), l).Printf("An unexpected error occurred: %v\n", err)
+		return
 	}
+	logs.FromContext(r.Context(), l).Print(err.Error())
 }
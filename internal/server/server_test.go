@@ -0,0 +1,54 @@
+package server
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestShutdown(t *testing.T) {
+	started := make(chan struct{})
+	srv := &Server{Log: logrus.New()}
+	srv.srv = &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(100 * time.Millisecond)
+		w.Write([]byte("done"))
+	})}
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.srv.Serve(lis)
+
+	resC := make(chan string)
+	go func() {
+		res, err := http.Get("http://" + lis.Addr().String())
+		if err != nil {
+			resC <- err.Error()
+			return
+		}
+		defer res.Body.Close()
+		b, _ := ioutil.ReadAll(res.Body)
+		resC <- string(b)
+	}()
+
+	<-started
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		t.Fatalf("Expected in-flight request to finish within the grace period, got %v", err)
+	}
+	if body := <-resC; body != "done" {
+		t.Errorf("Expected in-flight request to complete, got %s", body)
+	}
+
+	if _, err := http.Get("http://" + lis.Addr().String()); err == nil {
+		t.Error("Expected new connections to be refused")
+	}
+}
@@ -0,0 +1,171 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/mtekmir/warehouse-service/internal/auth"
+	"github.com/mtekmir/warehouse-service/internal/errors"
+	"github.com/mtekmir/warehouse-service/internal/tracing"
+)
+
+type apiKeyRepo struct{}
+
+const apiKeyColumns = "id, name, prefix, key_hash, scopes, created_at, rotated_at, revoked_at"
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanAPIKey(row scanner) (*auth.Key, error) {
+	var k auth.Key
+	var scopes string
+	var rotatedAt, revokedAt sql.NullTime
+	if err := row.Scan(&k.ID, &k.Name, &k.Prefix, &k.Hash, &scopes, &k.CreatedAt, &rotatedAt, &revokedAt); err != nil {
+		return nil, err
+	}
+	k.Scopes = auth.SplitScopes(scopes)
+	if rotatedAt.Valid {
+		k.RotatedAt = &rotatedAt.Time
+	}
+	if revokedAt.Valid {
+		k.RevokedAt = &revokedAt.Time
+	}
+	return &k, nil
+}
+
+// Insert inserts an api key into db.
+func (apiKeyRepo) Insert(ctx context.Context, db auth.Executor, k *auth.Key) (_ *auth.Key, err error) {
+	var op errors.Op = "sqliteAPIKeyRepo.insert"
+	ctx, span := tracing.Start(ctx, string(op))
+	defer func() { tracing.End(span, err) }()
+
+	row := db.QueryRowContext(ctx, `
+		INSERT INTO api_keys (name, prefix, key_hash, scopes, created_at) VALUES (?, ?, ?, ?, ?)
+		RETURNING `+apiKeyColumns,
+		k.Name, k.Prefix, k.Hash, auth.JoinScopes(k.Scopes), time.Now().UTC(),
+	)
+
+	inserted, err := scanAPIKey(row)
+	if err != nil {
+		return nil, errors.E(op, err)
+	}
+
+	return inserted, nil
+}
+
+// FindByHash returns the api key with the hash. Returns nil if it doesn't exist.
+func (apiKeyRepo) FindByHash(ctx context.Context, db auth.Executor, hash string) (_ *auth.Key, err error) {
+	var op errors.Op = "sqliteAPIKeyRepo.findByHash"
+	ctx, span := tracing.Start(ctx, string(op))
+	defer func() { tracing.End(span, err) }()
+
+	k, err := scanAPIKey(db.QueryRowContext(ctx, "SELECT "+apiKeyColumns+" FROM api_keys WHERE key_hash = ?", hash))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.E(op, err)
+	}
+
+	return k, nil
+}
+
+// FindByID returns the api key with the id. Returns nil if it doesn't exist.
+func (apiKeyRepo) FindByID(ctx context.Context, db auth.Executor, ID auth.KeyID) (_ *auth.Key, err error) {
+	var op errors.Op = "sqliteAPIKeyRepo.findByID"
+	ctx, span := tracing.Start(ctx, string(op))
+	defer func() { tracing.End(span, err) }()
+
+	k, err := scanAPIKey(db.QueryRowContext(ctx, "SELECT "+apiKeyColumns+" FROM api_keys WHERE id = ?", ID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.E(op, err)
+	}
+
+	return k, nil
+}
+
+// FindAll returns all the api keys.
+func (apiKeyRepo) FindAll(ctx context.Context, db auth.Executor) (_ []*auth.Key, err error) {
+	var op errors.Op = "sqliteAPIKeyRepo.findAll"
+	ctx, span := tracing.Start(ctx, string(op))
+	defer func() { tracing.End(span, err) }()
+
+	rows, err := db.QueryContext(ctx, "SELECT "+apiKeyColumns+" FROM api_keys ORDER BY id")
+	if err != nil {
+		return nil, errors.E(op, err)
+	}
+	defer rows.Close()
+
+	kk := []*auth.Key{}
+	for rows.Next() {
+		k, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, errors.E(op, err)
+		}
+		kk = append(kk, k)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.E(op, err)
+	}
+
+	return kk, nil
+}
+
+// UpdateHash replaces the hash of a non-revoked api key. Returns nil if there's no such key.
+func (apiKeyRepo) UpdateHash(ctx context.Context, db auth.Executor, ID auth.KeyID, prefix, hash string, rotatedAt time.Time) (_ *auth.Key, err error) {
+	var op errors.Op = "sqliteAPIKeyRepo.updateHash"
+	ctx, span := tracing.Start(ctx, string(op))
+	defer func() { tracing.End(span, err) }()
+
+	row := db.QueryRowContext(ctx, `
+		UPDATE api_keys SET prefix = ?, key_hash = ?, rotated_at = ?
+		WHERE id = ? AND revoked_at IS NULL
+		RETURNING `+apiKeyColumns,
+		prefix, hash, rotatedAt.UTC(), ID,
+	)
+
+	k, err := scanAPIKey(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.E(op, err)
+	}
+
+	return k, nil
+}
+
+// Revoke revokes an api key. Revoking a revoked key keeps the original revocation time.
+// Returns nil if there's no such key.
+func (apiKeyRepo) Revoke(ctx context.Context, db auth.Executor, ID auth.KeyID, revokedAt time.Time) (_ *auth.Key, err error) {
+	var op errors.Op = "sqliteAPIKeyRepo.revoke"
+	ctx, span := tracing.Start(ctx, string(op))
+	defer func() { tracing.End(span, err) }()
+
+	row := db.QueryRowContext(ctx, `
+		UPDATE api_keys SET revoked_at = COALESCE(revoked_at, ?)
+		WHERE id = ?
+		RETURNING `+apiKeyColumns,
+		revokedAt.UTC(), ID,
+	)
+
+	k, err := scanAPIKey(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.E(op, err)
+	}
+
+	return k, nil
+}
+
+// NewAPIKeyRepo returns a sqlite repo for api keys.
+func NewAPIKeyRepo() auth.Repo {
+	return apiKeyRepo{}
+}
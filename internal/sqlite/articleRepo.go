@@ -0,0 +1,311 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mtekmir/warehouse-service/internal/article"
+	"github.com/mtekmir/warehouse-service/internal/errors"
+	"github.com/mtekmir/warehouse-service/internal/tracing"
+)
+
+type articleRepo struct{}
+
+// Import imports articles. Stocks of duplicate articles are summed up, new articles are
+// created and stocks of existing ones are increased. Returns the articles in the order
+// they first appear in aa.
+func (r articleRepo) Import(ctx context.Context, db article.Executor, aa []*article.Article) (_ []*article.Article, err error) {
+	var op errors.Op = "sqliteArticleRepo.import"
+	ctx, span := tracing.Start(ctx, string(op))
+	defer func() { tracing.End(span, err) }()
+
+	order := make([]article.ArtID, 0, len(aa))
+	rows := make(map[article.ArtID]*article.Article, len(aa))
+	for _, a := range aa {
+		if row, ok := rows[a.ArtID]; ok {
+			row.Stock += a.Stock
+			continue
+		}
+		order = append(order, a.ArtID)
+		rows[a.ArtID] = &article.Article{ArtID: a.ArtID, Name: a.Name, Stock: a.Stock}
+	}
+
+	existing, err := r.FindAll(ctx, db, &order)
+	if err != nil {
+		return nil, errors.E(op, err)
+	}
+	existingM := make(map[article.ArtID]*article.Article, len(existing))
+	for _, a := range existing {
+		existingM[a.ArtID] = a
+	}
+
+	toCreate := make([]*article.Article, 0, len(order)-len(existing))
+	adjustments := make([]*article.QtyAdjustment, 0, len(existing))
+	for _, artID := range order {
+		if a, ok := existingM[artID]; ok {
+			adjustments = append(adjustments, &article.QtyAdjustment{ID: a.ID, Qty: rows[artID].Stock})
+			a.Stock += rows[artID].Stock
+			continue
+		}
+		toCreate = append(toCreate, rows[artID])
+	}
+
+	if len(toCreate) > 0 {
+		created, err := r.BatchInsert(ctx, db, toCreate)
+		if err != nil {
+			return nil, errors.E(op, err)
+		}
+		for _, a := range created {
+			existingM[a.ArtID] = a
+		}
+	}
+	if len(adjustments) > 0 {
+		if err := r.AdjustQuantities(ctx, db, article.QtyAdjustmentAdd, adjustments); err != nil {
+			return nil, errors.E(op, err)
+		}
+	}
+
+	res := make([]*article.Article, 0, len(order))
+	for _, artID := range order {
+		res = append(res, existingM[artID])
+	}
+	return res, nil
+}
+
+// BatchInsert inserts an article slice into db. Does not handle duplicates.
+func (articleRepo) BatchInsert(ctx context.Context, db article.Executor, arts []*article.Article) (_ []*article.Article, err error) {
+	var op errors.Op = "sqliteArticleRepo.batchInsert"
+	ctx, span := tracing.Start(ctx, string(op))
+	defer func() { tracing.End(span, err) }()
+
+	values := make([]interface{}, 0, len(arts)*3)
+	pHolders := make([]string, 0, len(arts))
+	for _, a := range arts {
+		pHolders = append(pHolders, "(?, ?, ?)")
+		values = append(values, a.ArtID, a.Name, a.Stock)
+	}
+
+	stmt := "INSERT INTO articles (art_id, name, stock) VALUES " + strings.Join(pHolders, ", ") + " RETURNING id, art_id, name, stock"
+	rows, err := db.QueryContext(ctx, stmt, values...)
+	if err != nil {
+		return nil, errors.E(op, err)
+	}
+	defer rows.Close()
+
+	inserted := make([]*article.Article, 0, len(arts))
+	for rows.Next() {
+		var a article.Article
+		if err := rows.Scan(&a.ID, &a.ArtID, &a.Name, &a.Stock); err != nil {
+			return nil, errors.E(op, err)
+		}
+		inserted = append(inserted, &a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.E(op, err)
+	}
+
+	// SQLite doesn't guarantee the order of returned rows, ids follow the insert order.
+	sort.Slice(inserted, func(i, j int) bool { return inserted[i].ID < inserted[j].ID })
+	return inserted, nil
+}
+
+// AdjustQuantities is for updating quantities of articles.
+func (articleRepo) AdjustQuantities(ctx context.Context, db article.Executor, t article.QtyAdjustmentKind, changes []*article.QtyAdjustment) (err error) {
+	var op errors.Op = "sqliteArticleRepo.adjustQuantities"
+	ctx, span := tracing.Start(ctx, string(op))
+	defer func() { tracing.End(span, err) }()
+
+	pHolders := make([]string, 0, len(changes))
+	values := make([]interface{}, 0, len(changes)*2)
+	for _, c := range changes {
+		pHolders = append(pHolders, "(?, ?)")
+		values = append(values, c.ID, c.Qty)
+	}
+
+	adjustment := "v.q"
+	switch t {
+	case article.QtyAdjustmentAdd:
+		adjustment = "stock + v.q"
+	case article.QtyAdjustmentSubtract:
+		adjustment = "stock - v.q"
+	}
+
+	stmt := `
+		WITH v(id, q) AS (VALUES ` + strings.Join(pHolders, ", ") + `)
+		UPDATE articles SET stock = ` + adjustment + `
+		FROM v
+		WHERE articles.id = v.id
+	`
+	res, err := db.ExecContext(ctx, stmt, values...)
+	if err != nil {
+		return errors.E(op, err)
+	}
+	count, err := res.RowsAffected()
+	if err != nil {
+		return errors.E(op, err)
+	}
+	if int(count) != len(changes) {
+		return errors.E(op, "Updated rows don't match with articles length")
+	}
+	return nil
+}
+
+// FindAll returns the articles with the art ids, or all articles if bb is nil, ordered
+// by art id.
+func (articleRepo) FindAll(ctx context.Context, db article.Executor, bb *[]article.ArtID) (_ []*article.Article, err error) {
+	var op errors.Op = "sqliteArticleRepo.findAll"
+	ctx, span := tracing.Start(ctx, string(op))
+	defer func() { tracing.End(span, err) }()
+
+	var where string
+	var values []interface{}
+	if bb != nil {
+		pHolders := make([]string, 0, len(*bb))
+		for _, artID := range *bb {
+			pHolders = append(pHolders, "?")
+			values = append(values, artID)
+		}
+		where = "WHERE art_id IN (" + strings.Join(pHolders, ", ") + ")"
+	}
+
+	rows, err := db.QueryContext(ctx, "SELECT id, name, art_id, stock FROM articles "+where+" ORDER BY art_id", values...)
+	if err != nil {
+		return nil, errors.E(op, err)
+	}
+	defer rows.Close()
+
+	arts := []*article.Article{}
+	for rows.Next() {
+		var a article.Article
+		if err := rows.Scan(&a.ID, &a.Name, &a.ArtID, &a.Stock); err != nil {
+			return nil, errors.E(op, err)
+		}
+		arts = append(arts, &a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.E(op, err)
+	}
+
+	return arts, nil
+}
+
+// InsertLots adds the quantities of the lots to the existing lots with the same numbers
+// or inserts them.
+func (articleRepo) InsertLots(ctx context.Context, db article.Executor, lots []*article.Lot) (err error) {
+	var op errors.Op = "sqliteArticleRepo.insertLots"
+	ctx, span := tracing.Start(ctx, string(op))
+	defer func() { tracing.End(span, err) }()
+
+	pHolders := make([]string, 0, len(lots))
+	values := make([]interface{}, 0, len(lots)*5)
+	for _, l := range lots {
+		var expiresAt *time.Time
+		if l.ExpiresAt != nil {
+			e := l.ExpiresAt.UTC()
+			expiresAt = &e
+		}
+		pHolders = append(pHolders, "(?, ?, ?, ?, ?)")
+		values = append(values, l.ArticleID, l.Number, l.ReceivedAt.UTC(), expiresAt, l.Qty)
+	}
+
+	stmt := `
+		INSERT INTO lots (article_id, number, received_at, expires_at, qty) VALUES ` + strings.Join(pHolders, ", ") + `
+		ON CONFLICT (article_id, number) DO UPDATE SET qty = lots.qty + excluded.qty
+	`
+	if _, err := db.ExecContext(ctx, stmt, values...); err != nil {
+		return errors.E(op, err)
+	}
+	return nil
+}
+
+// ConsumeLots subtracts the quantities from the lots that aren't expired at the time,
+// first expired first out, and deletes the emptied lots. Every lot gives the part of the
+// quantity that the lots before it don't cover.
+func (articleRepo) ConsumeLots(ctx context.Context, db article.Executor, changes []*article.QtyAdjustment, at time.Time) (err error) {
+	var op errors.Op = "sqliteArticleRepo.consumeLots"
+	ctx, span := tracing.Start(ctx, string(op))
+	defer func() { tracing.End(span, err) }()
+
+	pHolders := make([]string, 0, len(changes))
+	values := make([]interface{}, 0, len(changes)*2+1)
+	for _, c := range changes {
+		pHolders = append(pHolders, "(?, ?)")
+		values = append(values, c.ID, c.Qty)
+	}
+	values = append(values, at.UTC())
+
+	stmt := `
+		WITH c(article_id, q) AS (VALUES ` + strings.Join(pHolders, ", ") + `),
+		l AS (
+			SELECT l.id, c.q, SUM(l.qty) OVER (
+				PARTITION BY l.article_id ORDER BY l.expires_at NULLS LAST, l.received_at, l.id
+			) - l.qty AS ahead
+			FROM lots l
+			JOIN c ON c.article_id = l.article_id
+			WHERE l.expires_at IS NULL OR l.expires_at > ?
+		)
+		UPDATE lots SET qty = lots.qty - min(lots.qty, l.q - l.ahead)
+		FROM l
+		WHERE lots.id = l.id AND l.ahead < l.q
+	`
+	if _, err := db.ExecContext(ctx, stmt, values...); err != nil {
+		return errors.E(op, err)
+	}
+
+	IDs := make([]interface{}, 0, len(changes))
+	pHolders = make([]string, 0, len(changes))
+	for _, c := range changes {
+		pHolders = append(pHolders, "?")
+		IDs = append(IDs, c.ID)
+	}
+	stmt = "DELETE FROM lots WHERE article_id IN (" + strings.Join(pHolders, ", ") + ") AND qty <= 0"
+	if _, err := db.ExecContext(ctx, stmt, IDs...); err != nil {
+		return errors.E(op, err)
+	}
+	return nil
+}
+
+// FindLots returns the lots expiring at or before the time, soonest first.
+func (articleRepo) FindLots(ctx context.Context, db article.Executor, before time.Time) (_ []*article.Lot, err error) {
+	var op errors.Op = "sqliteArticleRepo.findLots"
+	ctx, span := tracing.Start(ctx, string(op))
+	defer func() { tracing.End(span, err) }()
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT l.id, l.article_id, a.art_id, l.number, l.received_at, l.expires_at, l.qty
+		FROM lots l
+		JOIN articles a ON a.id = l.article_id
+		WHERE l.expires_at <= ?
+		ORDER BY l.expires_at, a.art_id, l.number
+	`, before.UTC())
+	if err != nil {
+		return nil, errors.E(op, err)
+	}
+	defer rows.Close()
+
+	lots := []*article.Lot{}
+	for rows.Next() {
+		var l article.Lot
+		var expiresAt sql.NullTime
+		if err := rows.Scan(&l.ID, &l.ArticleID, &l.ArtID, &l.Number, &l.ReceivedAt, &expiresAt, &l.Qty); err != nil {
+			return nil, errors.E(op, err)
+		}
+		if expiresAt.Valid {
+			l.ExpiresAt = &expiresAt.Time
+		}
+		lots = append(lots, &l)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.E(op, err)
+	}
+
+	return lots, nil
+}
+
+// NewArticleRepo returns a sqlite repo for articles.
+func NewArticleRepo() article.Repo {
+	return articleRepo{}
+}
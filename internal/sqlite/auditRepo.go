@@ -0,0 +1,112 @@
+package sqlite
+
+import (
+	"context"
+	"strings"
+
+	"github.com/mtekmir/warehouse-service/internal/audit"
+	"github.com/mtekmir/warehouse-service/internal/errors"
+	"github.com/mtekmir/warehouse-service/internal/tracing"
+)
+
+type auditRepo struct{}
+
+const auditEventColumns = "id, actor, action, targets, payload_digest, result, request_id, created_at"
+
+func scanAuditEvent(row scanner) (*audit.Event, error) {
+	var e audit.Event
+	var targets string
+	if err := row.Scan(&e.ID, &e.Actor, &e.Action, &targets, &e.PayloadDigest, &e.Result, &e.RequestID, &e.CreatedAt); err != nil {
+		return nil, err
+	}
+	e.Targets = audit.SplitTargets(targets)
+	return &e, nil
+}
+
+// Insert inserts an audit event into db.
+func (auditRepo) Insert(ctx context.Context, db audit.Executor, e *audit.Event) (_ *audit.Event, err error) {
+	var op errors.Op = "sqliteAuditRepo.insert"
+	ctx, span := tracing.Start(ctx, string(op))
+	defer func() { tracing.End(span, err) }()
+
+	row := db.QueryRowContext(ctx, `
+		INSERT INTO audit_events (actor, action, targets, payload_digest, result, request_id, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		RETURNING `+auditEventColumns,
+		e.Actor, e.Action, audit.JoinTargets(e.Targets), e.PayloadDigest, e.Result, e.RequestID, e.CreatedAt.UTC(),
+	)
+
+	inserted, err := scanAuditEvent(row)
+	if err != nil {
+		return nil, errors.E(op, err)
+	}
+
+	return inserted, nil
+}
+
+// FindAll returns the audit events matching the filters, newest first.
+func (auditRepo) FindAll(ctx context.Context, db audit.Executor, ff *audit.Filters) (_ []*audit.Event, err error) {
+	var op errors.Op = "sqliteAuditRepo.findAll"
+	ctx, span := tracing.Start(ctx, string(op))
+	defer func() { tracing.End(span, err) }()
+
+	where, values := []string{}, []interface{}{}
+	if ff.Actor != "" {
+		where = append(where, "actor = ?")
+		values = append(values, ff.Actor)
+	}
+	if ff.Action != "" {
+		where = append(where, "action = ?")
+		values = append(values, ff.Action)
+	}
+	if ff.Target != "" {
+		where = append(where, "instr(' ' || targets || ' ', ' ' || ? || ' ') > 0")
+		values = append(values, ff.Target)
+	}
+	if ff.From != nil {
+		where = append(where, "created_at >= ?")
+		values = append(values, ff.From.UTC())
+	}
+	if ff.To != nil {
+		where = append(where, "created_at < ?")
+		values = append(values, ff.To.UTC())
+	}
+
+	query := `SELECT ` + auditEventColumns + ` FROM audit_events`
+	if len(where) > 0 {
+		query += ` WHERE ` + strings.Join(where, " AND ")
+	}
+	query += ` ORDER BY created_at DESC, id DESC`
+
+	// SQLite requires a limit for an offset, -1 means no limit.
+	if ff.Limit > 0 || ff.Offset > 0 {
+		limit := ff.Limit
+		if limit <= 0 {
+			limit = -1
+		}
+		query += ` LIMIT ? OFFSET ?`
+		values = append(values, limit, ff.Offset)
+	}
+
+	rows, err := db.QueryContext(ctx, query, values...)
+	if err != nil {
+		return nil, errors.E(op, err)
+	}
+	defer rows.Close()
+
+	ee := []*audit.Event{}
+	for rows.Next() {
+		e, err := scanAuditEvent(rows)
+		if err != nil {
+			return nil, errors.E(op, err)
+		}
+		ee = append(ee, e)
+	}
+
+	return ee, nil
+}
+
+// NewAuditRepo returns a sqlite repo for audit events.
+func NewAuditRepo() audit.Repo {
+	return auditRepo{}
+}
@@ -0,0 +1,26 @@
+package sqlite_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/mtekmir/warehouse-service/internal/sqlite"
+	"github.com/mtekmir/warehouse-service/test/repotest"
+	"github.com/sirupsen/logrus"
+)
+
+func TestConformance(t *testing.T) {
+	repotest.Run(t, func(t *testing.T) *repotest.Backend {
+		db, dbTidy, err := sqlite.Setup(logrus.New(), "sqlite://"+filepath.Join(t.TempDir(), "warehouse.db"))
+		if err != nil {
+			t.Fatalf("Unable to set up db. %v", err)
+		}
+		t.Cleanup(dbTidy)
+
+		return &repotest.Backend{
+			DB: db, Articles: sqlite.NewArticleRepo(), Products: sqlite.NewProductRepo(), Audit: sqlite.NewAuditRepo(), Outbox: sqlite.NewOutboxRepo(),
+			Inventory: func(ctx context.Context) (int, int, error) { return sqlite.InventoryStats(ctx, db) },
+		}
+	})
+}
@@ -0,0 +1,44 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/mtekmir/warehouse-service/internal/errors"
+	"github.com/mtekmir/warehouse-service/internal/tracing"
+)
+
+// InventoryStats returns the number of products that can't be built with the current
+// stock and the total units of articles in stock. Archived products aren't counted and
+// products are built with the revisions of their bills of materials in effect, without
+// the units of expired lots.
+func InventoryStats(ctx context.Context, db *sql.DB) (outOfStock, units int, err error) {
+	var op errors.Op = "sqlite.inventoryStats"
+	ctx, span := tracing.Start(ctx, string(op))
+	defer func() { tracing.End(span, err) }()
+
+	now := time.Now().UTC()
+	q := `
+		SELECT
+			(SELECT COUNT(*) FROM (
+				SELECT pa.product_id
+				FROM product_articles AS pa
+				JOIN articles AS a ON a.id = pa.article_id
+				JOIN products AS p ON p.id = pa.product_id
+				LEFT JOIN (
+					SELECT article_id, SUM(qty) AS qty FROM lots WHERE expires_at <= ? GROUP BY article_id
+				) AS e ON e.article_id = a.id
+				WHERE p.status <> 'archived'
+				AND pa.effective_from <= ? AND (pa.effective_to IS NULL OR pa.effective_to > ?)
+				GROUP BY pa.product_id
+				HAVING MIN((a.stock - COALESCE(e.qty, 0)) / pa.amount) <= 0
+			)),
+			(SELECT COALESCE(SUM(stock), 0) FROM articles)
+	`
+	if err := db.QueryRowContext(ctx, q, now, now, now).Scan(&outOfStock, &units); err != nil {
+		return 0, 0, errors.E(op, err)
+	}
+
+	return outOfStock, units, nil
+}
@@ -0,0 +1,255 @@
+package sqlite
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+//go:embed migrations/*.sql
+var embedded embed.FS
+
+type migration struct {
+	version     int
+	description string
+	filename    string
+	script      string
+	checksum    string // Hex encoded sha256 of the script.
+}
+
+var migrationFile = regexp.MustCompile(`^V([0-9]{3})__([a-zA-Z_]*)\.sql$`)
+
+// Migrate runs the embedded migrations that aren't applied yet. Each migration runs in
+// a transaction that holds the write lock, so instances starting at the same time
+// don't apply a migration twice. Fails if an applied migration was edited.
+func Migrate(log *logrus.Logger, db *sql.DB) error {
+	mm, err := parseMigrations()
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`
+		create table if not exists schema_version(
+			id integer primary key autoincrement,
+			version integer not null,
+			description text not null,
+			filename text not null,
+			applied_on timestamp,
+			checksum text
+		)
+	`)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range mm {
+		if err := executeMigration(log, db, m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// executeMigration applies the migration unless it's applied, in which case its
+// checksum is verified.
+func executeMigration(log *logrus.Logger, db *sql.DB, m migration) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var sum sql.NullString
+	err = tx.QueryRow("SELECT checksum FROM schema_version WHERE version = ?", m.version).Scan(&sum)
+	switch {
+	case err == nil:
+		if sum.Valid && sum.String != m.checksum {
+			return fmt.Errorf("migration %s was edited after it was applied, checksum %s doesn't match the applied %s", m.filename, m.checksum, sum.String)
+		}
+		return nil
+	case err != sql.ErrNoRows:
+		return err
+	}
+
+	log.Println("Executing migration", m.filename)
+	if _, err := tx.Exec(m.script); err != nil {
+		return fmt.Errorf("migration %s failed: %w", m.filename, err)
+	}
+	_, err = tx.Exec(`
+		INSERT INTO schema_version (version, description, filename, applied_on, checksum)
+		VALUES (?, ?, ?, ?, ?)
+	`, m.version, m.description, m.filename, time.Now().UTC(), m.checksum)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// SchemaVersion returns the version of the last applied migration.
+func SchemaVersion(ctx context.Context, db *sql.DB) (int, error) {
+	var version int
+	err := db.QueryRowContext(ctx, "SELECT version FROM schema_version ORDER BY id DESC LIMIT 1").Scan(&version)
+	if err != nil && err != sql.ErrNoRows {
+		return 0, err
+	}
+	return version, nil
+}
+
+// LatestVersion returns the version of the latest embedded migration.
+func LatestVersion() (int, error) {
+	mm, err := parseMigrations()
+	if err != nil {
+		return 0, err
+	}
+	if len(mm) == 0 {
+		return 0, nil
+	}
+	return mm[len(mm)-1].version, nil
+}
+
+// MigrationState is the state of a migration in the db.
+type MigrationState struct {
+	Version     int
+	Description string
+	Filename    string
+	Applied     bool
+	AppliedOn   *time.Time
+	Edited      bool // The script changed after it was applied.
+	Unknown     bool // The migration is applied but it isn't embedded.
+}
+
+// MigrationStatus returns the states of the embedded migrations and of the applied
+// migrations that aren't embedded, sorted by version. It doesn't modify the db.
+func MigrationStatus(ctx context.Context, db *sql.DB) ([]*MigrationState, error) {
+	mm, err := parseMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	states := make(map[int]*MigrationState, len(mm))
+	sums := make(map[int]string, len(mm))
+	for _, m := range mm {
+		states[m.version] = &MigrationState{Version: m.version, Description: m.description, Filename: m.filename}
+		sums[m.version] = m.checksum
+	}
+
+	var exists bool
+	err = db.QueryRowContext(ctx, "SELECT COUNT(*) > 0 FROM sqlite_master WHERE type = 'table' AND name = 'schema_version'").Scan(&exists)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		rows, err := db.QueryContext(ctx, "SELECT version, description, filename, applied_on, checksum FROM schema_version ORDER BY version")
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var a MigrationState
+			var appliedOn sql.NullTime
+			var sum sql.NullString
+			if err := rows.Scan(&a.Version, &a.Description, &a.Filename, &appliedOn, &sum); err != nil {
+				return nil, err
+			}
+
+			st, ok := states[a.Version]
+			if !ok {
+				st = &MigrationState{Version: a.Version, Description: a.Description, Filename: a.Filename, Unknown: true}
+				states[a.Version] = st
+			}
+			st.Applied = true
+			if appliedOn.Valid {
+				st.AppliedOn = &appliedOn.Time
+			}
+			st.Edited = ok && sum.Valid && sum.String != sums[a.Version]
+		}
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	ss := make([]*MigrationState, 0, len(states))
+	for _, st := range states {
+		ss = append(ss, st)
+	}
+	sort.Slice(ss, func(i, j int) bool { return ss[i].Version < ss[j].Version })
+	return ss, nil
+}
+
+// NewMigration creates an empty V### file for the next migration in dir and returns its
+// path. SQLite migrations can't be reverted, so there's no U### file. Spaces and dashes
+// in the description are replaced by underscores.
+func NewMigration(dir, description string) (string, error) {
+	name := strings.NewReplacer(" ", "_", "-", "_").Replace(strings.TrimSpace(description))
+	if !regexp.MustCompile(`^[a-zA-Z_]+$`).MatchString(name) {
+		return "", fmt.Errorf("migration description must only contain letters, spaces, dashes and underscores, got %q", description)
+	}
+
+	ff, err := os.ReadDir(dir)
+	if err != nil {
+		return "", fmt.Errorf("unable to read the migrations in %s: %w", dir, err)
+	}
+	latest := 0
+	for _, f := range ff {
+		if parts := migrationFile.FindStringSubmatch(f.Name()); parts != nil {
+			if v, _ := strconv.Atoi(parts[1]); v > latest {
+				latest = v
+			}
+		}
+	}
+	if latest >= 999 {
+		return "", fmt.Errorf("migration versions are exhausted")
+	}
+
+	p := filepath.Join(dir, fmt.Sprintf("V%03d__%s.sql", latest+1, name))
+	f, err := os.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return "", err
+	}
+	f.Close()
+	return p, nil
+}
+
+// parseMigrations parses the embedded migrations, sorted by version.
+func parseMigrations() ([]migration, error) {
+	ff, err := fs.ReadDir(embedded, "migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	mm := make([]migration, 0, len(ff))
+	for _, f := range ff {
+		parts := migrationFile.FindStringSubmatch(f.Name())
+		if parts == nil {
+			return nil, fmt.Errorf("migration file names should match %s, got %s", migrationFile, f.Name())
+		}
+		version, _ := strconv.Atoi(parts[1])
+		script, err := fs.ReadFile(embedded, "migrations/"+f.Name())
+		if err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256(script)
+		mm = append(mm, migration{
+			version:     version,
+			description: strings.Join(strings.Split(parts[2], "_"), " "),
+			filename:    f.Name(),
+			script:      string(script),
+			checksum:    hex.EncodeToString(sum[:]),
+		})
+	}
+	// ReadDir sorts by file name, which sorts by version.
+	return mm, nil
+}
@@ -0,0 +1,44 @@
+package sqlite_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/mtekmir/warehouse-service/internal/sqlite"
+	"github.com/sirupsen/logrus"
+)
+
+func TestMigrate(t *testing.T) {
+	db, err := sqlite.Open("sqlite://" + filepath.Join(t.TempDir(), "warehouse.db"))
+	if err != nil {
+		t.Fatalf("Unable to open db. %v", err)
+	}
+	defer db.Close()
+
+	for i := 0; i < 2; i++ {
+		if err := sqlite.Migrate(logrus.New(), db); err != nil {
+			t.Fatalf("Unable to migrate, run %d. %v", i+1, err)
+		}
+	}
+
+	v, err := sqlite.SchemaVersion(context.Background(), db)
+	if err != nil {
+		t.Fatalf("Unable to get the schema version. %v", err)
+	}
+	latest, err := sqlite.LatestVersion()
+	if err != nil {
+		t.Fatalf("Unable to get the latest version. %v", err)
+	}
+	if v != latest || v != 12 {
+		t.Errorf("Expected schema version to be the latest version 12. Got %d, latest %d", v, latest)
+	}
+
+	var n int
+	if err := db.QueryRow("SELECT COUNT(*) FROM schema_version").Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n != 12 {
+		t.Errorf("Expected migrations to be applied once. Got %d rows", n)
+	}
+}
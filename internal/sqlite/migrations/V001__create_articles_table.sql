@@ -0,0 +1,6 @@
+create table if not exists articles(
+  id integer primary key autoincrement,
+  art_id text unique not null,
+  name text not null,
+  stock integer default 0
+)
@@ -0,0 +1,5 @@
+create table if not exists products(
+  id integer primary key autoincrement,
+  barcode text unique not null,
+  name text not null
+)
@@ -0,0 +1,6 @@
+create table if not exists product_articles(
+  id integer primary key autoincrement,
+  amount integer not null,
+  product_id integer not null references products(id),
+  article_id integer not null references articles(id)
+)
@@ -0,0 +1,10 @@
+create table if not exists api_keys(
+  id integer primary key autoincrement,
+  name text not null,
+  prefix text not null,
+  key_hash text unique not null,
+  scopes text not null,
+  created_at timestamp not null,
+  rotated_at timestamp,
+  revoked_at timestamp
+)
@@ -0,0 +1,3 @@
+alter table products add column status text not null default 'active'
+  check (status in ('draft', 'active', 'discontinued', 'archived'));
+alter table products add column archived_at timestamp
\ No newline at end of file
@@ -0,0 +1,3 @@
+alter table product_articles add column revision integer not null default 1;
+alter table product_articles add column effective_from timestamp not null default '1970-01-01 00:00:00';
+alter table product_articles add column effective_to timestamp
\ No newline at end of file
@@ -0,0 +1,7 @@
+create table if not exists removals(
+  id integer primary key autoincrement,
+  product_id integer not null references products(id),
+  revision integer not null,
+  qty integer not null,
+  removed_at timestamp not null
+)
\ No newline at end of file
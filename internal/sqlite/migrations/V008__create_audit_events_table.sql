@@ -0,0 +1,11 @@
+create table if not exists audit_events(
+  id integer primary key autoincrement,
+  actor text not null,
+  action text not null,
+  targets text not null,
+  payload_digest text not null,
+  result text not null,
+  request_id text not null,
+  created_at timestamp not null
+);
+create index if not exists audit_events_created_at_idx on audit_events(created_at)
\ No newline at end of file
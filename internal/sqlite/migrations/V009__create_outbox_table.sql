@@ -0,0 +1,11 @@
+create table if not exists outbox(
+  id integer primary key autoincrement,
+  type text not null,
+  payload text not null,
+  created_at timestamp not null,
+  locked_until timestamp,
+  delivered_at timestamp,
+  attempts integer not null default 0,
+  last_error text
+);
+create index if not exists outbox_pending_idx on outbox(id) where delivered_at is null
\ No newline at end of file
@@ -0,0 +1,10 @@
+create table if not exists lots(
+  id integer primary key autoincrement,
+  article_id integer not null references articles(id),
+  number text not null,
+  received_at timestamp not null,
+  expires_at timestamp,
+  qty integer not null,
+  unique (article_id, number)
+);
+create index if not exists lots_expires_at_idx on lots(expires_at)
\ No newline at end of file
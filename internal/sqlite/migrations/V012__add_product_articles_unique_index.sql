@@ -0,0 +1,14 @@
+update product_articles set amount = (
+  select sum(d.amount) from product_articles as d
+  where d.product_id = product_articles.product_id and d.revision = product_articles.revision and d.article_id = product_articles.article_id
+)
+where id in (
+  select min(id) from product_articles
+  group by product_id, revision, article_id
+  having count(*) > 1
+);
+delete from product_articles where id not in (
+  select min(id) from product_articles
+  group by product_id, revision, article_id
+);
+create unique index if not exists product_articles_revision_article_idx on product_articles(product_id, revision, article_id)
\ No newline at end of file
@@ -0,0 +1,199 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mtekmir/warehouse-service/internal/errors"
+	"github.com/mtekmir/warehouse-service/internal/outbox"
+	"github.com/mtekmir/warehouse-service/internal/tracing"
+)
+
+type outboxRepo struct{}
+
+// Insert stores the events in the outbox.
+func (outboxRepo) Insert(ctx context.Context, db outbox.Executor, ee []*outbox.Event) (err error) {
+	var op errors.Op = "sqliteOutboxRepo.insert"
+	ctx, span := tracing.Start(ctx, string(op))
+	defer func() { tracing.End(span, err) }()
+
+	if len(ee) == 0 {
+		return nil
+	}
+
+	now := time.Now().UTC()
+	values := make([]interface{}, 0, len(ee)*3)
+	pHolders := make([]string, 0, len(ee))
+	for _, e := range ee {
+		pHolders = append(pHolders, "(?, ?, ?)")
+		values = append(values, e.Type, string(e.Payload), now)
+	}
+
+	stmt := "INSERT INTO outbox (type, payload, created_at) VALUES " + strings.Join(pHolders, ", ")
+	if _, err := db.ExecContext(ctx, stmt, values...); err != nil {
+		return errors.E(op, err)
+	}
+
+	return nil
+}
+
+// Claim leases the oldest undelivered events that aren't leased.
+func (outboxRepo) Claim(ctx context.Context, db outbox.Executor, limit int, now, until time.Time) (_ []*outbox.Event, err error) {
+	var op errors.Op = "sqliteOutboxRepo.claim"
+	ctx, span := tracing.Start(ctx, string(op))
+	defer func() { tracing.End(span, err) }()
+
+	rows, err := db.QueryContext(ctx, `
+		UPDATE outbox SET locked_until = ?
+		WHERE id IN (
+			SELECT id FROM outbox
+			WHERE delivered_at IS NULL AND dead_at IS NULL AND (locked_until IS NULL OR locked_until <= ?)
+			ORDER BY id
+			LIMIT ?
+		)
+		RETURNING id, type, payload, created_at`,
+		until.UTC(), now.UTC(), limit,
+	)
+	if err != nil {
+		return nil, errors.E(op, err)
+	}
+	ee, err := scanOutboxEvents(rows)
+	if err != nil {
+		return nil, errors.E(op, err)
+	}
+
+	// Rows returned by an update aren't ordered.
+	sort.Slice(ee, func(i, j int) bool { return ee[i].ID < ee[j].ID })
+	return ee, nil
+}
+
+// MarkDelivered marks the events as delivered.
+func (outboxRepo) MarkDelivered(ctx context.Context, db outbox.Executor, IDs []outbox.EventID, at time.Time) (err error) {
+	var op errors.Op = "sqliteOutboxRepo.markDelivered"
+	ctx, span := tracing.Start(ctx, string(op))
+	defer func() { tracing.End(span, err) }()
+
+	pHolders, values := eventIDs(IDs, at.UTC())
+	_, err = db.ExecContext(ctx, "UPDATE outbox SET delivered_at = ?, locked_until = NULL, attempts = attempts + 1 WHERE id IN ("+pHolders+")", values...)
+	if err != nil {
+		return errors.E(op, err)
+	}
+
+	return nil
+}
+
+// Release ends the leases of the events and records the failed attempt. Events that
+// reach maxAttempts are dead-lettered.
+func (outboxRepo) Release(ctx context.Context, db outbox.Executor, IDs []outbox.EventID, reason string, maxAttempts int) (err error) {
+	var op errors.Op = "sqliteOutboxRepo.release"
+	ctx, span := tracing.Start(ctx, string(op))
+	defer func() { tracing.End(span, err) }()
+
+	pHolders, values := eventIDs(IDs, reason, maxAttempts, maxAttempts, time.Now().UTC())
+	_, err = db.ExecContext(ctx, `
+		UPDATE outbox SET locked_until = NULL, attempts = attempts + 1, last_error = ?,
+		dead_at = CASE WHEN ? > 0 AND attempts + 1 >= ? THEN ? END
+		WHERE id IN (`+pHolders+")", values...)
+	if err != nil {
+		return errors.E(op, err)
+	}
+
+	return nil
+}
+
+// Prune deletes delivered events stored before the time, and pending ones if pending
+// is set.
+func (outboxRepo) Prune(ctx context.Context, db outbox.Executor, before time.Time, pending bool, limit int) (_ int, err error) {
+	var op errors.Op = "sqliteOutboxRepo.prune"
+	ctx, span := tracing.Start(ctx, string(op))
+	defer func() { tracing.End(span, err) }()
+
+	res, err := db.ExecContext(ctx, `
+		DELETE FROM outbox WHERE id IN (
+			SELECT id FROM outbox
+			WHERE created_at < ? AND (delivered_at IS NOT NULL OR (? AND dead_at IS NULL))
+			LIMIT ?
+		)`,
+		before.UTC(), pending, limit,
+	)
+	if err != nil {
+		return 0, errors.E(op, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, errors.E(op, err)
+	}
+
+	return int(n), nil
+}
+
+// FindAfter returns the events with ids bigger than after.
+func (outboxRepo) FindAfter(ctx context.Context, db outbox.Executor, after outbox.EventID, limit int) (_ []*outbox.Event, err error) {
+	var op errors.Op = "sqliteOutboxRepo.findAfter"
+	ctx, span := tracing.Start(ctx, string(op))
+	defer func() { tracing.End(span, err) }()
+
+	rows, err := db.QueryContext(ctx, "SELECT id, type, payload, created_at FROM outbox WHERE id > ? ORDER BY id LIMIT ?", after, limit)
+	if err != nil {
+		return nil, errors.E(op, err)
+	}
+	ee, err := scanOutboxEvents(rows)
+	if err != nil {
+		return nil, errors.E(op, err)
+	}
+
+	return ee, nil
+}
+
+// LastID returns the id of the latest event.
+func (outboxRepo) LastID(ctx context.Context, db outbox.Executor) (_ outbox.EventID, err error) {
+	var op errors.Op = "sqliteOutboxRepo.lastID"
+	ctx, span := tracing.Start(ctx, string(op))
+	defer func() { tracing.End(span, err) }()
+
+	var ID outbox.EventID
+	if err := db.QueryRowContext(ctx, "SELECT COALESCE(MAX(id), 0) FROM outbox").Scan(&ID); err != nil {
+		return 0, errors.E(op, err)
+	}
+
+	return ID, nil
+}
+
+// scanOutboxEvents scans the id, type, payload and created_at columns of the rows and
+// closes them.
+func scanOutboxEvents(rows *sql.Rows) ([]*outbox.Event, error) {
+	defer rows.Close()
+
+	ee := []*outbox.Event{}
+	for rows.Next() {
+		var e outbox.Event
+		var payload string
+		if err := rows.Scan(&e.ID, &e.Type, &payload, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		e.Payload = json.RawMessage(payload)
+		ee = append(ee, &e)
+	}
+	return ee, rows.Err()
+}
+
+// eventIDs returns the placeholders of the ids and the values, following the leading
+// values.
+func eventIDs(IDs []outbox.EventID, leading ...interface{}) (string, []interface{}) {
+	pHolders := make([]string, 0, len(IDs))
+	values := append(make([]interface{}, 0, len(IDs)+len(leading)), leading...)
+	for _, ID := range IDs {
+		pHolders = append(pHolders, "?")
+		values = append(values, ID)
+	}
+	return strings.Join(pHolders, ", "), values
+}
+
+// NewOutboxRepo returns a sqlite repo for the outbox.
+func NewOutboxRepo() outbox.Repo {
+	return outboxRepo{}
+}
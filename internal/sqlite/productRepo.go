@@ -0,0 +1,421 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mtekmir/warehouse-service/internal/errors"
+	"github.com/mtekmir/warehouse-service/internal/product"
+	"github.com/mtekmir/warehouse-service/internal/tracing"
+)
+
+type productRepo struct{}
+
+// ExistingProductsMap is used while importing products. It takes in a barcodes slice and returns
+// a map of found products barcodes to ids.
+func (productRepo) ExistingProductsMap(ctx context.Context, db product.Executor, bb []*product.Barcode) (_ map[product.Barcode]product.ID, err error) {
+	var op errors.Op = "sqliteProductRepo.existingProductsMap"
+	ctx, span := tracing.Start(ctx, string(op))
+	defer func() { tracing.End(span, err) }()
+
+	pHolders := make([]string, 0, len(bb))
+	values := make([]interface{}, 0, len(bb))
+	for _, b := range bb {
+		pHolders = append(pHolders, "?")
+		values = append(values, *b)
+	}
+
+	rows, err := db.QueryContext(ctx, "SELECT id, barcode FROM products WHERE barcode IN ("+strings.Join(pHolders, ", ")+")", values...)
+	if err != nil {
+		return nil, errors.E(op, err)
+	}
+	defer rows.Close()
+
+	m := make(map[product.Barcode]product.ID, len(bb))
+	for rows.Next() {
+		var ID product.ID
+		var b product.Barcode
+		if err := rows.Scan(&ID, &b); err != nil {
+			return nil, errors.E(op, err)
+		}
+		m[b] = ID
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.E(op, err)
+	}
+
+	return m, nil
+}
+
+// FindAll returns the products with their stock information. Available quantities are
+// calculated in the db so that products can be filtered, sorted and paginated by them.
+func (productRepo) FindAll(ctx context.Context, db product.Executor, ff *product.Filters) (_ []*product.StockInfo, err error) {
+	var op errors.Op = "sqliteProductRepo.findAll"
+	ctx, span := tracing.Start(ctx, string(op))
+	defer func() { tracing.End(span, err) }()
+
+	filterQueries := make([]string, 0, 3)
+	var values []interface{}
+
+	if ff.BB != nil {
+		pHolders := make([]string, 0, len(*ff.BB))
+		for _, b := range *ff.BB {
+			pHolders = append(pHolders, "?")
+			values = append(values, b)
+		}
+		filterQueries = append(filterQueries, fmt.Sprintf("p.barcode IN (%s)", strings.Join(pHolders, ", ")))
+	}
+
+	if ff.ID != nil {
+		filterQueries = append(filterQueries, "p.id = ?")
+		values = append(values, *ff.ID)
+	}
+
+	if ff.ArtIDs != nil {
+		pHolders := make([]string, 0, len(*ff.ArtIDs))
+		for _, artID := range *ff.ArtIDs {
+			pHolders = append(pHolders, "?")
+			values = append(values, artID)
+		}
+		filterQueries = append(filterQueries, fmt.Sprintf(
+			"p.id IN (SELECT cpa.product_id FROM current_pa cpa JOIN articles ca ON ca.id = cpa.article_id WHERE ca.art_id IN (%s))",
+			strings.Join(pHolders, ", "),
+		))
+	}
+
+	if len(ff.Statuses) > 0 {
+		pHolders := make([]string, 0, len(ff.Statuses))
+		for _, st := range ff.Statuses {
+			pHolders = append(pHolders, "?")
+			values = append(values, st)
+		}
+		filterQueries = append(filterQueries, fmt.Sprintf("p.status IN (%s)", strings.Join(pHolders, ", ")))
+	} else {
+		filterQueries = append(filterQueries, "p.status <> 'archived'")
+	}
+
+	var filters string
+	if len(filterQueries) > 0 {
+		filters = "WHERE " + strings.Join(filterQueries, " AND ")
+	}
+
+	var having string
+	if ff.InStock {
+		having = "HAVING MIN((a.stock - COALESCE(e.qty, 0)) / pa.amount) > 0"
+	}
+
+	order := productsOrder(ff.Sort)
+
+	// SQLite requires a limit for an offset, -1 means no limit.
+	var pagination string
+	if ff.Limit > 0 || ff.Offset > 0 {
+		limit := ff.Limit
+		if limit <= 0 {
+			limit = -1
+		}
+		pagination = "LIMIT ? OFFSET ?"
+		values = append(values, limit, ff.Offset)
+	}
+
+	// Only the rows of the revisions in effect and the lots that aren't expired are used.
+	now := time.Now().UTC()
+	values = append([]interface{}{now, now, now}, values...)
+
+	stmt := fmt.Sprintf(`
+		WITH current_pa AS (
+			SELECT * FROM product_articles WHERE effective_from <= ? AND (effective_to IS NULL OR effective_to > ?)
+		),
+		expired AS (
+			SELECT article_id, SUM(qty) AS qty FROM lots WHERE expires_at <= ? GROUP BY article_id
+		),
+		p AS (
+			SELECT p.id, p.barcode, p.name, p.status, p.archived_at, MAX(pa.revision) AS revision,
+			MAX(MIN((a.stock - COALESCE(e.qty, 0)) / pa.amount), 0) AS available_quantity
+			FROM products p
+			JOIN current_pa pa ON p.id = pa.product_id
+			JOIN articles a ON a.id = pa.article_id
+			LEFT JOIN expired e ON e.article_id = a.id
+			%s
+			GROUP BY p.id
+			%s
+			ORDER BY %s
+			%s
+		)
+		SELECT p.id, p.barcode, p.name, p.status, p.archived_at, p.revision, p.available_quantity,
+		a.id, a.art_id, a.name, pa.amount, a.stock
+		FROM p
+		JOIN current_pa pa ON p.id = pa.product_id
+		JOIN articles a ON a.id = pa.article_id
+		ORDER BY %s, pa.id
+	`, filters, having, order, pagination, order)
+
+	rows, err := db.QueryContext(ctx, stmt, values...)
+	if err != nil {
+		return nil, errors.E(op, err)
+	}
+	defer rows.Close()
+
+	res := []*product.StockInfo{}
+	var last *product.StockInfo
+
+	for rows.Next() {
+		var p product.StockInfo
+		var art product.ArticleStock
+		var archivedAt sql.NullTime
+
+		err := rows.Scan(&p.ID, &p.Barcode, &p.Name, &p.Status, &archivedAt, &p.Revision, &p.AvailableQty, &art.ID, &art.ArtID, &art.Name, &art.RequiredAmount, &art.Stock)
+		if err != nil {
+			return nil, errors.E(op, err)
+		}
+
+		if archivedAt.Valid {
+			p.ArchivedAt = &archivedAt.Time
+		}
+
+		// Rows of a product are adjacent since they are ordered by product first.
+		if last != nil && last.ID == p.ID {
+			last.Articles = append(last.Articles, &art)
+			continue
+		}
+		p.Articles = []*product.ArticleStock{&art}
+		last = &p
+		res = append(res, &p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.E(op, err)
+	}
+
+	return res, nil
+}
+
+// productsOrder returns the ORDER BY clause for the products cte. IDs are used as a
+// tie breaker so that pagination is stable.
+func productsOrder(s *product.Sort) string {
+	if s == nil {
+		return "p.id"
+	}
+
+	dir := "ASC"
+	if s.Desc {
+		dir = "DESC"
+	}
+
+	switch s.Field {
+	case product.SortByName:
+		return fmt.Sprintf("p.name %s, p.id", dir)
+	case product.SortByAvailability:
+		return fmt.Sprintf("available_quantity %s, p.id", dir)
+	default:
+		return fmt.Sprintf("p.id %s", dir)
+	}
+}
+
+// BatchInsert inserts products without their articles. Does not handle duplicates.
+func (productRepo) BatchInsert(ctx context.Context, db product.Executor, pp []*product.Product) (_ []*product.Product, err error) {
+	var op errors.Op = "sqliteProductRepo.batchInsert"
+	ctx, span := tracing.Start(ctx, string(op))
+	defer func() { tracing.End(span, err) }()
+
+	values := make([]interface{}, 0, len(pp)*2)
+	pHolders := make([]string, 0, len(pp))
+	for _, p := range pp {
+		pHolders = append(pHolders, "(?, ?)")
+		values = append(values, p.Barcode, p.Name)
+	}
+
+	rows, err := db.QueryContext(ctx, "INSERT INTO products (barcode, name) VALUES "+strings.Join(pHolders, ", ")+" RETURNING id, barcode, name", values...)
+	if err != nil {
+		return nil, errors.E(op, err)
+	}
+	defer rows.Close()
+
+	inserted := make([]*product.Product, 0, len(pp))
+	for rows.Next() {
+		var p product.Product
+		if err := rows.Scan(&p.ID, &p.Barcode, &p.Name); err != nil {
+			return nil, errors.E(op, err)
+		}
+		inserted = append(inserted, &p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.E(op, err)
+	}
+
+	// SQLite doesn't guarantee the order of returned rows, ids follow the insert order.
+	sort.Slice(inserted, func(i, j int) bool { return inserted[i].ID < inserted[j].ID })
+	return inserted, nil
+}
+
+// InsertProductArticles puts the articles of products into product_articles table.
+func (productRepo) InsertProductArticles(ctx context.Context, db product.Executor, arts []*product.ArticleRow) (err error) {
+	var op errors.Op = "sqliteProductRepo.insertProductArticles"
+	ctx, span := tracing.Start(ctx, string(op))
+	defer func() { tracing.End(span, err) }()
+
+	// Articles of new products are the first revision of their bill of materials.
+	now := time.Now().UTC()
+	pHolders := make([]string, 0, len(arts))
+	values := make([]interface{}, 0, len(arts)*4)
+	for _, a := range arts {
+		pHolders = append(pHolders, "(?, ?, ?, ?)")
+		values = append(values, a.Amount, a.ProductID, a.ID, now)
+	}
+
+	_, err = db.ExecContext(ctx, "INSERT INTO product_articles (amount, product_id, article_id, effective_from) VALUES "+strings.Join(pHolders, ", "), values...)
+	if err != nil {
+		return errors.E(op, err)
+	}
+
+	return nil
+}
+
+// UpdateStatus moves a product from a status to another. Archiving sets the archive
+// time, other states clear it.
+func (productRepo) UpdateStatus(ctx context.Context, db product.Executor, ID product.ID, from, to product.Status) (err error) {
+	var op errors.Op = "sqliteProductRepo.updateStatus"
+	ctx, span := tracing.Start(ctx, string(op))
+	defer func() { tracing.End(span, err) }()
+
+	res, err := db.ExecContext(ctx, `
+		UPDATE products SET status = ?, archived_at = CASE WHEN ? THEN current_timestamp END
+		WHERE id = ? AND status = ?
+	`, to, to == product.StatusArchived, ID, from)
+	if err != nil {
+		return errors.E(op, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return errors.E(op, err)
+	}
+	if n > 0 {
+		return nil
+	}
+
+	var st product.Status
+	err = db.QueryRowContext(ctx, "SELECT status FROM products WHERE id = ?", ID).Scan(&st)
+	if err == sql.ErrNoRows {
+		return errors.E(op, errors.NotFound, "Product not found")
+	}
+	if err != nil {
+		return errors.E(op, err)
+	}
+	return errors.E(op, errors.Invalid, fmt.Sprintf("Product is no longer %s", from))
+}
+
+// Lock takes the write lock of the db until the transaction of db ends, SQLite doesn't
+// lock rows.
+func (productRepo) Lock(ctx context.Context, db product.Executor, ID product.ID) (err error) {
+	var op errors.Op = "sqliteProductRepo.lock"
+	ctx, span := tracing.Start(ctx, string(op))
+	defer func() { tracing.End(span, err) }()
+
+	res, err := db.ExecContext(ctx, "UPDATE products SET id = id WHERE id = ?", ID)
+	if err != nil {
+		return errors.E(op, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return errors.E(op, err)
+	}
+	if n == 0 {
+		return errors.E(op, errors.NotFound, "Product not found")
+	}
+
+	return nil
+}
+
+// FindRevisions returns the revisions of the bill of materials of a product, oldest first.
+func (productRepo) FindRevisions(ctx context.Context, db product.Executor, ID product.ID) (_ []*product.Revision, err error) {
+	var op errors.Op = "sqliteProductRepo.findRevisions"
+	ctx, span := tracing.Start(ctx, string(op))
+	defer func() { tracing.End(span, err) }()
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT pa.revision, pa.effective_from, pa.effective_to, a.id, a.art_id, a.name, pa.amount
+		FROM product_articles pa
+		JOIN articles a ON a.id = pa.article_id
+		WHERE pa.product_id = ?
+		ORDER BY pa.revision, pa.id
+	`, ID)
+	if err != nil {
+		return nil, errors.E(op, err)
+	}
+	defer rows.Close()
+
+	rr := []*product.Revision{}
+	var last *product.Revision
+	for rows.Next() {
+		var r product.Revision
+		var a product.Article
+		var effectiveTo sql.NullTime
+		if err := rows.Scan(&r.Number, &r.EffectiveFrom, &effectiveTo, &a.ID, &a.ArtID, &a.Name, &a.Amount); err != nil {
+			return nil, errors.E(op, err)
+		}
+
+		if last != nil && last.Number == r.Number {
+			last.Articles = append(last.Articles, &a)
+			continue
+		}
+		if effectiveTo.Valid {
+			r.EffectiveTo = &effectiveTo.Time
+		}
+		r.Articles = []*product.Article{&a}
+		last = &r
+		rr = append(rr, &r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.E(op, err)
+	}
+
+	return rr, nil
+}
+
+// InsertRevision ends the latest revision of a product at the effective time of the new
+// revision and inserts the articles of the new revision.
+func (productRepo) InsertRevision(ctx context.Context, db product.Executor, ID product.ID, rev *product.Revision) (err error) {
+	var op errors.Op = "sqliteProductRepo.insertRevision"
+	ctx, span := tracing.Start(ctx, string(op))
+	defer func() { tracing.End(span, err) }()
+
+	_, err = db.ExecContext(ctx, "UPDATE product_articles SET effective_to = ? WHERE product_id = ? AND effective_to IS NULL", rev.EffectiveFrom, ID)
+	if err != nil {
+		return errors.E(op, err)
+	}
+
+	pHolders := make([]string, 0, len(rev.Articles))
+	values := make([]interface{}, 0, len(rev.Articles)*5)
+	for _, a := range rev.Articles {
+		pHolders = append(pHolders, "(?, ?, ?, ?, ?)")
+		values = append(values, a.Amount, ID, a.ID, rev.Number, rev.EffectiveFrom)
+	}
+
+	stmt := "INSERT INTO product_articles (amount, product_id, article_id, revision, effective_from) VALUES " + strings.Join(pHolders, ", ")
+	if _, err := db.ExecContext(ctx, stmt, values...); err != nil {
+		return errors.E(op, err)
+	}
+
+	return nil
+}
+
+// InsertRemoval records the removal of units of a product.
+func (productRepo) InsertRemoval(ctx context.Context, db product.Executor, rm *product.Removal) (err error) {
+	var op errors.Op = "sqliteProductRepo.insertRemoval"
+	ctx, span := tracing.Start(ctx, string(op))
+	defer func() { tracing.End(span, err) }()
+
+	_, err = db.ExecContext(ctx, "INSERT INTO removals (product_id, revision, qty, removed_at) VALUES (?, ?, ?, ?)", rm.ProductID, rm.Revision, rm.Qty, time.Now().UTC())
+	if err != nil {
+		return errors.E(op, err)
+	}
+
+	return nil
+}
+
+// NewProductRepo returns a sqlite repo for products.
+func NewProductRepo() product.Repo {
+	return productRepo{}
+}
@@ -0,0 +1,55 @@
+// Package sqlite implements the repos on SQLite, for running the service on a single box
+// without Postgres.
+package sqlite
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	// SQLite driver
+	_ "modernc.org/sqlite"
+)
+
+// Open opens the db of a sqlite url such as sqlite:///var/lib/warehouse.db,
+// sqlite://warehouse.db or sqlite::memory:. Migrations aren't run.
+//
+// The db is limited to a single connection since SQLite allows a single writer, and
+// transactions take the write lock when they begin.
+func Open(dbURL string) (*sql.DB, error) {
+	path := strings.TrimPrefix(strings.TrimPrefix(dbURL, "sqlite:"), "//")
+	if path == "" {
+		return nil, fmt.Errorf("sqlite url %q has no path", dbURL)
+	}
+
+	sep := "?"
+	if strings.Contains(path, "?") {
+		sep = "&"
+	}
+	dsn := "file:" + path + sep + "_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_txlock=immediate"
+
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+	return db, nil
+}
+
+// Setup sets up the db runs migrations and returns a func to close it.
+func Setup(log *logrus.Logger, dbURL string) (*sql.DB, func(), error) {
+	db, err := Open(dbURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	log.Println("Opened SQLite DB")
+
+	dbTidy := func() { db.Close() }
+
+	if err := Migrate(log, db); err != nil {
+		return nil, dbTidy, err
+	}
+
+	return db, dbTidy, nil
+}
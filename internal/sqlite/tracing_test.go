@@ -0,0 +1,57 @@
+package sqlite_test
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mtekmir/warehouse-service/internal/product"
+	"github.com/mtekmir/warehouse-service/internal/sqlite"
+	"github.com/mtekmir/warehouse-service/internal/tracing"
+	"github.com/sirupsen/logrus"
+)
+
+func TestSpansRecordErrors(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "traces.json")
+	shutdown, err := tracing.Setup(context.Background(), tracing.ExporterFile, file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, dbTidy, err := sqlite.Setup(logrus.New(), "sqlite://"+filepath.Join(t.TempDir(), "warehouse.db"))
+	if err != nil {
+		t.Fatalf("Unable to set up db. %v", err)
+	}
+	defer dbTidy()
+
+	ps := product.NewService(logrus.New(), db, sqlite.NewProductRepo(), sqlite.NewArticleRepo(), nil)
+	if _, err := ps.Transition(context.Background(), 100, product.StatusArchived); err == nil {
+		t.Fatal("Expected an error for a missing product")
+	}
+	if err := sqlite.NewProductRepo().Lock(context.Background(), db, 100); err == nil {
+		t.Fatal("Expected an error for a missing product")
+	}
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"productService.transition", "sqliteProductRepo.lock"} {
+		found := false
+		for _, line := range strings.Split(string(b), "\n") {
+			if strings.Contains(line, `"Name":"`+name+`"`) {
+				found = true
+				if !strings.Contains(line, `"Code":"Error"`) || !strings.Contains(line, "Product not found") {
+					t.Errorf("Expected the span of %s to record the error. Got %s", name, line)
+				}
+			}
+		}
+		if !found {
+			t.Errorf("Expected a span of %s", name)
+		}
+	}
+}
@@ -0,0 +1,325 @@
+// Package stream pushes the changes of article stocks and product availabilities to
+// subscribers as they happen. Changes are read from the events of the outbox, so every
+// replica streams the changes made through any of them, and subscribers resume from the
+// id of the last event they received.
+package stream
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/mtekmir/warehouse-service/internal/article"
+	"github.com/mtekmir/warehouse-service/internal/errors"
+	"github.com/mtekmir/warehouse-service/internal/outbox"
+	"github.com/mtekmir/warehouse-service/internal/product"
+	"github.com/sirupsen/logrus"
+)
+
+// Stock is the stock of an article after a change.
+type Stock struct {
+	ArtID article.ArtID `json:"art_id"`
+	Stock int           `json:"stock"`
+}
+
+// Availability is the available quantity of a product after a change of the stocks of
+// its articles.
+type Availability struct {
+	ID           product.ID      `json:"id"`
+	Barcode      product.Barcode `json:"barcode"`
+	AvailableQty int             `json:"available_quantity"`
+}
+
+// Update holds the changes of an event of the outbox. Availabilities are the ones at the
+// time the update is read rather than right after the event, since they depend on the
+// stocks of other articles too.
+type Update struct {
+	ID             outbox.EventID
+	Stocks         []*Stock
+	Availabilities []*Availability
+}
+
+// empty reports whether the update has no changes.
+func (u *Update) empty() bool {
+	return len(u.Stocks) == 0 && len(u.Availabilities) == 0
+}
+
+// Filter selects the changes a subscriber receives. Stocks of the articles with the art
+// ids and availabilities of the products with the barcodes are selected. A nil filter
+// selects all changes.
+type Filter struct {
+	ArtIDs   map[article.ArtID]bool
+	Barcodes map[product.Barcode]bool
+}
+
+// apply returns the changes of the update that the filter selects.
+func (f *Filter) apply(u *Update) *Update {
+	if f == nil {
+		return u
+	}
+	res := &Update{ID: u.ID}
+	for _, s := range u.Stocks {
+		if f.ArtIDs[s.ArtID] {
+			res.Stocks = append(res.Stocks, s)
+		}
+	}
+	for _, a := range u.Availabilities {
+		if f.Barcodes[a.Barcode] {
+			res.Availabilities = append(res.Availabilities, a)
+		}
+	}
+	return res
+}
+
+type productFinder interface {
+	FindAll(ctx context.Context, ff *product.Filters) ([]*product.StockInfo, error)
+}
+
+const (
+	batchSize  = 100 // Max number of events read at once.
+	bufferSize = 256 // Max number of updates queued for a subscriber.
+)
+
+// Hub reads the new events of the outbox and sends their updates to the subscribers.
+// Subscribers that fall behind by more than bufferSize updates are dropped, they resume
+// with the id of the last update they received.
+type Hub struct {
+	log      *logrus.Logger
+	db       *sql.DB
+	repo     outbox.Repo
+	products productFinder
+	poll     time.Duration
+	wake     chan struct{}
+
+	mu    sync.Mutex
+	ready bool
+	last  outbox.EventID // Id of the last event sent to the subscribers.
+	subs  map[*Subscription]struct{}
+}
+
+// Wake makes the hub read the new events without waiting for the poll interval, e.g. when
+// the db notifies that events were stored. It doesn't block.
+func (h *Hub) Wake() {
+	select {
+	case h.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run reads the new events when woken and every poll interval until ctx is done.
+// Subscriptions are closed when it returns.
+func (h *Hub) Run(ctx context.Context) {
+	defer h.closeAll()
+
+	t := time.NewTicker(h.poll)
+	defer t.Stop()
+
+	for {
+		if err := h.read(ctx); err != nil && ctx.Err() == nil {
+			h.log.Printf("Unable to read events for the stream: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-h.wake:
+		case <-t.C:
+		}
+	}
+}
+
+// read sends the updates of the events after the last one to the subscribers. The first
+// read only finds the last event, subscribers receive the events stored after it.
+func (h *Hub) read(ctx context.Context) error {
+	var op errors.Op = "streamHub.read"
+
+	h.mu.Lock()
+	ready, last := h.ready, h.last
+	h.mu.Unlock()
+
+	if !ready {
+		ID, err := h.repo.LastID(ctx, h.db)
+		if err != nil {
+			return errors.E(op, err)
+		}
+		h.mu.Lock()
+		h.ready, h.last = true, ID
+		h.mu.Unlock()
+		return nil
+	}
+
+	for {
+		ee, err := h.repo.FindAfter(ctx, h.db, last, batchSize)
+		if err != nil {
+			return errors.E(op, err)
+		}
+		for _, e := range ee {
+			u, err := h.update(ctx, e)
+			if err != nil {
+				return errors.E(op, err)
+			}
+			h.broadcast(u)
+			last = e.ID
+		}
+		if len(ee) < batchSize {
+			return nil
+		}
+	}
+}
+
+// update returns the update of the event. Only stock changes update stocks and product
+// availabilities, other events have empty updates.
+func (h *Hub) update(ctx context.Context, e *outbox.Event) (*Update, error) {
+	u := &Update{ID: e.ID}
+	if e.Type != outbox.TypeStockChanged {
+		return u, nil
+	}
+
+	var p outbox.StockChanged
+	if err := json.Unmarshal(e.Payload, &p); err != nil {
+		return nil, err
+	}
+	if len(p.Articles) == 0 {
+		return u, nil
+	}
+
+	artIDs := make([]article.ArtID, 0, len(p.Articles))
+	for _, a := range p.Articles {
+		artIDs = append(artIDs, article.ArtID(a.ArtID))
+		u.Stocks = append(u.Stocks, &Stock{ArtID: article.ArtID(a.ArtID), Stock: a.Stock})
+	}
+
+	pp, err := h.products.FindAll(ctx, &product.Filters{ArtIDs: &artIDs})
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range pp {
+		u.Availabilities = append(u.Availabilities, &Availability{ID: p.ID, Barcode: p.Barcode, AvailableQty: p.AvailableQty})
+	}
+
+	return u, nil
+}
+
+// broadcast sends the update to the subscribers and records it as the last one.
+func (h *Hub) broadcast(u *Update) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.last = u.ID
+	for s := range h.subs {
+		fu := s.filter.apply(u)
+		if fu.empty() {
+			continue
+		}
+		select {
+		case s.c <- fu:
+		default:
+			h.log.Printf("Dropping a stream subscriber that fell behind at event %d", u.ID)
+			h.remove(s)
+		}
+	}
+}
+
+// remove unsubscribes the subscription. The lock must be held.
+func (h *Hub) remove(s *Subscription) {
+	if _, ok := h.subs[s]; ok {
+		delete(h.subs, s)
+		close(s.c)
+	}
+}
+
+func (h *Hub) closeAll() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for s := range h.subs {
+		h.remove(s)
+	}
+	h.ready = false
+}
+
+// Subscribe subscribes to the updates selected by the filter. Updates of the events after
+// the given id are replayed with Replay before the new ones are received from C, after
+// zero means that only new updates are received.
+func (h *Hub) Subscribe(f *Filter, after outbox.EventID) (*Subscription, error) {
+	var op errors.Op = "streamHub.subscribe"
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !h.ready {
+		return nil, errors.E(op, errors.Unavailable, "Event stream isn't ready")
+	}
+
+	c := make(chan *Update, bufferSize)
+	s := &Subscription{C: c, c: c, hub: h, filter: f, after: after, upTo: h.last}
+	if after == 0 {
+		s.after = h.last
+	}
+	h.subs[s] = struct{}{}
+	return s, nil
+}
+
+// Subscription receives the updates of a subscriber.
+type Subscription struct {
+	// C receives the new updates. It's closed when the subscriber falls behind or the hub
+	// stops.
+	C <-chan *Update
+
+	c           chan *Update
+	hub         *Hub
+	filter      *Filter
+	after, upTo outbox.EventID // Events to replay.
+}
+
+// Replay sends the updates of the events the subscriber missed, from the event after the
+// one it subscribed with up to the last event sent by the hub when it subscribed.
+func (s *Subscription) Replay(ctx context.Context, send func(*Update) error) error {
+	var op errors.Op = "streamSubscription.replay"
+
+	for last := s.after; last != s.upTo; {
+		ee, err := s.hub.repo.FindAfter(ctx, s.hub.db, last, batchSize)
+		if err != nil {
+			return errors.E(op, err)
+		}
+		if len(ee) == 0 {
+			return nil
+		}
+		for _, e := range ee {
+			u, err := s.hub.update(ctx, e)
+			if err != nil {
+				return errors.E(op, err)
+			}
+			if fu := s.filter.apply(u); !fu.empty() {
+				if err := send(fu); err != nil {
+					return err
+				}
+			}
+			if last = e.ID; last == s.upTo {
+				return nil
+			}
+		}
+	}
+	return nil
+}
+
+// Close unsubscribes.
+func (s *Subscription) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	s.hub.remove(s)
+}
+
+// NewHub creates a hub that reads the events of the outbox every poll interval and
+// finds the availabilities of the products with the finder.
+func NewHub(l *logrus.Logger, db *sql.DB, r outbox.Repo, pf productFinder, poll time.Duration) *Hub {
+	return &Hub{
+		log:      l,
+		db:       db,
+		repo:     r,
+		products: pf,
+		poll:     poll,
+		wake:     make(chan struct{}, 1),
+		subs:     make(map[*Subscription]struct{}),
+	}
+}
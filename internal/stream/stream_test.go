@@ -0,0 +1,166 @@
+package stream_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mtekmir/warehouse-service/internal/article"
+	"github.com/mtekmir/warehouse-service/internal/errors"
+	"github.com/mtekmir/warehouse-service/internal/memory"
+	"github.com/mtekmir/warehouse-service/internal/outbox"
+	"github.com/mtekmir/warehouse-service/internal/product"
+	"github.com/mtekmir/warehouse-service/internal/stream"
+	"github.com/mtekmir/warehouse-service/test"
+	"github.com/sirupsen/logrus"
+)
+
+type fixture struct {
+	hub      *stream.Hub
+	articles *article.Service
+	products *product.Service
+}
+
+// setup runs a hub over memory repos with a chair made of 4 legs and a seat in stock.
+func setup(t *testing.T) *fixture {
+	t.Helper()
+	s := memory.NewStore()
+	db := memory.NewDB(s)
+	t.Cleanup(func() { db.Close() })
+	or := memory.NewOutboxRepo(s)
+	ar := memory.NewArticleRepo(s)
+	ps := product.NewService(logrus.New(), db, memory.NewProductRepo(s), ar, or)
+	f := &fixture{
+		hub:      stream.NewHub(logrus.New(), db, or, ps, time.Hour),
+		articles: article.NewService(logrus.New(), db, ar, or),
+		products: ps,
+	}
+
+	err := ps.Import(context.Background(), []*product.Product{
+		{Barcode: "b1", Name: "chair", Articles: []*product.Article{{ArtID: "1", Name: "leg", Amount: 4}, {ArtID: "2", Name: "seat", Amount: 1}}},
+	})
+	if err != nil {
+		t.Fatalf("Unable to import products. %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		f.hub.Run(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	return f
+}
+
+// subscribe subscribes once the hub is ready.
+func (f *fixture) subscribe(t *testing.T, ff *stream.Filter, after outbox.EventID) *stream.Subscription {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		sub, err := f.hub.Subscribe(ff, after)
+		if err == nil {
+			t.Cleanup(sub.Close)
+			return sub
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Unable to subscribe. %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// importArticles imports the articles and wakes the hub.
+func (f *fixture) importArticles(t *testing.T, aa ...*article.Article) {
+	t.Helper()
+	if _, err := f.articles.Import(context.Background(), aa); err != nil {
+		t.Fatalf("Unable to import articles. %v", err)
+	}
+	f.hub.Wake()
+}
+
+func receive(t *testing.T, sub *stream.Subscription) *stream.Update {
+	t.Helper()
+	select {
+	case u, ok := <-sub.C:
+		if !ok {
+			t.Fatal("Subscription was closed")
+		}
+		return u
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for an update")
+		return nil
+	}
+}
+
+func TestHub(t *testing.T) {
+	t.Parallel()
+	f := setup(t)
+	all := f.subscribe(t, nil, 0)
+	legs := f.subscribe(t, &stream.Filter{ArtIDs: map[article.ArtID]bool{"1": true}}, 0)
+	chairs := f.subscribe(t, &stream.Filter{Barcodes: map[product.Barcode]bool{"b1": true}}, 0)
+
+	// Events of the product import before subscribing aren't sent.
+	f.importArticles(t, &article.Article{ArtID: "2", Name: "seat", Stock: 1})
+	u := receive(t, all)
+	test.Compare(t, "update", &stream.Update{
+		ID:             3,
+		Stocks:         []*stream.Stock{{ArtID: "2", Stock: 2}},
+		Availabilities: []*stream.Availability{{ID: 1, Barcode: "b1", AvailableQty: 1}},
+	}, u)
+	test.Compare(t, "chair update", &stream.Update{ID: 3, Availabilities: u.Availabilities}, receive(t, chairs))
+
+	// Removals change the stocks of the articles too.
+	if _, err := f.products.Remove(context.Background(), 1, 1); err != nil {
+		t.Fatalf("Unable to remove a product. %v", err)
+	}
+	f.hub.Wake()
+	test.Compare(t, "leg update", &stream.Update{ID: 5, Stocks: []*stream.Stock{{ArtID: "1", Stock: 0}}}, receive(t, legs))
+	test.Compare(t, "chair update", &stream.Update{
+		ID:             5,
+		Availabilities: []*stream.Availability{{ID: 1, Barcode: "b1", AvailableQty: 0}},
+	}, receive(t, chairs))
+}
+
+func TestHubReplay(t *testing.T) {
+	t.Parallel()
+	f := setup(t)
+	live := f.subscribe(t, nil, 0)
+	f.importArticles(t, &article.Article{ArtID: "1", Name: "leg", Stock: 4})
+	f.importArticles(t, &article.Article{ArtID: "2", Name: "seat", Stock: 1})
+	f.importArticles(t, &article.Article{ArtID: "1", Name: "leg", Stock: 4})
+	for i := 0; i < 3; i++ {
+		receive(t, live)
+	}
+
+	// Every import stores a stock change and a completion without changes, a subscriber
+	// resuming after the first leg import at 3 misses the stock changes 5 and 7.
+	sub := f.subscribe(t, &stream.Filter{ArtIDs: map[article.ArtID]bool{"1": true, "2": true}}, 3)
+	var replayed []*stream.Update
+	err := sub.Replay(context.Background(), func(u *stream.Update) error {
+		replayed = append(replayed, u)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Unable to replay. %v", err)
+	}
+	test.Compare(t, "replayed", []*stream.Update{
+		{ID: 5, Stocks: []*stream.Stock{{ArtID: "2", Stock: 2}}},
+		{ID: 7, Stocks: []*stream.Stock{{ArtID: "1", Stock: 12}}},
+	}, replayed)
+}
+
+func TestHubNotReady(t *testing.T) {
+	t.Parallel()
+	s := memory.NewStore()
+	hub := stream.NewHub(logrus.New(), memory.NewDB(s), memory.NewOutboxRepo(s), product.NewService(logrus.New(), memory.NewDB(s), memory.NewProductRepo(s), memory.NewArticleRepo(s), nil), time.Hour)
+
+	_, err := hub.Subscribe(nil, 0)
+	var e *errors.Error
+	if !errors.As(err, &e) || e.Kind != errors.Unavailable {
+		t.Errorf("Expected an unavailable error before the hub runs. Got %v", err)
+	}
+}
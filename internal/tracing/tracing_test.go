@@ -0,0 +1,45 @@
+package tracing_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mtekmir/warehouse-service/internal/tracing"
+)
+
+func TestFileExporter(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "traces.json")
+	shutdown, err := tracing.Setup(context.Background(), tracing.ExporterFile, file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, span := tracing.Start(context.Background(), "productService.import")
+	_, child := tracing.StartClient(ctx, "SELECT")
+	tracing.End(child, errors.New("connection refused"))
+	span.End()
+
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{`"Name":"productService.import"`, `"Name":"SELECT"`, "connection refused"} {
+		if !strings.Contains(string(b), s) {
+			t.Errorf("Expected exported spans to contain %s", s)
+		}
+	}
+}
+
+func TestUnknownExporter(t *testing.T) {
+	if _, err := tracing.Setup(context.Background(), "zipkin", ""); err == nil {
+		t.Error("Expected unknown exporters to be rejected")
+	}
+}
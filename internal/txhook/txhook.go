@@ -0,0 +1,20 @@
+// Package txhook reports the end of transactions to the repos that were used in them.
+package txhook
+
+import "database/sql"
+
+// Observer is implemented by repos that act when the transactions they were used in
+// end, such as the cache, which invalidates the entries written in them again.
+type Observer interface {
+	TxEnded(tx *sql.Tx)
+}
+
+// Ended reports the end of tx to the repos that are observers. It's deferred right
+// after beginning tx so that it runs after the commit or the rollback.
+func Ended(tx *sql.Tx, repos ...interface{}) {
+	for _, r := range repos {
+		if o, ok := r.(Observer); ok {
+			o.TxEnded(tx)
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package txhook_test
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/mtekmir/warehouse-service/internal/txhook"
+)
+
+type observer struct {
+	ended []*sql.Tx
+}
+
+func (o *observer) TxEnded(tx *sql.Tx) {
+	o.ended = append(o.ended, tx)
+}
+
+func TestEnded(t *testing.T) {
+	o1, o2 := &observer{}, &observer{}
+	tx := &sql.Tx{}
+
+	txhook.Ended(tx, o1, struct{}{}, nil, o2)
+
+	for i, o := range []*observer{o1, o2} {
+		if len(o.ended) != 1 || o.ended[0] != tx {
+			t.Errorf("Expected observer %d to be told about the end of the transaction, got %v", i, o.ended)
+		}
+	}
+}
@@ -2,8 +2,14 @@ package test
 
 import (
 	"context"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/mtekmir/warehouse-service/internal/article"
+	"github.com/mtekmir/warehouse-service/internal/audit"
+	"github.com/mtekmir/warehouse-service/internal/auth"
+	"github.com/mtekmir/warehouse-service/internal/errors"
 	"github.com/mtekmir/warehouse-service/internal/product"
 )
 
@@ -22,6 +28,11 @@ func (m *MockArticleService) FindAll(_ context.Context) ([]*article.Article, err
 	return []*article.Article{}, nil
 }
 
+func (m *MockArticleService) ExpiringLots(_ context.Context, days int) ([]*article.Lot, error) {
+	m.Calls["ExpiringLots"] = days
+	return []*article.Lot{}, nil
+}
+
 func NewMockArticleService() *MockArticleService {
 	return &MockArticleService{
 		Calls: make(map[string]interface{}),
@@ -52,8 +63,106 @@ func (m *MockProductService) FindAll(ctx context.Context, ff *product.Filters) (
 	return []*product.StockInfo{}, nil
 }
 
+func (m *MockProductService) Transition(ctx context.Context, ID product.ID, to product.Status) (*product.StockInfo, error) {
+	m.Calls["Transition"] = []interface{}{ID, to}
+	return &product.StockInfo{ID: ID, Status: to}, nil
+}
+
+func (m *MockProductService) Revisions(ctx context.Context, ID product.ID) ([]*product.Revision, error) {
+	m.Calls["Revisions"] = []interface{}{ID}
+	return []*product.Revision{}, nil
+}
+
+func (m *MockProductService) Revise(ctx context.Context, ID product.ID, effectiveFrom time.Time, arts []*product.Article) (*product.Revision, error) {
+	m.Calls["Revise"] = []interface{}{ID, effectiveFrom, arts}
+	return &product.Revision{}, nil
+}
+
 func NewMockProductService() *MockProductService {
 	return &MockProductService{
 		Calls: make(map[string][]interface{}),
 	}
 }
+
+// MockAuthService is mock impl of auth service. Tokens are authenticated against Keys.
+type MockAuthService struct {
+	Keys map[string]*auth.Key
+}
+
+func (m *MockAuthService) Authenticate(_ context.Context, token string) (*auth.Key, error) {
+	k, ok := m.Keys[token]
+	if !ok {
+		return nil, errors.E(errors.Op("mockAuthService.authenticate"), errors.Unauthorized, "Invalid api key")
+	}
+	return k, nil
+}
+
+// AuthenticateTicket authenticates tickets issued by IssueTicket, which are the tokens of
+// the keys prefixed with "ticket:".
+func (m *MockAuthService) AuthenticateTicket(ctx context.Context, ticket string) (*auth.Key, error) {
+	if !strings.HasPrefix(ticket, "ticket:") {
+		return nil, errors.E(errors.Op("mockAuthService.authenticateTicket"), errors.Unauthorized, "Invalid ticket")
+	}
+	return m.Authenticate(ctx, strings.TrimPrefix(ticket, "ticket:"))
+}
+
+func (m *MockAuthService) IssueTicket(_ context.Context, k *auth.Key) (string, time.Time, error) {
+	for token, key := range m.Keys {
+		if key == k {
+			return "ticket:" + token, time.Now().Add(auth.TicketTTL), nil
+		}
+	}
+	return "", time.Time{}, errors.E(errors.Op("mockAuthService.issueTicket"), errors.Invalid, "Unknown api key")
+}
+
+func (m *MockAuthService) Create(_ context.Context, name string, scopes []auth.Scope) (*auth.Key, string, error) {
+	return &auth.Key{Name: name, Scopes: scopes}, "", nil
+}
+
+func (m *MockAuthService) Rotate(_ context.Context, ID auth.KeyID) (*auth.Key, string, error) {
+	return &auth.Key{ID: ID}, "", nil
+}
+
+func (m *MockAuthService) Revoke(_ context.Context, ID auth.KeyID) (*auth.Key, error) {
+	return &auth.Key{ID: ID}, nil
+}
+
+func (m *MockAuthService) FindAll(_ context.Context) ([]*auth.Key, error) {
+	return []*auth.Key{}, nil
+}
+
+func NewMockAuthService(keys map[string]*auth.Key) *MockAuthService {
+	return &MockAuthService{Keys: keys}
+}
+
+// MockAuditService is mock impl of audit service. Recorded events are kept in Events.
+type MockAuditService struct {
+	mu      sync.Mutex
+	Events  []*audit.Event
+	Filters *audit.Filters // Filters of the last FindAll call.
+}
+
+func (m *MockAuditService) Record(_ context.Context, e *audit.Event) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.Events = append(m.Events, e)
+	return nil
+}
+
+func (m *MockAuditService) FindAll(_ context.Context, ff *audit.Filters) ([]*audit.Event, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.Filters = ff
+	return m.Events, nil
+}
+
+// Recorded returns the recorded events.
+func (m *MockAuditService) Recorded() []*audit.Event {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]*audit.Event(nil), m.Events...)
+}
+
+func NewMockAuditService() *MockAuditService {
+	return &MockAuditService{}
+}
@@ -0,0 +1,125 @@
+package repotest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mtekmir/warehouse-service/internal/audit"
+	"github.com/mtekmir/warehouse-service/internal/errors"
+	"github.com/mtekmir/warehouse-service/test"
+	"github.com/sirupsen/logrus"
+)
+
+// RunAuditRepo runs the suite of the audit repo. Only the Audit and DB fields of the
+// backends are used, the suite is skipped for backends without an audit repo.
+func RunAuditRepo(t *testing.T, newBackend NewBackend) {
+	ctx := context.Background()
+	base := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	setup := func(t *testing.T) *Backend {
+		b := newBackend(t)
+		if b.Audit == nil {
+			t.Skip("Backend has no audit repo")
+		}
+		for i, e := range []*audit.Event{
+			{Actor: "key:1", Action: "article.import", Targets: []string{"article:1", "article:2"}, PayloadDigest: "sha256:aa", Result: "ok", RequestID: "r1"},
+			{Actor: "key:2", Action: "product.remove", Targets: []string{"product:1", "article:1"}, PayloadDigest: "sha256:bb", Result: "ok", RequestID: "r2"},
+			{Actor: "key:1", Action: "product.remove", Targets: []string{"product:10"}, Result: "invalid"},
+			{Actor: "key:bootstrap", Action: "key.create", Targets: []string{}, Result: "ok"},
+		} {
+			e.CreatedAt = base.Add(time.Duration(i) * time.Minute)
+			if _, err := b.Audit.Insert(ctx, b.DB, e); err != nil {
+				t.Fatalf("Unable to insert audit event. %v", err)
+			}
+		}
+		return b
+	}
+
+	t.Run("insert", func(t *testing.T) {
+		b := setup(t)
+
+		ee := findEvents(t, b, &audit.Filters{Limit: 1})
+		if len(ee) != 1 {
+			t.Fatalf("Expected 1 event, got %d", len(ee))
+		}
+		if !ee[0].CreatedAt.Equal(base.Add(3 * time.Minute)) {
+			t.Errorf("Expected created at to be %s, got %s", base.Add(3*time.Minute), ee[0].CreatedAt)
+		}
+		ee[0].CreatedAt = time.Time{}
+		test.Compare(t, "event", &audit.Event{ID: 4, Actor: "key:bootstrap", Action: "key.create", Targets: []string{}, Result: "ok"}, ee[0])
+
+		ee = findEvents(t, b, &audit.Filters{Actor: "key:2"})
+		ee[0].CreatedAt = time.Time{}
+		test.Compare(t, "event", &audit.Event{
+			ID: 2, Actor: "key:2", Action: "product.remove", Targets: []string{"product:1", "article:1"}, PayloadDigest: "sha256:bb", Result: "ok", RequestID: "r2",
+		}, ee[0])
+	})
+
+	t.Run("filters", func(t *testing.T) {
+		b := setup(t)
+
+		at := func(min int) *time.Time {
+			t := base.Add(time.Duration(min) * time.Minute)
+			return &t
+		}
+		for _, c := range []struct {
+			name     string
+			ff       *audit.Filters
+			expected []audit.EventID
+		}{
+			{"all", &audit.Filters{}, []audit.EventID{4, 3, 2, 1}},
+			{"actor", &audit.Filters{Actor: "key:1"}, []audit.EventID{3, 1}},
+			{"action", &audit.Filters{Action: "product.remove"}, []audit.EventID{3, 2}},
+			{"target", &audit.Filters{Target: "article:1"}, []audit.EventID{2, 1}},
+			{"target prefix", &audit.Filters{Target: "product:1"}, []audit.EventID{2}},
+			{"time range", &audit.Filters{From: at(1), To: at(3)}, []audit.EventID{3, 2}},
+			{"combined", &audit.Filters{Actor: "key:1", Action: "product.remove", From: at(0)}, []audit.EventID{3}},
+			{"pagination", &audit.Filters{Limit: 2, Offset: 1}, []audit.EventID{3, 2}},
+			{"offset", &audit.Filters{Offset: 3}, []audit.EventID{1}},
+			{"no match", &audit.Filters{Actor: "key:9"}, []audit.EventID{}},
+		} {
+			ids := []audit.EventID{}
+			for _, e := range findEvents(t, b, c.ff) {
+				ids = append(ids, e.ID)
+			}
+			test.Compare(t, c.name, c.expected, ids)
+		}
+	})
+
+	t.Run("service", func(t *testing.T) {
+		b := setup(t)
+		svc := audit.NewService(logrus.New(), b.DB, b.Audit)
+
+		e := &audit.Event{Actor: "key:1", Action: "product.archive"}
+		if err := svc.Record(ctx, e); err != nil {
+			t.Fatalf("Unable to record audit event. %v", err)
+		}
+		if e.ID != 5 || e.CreatedAt.IsZero() {
+			t.Errorf("Expected the event to get an id and a creation time. Got %d, %s", e.ID, e.CreatedAt)
+		}
+
+		ee, err := svc.FindAll(ctx, &audit.Filters{Action: "product.archive"})
+		if err != nil {
+			t.Fatalf("Unable to find audit events. %v", err)
+		}
+		if len(ee) != 1 || ee[0].ID != 5 {
+			t.Errorf("Expected to find the recorded event. Got %v", ee)
+		}
+
+		from, to := base, base.Add(-time.Minute)
+		_, err = svc.FindAll(ctx, &audit.Filters{From: &from, To: &to})
+		expectKind(t, err, errors.Invalid)
+		_, err = svc.FindAll(ctx, &audit.Filters{Limit: audit.MaxLimit + 1})
+		expectKind(t, err, errors.Invalid)
+	})
+}
+
+func findEvents(t *testing.T, b *Backend, ff *audit.Filters) []*audit.Event {
+	t.Helper()
+	ee, err := b.Audit.FindAll(context.Background(), b.DB, ff)
+	if err != nil {
+		t.Fatalf("Unable to find audit events. %v", err)
+	}
+	return ee
+}
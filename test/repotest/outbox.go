@@ -0,0 +1,185 @@
+package repotest
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/mtekmir/warehouse-service/internal/outbox"
+	"github.com/mtekmir/warehouse-service/test"
+)
+
+// RunOutboxRepo runs the suite of the outbox repo. Only the Outbox and DB fields of the
+// backends are used, the suite is skipped for backends without an outbox repo.
+func RunOutboxRepo(t *testing.T, newBackend NewBackend) {
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	setup := func(t *testing.T, n int) *Backend {
+		b := newBackend(t)
+		if b.Outbox == nil {
+			t.Skip("Backend has no outbox repo")
+		}
+		ee := make([]*outbox.Event, 0, n)
+		for i := 0; i < n; i++ {
+			ee = append(ee, &outbox.Event{Type: outbox.TypeImportCompleted, Payload: json.RawMessage(`{"rows": 1}`)})
+		}
+		if err := b.Outbox.Insert(ctx, b.DB, ee); err != nil {
+			t.Fatalf("Unable to insert events. %v", err)
+		}
+		return b
+	}
+
+	claim := func(t *testing.T, b *Backend, limit int, at time.Time) []outbox.EventID {
+		t.Helper()
+		ee, err := b.Outbox.Claim(ctx, b.DB, limit, at, at.Add(time.Minute))
+		if err != nil {
+			t.Fatalf("Unable to claim events. %v", err)
+		}
+		IDs := []outbox.EventID{}
+		for _, e := range ee {
+			IDs = append(IDs, e.ID)
+		}
+		return IDs
+	}
+
+	t.Run("insert", func(t *testing.T) {
+		b := setup(t, 2)
+
+		ee, err := b.Outbox.Claim(ctx, b.DB, 10, now, now.Add(time.Minute))
+		if err != nil {
+			t.Fatalf("Unable to claim events. %v", err)
+		}
+		if len(ee) != 2 {
+			t.Fatalf("Expected 2 events, got %d", len(ee))
+		}
+		if ee[0].CreatedAt.IsZero() {
+			t.Error("Expected the creation time to be set")
+		}
+		var payload map[string]int
+		if err := json.Unmarshal(ee[0].Payload, &payload); err != nil {
+			t.Fatalf("Unable to decode payload %s. %v", ee[0].Payload, err)
+		}
+		test.Compare(t, "payload", map[string]int{"rows": 1}, payload)
+		ee[0].CreatedAt, ee[0].Payload = time.Time{}, nil
+		test.Compare(t, "event", &outbox.Event{ID: 1, Type: outbox.TypeImportCompleted}, ee[0])
+
+		if err := b.Outbox.Insert(ctx, b.DB, nil); err != nil {
+			t.Errorf("Unable to insert no events. %v", err)
+		}
+	})
+
+	t.Run("claim leases events", func(t *testing.T) {
+		b := setup(t, 3)
+
+		test.Compare(t, "claimed", []outbox.EventID{1, 2}, claim(t, b, 2, now))
+		test.Compare(t, "claimed", []outbox.EventID{3}, claim(t, b, 2, now))
+		test.Compare(t, "claimed", []outbox.EventID{}, claim(t, b, 2, now))
+		// Leases end after a minute.
+		test.Compare(t, "claimed", []outbox.EventID{1, 2, 3}, claim(t, b, 10, now.Add(2*time.Minute)))
+	})
+
+	t.Run("delivered events aren't claimed", func(t *testing.T) {
+		b := setup(t, 3)
+
+		IDs := claim(t, b, 2, now)
+		if err := b.Outbox.MarkDelivered(ctx, b.DB, IDs, now); err != nil {
+			t.Fatalf("Unable to mark events delivered. %v", err)
+		}
+		test.Compare(t, "claimed", []outbox.EventID{3}, claim(t, b, 10, now.Add(2*time.Minute)))
+	})
+
+	t.Run("released events are claimed again", func(t *testing.T) {
+		b := setup(t, 3)
+
+		IDs := claim(t, b, 2, now)
+		if err := b.Outbox.Release(ctx, b.DB, IDs, "endpoint is down", 0); err != nil {
+			t.Fatalf("Unable to release events. %v", err)
+		}
+		test.Compare(t, "claimed", []outbox.EventID{1, 2, 3}, claim(t, b, 10, now))
+	})
+
+	t.Run("dead-lettered events aren't claimed", func(t *testing.T) {
+		b := setup(t, 3)
+
+		for i := 0; i < 2; i++ {
+			if err := b.Outbox.Release(ctx, b.DB, claim(t, b, 1, now), "invalid event", 2); err != nil {
+				t.Fatalf("Unable to release events. %v", err)
+			}
+		}
+		test.Compare(t, "claimed", []outbox.EventID{2, 3}, claim(t, b, 10, now))
+	})
+
+	t.Run("prune", func(t *testing.T) {
+		b := setup(t, 4)
+
+		if err := b.Outbox.MarkDelivered(ctx, b.DB, claim(t, b, 1, now), now); err != nil {
+			t.Fatalf("Unable to mark events delivered. %v", err)
+		}
+		if err := b.Outbox.Release(ctx, b.DB, claim(t, b, 1, now), "invalid event", 1); err != nil {
+			t.Fatalf("Unable to release events. %v", err)
+		}
+		prune := func(before time.Time, pending bool) int {
+			t.Helper()
+			n, err := b.Outbox.Prune(ctx, b.DB, before, pending, 10)
+			if err != nil {
+				t.Fatalf("Unable to prune events. %v", err)
+			}
+			return n
+		}
+
+		if n := prune(now.Add(-time.Hour), true); n != 0 {
+			t.Errorf("Expected no events newer than the retention to be pruned, got %d", n)
+		}
+		if n := prune(now.Add(time.Hour), false); n != 1 {
+			t.Errorf("Expected the delivered event to be pruned, got %d", n)
+		}
+		// The dead-lettered event is kept.
+		if n := prune(now.Add(time.Hour), true); n != 2 {
+			t.Errorf("Expected the pending events to be pruned, got %d", n)
+		}
+		ee, err := b.Outbox.FindAfter(ctx, b.DB, 0, 10)
+		if err != nil {
+			t.Fatalf("Unable to find events. %v", err)
+		}
+		if len(ee) != 1 || ee[0].ID != 2 {
+			t.Errorf("Expected only the dead-lettered event to be kept, got %d events", len(ee))
+		}
+	})
+	t.Run("find after", func(t *testing.T) {
+		b := newBackend(t)
+		if b.Outbox == nil {
+			t.Skip("Backend has no outbox repo")
+		}
+		last, err := b.Outbox.LastID(ctx, b.DB)
+		if err != nil || last != 0 {
+			t.Fatalf("Expected no last id without events. Got %d, %v", last, err)
+		}
+
+		b = setup(t, 4)
+		// Delivery doesn't matter.
+		if err := b.Outbox.MarkDelivered(ctx, b.DB, claim(t, b, 1, now), now); err != nil {
+			t.Fatalf("Unable to mark events delivered. %v", err)
+		}
+		find := func(after outbox.EventID, limit int) []outbox.EventID {
+			t.Helper()
+			ee, err := b.Outbox.FindAfter(ctx, b.DB, after, limit)
+			if err != nil {
+				t.Fatalf("Unable to find events. %v", err)
+			}
+			IDs := []outbox.EventID{}
+			for _, e := range ee {
+				IDs = append(IDs, e.ID)
+			}
+			return IDs
+		}
+		test.Compare(t, "found", []outbox.EventID{1, 2, 3}, find(0, 3))
+		test.Compare(t, "found", []outbox.EventID{3, 4}, find(2, 10))
+		test.Compare(t, "found", []outbox.EventID{}, find(4, 10))
+
+		if last, err = b.Outbox.LastID(ctx, b.DB); err != nil || last != 4 {
+			t.Errorf("Expected the last id to be 4. Got %d, %v", last, err)
+		}
+	})
+}
@@ -0,0 +1,1184 @@
+// Package repotest checks that implementations of article.Repo, product.Repo,
+// audit.Repo and outbox.Repo behave like the Postgres repos, so that alternative backends and wrapped
+// repos can be used interchangeably.
+//
+//	func TestRepos(t *testing.T) {
+//		repotest.Run(t, func(t *testing.T) *repotest.Backend {
+//			return &repotest.Backend{DB: db, Articles: NewArticleRepo(), Products: NewProductRepo()}
+//		})
+//	}
+package repotest
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mtekmir/warehouse-service/internal/article"
+	"github.com/mtekmir/warehouse-service/internal/audit"
+	"github.com/mtekmir/warehouse-service/internal/errors"
+	"github.com/mtekmir/warehouse-service/internal/outbox"
+	"github.com/mtekmir/warehouse-service/internal/product"
+	"github.com/mtekmir/warehouse-service/test"
+	"github.com/sirupsen/logrus"
+)
+
+// Backend holds the repos under test and the db they are used with.
+type Backend struct {
+	// DB is passed to the repos as the executor. It's a *sql.DB rather than an executor
+	// since the services that are run against the repos begin transactions on it.
+	DB       *sql.DB
+	Articles article.Repo
+	Products product.Repo
+	Audit    audit.Repo  // Optional.
+	Outbox   outbox.Repo // Optional, events of the services are checked if set.
+	// Inventory returns the inventory stats of the backend. Optional.
+	Inventory func(ctx context.Context) (outOfStock, units int, err error)
+}
+
+// NewBackend returns a backend with empty tables, ids of new rows start from 1. It's
+// called once for each case of the suite.
+type NewBackend func(t *testing.T) *Backend
+
+// Run runs the article, product, audit and outbox repo suites.
+func Run(t *testing.T, newBackend NewBackend) {
+	t.Run("articles", func(t *testing.T) { RunArticleRepo(t, newBackend) })
+	t.Run("products", func(t *testing.T) { RunProductRepo(t, newBackend) })
+	t.Run("audit", func(t *testing.T) { RunAuditRepo(t, newBackend) })
+	t.Run("outbox", func(t *testing.T) { RunOutboxRepo(t, newBackend) })
+}
+
+// RunArticleRepo runs the suite of the article repo. Only the Articles and DB fields of
+// the backends are used.
+func RunArticleRepo(t *testing.T, newBackend NewBackend) {
+	ctx := context.Background()
+
+	t.Run("import sums duplicates", func(t *testing.T) {
+		b := newBackend(t)
+
+		imported, err := b.Articles.Import(ctx, b.DB, []*article.Article{
+			{ArtID: "1", Name: "leg", Stock: 4},
+			{ArtID: "2", Name: "seat", Stock: 1},
+			{ArtID: "1", Name: "leg", Stock: 4},
+			{ArtID: "1", Name: "leg", Stock: 2},
+		})
+		if err != nil {
+			t.Fatalf("Unable to import articles. %v", err)
+		}
+		expected := []*article.Article{
+			{ID: 1, ArtID: "1", Name: "leg", Stock: 10},
+			{ID: 2, ArtID: "2", Name: "seat", Stock: 1},
+		}
+		test.Compare(t, "article", expected, sortArticles(imported))
+		test.Compare(t, "article", expected, findArticles(t, b, nil))
+	})
+
+	t.Run("import adds to existing articles", func(t *testing.T) {
+		b := newBackend(t)
+
+		if _, err := b.Articles.Import(ctx, b.DB, []*article.Article{
+			{ArtID: "1", Name: "leg", Stock: 4},
+			{ArtID: "2", Name: "seat", Stock: 1},
+		}); err != nil {
+			t.Fatalf("Unable to import articles. %v", err)
+		}
+
+		imported, err := b.Articles.Import(ctx, b.DB, []*article.Article{
+			{ArtID: "3", Name: "top", Stock: 1},
+			{ArtID: "2", Name: "seat", Stock: 2},
+			{ArtID: "2", Name: "seat", Stock: 3},
+		})
+		if err != nil {
+			t.Fatalf("Unable to import articles. %v", err)
+		}
+		test.Compare(t, "article", []*article.Article{
+			{ID: 2, ArtID: "2", Name: "seat", Stock: 6},
+			{ID: 3, ArtID: "3", Name: "top", Stock: 1},
+		}, sortArticles(imported))
+
+		test.Compare(t, "article", []*article.Article{
+			{ID: 1, ArtID: "1", Name: "leg", Stock: 4},
+			{ID: 2, ArtID: "2", Name: "seat", Stock: 6},
+			{ID: 3, ArtID: "3", Name: "top", Stock: 1},
+		}, findArticles(t, b, nil))
+	})
+
+	t.Run("batch insert", func(t *testing.T) {
+		b := newBackend(t)
+
+		inserted, err := b.Articles.BatchInsert(ctx, b.DB, []*article.Article{
+			{ArtID: "2", Name: "seat", Stock: 1},
+			{ArtID: "1", Name: "leg", Stock: 4},
+		})
+		if err != nil {
+			t.Fatalf("Unable to insert articles. %v", err)
+		}
+		test.Compare(t, "article", []*article.Article{
+			{ID: 1, ArtID: "2", Name: "seat", Stock: 1},
+			{ID: 2, ArtID: "1", Name: "leg", Stock: 4},
+		}, inserted)
+
+		if _, err := b.Articles.BatchInsert(ctx, b.DB, []*article.Article{{ArtID: "1", Name: "leg", Stock: 1}}); err == nil {
+			t.Error("Expected an error when inserting an existing art id")
+		}
+	})
+
+	t.Run("find all", func(t *testing.T) {
+		b := newBackend(t)
+		if _, err := b.Articles.BatchInsert(ctx, b.DB, []*article.Article{
+			{ArtID: "3", Name: "art_3", Stock: 3},
+			{ArtID: "1", Name: "art_1", Stock: 1},
+			{ArtID: "2", Name: "art_2", Stock: 2},
+		}); err != nil {
+			t.Fatalf("Unable to insert articles. %v", err)
+		}
+
+		all := []*article.Article{
+			{ID: 2, ArtID: "1", Name: "art_1", Stock: 1},
+			{ID: 3, ArtID: "2", Name: "art_2", Stock: 2},
+			{ID: 1, ArtID: "3", Name: "art_3", Stock: 3},
+		}
+		test.Compare(t, "article", all, findArticles(t, b, nil))
+		test.Compare(t, "article", []*article.Article{all[0], all[2]}, findArticles(t, b, &[]article.ArtID{"3", "missing", "1", "1"}))
+		if found := findArticles(t, b, &[]article.ArtID{"missing"}); len(found) != 0 {
+			t.Errorf("Expected no articles. Got %d", len(found))
+		}
+	})
+
+	t.Run("adjust quantities", func(t *testing.T) {
+		b := newBackend(t)
+		arts := insertArticles(t, b, 10, 10)
+
+		steps := []struct {
+			name     string
+			kind     article.QtyAdjustmentKind
+			qty      [2]int
+			expected [2]int
+		}{
+			{name: "add", kind: article.QtyAdjustmentAdd, qty: [2]int{5, 1}, expected: [2]int{15, 11}},
+			{name: "subtract", kind: article.QtyAdjustmentSubtract, qty: [2]int{3, 11}, expected: [2]int{12, 0}},
+			{name: "subtract below zero", kind: article.QtyAdjustmentSubtract, qty: [2]int{2, 1}, expected: [2]int{10, -1}},
+			{name: "replace", kind: article.QtyAdjustmentReplace, qty: [2]int{7, 2}, expected: [2]int{7, 2}},
+			{name: "add zero", kind: article.QtyAdjustmentAdd, qty: [2]int{0, 0}, expected: [2]int{7, 2}},
+		}
+		for _, s := range steps {
+			err := b.Articles.AdjustQuantities(ctx, b.DB, s.kind, []*article.QtyAdjustment{
+				{ID: arts[0].ID, Qty: s.qty[0]},
+				{ID: arts[1].ID, Qty: s.qty[1]},
+			})
+			if err != nil {
+				t.Fatalf("Unable to adjust quantities (%s). %v", s.name, err)
+			}
+			found := findArticles(t, b, nil)
+			if found[0].Stock != s.expected[0] || found[1].Stock != s.expected[1] {
+				t.Errorf("Expected stocks %v after %s. Got %d and %d", s.expected, s.name, found[0].Stock, found[1].Stock)
+			}
+		}
+
+		// Only the articles in the changes are adjusted.
+		if err := b.Articles.AdjustQuantities(ctx, b.DB, article.QtyAdjustmentReplace, []*article.QtyAdjustment{{ID: arts[1].ID, Qty: 5}}); err != nil {
+			t.Fatalf("Unable to adjust quantities. %v", err)
+		}
+		found := findArticles(t, b, nil)
+		if found[0].Stock != 7 || found[1].Stock != 5 {
+			t.Errorf("Expected stocks [7 5]. Got %d and %d", found[0].Stock, found[1].Stock)
+		}
+	})
+
+	t.Run("adjust quantities row count mismatch", func(t *testing.T) {
+		b := newBackend(t)
+		arts := insertArticles(t, b, 10)
+
+		cases := []struct {
+			name    string
+			changes []*article.QtyAdjustment
+		}{
+			{name: "missing article", changes: []*article.QtyAdjustment{{ID: arts[0].ID, Qty: 1}, {ID: arts[0].ID + 100, Qty: 1}}},
+			{name: "duplicate article", changes: []*article.QtyAdjustment{{ID: arts[0].ID, Qty: 1}, {ID: arts[0].ID, Qty: 1}}},
+		}
+		for _, c := range cases {
+			err := b.Articles.AdjustQuantities(ctx, b.DB, article.QtyAdjustmentAdd, c.changes)
+			if err == nil {
+				t.Errorf("Expected an error for %s", c.name)
+				continue
+			}
+			if !strings.Contains(err.Error(), "Updated rows don't match with articles length") {
+				t.Errorf("Expected a row count mismatch error for %s. Got %v", c.name, err)
+			}
+		}
+	})
+
+	t.Run("lots", func(t *testing.T) {
+		b := newBackend(t)
+		arts := insertArticles(t, b, 10, 10)
+
+		// Times are truncated since Postgres keeps microseconds.
+		now := time.Now().UTC().Truncate(time.Microsecond)
+		received := now.AddDate(0, -1, 0)
+		expired, soon, later := now.AddDate(0, 0, -1), now.AddDate(0, 0, 10), now.AddDate(0, 0, 40)
+		lots := []*article.Lot{
+			{ArticleID: arts[0].ID, Number: "L1", ReceivedAt: received, ExpiresAt: &expired, Qty: 2},
+			{ArticleID: arts[0].ID, Number: "L2", ReceivedAt: received, ExpiresAt: &later, Qty: 3},
+			{ArticleID: arts[0].ID, Number: "L3", ReceivedAt: received, Qty: 2},
+			{ArticleID: arts[1].ID, Number: "L1", ReceivedAt: received, ExpiresAt: &soon, Qty: 4},
+		}
+		if err := b.Articles.InsertLots(ctx, b.DB, lots); err != nil {
+			t.Fatalf("Unable to insert lots. %v", err)
+		}
+		// Quantities are added to existing lots, their dates don't change.
+		err := b.Articles.InsertLots(ctx, b.DB, []*article.Lot{
+			{ArticleID: arts[1].ID, Number: "L1", ReceivedAt: now, ExpiresAt: &later, Qty: 1},
+		})
+		if err != nil {
+			t.Fatalf("Unable to insert lots. %v", err)
+		}
+
+		test.Compare(t, "lot", []*article.Lot{
+			{ArticleID: arts[0].ID, ArtID: "1", Number: "L1", ReceivedAt: received, ExpiresAt: &expired, Qty: 2},
+			{ArticleID: arts[1].ID, ArtID: "2", Number: "L1", ReceivedAt: received, ExpiresAt: &soon, Qty: 5},
+		}, findLots(t, b, now.AddDate(0, 0, 30)), lotCmp)
+		if found := findLots(t, b, now.AddDate(0, 0, -2)); len(found) != 0 {
+			t.Errorf("Expected no lots to expire. Got %d", len(found))
+		}
+	})
+
+	t.Run("consume lots", func(t *testing.T) {
+		b := newBackend(t)
+		arts := insertArticles(t, b, 20, 20)
+
+		now := time.Now().UTC().Truncate(time.Microsecond)
+		received := now.AddDate(0, -1, 0)
+		expired, soon, later := now.AddDate(0, 0, -1), now.AddDate(0, 0, 10), now.AddDate(0, 0, 40)
+		err := b.Articles.InsertLots(ctx, b.DB, []*article.Lot{
+			{ArticleID: arts[0].ID, Number: "expired", ReceivedAt: received, ExpiresAt: &expired, Qty: 2},
+			{ArticleID: arts[0].ID, Number: "later", ReceivedAt: received, ExpiresAt: &later, Qty: 3},
+			{ArticleID: arts[0].ID, Number: "never", ReceivedAt: received, Qty: 2},
+			{ArticleID: arts[0].ID, Number: "soon", ReceivedAt: received, ExpiresAt: &soon, Qty: 1},
+			{ArticleID: arts[1].ID, Number: "soon", ReceivedAt: received, ExpiresAt: &soon, Qty: 4},
+		})
+		if err != nil {
+			t.Fatalf("Unable to insert lots. %v", err)
+		}
+
+		// Expired lots are skipped, the ones expiring soonest are consumed first.
+		err = b.Articles.ConsumeLots(ctx, b.DB, []*article.QtyAdjustment{{ID: arts[0].ID, Qty: 3}, {ID: arts[1].ID, Qty: 1}}, now)
+		if err != nil {
+			t.Fatalf("Unable to consume lots. %v", err)
+		}
+		test.Compare(t, "lot", []*article.Lot{
+			{ArticleID: arts[0].ID, ArtID: "1", Number: "expired", ReceivedAt: received, ExpiresAt: &expired, Qty: 2},
+			{ArticleID: arts[1].ID, ArtID: "2", Number: "soon", ReceivedAt: received, ExpiresAt: &soon, Qty: 3},
+			{ArticleID: arts[0].ID, ArtID: "1", Number: "later", ReceivedAt: received, ExpiresAt: &later, Qty: 1},
+		}, findLots(t, b, now.AddDate(1, 0, 0)), lotCmp)
+
+		// Lots without an expiry date go last, quantities beyond the lots come out of the
+		// untracked stock. Emptied lots are deleted.
+		err = b.Articles.ConsumeLots(ctx, b.DB, []*article.QtyAdjustment{{ID: arts[0].ID, Qty: 10}}, now)
+		if err != nil {
+			t.Fatalf("Unable to consume lots. %v", err)
+		}
+		test.Compare(t, "lot", []*article.Lot{
+			{ArticleID: arts[0].ID, ArtID: "1", Number: "expired", ReceivedAt: received, ExpiresAt: &expired, Qty: 2},
+			{ArticleID: arts[1].ID, ArtID: "2", Number: "soon", ReceivedAt: received, ExpiresAt: &soon, Qty: 3},
+		}, findLots(t, b, now.AddDate(1, 0, 0)), lotCmp)
+		// A lot with the number of a deleted one is a new lot.
+		err = b.Articles.InsertLots(ctx, b.DB, []*article.Lot{{ArticleID: arts[0].ID, Number: "later", ReceivedAt: now, ExpiresAt: &soon, Qty: 1}})
+		if err != nil {
+			t.Fatalf("Unable to insert lots. %v", err)
+		}
+		test.Compare(t, "lot", []*article.Lot{
+			{ArticleID: arts[0].ID, ArtID: "1", Number: "expired", ReceivedAt: received, ExpiresAt: &expired, Qty: 2},
+			{ArticleID: arts[0].ID, ArtID: "1", Number: "later", ReceivedAt: now, ExpiresAt: &soon, Qty: 1},
+			{ArticleID: arts[1].ID, ArtID: "2", Number: "soon", ReceivedAt: received, ExpiresAt: &soon, Qty: 3},
+		}, findLots(t, b, now.AddDate(0, 0, 10)), lotCmp)
+	})
+
+	t.Run("service lots", func(t *testing.T) {
+		b := newBackend(t)
+		as := article.NewService(logrus.New(), b.DB, b.Articles, nil)
+
+		now := time.Now().UTC().Truncate(time.Microsecond)
+		soon, later := now.AddDate(0, 0, 5), now.AddDate(0, 0, 60)
+		_, err := as.Import(ctx, []*article.Article{
+			{ArtID: "1", Name: "glue", Stock: 6, Lots: []*article.Lot{
+				{Number: "G1", ReceivedAt: now, ExpiresAt: &later, Qty: 2},
+				{Number: "G2", ReceivedAt: now, ExpiresAt: &soon, Qty: 3},
+			}},
+			{ArtID: "1", Name: "glue", Stock: 1, Lots: []*article.Lot{{Number: "G2", Qty: 1}}},
+		})
+		if err != nil {
+			t.Fatalf("Unable to import articles. %v", err)
+		}
+		test.Compare(t, "article", []*article.Article{{ID: 1, ArtID: "1", Name: "glue", Stock: 7}}, findArticles(t, b, nil))
+
+		lots, err := as.ExpiringLots(ctx, 30)
+		if err != nil {
+			t.Fatalf("Unable to find expiring lots. %v", err)
+		}
+		for _, l := range lots {
+			l.ID = 0
+		}
+		// Lots with the same number are merged, the dates of the first one are kept.
+		test.Compare(t, "lot", []*article.Lot{
+			{ArticleID: 1, ArtID: "1", Number: "G2", ReceivedAt: now, ExpiresAt: &soon, Qty: 4},
+		}, lots, lotCmp)
+
+		if _, err := as.ExpiringLots(ctx, -1); err == nil {
+			t.Error("Expected an error for negative days")
+		} else {
+			expectKind(t, err, errors.Invalid)
+		}
+
+		cases := []struct {
+			name string
+			art  *article.Article
+		}{
+			{name: "missing number", art: &article.Article{ArtID: "2", Name: "paint", Stock: 1, Lots: []*article.Lot{{Qty: 1}}}},
+			{name: "zero qty", art: &article.Article{ArtID: "2", Name: "paint", Stock: 1, Lots: []*article.Lot{{Number: "P1"}}}},
+			{name: "expires before received", art: &article.Article{ArtID: "2", Name: "paint", Stock: 1, Lots: []*article.Lot{{Number: "P1", ReceivedAt: now, ExpiresAt: &now, Qty: 1}}}},
+			{name: "stock less than lots", art: &article.Article{ArtID: "2", Name: "paint", Stock: 1, Lots: []*article.Lot{{Number: "P1", Qty: 2}}}},
+		}
+		for _, c := range cases {
+			_, err := as.Import(ctx, []*article.Article{c.art})
+			if err == nil {
+				t.Errorf("Expected an error for %s", c.name)
+				continue
+			}
+			expectKind(t, err, errors.Invalid)
+		}
+		if found := findArticles(t, b, nil); len(found) != 1 {
+			t.Errorf("Expected invalid imports not to create articles. Got %d articles", len(found))
+		}
+	})
+
+	t.Run("rollback", func(t *testing.T) {
+		b := newBackend(t)
+		arts := insertArticles(t, b, 10, 10)
+
+		now := time.Now().UTC().Truncate(time.Microsecond)
+		received, soon, later := now.AddDate(0, -1, 0), now.AddDate(0, 0, 10), now.AddDate(0, 0, 40)
+		err := b.Articles.InsertLots(ctx, b.DB, []*article.Lot{
+			{ArticleID: arts[0].ID, Number: "soon", ReceivedAt: received, ExpiresAt: &soon, Qty: 2},
+			{ArticleID: arts[0].ID, Number: "later", ReceivedAt: received, ExpiresAt: &later, Qty: 3},
+		})
+		if err != nil {
+			t.Fatalf("Unable to insert lots. %v", err)
+		}
+		articles, lots := findArticles(t, b, nil), findLots(t, b, now.AddDate(1, 0, 0))
+
+		tx, err := b.DB.BeginTx(ctx, nil)
+		if err != nil {
+			t.Fatalf("Unable to begin a transaction. %v", err)
+		}
+		if _, err := b.Articles.Import(ctx, tx, []*article.Article{{ArtID: "1", Name: "art_1", Stock: 5}, {ArtID: "3", Name: "art_3", Stock: 1}}); err != nil {
+			t.Fatalf("Unable to import articles. %v", err)
+		}
+		if _, err := b.Articles.BatchInsert(ctx, tx, []*article.Article{{ArtID: "4", Name: "art_4", Stock: 1}}); err != nil {
+			t.Fatalf("Unable to insert articles. %v", err)
+		}
+		if err := b.Articles.AdjustQuantities(ctx, tx, article.QtyAdjustmentReplace, []*article.QtyAdjustment{{ID: arts[1].ID, Qty: 1}}); err != nil {
+			t.Fatalf("Unable to adjust quantities. %v", err)
+		}
+		err = b.Articles.InsertLots(ctx, tx, []*article.Lot{
+			{ArticleID: arts[0].ID, Number: "later", ReceivedAt: received, ExpiresAt: &later, Qty: 1},
+			{ArticleID: arts[1].ID, Number: "new", ReceivedAt: received, ExpiresAt: &soon, Qty: 1},
+		})
+		if err != nil {
+			t.Fatalf("Unable to insert lots. %v", err)
+		}
+		// Empties the soon lot.
+		if err := b.Articles.ConsumeLots(ctx, tx, []*article.QtyAdjustment{{ID: arts[0].ID, Qty: 3}}, now); err != nil {
+			t.Fatalf("Unable to consume lots. %v", err)
+		}
+		if err := tx.Rollback(); err != nil {
+			t.Fatalf("Unable to roll back. %v", err)
+		}
+
+		test.Compare(t, "article", articles, findArticles(t, b, nil))
+		test.Compare(t, "lot", lots, findLots(t, b, now.AddDate(1, 0, 0)), lotCmp)
+	})
+}
+
+// lotCmp compares the times of lots by the instant, backends return them in different
+// locations.
+var lotCmp = cmp.Comparer(func(a, b time.Time) bool { return a.Equal(b) })
+
+// findLots returns the lots expiring at or before the time without their ids, which
+// backends allocate differently on conflicts.
+func findLots(t *testing.T, b *Backend, before time.Time) []*article.Lot {
+	t.Helper()
+	lots, err := b.Articles.FindLots(context.Background(), b.DB, before)
+	if err != nil {
+		t.Fatalf("Unable to find lots. %v", err)
+	}
+	for _, l := range lots {
+		l.ID = 0
+	}
+	return lots
+}
+
+// RunProductRepo runs the suite of the product repo. The article repo of the backends
+// is used for setting up the articles of products.
+func RunProductRepo(t *testing.T, newBackend NewBackend) {
+	ctx := context.Background()
+
+	t.Run("existing products map", func(t *testing.T) {
+		b := newBackend(t)
+		insertProducts(t, b, "chair", "table")
+
+		b1, b2, missing := product.Barcode("b1"), product.Barcode("b2"), product.Barcode("missing")
+		existing, err := b.Products.ExistingProductsMap(ctx, b.DB, []*product.Barcode{&b2, &missing, &b1})
+		if err != nil {
+			t.Fatalf("Unable to find existing products. %v", err)
+		}
+		test.Compare(t, "existing product", map[product.Barcode]product.ID{"b1": 1, "b2": 2}, existing)
+	})
+
+	t.Run("batch insert", func(t *testing.T) {
+		b := newBackend(t)
+
+		inserted, err := b.Products.BatchInsert(ctx, b.DB, []*product.Product{
+			{Barcode: "b2", Name: "table"},
+			{Barcode: "b1", Name: "chair"},
+		})
+		if err != nil {
+			t.Fatalf("Unable to insert products. %v", err)
+		}
+		test.Compare(t, "product", []*product.Product{
+			{ID: 1, Barcode: "b2", Name: "table"},
+			{ID: 2, Barcode: "b1", Name: "chair"},
+		}, inserted)
+
+		if _, err := b.Products.BatchInsert(ctx, b.DB, []*product.Product{{Barcode: "b1", Name: "chair"}}); err == nil {
+			t.Error("Expected an error when inserting an existing barcode")
+		}
+	})
+
+	t.Run("availability", func(t *testing.T) {
+		b := newBackend(t)
+		arts := insertArticles(t, b, 7, 3, 0, 5)
+		insertProducts(t, b, "floor", "min", "zero stock", "not enough", "no articles")
+		insertProductArticles(t, b, []*product.ArticleRow{
+			{ProductID: 1, ID: arts[0].ID, Amount: 2},
+			{ProductID: 2, ID: arts[0].ID, Amount: 1},
+			{ProductID: 2, ID: arts[1].ID, Amount: 1},
+			{ProductID: 3, ID: arts[0].ID, Amount: 1},
+			{ProductID: 3, ID: arts[2].ID, Amount: 1},
+			{ProductID: 4, ID: arts[3].ID, Amount: 6},
+		})
+
+		pp := findProducts(t, b, &product.Filters{})
+		got := make(map[string]int, len(pp))
+		for _, p := range pp {
+			got[p.Name] = p.AvailableQty
+		}
+		// Products without articles aren't listed.
+		test.Compare(t, "available quantitie", map[string]int{"floor": 3, "min": 3, "zero stock": 0, "not enough": 0}, got)
+
+		test.Compare(t, "product", []*product.StockInfo{
+			{ID: 2, Barcode: "b2", Name: "min", Status: product.StatusActive, Revision: 1, AvailableQty: 3, Articles: []*product.ArticleStock{
+				{ID: 1, ArtID: "1", Name: "art_1", Stock: 7, RequiredAmount: 1},
+				{ID: 2, ArtID: "2", Name: "art_2", Stock: 3, RequiredAmount: 1},
+			}},
+		}, findProducts(t, b, &product.Filters{ID: productID(2)}))
+	})
+
+	t.Run("expired lots", func(t *testing.T) {
+		b := newBackend(t)
+		arts := insertArticles(t, b, 10, 10)
+		insertProducts(t, b, "chair")
+		insertProductArticles(t, b, []*product.ArticleRow{
+			{ProductID: 1, ID: arts[0].ID, Amount: 2},
+			{ProductID: 1, ID: arts[1].ID, Amount: 1},
+		})
+
+		now := time.Now().UTC()
+		expired, later := now.AddDate(0, 0, -1), now.AddDate(0, 0, 10)
+		insertLots := func(lots ...*article.Lot) {
+			t.Helper()
+			if err := b.Articles.InsertLots(ctx, b.DB, lots); err != nil {
+				t.Fatalf("Unable to insert lots. %v", err)
+			}
+		}
+
+		// Units of expired lots can't be used, stocks still include them.
+		insertLots(
+			&article.Lot{ArticleID: arts[0].ID, Number: "L1", ReceivedAt: now.AddDate(0, -1, 0), ExpiresAt: &expired, Qty: 4},
+			&article.Lot{ArticleID: arts[0].ID, Number: "L2", ReceivedAt: now, ExpiresAt: &later, Qty: 2},
+		)
+		test.Compare(t, "product", []*product.StockInfo{
+			{ID: 1, Barcode: "b1", Name: "chair", Status: product.StatusActive, Revision: 1, AvailableQty: 3, Articles: []*product.ArticleStock{
+				{ID: 1, ArtID: "1", Name: "art_1", Stock: 10, RequiredAmount: 2},
+				{ID: 2, ArtID: "2", Name: "art_2", Stock: 10, RequiredAmount: 1},
+			}},
+		}, findProducts(t, b, &product.Filters{InStock: true}))
+
+		insertLots(&article.Lot{ArticleID: arts[1].ID, Number: "L1", ReceivedAt: now.AddDate(0, -1, 0), ExpiresAt: &expired, Qty: 10})
+		if pp := findProducts(t, b, &product.Filters{}); len(pp) != 1 || pp[0].AvailableQty != 0 {
+			t.Errorf("Expected no chairs to be available. Got %+v", pp)
+		}
+		if pp := findProducts(t, b, &product.Filters{InStock: true}); len(pp) != 0 {
+			t.Errorf("Expected no products in stock. Got %d", len(pp))
+		}
+	})
+
+	t.Run("inventory", func(t *testing.T) {
+		b := newBackend(t)
+		if b.Inventory == nil {
+			t.Skip("Backend has no inventory stats")
+		}
+		arts := insertArticles(t, b, 2, 10, 0)
+		insertProducts(t, b, "chair", "table", "stool", "archived")
+		insertProductArticles(t, b, []*product.ArticleRow{
+			{ProductID: 1, ID: arts[0].ID, Amount: 2},
+			{ProductID: 2, ID: arts[1].ID, Amount: 1},
+			{ProductID: 3, ID: arts[2].ID, Amount: 1},
+			{ProductID: 4, ID: arts[2].ID, Amount: 1},
+		})
+		if err := b.Products.UpdateStatus(ctx, b.DB, 4, product.StatusActive, product.StatusArchived); err != nil {
+			t.Fatalf("Unable to archive a product. %v", err)
+		}
+		// The fully expired lot has more units than the stock left, so the usable stock of
+		// the chair is negative.
+		now := time.Now().UTC()
+		expired := now.AddDate(0, 0, -1)
+		err := b.Articles.InsertLots(ctx, b.DB, []*article.Lot{
+			{ArticleID: arts[0].ID, Number: "L1", ReceivedAt: now.AddDate(0, -1, 0), ExpiresAt: &expired, Qty: 10},
+		})
+		if err != nil {
+			t.Fatalf("Unable to insert lots. %v", err)
+		}
+
+		outOfStock, units, err := b.Inventory(ctx)
+		if err != nil {
+			t.Fatalf("Unable to get the inventory stats. %v", err)
+		}
+		if outOfStock != 2 || units != 12 {
+			t.Errorf("Expected 2 products out of stock and 12 units. Got %d and %d", outOfStock, units)
+		}
+	})
+
+	t.Run("available quantity isn't negative", func(t *testing.T) {
+		b := newBackend(t)
+		arts := insertArticles(t, b, 2)
+		insertProducts(t, b, "chair")
+		insertProductArticles(t, b, []*product.ArticleRow{{ProductID: 1, ID: arts[0].ID, Amount: 1}})
+		now := time.Now().UTC()
+		expired := now.AddDate(0, 0, -1)
+		err := b.Articles.InsertLots(ctx, b.DB, []*article.Lot{
+			{ArticleID: arts[0].ID, Number: "L1", ReceivedAt: now.AddDate(0, -1, 0), ExpiresAt: &expired, Qty: 5},
+		})
+		if err != nil {
+			t.Fatalf("Unable to insert lots. %v", err)
+		}
+
+		pp := findProducts(t, b, &product.Filters{})
+		if len(pp) != 1 || pp[0].AvailableQty != 0 {
+			t.Fatalf("Expected the chair with no available quantity. Got %v", pp)
+		}
+		if pp := findProducts(t, b, &product.Filters{InStock: true}); len(pp) != 0 {
+			t.Errorf("Expected no products in stock. Got %d", len(pp))
+		}
+	})
+
+	t.Run("filters", func(t *testing.T) {
+		b := newBackend(t)
+		setupProducts(t, b)
+
+		cases := []struct {
+			name     string
+			ff       *product.Filters
+			expected []product.ID
+		}{
+			{name: "none", ff: &product.Filters{}, expected: []product.ID{1, 2, 3, 4}},
+			{name: "barcodes", ff: &product.Filters{BB: &[]product.Barcode{"b3", "missing", "b1"}}, expected: []product.ID{1, 3}},
+			{name: "id", ff: &product.Filters{ID: productID(2)}, expected: []product.ID{2}},
+			{name: "missing id", ff: &product.Filters{ID: productID(100)}, expected: []product.ID{}},
+			{name: "barcodes and id", ff: &product.Filters{BB: &[]product.Barcode{"b1", "b2"}, ID: productID(2)}, expected: []product.ID{2}},
+			{name: "barcodes and other id", ff: &product.Filters{BB: &[]product.Barcode{"b1"}, ID: productID(2)}, expected: []product.ID{}},
+			{name: "in stock", ff: &product.Filters{InStock: true}, expected: []product.ID{1, 2, 4}},
+			{name: "in stock barcodes", ff: &product.Filters{InStock: true, BB: &[]product.Barcode{"b3", "b4"}}, expected: []product.ID{4}},
+			{name: "art ids", ff: &product.Filters{ArtIDs: &[]article.ArtID{"2", "missing"}}, expected: []product.ID{2, 4}},
+			{name: "in stock art ids", ff: &product.Filters{InStock: true, ArtIDs: &[]article.ArtID{"3", "2"}}, expected: []product.ID{2, 4}},
+		}
+		for _, c := range cases {
+			test.Compare(t, "product id", c.expected, productIDs(findProducts(t, b, c.ff)))
+		}
+		// All the articles of the products are returned.
+		if stool := findProducts(t, b, &product.Filters{ArtIDs: &[]article.ArtID{"3"}}); len(stool) != 1 || len(stool[0].Articles) != 2 {
+			t.Errorf("Expected the stool with its 2 articles. Got %+v", stool)
+		}
+	})
+
+	t.Run("sort and paginate", func(t *testing.T) {
+		b := newBackend(t)
+		setupProducts(t, b)
+
+		cases := []struct {
+			name     string
+			ff       *product.Filters
+			expected []product.ID
+		}{
+			{name: "id desc", ff: &product.Filters{Sort: &product.Sort{Field: product.SortByID, Desc: true}}, expected: []product.ID{4, 3, 2, 1}},
+			{name: "name", ff: &product.Filters{Sort: &product.Sort{Field: product.SortByName}}, expected: []product.ID{4, 1, 3, 2}},
+			{name: "name desc", ff: &product.Filters{Sort: &product.Sort{Field: product.SortByName, Desc: true}}, expected: []product.ID{2, 3, 1, 4}},
+			{name: "availability", ff: &product.Filters{Sort: &product.Sort{Field: product.SortByAvailability}}, expected: []product.ID{3, 1, 4, 2}},
+			{name: "availability desc", ff: &product.Filters{Sort: &product.Sort{Field: product.SortByAvailability, Desc: true}}, expected: []product.ID{2, 1, 4, 3}},
+			{name: "limit", ff: &product.Filters{Limit: 2}, expected: []product.ID{1, 2}},
+			{name: "limit and offset", ff: &product.Filters{Limit: 2, Offset: 1}, expected: []product.ID{2, 3}},
+			{name: "offset", ff: &product.Filters{Offset: 3}, expected: []product.ID{4}},
+			{name: "offset past the end", ff: &product.Filters{Offset: 10}, expected: []product.ID{}},
+			{name: "sorted page", ff: &product.Filters{Sort: &product.Sort{Field: product.SortByAvailability}, Limit: 2, Offset: 1}, expected: []product.ID{1, 4}},
+			{name: "in stock page", ff: &product.Filters{InStock: true, Limit: 2, Offset: 1}, expected: []product.ID{2, 4}},
+		}
+		for _, c := range cases {
+			test.Compare(t, "product id", c.expected, productIDs(findProducts(t, b, c.ff)))
+		}
+	})
+
+	t.Run("statuses", func(t *testing.T) {
+		b := newBackend(t)
+		setupProducts(t, b)
+
+		updateStatus := func(ID product.ID, from, to product.Status) {
+			t.Helper()
+			if err := b.Products.UpdateStatus(ctx, b.DB, ID, from, to); err != nil {
+				t.Fatalf("Unable to update the status of product %d. %v", ID, err)
+			}
+		}
+		updateStatus(2, product.StatusActive, product.StatusArchived)
+		updateStatus(3, product.StatusActive, product.StatusDiscontinued)
+		updateStatus(4, product.StatusActive, product.StatusDraft)
+
+		cases := []struct {
+			name     string
+			ff       *product.Filters
+			expected []product.ID
+		}{
+			{name: "archived left out", ff: &product.Filters{}, expected: []product.ID{1, 3, 4}},
+			{name: "archived id left out", ff: &product.Filters{ID: productID(2)}, expected: []product.ID{}},
+			{name: "archived", ff: &product.Filters{Statuses: []product.Status{product.StatusArchived}}, expected: []product.ID{2}},
+			{name: "some", ff: &product.Filters{Statuses: []product.Status{product.StatusActive, product.StatusDraft}}, expected: []product.ID{1, 4}},
+			{name: "all", ff: &product.Filters{Statuses: product.Statuses}, expected: []product.ID{1, 2, 3, 4}},
+			{name: "all in stock", ff: &product.Filters{Statuses: product.Statuses, InStock: true}, expected: []product.ID{1, 2, 4}},
+		}
+		for _, c := range cases {
+			test.Compare(t, "product id", c.expected, productIDs(findProducts(t, b, c.ff)))
+		}
+
+		archived := findProducts(t, b, &product.Filters{ID: productID(2), Statuses: product.Statuses})
+		if archived[0].Status != product.StatusArchived || archived[0].ArchivedAt == nil {
+			t.Errorf("Expected the product to be archived with an archive time. Got %s, %v", archived[0].Status, archived[0].ArchivedAt)
+		}
+
+		updateStatus(2, product.StatusArchived, product.StatusDraft)
+		restored := findProducts(t, b, &product.Filters{ID: productID(2)})
+		if len(restored) != 1 || restored[0].Status != product.StatusDraft || restored[0].ArchivedAt != nil {
+			t.Errorf("Expected the product to be restored as a draft. Got %+v", restored)
+		}
+
+		expectKind(t, b.Products.UpdateStatus(ctx, b.DB, 100, product.StatusDraft, product.StatusActive), errors.NotFound)
+		// The product isn't archived anymore.
+		expectKind(t, b.Products.UpdateStatus(ctx, b.DB, 2, product.StatusArchived, product.StatusActive), errors.Invalid)
+		if pp := findProducts(t, b, &product.Filters{ID: productID(2)}); len(pp) != 1 || pp[0].Status != product.StatusDraft {
+			t.Errorf("Expected the product to stay a draft. Got %+v", pp)
+		}
+	})
+
+	t.Run("service transitions", func(t *testing.T) {
+		b := newBackend(t)
+		setupProducts(t, b)
+		ps := product.NewService(logrus.New(), b.DB, b.Products, b.Articles, b.Outbox)
+
+		if _, err := ps.Transition(ctx, 1, product.StatusDiscontinued); err != nil {
+			t.Fatalf("Unable to discontinue a product. %v", err)
+		}
+		_, err := ps.Remove(ctx, 1, 1)
+		expectKind(t, err, errors.Invalid)
+		// Discontinued products can't go back to draft.
+		_, err = ps.Transition(ctx, 1, product.StatusDraft)
+		expectKind(t, err, errors.Invalid)
+
+		archived, err := ps.Transition(ctx, 1, product.StatusArchived)
+		if err != nil {
+			t.Fatalf("Unable to archive a product. %v", err)
+		}
+		if archived.Status != product.StatusArchived || archived.ArchivedAt == nil {
+			t.Errorf("Expected the product to be archived. Got %s, %v", archived.Status, archived.ArchivedAt)
+		}
+		_, err = ps.Find(ctx, 1)
+		expectKind(t, err, errors.NotFound)
+		_, err = ps.Transition(ctx, 100, product.StatusArchived)
+		expectKind(t, err, errors.NotFound)
+
+		if _, err := ps.Transition(ctx, 1, product.StatusDraft); err != nil {
+			t.Fatalf("Unable to restore the product. %v", err)
+		}
+		// Drafts aren't released yet.
+		_, err = ps.Remove(ctx, 1, 1)
+		expectKind(t, err, errors.Invalid)
+		if _, err := ps.Transition(ctx, 1, product.StatusActive); err != nil {
+			t.Fatalf("Unable to activate the product. %v", err)
+		}
+		if _, err := ps.Remove(ctx, 1, 1); err != nil {
+			t.Errorf("Unable to remove a restored product. %v", err)
+		}
+	})
+
+	t.Run("revisions", func(t *testing.T) {
+		b := newBackend(t)
+		setupProducts(t, b)
+		arts := sortArticles(findArticles(t, b, nil))
+
+		rr, err := b.Products.FindRevisions(ctx, b.DB, 1)
+		if err != nil {
+			t.Fatalf("Unable to find revisions. %v", err)
+		}
+		if len(rr) != 1 || rr[0].Number != 1 || rr[0].EffectiveTo != nil {
+			t.Fatalf("Expected a single open revision 1. Got %+v", rr)
+		}
+		test.Compare(t, "revision article", []*product.Article{{ID: arts[0].ID, ArtID: "1", Name: "art_1", Amount: 4}}, rr[0].Articles)
+
+		// Times are truncated since Postgres keeps microseconds.
+		now := time.Now().UTC().Truncate(time.Microsecond)
+		later := now.Add(time.Hour)
+		insertRevision := func(number int, from time.Time, aa ...*product.Article) {
+			t.Helper()
+			err := b.Products.InsertRevision(ctx, b.DB, 1, &product.Revision{Number: number, EffectiveFrom: from, Articles: aa})
+			if err != nil {
+				t.Fatalf("Unable to insert revision %d. %v", number, err)
+			}
+		}
+		insertRevision(2, now, &product.Article{ID: arts[0].ID, Amount: 2}, &product.Article{ID: arts[1].ID, Amount: 1})
+		insertRevision(3, later, &product.Article{ID: arts[1].ID, Amount: 5})
+
+		// Revision 2 is in effect until revision 3 takes effect.
+		chair := findProducts(t, b, &product.Filters{ID: productID(1)})[0]
+		if chair.Revision != 2 || chair.AvailableQty != 4 || len(chair.Articles) != 2 {
+			t.Errorf("Expected 4 chairs of revision 2 with 2 articles. Got %d of revision %d with %d articles", chair.AvailableQty, chair.Revision, len(chair.Articles))
+		}
+
+		if rr, err = b.Products.FindRevisions(ctx, b.DB, 1); err != nil {
+			t.Fatalf("Unable to find revisions. %v", err)
+		}
+		test.Compare(t, "revision numbers", []int{1, 2, 3}, []int{rr[0].Number, rr[1].Number, rr[2].Number})
+		if rr[0].EffectiveTo == nil || !rr[0].EffectiveTo.Equal(now) {
+			t.Errorf("Expected revision 1 to end at %s. Got %v", now, rr[0].EffectiveTo)
+		}
+		if !rr[1].EffectiveFrom.Equal(now) || rr[1].EffectiveTo == nil || !rr[1].EffectiveTo.Equal(later) {
+			t.Errorf("Expected revision 2 to be in effect from %s to %s. Got %s to %v", now, later, rr[1].EffectiveFrom, rr[1].EffectiveTo)
+		}
+		if !rr[2].EffectiveFrom.Equal(later) || rr[2].EffectiveTo != nil {
+			t.Errorf("Expected revision 3 to be in effect from %s on. Got %s to %v", later, rr[2].EffectiveFrom, rr[2].EffectiveTo)
+		}
+		test.Compare(t, "revision 2 articles", []*product.Article{
+			{ID: arts[0].ID, ArtID: "1", Name: "art_1", Amount: 2},
+			{ID: arts[1].ID, ArtID: "2", Name: "art_2", Amount: 1},
+		}, rr[1].Articles)
+
+		if rr, err = b.Products.FindRevisions(ctx, b.DB, 100); err != nil || len(rr) != 0 {
+			t.Errorf("Expected no revisions for a missing product. Got %v, %v", rr, err)
+		}
+	})
+
+	t.Run("lock", func(t *testing.T) {
+		b := newBackend(t)
+		setupProducts(t, b)
+
+		if err := b.Products.Lock(ctx, b.DB, 1); err != nil {
+			t.Errorf("Unable to lock a product. %v", err)
+		}
+		expectKind(t, b.Products.Lock(ctx, b.DB, 100), errors.NotFound)
+	})
+
+	t.Run("service revisions", func(t *testing.T) {
+		b := newBackend(t)
+		setupProducts(t, b)
+		ps := product.NewService(logrus.New(), b.DB, b.Products, b.Articles, b.Outbox)
+
+		rev, err := ps.Revise(ctx, 1, time.Time{}, []*product.Article{{ArtID: "2", Amount: 2}})
+		if err != nil {
+			t.Fatalf("Unable to revise a product. %v", err)
+		}
+		test.Compare(t, "changes", []*product.BOMChange{
+			{ArtID: "1", Name: "art_1", From: 4, To: 0},
+			{ArtID: "2", Name: "art_2", From: 0, To: 2},
+		}, rev.Changes)
+
+		_, err = ps.Revise(ctx, 1, time.Time{}, []*product.Article{{ArtID: "9", Amount: 1}})
+		expectKind(t, err, errors.Invalid)
+		// In the past.
+		_, err = ps.Revise(ctx, 1, rev.EffectiveFrom.Add(-time.Hour), []*product.Article{{ArtID: "1", Amount: 1}})
+		expectKind(t, err, errors.Invalid)
+		_, err = ps.Revise(ctx, 1, time.Time{}, []*product.Article{{ArtID: "1", Amount: 1}, {ArtID: "1", Amount: 2}})
+		expectKind(t, err, errors.Invalid)
+		_, err = ps.Revise(ctx, 100, time.Time{}, []*product.Article{{ArtID: "1", Amount: 1}})
+		expectKind(t, err, errors.NotFound)
+
+		rr, err := ps.Revisions(ctx, 1)
+		if err != nil {
+			t.Fatalf("Unable to find revisions. %v", err)
+		}
+		if len(rr) != 2 {
+			t.Fatalf("Expected 2 revisions. Got %d", len(rr))
+		}
+		test.Compare(t, "first changes", []*product.BOMChange{{ArtID: "1", Name: "art_1", To: 4}}, rr[0].Changes)
+		test.Compare(t, "second changes", rev.Changes, rr[1].Changes)
+		_, err = ps.Revisions(ctx, 100)
+		expectKind(t, err, errors.NotFound)
+
+		// Stocks are 8, 5 and 0, the chair needs 2 of art 2 now.
+		removed, err := ps.Remove(ctx, 1, 1)
+		if err != nil {
+			t.Fatalf("Unable to remove a product. %v", err)
+		}
+		if removed.Revision != 2 || removed.AvailableQty != 1 {
+			t.Errorf("Expected 1 chair of revision 2 to be left. Got %d of revision %d", removed.AvailableQty, removed.Revision)
+		}
+	})
+
+	t.Run("service revisions in the future", func(t *testing.T) {
+		b := newBackend(t)
+		setupProducts(t, b)
+		ps := product.NewService(logrus.New(), b.DB, b.Products, b.Articles, b.Outbox)
+
+		now := time.Now()
+		if _, err := ps.Revise(ctx, 1, now.Add(2*time.Hour), []*product.Article{{ArtID: "2", Amount: 1}}); err != nil {
+			t.Fatalf("Unable to revise a product. %v", err)
+		}
+		// Revisions take effect after the latest one, even if it isn't in effect yet.
+		_, err := ps.Revise(ctx, 1, now.Add(time.Hour), []*product.Article{{ArtID: "2", Amount: 2}})
+		expectKind(t, err, errors.Invalid)
+		rev, err := ps.Revise(ctx, 1, now.Add(3*time.Hour), []*product.Article{{ArtID: "2", Amount: 3}})
+		if err != nil {
+			t.Fatalf("Unable to revise a product. %v", err)
+		}
+		if rev.Number != 3 {
+			t.Errorf("Expected revision 3, got %d", rev.Number)
+		}
+
+		// The first revision is still in effect.
+		chair := findProducts(t, b, &product.Filters{ID: productID(1)})[0]
+		if chair.Revision != 1 {
+			t.Errorf("Expected revision 1 to be in effect, got %d", chair.Revision)
+		}
+	})
+
+	t.Run("service import merges articles", func(t *testing.T) {
+		b := newBackend(t)
+		ps := product.NewService(logrus.New(), b.DB, b.Products, b.Articles, b.Outbox)
+
+		err := ps.Import(ctx, []*product.Product{
+			{Barcode: "b1", Name: "chair", Articles: []*product.Article{{ArtID: "1", Name: "leg", Amount: 2}, {ArtID: "1", Name: "leg", Amount: 2}}},
+		})
+		if err != nil {
+			t.Fatalf("Unable to import products. %v", err)
+		}
+		test.Compare(t, "product", []*product.StockInfo{
+			{ID: 1, Barcode: "b1", Name: "chair", Status: product.StatusActive, Revision: 1, AvailableQty: 1, Articles: []*product.ArticleStock{
+				{ID: 1, ArtID: "1", Name: "leg", Stock: 4, RequiredAmount: 4},
+			}},
+		}, findProducts(t, b, &product.Filters{}))
+	})
+
+	t.Run("service", func(t *testing.T) {
+		b := newBackend(t)
+		ps := product.NewService(logrus.New(), b.DB, b.Products, b.Articles, b.Outbox)
+
+		err := ps.Import(ctx, []*product.Product{
+			{Barcode: "b1", Name: "chair", Articles: []*product.Article{{ArtID: "1", Name: "leg", Amount: 4}, {ArtID: "2", Name: "seat", Amount: 1}}},
+			{Barcode: "b2", Name: "table", Articles: []*product.Article{{ArtID: "1", Name: "leg", Amount: 4}, {ArtID: "3", Name: "top", Amount: 1}}},
+		})
+		if err != nil {
+			t.Fatalf("Unable to import products. %v", err)
+		}
+		// Importing an existing product only adds to the stock of its articles.
+		importEvent := &audit.Event{}
+		err = ps.Import(audit.WithEvent(ctx, importEvent), []*product.Product{
+			{Barcode: "b1", Name: "chair", Articles: []*product.Article{{ArtID: "1", Name: "leg", Amount: 4}, {ArtID: "2", Name: "seat", Amount: 1}}},
+		})
+		if err != nil {
+			t.Fatalf("Unable to import products. %v", err)
+		}
+		sort.Strings(importEvent.Targets)
+		test.Compare(t, "import targets", []string{"article:1", "article:2", "product:1"}, importEvent.Targets)
+		// Stocks are now leg 12, seat 2, top 1.
+
+		test.Compare(t, "product", []*product.StockInfo{
+			{ID: 1, Barcode: "b1", Name: "chair", Status: product.StatusActive, Revision: 1, AvailableQty: 2, Articles: []*product.ArticleStock{
+				{ID: 1, ArtID: "1", Name: "leg", Stock: 12, RequiredAmount: 4},
+				{ID: 2, ArtID: "2", Name: "seat", Stock: 2, RequiredAmount: 1},
+			}},
+			{ID: 2, Barcode: "b2", Name: "table", Status: product.StatusActive, Revision: 1, AvailableQty: 1, Articles: []*product.ArticleStock{
+				{ID: 1, ArtID: "1", Name: "leg", Stock: 12, RequiredAmount: 4},
+				{ID: 3, ArtID: "3", Name: "top", Stock: 1, RequiredAmount: 1},
+			}},
+		}, findProducts(t, b, &product.Filters{}))
+
+		if _, err := ps.Remove(ctx, 2, 2); err == nil {
+			t.Error("Expected an error when there is not enough stock")
+		}
+		removeEvent := &audit.Event{}
+		removed, err := ps.Remove(audit.WithEvent(ctx, removeEvent), 2, 1)
+		if err != nil {
+			t.Fatalf("Unable to remove a product. %v", err)
+		}
+		if removed.AvailableQty != 0 {
+			t.Errorf("Expected no table to be left. Got %d", removed.AvailableQty)
+		}
+		test.Compare(t, "remove targets", []string{"product:2", "article:1", "article:3"}, removeEvent.Targets)
+		// Stocks are now leg 8, seat 2, top 0.
+
+		test.Compare(t, "product id", []product.ID{1}, productIDs(findProducts(t, b, &product.Filters{InStock: true})))
+		chair, err := ps.Find(ctx, 1)
+		if err != nil {
+			t.Fatalf("Unable to find a product. %v", err)
+		}
+		if chair.AvailableQty != 2 {
+			t.Errorf("Expected 2 chairs to be available. Got %d", chair.AvailableQty)
+		}
+
+		if b.Outbox == nil {
+			return
+		}
+		ee, err := b.Outbox.Claim(ctx, b.DB, 10, time.Now(), time.Now().Add(time.Minute))
+		if err != nil {
+			t.Fatalf("Unable to claim events. %v", err)
+		}
+		types := make([]string, 0, len(ee))
+		for _, e := range ee {
+			types = append(types, e.Type)
+		}
+		// The failed removal stored no events.
+		test.Compare(t, "event types", []string{
+			outbox.TypeStockChanged, outbox.TypeImportCompleted,
+			outbox.TypeStockChanged, outbox.TypeImportCompleted,
+			outbox.TypeStockChanged, outbox.TypeProductRemoved,
+		}, types)
+
+		var changed outbox.StockChanged
+		if err := json.Unmarshal(ee[4].Payload, &changed); err != nil {
+			t.Fatalf("Unable to decode payload. %v", err)
+		}
+		test.Compare(t, "stock changed", outbox.StockChanged{Reason: outbox.ReasonRemoval, Articles: []*outbox.ArticleStock{
+			{ArtID: "1", Stock: 8}, {ArtID: "3", Stock: 0},
+		}}, changed)
+		var removedPayload outbox.ProductRemoved
+		if err := json.Unmarshal(ee[5].Payload, &removedPayload); err != nil {
+			t.Fatalf("Unable to decode payload. %v", err)
+		}
+		test.Compare(t, "product removed", outbox.ProductRemoved{ProductID: 2, Barcode: "b2", Revision: 1, Qty: 1}, removedPayload)
+	})
+
+	t.Run("service lots", func(t *testing.T) {
+		b := newBackend(t)
+		ps := product.NewService(logrus.New(), b.DB, b.Products, b.Articles, nil)
+		as := article.NewService(logrus.New(), b.DB, b.Articles, nil)
+
+		err := ps.Import(ctx, []*product.Product{
+			{Barcode: "b1", Name: "chair", Articles: []*product.Article{{ArtID: "1", Name: "leg", Amount: 4}, {ArtID: "2", Name: "seat", Amount: 1}}},
+		})
+		if err != nil {
+			t.Fatalf("Unable to import products. %v", err)
+		}
+		now := time.Now().UTC().Truncate(time.Microsecond)
+		received, expired, later := now.AddDate(0, -1, 0), now.AddDate(0, 0, -1), now.AddDate(0, 0, 10)
+		_, err = as.Import(ctx, []*article.Article{
+			{ArtID: "1", Name: "leg", Stock: 8, Lots: []*article.Lot{
+				{Number: "old", ReceivedAt: received, ExpiresAt: &expired, Qty: 4},
+				{Number: "new", ReceivedAt: received, ExpiresAt: &later, Qty: 4},
+			}},
+			{ArtID: "2", Name: "seat", Stock: 1},
+		})
+		if err != nil {
+			t.Fatalf("Unable to import articles. %v", err)
+		}
+		// Stocks are now leg 12 of which 4 are expired, seat 2.
+
+		removed, err := ps.Remove(ctx, 1, 1)
+		if err != nil {
+			t.Fatalf("Unable to remove a product. %v", err)
+		}
+		if removed.AvailableQty != 1 {
+			t.Errorf("Expected 1 chair to be left. Got %d", removed.AvailableQty)
+		}
+		if _, err := ps.Remove(ctx, 1, 2); err == nil {
+			t.Error("Expected an error when only expired stock is left")
+		}
+
+		// The legs came out of the lot that expires first, the expired lot is left.
+		lots, err := as.ExpiringLots(ctx, 30)
+		if err != nil {
+			t.Fatalf("Unable to find expiring lots. %v", err)
+		}
+		for _, l := range lots {
+			l.ID = 0
+		}
+		test.Compare(t, "lot", []*article.Lot{
+			{ArticleID: 1, ArtID: "1", Number: "old", ReceivedAt: received, ExpiresAt: &expired, Qty: 4},
+		}, lots, lotCmp)
+	})
+
+	t.Run("rollback", func(t *testing.T) {
+		b := newBackend(t)
+		setupProducts(t, b)
+		arts := sortArticles(findArticles(t, b, nil))
+		all := &product.Filters{Statuses: product.Statuses}
+		products := findProducts(t, b, all)
+		revisions, err := b.Products.FindRevisions(ctx, b.DB, 1)
+		if err != nil {
+			t.Fatalf("Unable to find revisions. %v", err)
+		}
+
+		tx, err := b.DB.BeginTx(ctx, nil)
+		if err != nil {
+			t.Fatalf("Unable to begin a transaction. %v", err)
+		}
+		inserted, err := b.Products.BatchInsert(ctx, tx, []*product.Product{{Barcode: "b5", Name: "shelf"}})
+		if err != nil {
+			t.Fatalf("Unable to insert products. %v", err)
+		}
+		if err := b.Products.InsertProductArticles(ctx, tx, []*product.ArticleRow{{ProductID: inserted[0].ID, ID: arts[1].ID, Amount: 1}}); err != nil {
+			t.Fatalf("Unable to insert product articles. %v", err)
+		}
+		rev := &product.Revision{Number: 2, EffectiveFrom: time.Now().UTC().Add(-time.Minute), Articles: []*product.Article{{ID: arts[1].ID, Amount: 1}}}
+		if err := b.Products.InsertRevision(ctx, tx, 1, rev); err != nil {
+			t.Fatalf("Unable to insert a revision. %v", err)
+		}
+		if err := b.Products.UpdateStatus(ctx, tx, 2, product.StatusActive, product.StatusArchived); err != nil {
+			t.Fatalf("Unable to update the status. %v", err)
+		}
+		if err := b.Products.InsertRemoval(ctx, tx, &product.Removal{ProductID: 4, Revision: 1, Qty: 1}); err != nil {
+			t.Fatalf("Unable to insert a removal. %v", err)
+		}
+		if b.Outbox != nil {
+			if err := b.Outbox.Insert(ctx, tx, []*outbox.Event{{Type: outbox.TypeProductRemoved, Payload: json.RawMessage(`{}`)}}); err != nil {
+				t.Fatalf("Unable to insert events. %v", err)
+			}
+		}
+		if err := tx.Rollback(); err != nil {
+			t.Fatalf("Unable to roll back. %v", err)
+		}
+
+		test.Compare(t, "product", products, findProducts(t, b, all))
+		rr, err := b.Products.FindRevisions(ctx, b.DB, 1)
+		if err != nil {
+			t.Fatalf("Unable to find revisions. %v", err)
+		}
+		test.Compare(t, "revision", revisions, rr)
+		if b.Outbox != nil {
+			ee, err := b.Outbox.FindAfter(ctx, b.DB, 0, 10)
+			if err != nil {
+				t.Fatalf("Unable to find events. %v", err)
+			}
+			if len(ee) != 0 {
+				t.Errorf("Expected the events to be rolled back. Got %d", len(ee))
+			}
+		}
+	})
+}
+
+// setupProducts inserts the products that the filter and sort cases use.
+//
+//	id  barcode  name   available
+//	1   b1       chair  2
+//	2   b2       table  5
+//	3   b3       stool  0
+//	4   b4       bench  2
+func setupProducts(t *testing.T, b *Backend) {
+	t.Helper()
+	arts := insertArticles(t, b, 8, 5, 0)
+	insertProducts(t, b, "chair", "table", "stool", "bench")
+	insertProductArticles(t, b, []*product.ArticleRow{
+		{ProductID: 1, ID: arts[0].ID, Amount: 4},
+		{ProductID: 2, ID: arts[1].ID, Amount: 1},
+		{ProductID: 3, ID: arts[0].ID, Amount: 1},
+		{ProductID: 3, ID: arts[2].ID, Amount: 1},
+		{ProductID: 4, ID: arts[0].ID, Amount: 3},
+		{ProductID: 4, ID: arts[1].ID, Amount: 2},
+	})
+}
+
+// insertArticles inserts articles with the stocks. Art ids are their positions
+// starting from 1.
+func insertArticles(t *testing.T, b *Backend, stocks ...int) []*article.Article {
+	t.Helper()
+	aa := make([]*article.Article, 0, len(stocks))
+	for i, s := range stocks {
+		artID := article.ArtID(strconv.Itoa(i + 1))
+		aa = append(aa, &article.Article{ArtID: artID, Name: "art_" + string(artID), Stock: s})
+	}
+	inserted, err := b.Articles.BatchInsert(context.Background(), b.DB, aa)
+	if err != nil {
+		t.Fatalf("Unable to insert articles. %v", err)
+	}
+	return inserted
+}
+
+// insertProducts inserts products with the names. Barcodes are b and their positions
+// starting from 1.
+func insertProducts(t *testing.T, b *Backend, names ...string) {
+	t.Helper()
+	pp := make([]*product.Product, 0, len(names))
+	for i, n := range names {
+		pp = append(pp, &product.Product{Barcode: product.Barcode("b" + strconv.Itoa(i+1)), Name: n})
+	}
+	if _, err := b.Products.BatchInsert(context.Background(), b.DB, pp); err != nil {
+		t.Fatalf("Unable to insert products. %v", err)
+	}
+}
+
+func insertProductArticles(t *testing.T, b *Backend, rows []*product.ArticleRow) {
+	t.Helper()
+	if err := b.Products.InsertProductArticles(context.Background(), b.DB, rows); err != nil {
+		t.Fatalf("Unable to insert product articles. %v", err)
+	}
+}
+
+func findArticles(t *testing.T, b *Backend, artIDs *[]article.ArtID) []*article.Article {
+	t.Helper()
+	aa, err := b.Articles.FindAll(context.Background(), b.DB, artIDs)
+	if err != nil {
+		t.Fatalf("Unable to find articles. %v", err)
+	}
+	return aa
+}
+
+func findProducts(t *testing.T, b *Backend, ff *product.Filters) []*product.StockInfo {
+	t.Helper()
+	pp, err := b.Products.FindAll(context.Background(), b.DB, ff)
+	if err != nil {
+		t.Fatalf("Unable to find products. %v", err)
+	}
+	return pp
+}
+
+func productIDs(pp []*product.StockInfo) []product.ID {
+	ids := make([]product.ID, 0, len(pp))
+	for _, p := range pp {
+		ids = append(ids, p.ID)
+	}
+	return ids
+}
+
+func productID(ID product.ID) *product.ID { return &ID }
+
+// sortArticles sorts by art id, the order of imported articles isn't defined.
+func sortArticles(aa []*article.Article) []*article.Article {
+	sort.Slice(aa, func(i, j int) bool { return aa[i].ArtID < aa[j].ArtID })
+	return aa
+}
+
+func expectKind(t *testing.T, err error, kind errors.Kind) {
+	t.Helper()
+	var e *errors.Error
+	if !errors.As(err, &e) || e.Kind != kind {
+		t.Errorf("Expected an error of kind %s. Got %v", kind, err)
+	}
+}
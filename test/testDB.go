@@ -3,6 +3,8 @@ package test
 import (
 	"context"
 	"database/sql"
+	"net/url"
+	"regexp"
 	"strings"
 	"testing"
 
@@ -12,12 +14,14 @@ import (
 	"github.com/mtekmir/warehouse-service/internal/config"
 )
 
+var nonIdent = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
 // SetupTX Sets up a database transaction to be used in tests. DbTidy will
 // Rollback the tx after test func returns.
 func SetupTX(t *testing.T) (tx *sql.Tx, dbTidy func()) {
 	t.Helper()
 
-	conf, err := config.Parse()
+	conf, err := config.Parse(nil)
 	if err != nil {
 		t.Fatalf("Unable to parse config. %v", err)
 		return nil, func() {}
@@ -54,10 +58,10 @@ func SetupTX(t *testing.T) (tx *sql.Tx, dbTidy func()) {
 }
 
 // SetupDB sets up test db. To be used in tests that setup a TX.
-func SetupDB(t *testing.T) (*sql.DB, func()) {
+func SetupDB(t testing.TB) (*sql.DB, func()) {
 	t.Helper()
 
-	conf, err := config.Parse()
+	conf, err := config.Parse(nil)
 	if err != nil {
 		t.Fatalf("Unable to parse config. %v", err)
 		return nil, func() {}
@@ -68,26 +72,36 @@ func SetupDB(t *testing.T) (*sql.DB, func()) {
 		t.Fatalf("Failed to initialize db. Err: %s", err.Error())
 	}
 
-	schemaName := strings.ToLower(t.Name())
-
-	dbTidy := func() {
-		_, err := db.Exec("DROP SCHEMA " + schemaName + " CASCADE")
-		if err != nil {
-			t.Fatalf("Error during db cleanup. Err: %s", err.Error())
-		}
-		db.Close()
-	}
+	// Names of subtests have slashes and spaces.
+	schemaName := strings.ToLower(nonIdent.ReplaceAllString(t.Name(), "_"))
 
 	// create test schema
 	_, err = db.Exec("CREATE SCHEMA " + schemaName)
 	if err != nil {
 		t.Fatalf("Error while creating the schema. Err: %s", err.Error())
 	}
+	db.Close()
 
-	// use schema
-	_, err = db.Exec("SET search_path TO " + schemaName)
+	// use schema on every connection of the pool
+	u, err := url.Parse(conf.DBURL)
 	if err != nil {
-		t.Fatalf("Error while switching to schema. Err: %s", err.Error())
+		t.Fatalf("Unable to parse db url. %v", err)
+	}
+	q := u.Query()
+	q.Set("search_path", schemaName)
+	u.RawQuery = q.Encode()
+
+	db, err = sql.Open("pgx", u.String())
+	if err != nil {
+		t.Fatalf("Failed to initialize db. Err: %s", err.Error())
+	}
+
+	dbTidy := func() {
+		_, err := db.Exec("DROP SCHEMA " + schemaName + " CASCADE")
+		if err != nil {
+			t.Fatalf("Error during db cleanup. Err: %s", err.Error())
+		}
+		db.Close()
 	}
 
 	return db, dbTidy
@@ -110,7 +124,7 @@ func CreateArticleTable(t *testing.T, db article.Executor) {
 }
 
 // CreateProductTables creates product tables for test.
-func CreateProductTables(t *testing.T, db *sql.DB) {
+func CreateProductTables(t testing.TB, db *sql.DB) {
 	t.Helper()
 	stmts := []string{
 		`create table if not exists articles(
@@ -122,13 +136,35 @@ func CreateProductTables(t *testing.T, db *sql.DB) {
 		`create table if not exists products(
 			id bigserial unique primary key,
 			barcode varchar unique not null,
-			name varchar unique not null
+			name varchar unique not null,
+			status varchar not null default 'active',
+			archived_at timestamptz
 		)`,
 		`create table if not exists product_articles(
 			id bigserial unique primary key,
 			amount int not null,
 			product_id bigint not null references products(id),
-			article_id bigint not null references articles(id)
+			article_id bigint not null references articles(id),
+			revision int not null default 1,
+			effective_from timestamptz not null default current_timestamp,
+			effective_to timestamptz,
+			unique (product_id, revision, article_id)
+		)`,
+		`create table if not exists removals(
+			id bigserial unique primary key,
+			product_id bigint not null references products(id),
+			revision int not null,
+			qty int not null,
+			removed_at timestamptz not null default current_timestamp
+		)`,
+		`create table if not exists lots(
+			id bigserial unique primary key,
+			article_id bigint not null references articles(id),
+			number varchar not null,
+			received_at timestamptz not null,
+			expires_at timestamptz,
+			qty int not null,
+			unique (article_id, number)
 		)`,
 	}
 